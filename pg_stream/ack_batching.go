@@ -0,0 +1,126 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var ackBatchingConfigFields = []*service.ConfigField{
+	service.NewDurationField("interval").
+		Description("The longest an acknowledged position waits before it is confirmed to the slot").
+		Default("1s"),
+	service.NewIntField("max_acks").
+		Description("The number of acknowledgements after which the position is confirmed without waiting for the interval. Set to `0` to only confirm on the interval").
+		Default(1000),
+}
+
+type ackBatchingConfig struct {
+	interval time.Duration
+	maxAcks  int
+}
+
+func newAckBatchingConfigFromParsed(conf *service.ParsedConfig) (c ackBatchingConfig, err error) {
+	if c.interval, err = conf.FieldDuration("interval"); err != nil {
+		return c, err
+	}
+	if c.maxAcks, err = conf.FieldInt("max_acks"); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// ackBatcher coalesces the positions acknowledged to a source and confirms
+// the latest one from a background goroutine, rather than sending a standby
+// status update to the server on every acknowledgement. Positions confirmed
+// late are only redelivered after a crash.
+type ackBatcher struct {
+	pglogicalstream.ReplicationSource
+	conf ackBatchingConfig
+
+	mut     sync.Mutex
+	pending string
+	acks    int
+
+	flushC   chan struct{}
+	stopC    chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newAckBatcher(source pglogicalstream.ReplicationSource, conf ackBatchingConfig) *ackBatcher {
+	b := &ackBatcher{
+		ReplicationSource: source,
+		conf:              conf,
+		flushC:            make(chan struct{}, 1),
+		stopC:             make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// AckLSN records the position, which is confirmed by the next flush.
+func (b *ackBatcher) AckLSN(lsn string) {
+	b.mut.Lock()
+	b.pending = lsn
+	b.acks++
+	full := b.conf.maxAcks > 0 && b.acks >= b.conf.maxAcks
+	b.mut.Unlock()
+
+	if full {
+		select {
+		case b.flushC <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *ackBatcher) loop() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.conf.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.flushC:
+		case <-b.stopC:
+			b.flush()
+			return
+		}
+		b.flush()
+	}
+}
+
+func (b *ackBatcher) flush() {
+	b.mut.Lock()
+	lsn := b.pending
+	b.pending = ""
+	b.acks = 0
+	b.mut.Unlock()
+
+	if lsn != "" {
+		b.ReplicationSource.AckLSN(lsn)
+	}
+}
+
+// Stop confirms the pending position before stopping the source.
+func (b *ackBatcher) Stop() error {
+	b.stopOnce.Do(func() {
+		close(b.stopC)
+		<-b.done
+	})
+	return b.ReplicationSource.Stop()
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// ackRecorder records the positions acknowledged to the sources of a fake
+// script.
+type ackRecorder struct {
+	mut   sync.Mutex
+	acked []string
+}
+
+func (r *ackRecorder) record(lsn string) {
+	r.mut.Lock()
+	r.acked = append(r.acked, lsn)
+	r.mut.Unlock()
+}
+
+func (r *ackRecorder) confirmed() []string {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return append([]string(nil), r.acked...)
+}
+
+// newFakeSource creates a source streaming the script for the orders table,
+// along with a recorder of the positions acknowledged to it.
+func newFakeSource(t *testing.T, script *pglogicalstream.FakeScript) (pglogicalstream.ReplicationSource, *ackRecorder) {
+	t.Helper()
+	acks := &ackRecorder{}
+	script.OnAck = acks.record
+	source, err := script.Source(pglogicalstream.Config{DbSchema: "public", DbTables: []string{"orders"}, SeparateChanges: true})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = source.Stop() })
+	return source, acks
+}
+
+func fakeInsert(id int) string {
+	return fmt.Sprintf(`{"kind":"insert","schema":"public","table":"orders","columnnames":["id"],"columntypes":["integer"],"columnvalues":[%d]}`, id)
+}
+
+func fakeTransaction(ids ...int) string {
+	changes := make([]string, len(ids))
+	for i, id := range ids {
+		changes[i] = fakeInsert(id)
+	}
+	return `{"change":[` + strings.Join(changes, ",") + `]}`
+}
+
+func TestAckBatcherFlushesOnMaxAcks(t *testing.T) {
+	source, acks := newFakeSource(t, &pglogicalstream.FakeScript{})
+	b := newAckBatcher(source, ackBatchingConfig{interval: time.Hour, maxAcks: 3})
+
+	b.AckLSN("0/10")
+	b.AckLSN("0/20")
+	assert.Never(t, func() bool { return len(acks.confirmed()) > 0 }, 50*time.Millisecond, 5*time.Millisecond)
+
+	b.AckLSN("0/30")
+	assert.Eventually(t, func() bool { return len(acks.confirmed()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"0/30"}, acks.confirmed())
+
+	// The pending position is confirmed when stopping.
+	b.AckLSN("0/40")
+	assert.NoError(t, b.Stop())
+	assert.NoError(t, b.Stop())
+	assert.Equal(t, []string{"0/30", "0/40"}, acks.confirmed())
+}
+
+func TestAckBatcherFlushesOnInterval(t *testing.T) {
+	source, acks := newFakeSource(t, &pglogicalstream.FakeScript{})
+	b := newAckBatcher(source, ackBatchingConfig{interval: 10 * time.Millisecond})
+	defer b.Stop()
+
+	b.AckLSN("0/10")
+	b.AckLSN("0/20")
+	assert.Eventually(t, func() bool { return len(acks.confirmed()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"0/20"}, acks.confirmed())
+}
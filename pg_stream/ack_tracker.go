@@ -0,0 +1,109 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"sync"
+	"time"
+)
+
+type trackedLSN struct {
+	lsn            string
+	transactionEnd bool
+	acked          bool
+	received       time.Time
+	// event is the recorded event of the change, written once released.
+	event *recordedEvent
+}
+
+// lsnAckTracker keeps track of change events in the order they were received
+// from the replication slot. Events can be acknowledged in any order but an
+// LSN is only released for confirmation once every event received before it
+// has been acknowledged as well, so the slot never moves past undelivered
+// data.
+type lsnAckTracker struct {
+	// commitBoundaries only releases the LSNs of events ending their
+	// transaction, as the events of a transaction share its LSN.
+	commitBoundaries bool
+	// record is called with the recorded events attached to released
+	// changes, in the order the changes were received.
+	record func(event recordedEvent)
+
+	mut     sync.Mutex
+	offset  uint64
+	pending []trackedLSN
+}
+
+// track registers an event and returns the sequence number used to
+// acknowledge it.
+func (t *lsnAckTracker) track(lsn string, transactionEnd bool) uint64 {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	t.pending = append(t.pending, trackedLSN{lsn: lsn, transactionEnd: transactionEnd, received: time.Now()})
+	return t.offset + uint64(len(t.pending)) - 1
+}
+
+// ack marks the event as delivered and returns the highest LSN that can be
+// confirmed, if any.
+func (t *lsnAckTracker) ack(seq uint64) (string, bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if seq < t.offset || seq >= t.offset+uint64(len(t.pending)) {
+		return "", false
+	}
+	t.pending[seq-t.offset].acked = true
+
+	var (
+		lsn      string
+		released int
+	)
+	for released < len(t.pending) && t.pending[released].acked {
+		if !t.commitBoundaries || t.pending[released].transactionEnd {
+			lsn = t.pending[released].lsn
+		}
+		if event := t.pending[released].event; event != nil && t.record != nil {
+			t.record(*event)
+		}
+		released++
+	}
+	if released == 0 {
+		return "", false
+	}
+
+	t.pending = t.pending[released:]
+	t.offset += uint64(released)
+	return lsn, true
+}
+
+// attach attaches the recorded event of a change, which is passed on to
+// record once the change is released.
+func (t *lsnAckTracker) attach(seq uint64, event recordedEvent) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if seq < t.offset || seq >= t.offset+uint64(len(t.pending)) {
+		return
+	}
+	t.pending[seq-t.offset].event = &event
+}
+
+// oldest returns the number of events that are tracked and when the oldest
+// event awaiting acknowledgement was received. Released events are dropped
+// from the front, so the first tracked event is always unacknowledged.
+func (t *lsnAckTracker) oldest() (int, time.Time, bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	if len(t.pending) == 0 {
+		return 0, time.Time{}, false
+	}
+	return len(t.pending), t.pending[0].received, true
+}
@@ -0,0 +1,44 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAckTrackerCommitBoundaries(t *testing.T) {
+	// Both transactions are split into separate events sharing their LSN.
+	track := func(acks *lsnAckTracker) []uint64 {
+		return []uint64{
+			acks.track("0/10", false),
+			acks.track("0/10", true),
+			acks.track("0/20", false),
+			acks.track("0/20", true),
+		}
+	}
+
+	acks := &lsnAckTracker{}
+	seqs := track(acks)
+	lsn, _ := acks.ack(seqs[0])
+	assert.Equal(t, "0/10", lsn, "the transaction is confirmed while half of it is unacknowledged")
+
+	acks = &lsnAckTracker{commitBoundaries: true}
+	seqs = track(acks)
+	lsn, _ = acks.ack(seqs[0])
+	assert.Empty(t, lsn)
+	lsn, _ = acks.ack(seqs[1])
+	assert.Equal(t, "0/10", lsn)
+
+	lsn, _ = acks.ack(seqs[2])
+	assert.Empty(t, lsn)
+	lsn, _ = acks.ack(seqs[3])
+	assert.Equal(t, "0/20", lsn)
+}
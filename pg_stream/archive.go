@@ -0,0 +1,181 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var archiveConfigFields = []*service.ConfigField{
+	service.NewStringField("path_prefix").
+		Description("The prefix of the archive paths").
+		Default("pg_stream"),
+}
+
+// archiveOutputTemplate writes the events of the archive mode to the path
+// they carry.
+const archiveOutputTemplate = `
+name: pg_stream_archive
+type: output
+status: experimental
+categories: [ Services ]
+summary: Writes the events of a pg_stream input in archive mode to object storage.
+description: |
+  Every event is written to an object of its own, at the path set by the input in the ` + "`archive_path`" + ` metadata field. Replay the archive with the ` + "`pg_stream_archive_replay`" + ` input.
+fields:
+  - name: provider
+    description: The output writing the objects, one of ` + "`aws_s3`, `gcp_cloud_storage`, `azure_blob_storage` or `file`" + `.
+    type: string
+    default: aws_s3
+  - name: bucket
+    description: The bucket, the container for ` + "`azure_blob_storage`" + `, or the directory for ` + "`file`" + `.
+    type: string
+  - name: config
+    description: Other fields of the output, such as credentials and regions.
+    type: unknown
+    kind: map
+    default: {}
+mapping: |
+  let bucket = this.bucket
+  let target = match this.provider {
+    "aws_s3" => { "bucket": $bucket, "path": "${! @archive_path }" }
+    "gcp_cloud_storage" => { "bucket": $bucket, "path": "${! @archive_path }" }
+    "azure_blob_storage" => { "container": $bucket, "path": "${! @archive_path }" }
+    "file" => { "path": $bucket + "/${! @archive_path }", "codec": "all-bytes" }
+    _ => throw("unsupported archive provider %s".format(this))
+  }
+  root = {}
+  root = root.merge({ (this.provider): this.config.assign($target) })
+`
+
+func init() {
+	if err := service.RegisterTemplateYAML(archiveOutputTemplate); err != nil {
+		panic(err)
+	}
+}
+
+// archiveRecord is an event written by the archive mode. The payload is
+// replayed with the metadata of the original event.
+type archiveRecord struct {
+	Lsn       *string           `json:"lsn"`
+	Timestamp time.Time         `json:"timestamp"`
+	Metadata  map[string]string `json:"metadata"`
+	Payload   json.RawMessage   `json:"payload"`
+}
+
+// changeArchiver wraps events into archive records, and sets their archive
+// path partitioned by date and table. Paths sort in LSN order within a
+// partition, and redelivered events are written to the same path again.
+type changeArchiver struct {
+	prefix string
+
+	lastLsn  string
+	seq      int
+	snapshot time.Time
+}
+
+func newChangeArchiverFromParsed(conf *service.ParsedConfig) (a *changeArchiver, err error) {
+	a = &changeArchiver{}
+	if a.prefix, err = conf.FieldString("path_prefix"); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reset starts numbering the snapshot rows afresh.
+func (a *changeArchiver) reset() {
+	a.lastLsn = ""
+	a.seq = -1
+	a.snapshot = time.Now()
+}
+
+// archivePath returns the path of the event. Events split from the same
+// transaction share its LSN and are numbered, and snapshot rows have the
+// zero LSN and are numbered in the order they are read.
+func (a *changeArchiver) archivePath(changes pglogicalstream.Wal2JsonChanges) (string, error) {
+	var lsn pglogrepl.LSN
+	date := a.snapshot
+	if changes.Lsn != nil {
+		var err error
+		if lsn, err = pglogrepl.ParseLSN(*changes.Lsn); err != nil {
+			return "", err
+		}
+		if !changes.Timestamp.IsZero() {
+			date = changes.Timestamp
+		}
+	}
+
+	key := ""
+	if changes.Lsn != nil {
+		key = *changes.Lsn
+	}
+	if key == a.lastLsn {
+		a.seq++
+	} else {
+		a.lastLsn, a.seq = key, 0
+	}
+	return path.Join(
+		a.prefix,
+		date.UTC().Format(time.DateOnly),
+		archiveTable(changes.Changes),
+		fmt.Sprintf("%016X-%06d.json", uint64(lsn), a.seq),
+	), nil
+}
+
+// archiveTable returns the table of the changes, events spanning several
+// tables are archived apart.
+func archiveTable(changes []pglogicalstream.Wal2JsonChange) string {
+	if len(changes) == 0 {
+		return "_transactions"
+	}
+	for _, change := range changes[1:] {
+		if change.Table != changes[0].Table {
+			return "_transactions"
+		}
+	}
+	return changes[0].Table
+}
+
+// wrap replaces the event by its archive record.
+func (a *changeArchiver) wrap(msg *service.Message, changes pglogicalstream.Wal2JsonChanges) error {
+	archivePath, err := a.archivePath(changes)
+	if err != nil {
+		return err
+	}
+	payload, err := msg.AsBytes()
+	if err != nil {
+		return err
+	}
+
+	record := archiveRecord{
+		Lsn:       changes.Lsn,
+		Timestamp: changes.Timestamp,
+		Metadata:  map[string]string{},
+		Payload:   payload,
+	}
+	_ = msg.MetaWalk(func(key, value string) error {
+		record.Metadata[key] = value
+		return nil
+	})
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	msg.SetBytes(b)
+	msg.MetaSetMut("archive_path", archivePath)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestArchiveReplayInLSNOrder(t *testing.T) {
+	dir := t.TempDir()
+	a := &changeArchiver{prefix: "pg_stream"}
+	a.reset()
+
+	archive := func(lsn string, table string, commit time.Time) {
+		changes := pglogicalstream.Wal2JsonChanges{
+			Timestamp: commit,
+			Changes:   []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: table}},
+		}
+		if lsn != "" {
+			changes.Lsn = &lsn
+		}
+		msg := service.NewMessage([]byte(`{"table":"` + table + `","lsn":"` + lsn + `"}`))
+		msg.MetaSetMut("table", table)
+		require.NoError(t, a.wrap(msg, changes))
+
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		archivePath, _ := msg.MetaGet("archive_path")
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, archivePath)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, archivePath), b, 0o644))
+	}
+
+	day := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	archive("", "orders", time.Time{})
+	archive("", "customers", time.Time{})
+	archive("0/200", "orders", day)
+	archive("0/200", "customers", day)
+	archive("0/1000", "customers", day.Add(2*time.Minute))
+	archive("0/300", "orders", day.Add(time.Minute))
+
+	replay := func(startLsn, endLsn pglogrepl.LSN) (payloads []string) {
+		in := &pgStreamArchiveReplayInput{
+			archive:  os.DirFS(filepath.Join(dir, "pg_stream")),
+			startLsn: startLsn,
+			endLsn:   endLsn,
+		}
+		require.NoError(t, in.Connect(context.Background()))
+		for {
+			msg, _, err := in.Read(context.Background())
+			if errors.Is(err, service.ErrEndOfInput) {
+				return payloads
+			}
+			require.NoError(t, err)
+
+			b, err := msg.AsBytes()
+			require.NoError(t, err)
+			table, _ := msg.MetaGet("table")
+			assert.Contains(t, string(b), table)
+			payloads = append(payloads, string(b))
+		}
+	}
+
+	assert.Equal(t, []string{
+		`{"table":"orders","lsn":""}`,
+		`{"table":"customers","lsn":""}`,
+		`{"table":"orders","lsn":"0/200"}`,
+		`{"table":"customers","lsn":"0/200"}`,
+		`{"table":"orders","lsn":"0/300"}`,
+		`{"table":"customers","lsn":"0/1000"}`,
+	}, replay(0, 0))
+	assert.Equal(t, []string{
+		`{"table":"orders","lsn":"0/200"}`,
+		`{"table":"customers","lsn":"0/200"}`,
+		`{"table":"orders","lsn":"0/300"}`,
+	}, replay(0x200, 0x300))
+}
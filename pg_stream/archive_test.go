@@ -0,0 +1,110 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/redpanda-data/benthos/v4/public/components/io"
+	_ "github.com/redpanda-data/benthos/v4/public/components/pure"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestChangeArchiverPaths(t *testing.T) {
+	a := &changeArchiver{prefix: "archive"}
+	a.reset()
+	a.snapshot = time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC)
+
+	lsn := "0/16B3748"
+	commit := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	orders := []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "orders"}}
+	mixed := []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "orders"}, {Kind: "insert", Table: "customers"}}
+
+	var paths []string
+	for _, changes := range []pglogicalstream.Wal2JsonChanges{
+		{Changes: orders},
+		{Changes: orders},
+		{Lsn: &lsn, Timestamp: commit, Changes: orders},
+		{Lsn: &lsn, Timestamp: commit, Changes: orders},
+		{Lsn: &lsn, Timestamp: commit, Changes: mixed},
+	} {
+		p, err := a.archivePath(changes)
+		require.NoError(t, err)
+		paths = append(paths, p)
+	}
+	assert.Equal(t, []string{
+		"archive/2024-02-29/orders/0000000000000000-000000.json",
+		"archive/2024-02-29/orders/0000000000000000-000001.json",
+		"archive/2024-03-01/orders/00000000016B3748-000000.json",
+		"archive/2024-03-01/orders/00000000016B3748-000001.json",
+		"archive/2024-03-01/_transactions/00000000016B3748-000002.json",
+	}, paths)
+}
+
+func TestChangeArchiverWrap(t *testing.T) {
+	a := &changeArchiver{prefix: "archive"}
+	a.reset()
+
+	lsn := "0/16B3748"
+	msg := service.NewMessage([]byte(`{"change":[]}`))
+	msg.MetaSetMut("phase", "stream")
+	require.NoError(t, a.wrap(msg, pglogicalstream.Wal2JsonChanges{
+		Lsn:     &lsn,
+		Changes: []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "orders"}},
+	}))
+
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	var record archiveRecord
+	require.NoError(t, json.Unmarshal(b, &record))
+	assert.Equal(t, lsn, *record.Lsn)
+	assert.Equal(t, map[string]string{"phase": "stream"}, record.Metadata)
+	assert.JSONEq(t, `{"change":[]}`, string(record.Payload))
+
+	archivePath, _ := msg.MetaGet("archive_path")
+	assert.Contains(t, archivePath, "/orders/00000000016B3748-000000.json")
+}
+
+func TestArchiveOutputTemplate(t *testing.T) {
+	dir := t.TempDir()
+
+	builder := service.NewStreamBuilder()
+	require.NoError(t, builder.SetYAML(`
+input:
+  generate:
+    count: 1
+    interval: ""
+    mapping: |
+      root = {"lsn": "0/16B3748"}
+      meta archive_path = "pg_stream/2024-03-01/orders/00000000016B3748-000000.json"
+output:
+  pg_stream_archive:
+    provider: file
+    bucket: `+dir+`
+`))
+	stream, err := builder.Build()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, stream.Run(ctx))
+
+	b, err := os.ReadFile(filepath.Join(dir, "pg_stream/2024-03-01/orders/00000000016B3748-000000.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"lsn":"0/16B3748"}`, string(b))
+}
@@ -0,0 +1,697 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var avroConfigFields = []*service.ConfigField{
+	service.NewURLField("schema_registry_url").
+		Description("The base URL of the schema registry").
+		Example("http://localhost:8081"),
+	service.NewStringField("username").
+		Description("The username of the basic authentication of the schema registry").
+		Default(""),
+	service.NewStringField("password").
+		Description("The password of the basic authentication of the schema registry").
+		Secret().
+		Default(""),
+	service.NewStringEnumField("compatibility", "BACKWARD", "BACKWARD_TRANSITIVE", "FORWARD", "FORWARD_TRANSITIVE", "FULL", "FULL_TRANSITIVE", "NONE").
+		Description("The compatibility level set on the subjects before their first schema is registered. The level of the registry applies when unset").
+		Optional(),
+	service.NewBoolField("check_compatibility").
+		Description("Before streaming, generate the schemas of the tables from the catalog and test them against the compatibility level of their existing subjects, so that the input fails to connect with the reasons and a diff of the fields instead of failing on the events of incompatible tables. Columns added by `derived_columns` and `lookups` aren't part of the checked schemas").
+		Default(true),
+	service.NewBoolField("key_schemas").
+		Description("Also register a key schema per table under the `<topic>-key` subject, a record of the primary key columns, as sink connectors of compacted topics require. The Avro encoded key is set as the `pg_key_avro` metadata field, along with the `key_schema_subject` and `key_schema_id` fields, and can be used as the Kafka message key. Events of tables without a primary key have no key").
+		Default(false),
+	service.NewStringAnnotatedEnumField("nullable", map[string]string{
+		string(avroNullableOptional): "Column fields are unions of null and the column type with a null default, so they can be omitted by readers and writers.",
+		string(avroNullableUnion):    "Column fields are unions of null and the column type without a default, as code generators expecting required nullable fields require.",
+		string(avroNullableSentinel): "Column fields have the column type with the zero value of the type as their default, `\"\"`, `0` or `false`, and null values are encoded as it.",
+	}).
+		Description("How the nullable columns of the `before` and `after` rows are represented. Changing it on existing subjects registers schemas incompatible with their previous versions").
+		Default(string(avroNullableOptional)),
+	service.NewStringField("namespace").
+		Description("The namespace of the Avro records, which the schema and table names are appended to").
+		Default("pg_stream"),
+	service.NewDurationField("timeout").
+		Description("The timeout of the schema registry requests").
+		Default("10s"),
+}
+
+// avroNullable is the representation of nullable columns in row records.
+type avroNullable string
+
+const (
+	avroNullableOptional avroNullable = "optional"
+	avroNullableUnion    avroNullable = "union"
+	avroNullableSentinel avroNullable = "sentinel"
+)
+
+// avroColumn is a column of the row record of a table.
+type avroColumn struct {
+	name     string
+	field    string
+	avroType string
+}
+
+// avroEncoder serialises events to Avro in the wire format of the Confluent
+// schema registry, deriving the schemas from the column types of the tables.
+type avroEncoder struct {
+	registry           *schemaRegistryClient
+	compatibility      string
+	checkCompatibility bool
+	keySchemas         bool
+	nullable           avroNullable
+	namespace          string
+	topics             *topicNamer
+	// primaryKeys are the primary key columns of the tables, which key
+	// schemas are derived from.
+	primaryKeys map[string][]string
+
+	// columns are the columns of each table seen so far. Columns are never
+	// removed from the schema, so it only evolves in backward compatible
+	// ways as long as the column types don't change.
+	columns map[string][]avroColumn
+	codecs  map[string]*goavro.Codec
+}
+
+// avroEvent is an event serialised to Avro.
+type avroEvent struct {
+	payload  []byte
+	subject  string
+	schemaID int
+
+	// key is the primary key of the event, nil when it has none.
+	key         []byte
+	keySubject  string
+	keySchemaID int
+}
+
+func newAvroEncoderFromParsed(conf *service.ParsedConfig, topics *topicNamer) (e *avroEncoder, err error) {
+	e = &avroEncoder{
+		topics:  topics,
+		columns: map[string][]avroColumn{},
+		codecs:  map[string]*goavro.Codec{},
+	}
+	u, err := conf.FieldURL("schema_registry_url")
+	if err != nil {
+		return nil, err
+	}
+	username, err := conf.FieldString("username")
+	if err != nil {
+		return nil, err
+	}
+	password, err := conf.FieldString("password")
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := conf.FieldDuration("timeout")
+	if err != nil {
+		return nil, err
+	}
+	if conf.Contains("compatibility") {
+		if e.compatibility, err = conf.FieldString("compatibility"); err != nil {
+			return nil, err
+		}
+	}
+	if e.checkCompatibility, err = conf.FieldBool("check_compatibility"); err != nil {
+		return nil, err
+	}
+	if e.keySchemas, err = conf.FieldBool("key_schemas"); err != nil {
+		return nil, err
+	}
+	var nullable string
+	if nullable, err = conf.FieldString("nullable"); err != nil {
+		return nil, err
+	}
+	e.nullable = avroNullable(nullable)
+	if e.namespace, err = conf.FieldString("namespace"); err != nil {
+		return nil, err
+	}
+	e.registry = newSchemaRegistryClient(u, username, password, timeout)
+	return e, nil
+}
+
+// avroPrimitiveType returns the Avro type the values of a Postgres type are
+// encoded as. Types without an Avro counterpart are encoded as strings.
+func avroPrimitiveType(pgType string) string {
+	t := strings.ToLower(pgType)
+	if strings.HasSuffix(t, "[]") {
+		return "string"
+	}
+	if i := strings.IndexByte(t, '('); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch t {
+	case "boolean", "bool":
+		return "boolean"
+	case "smallint", "integer", "int", "int2", "int4", "smallserial", "serial":
+		return "int"
+	case "bigint", "int8", "bigserial", "oid":
+		return "long"
+	case "real", "float4":
+		return "float"
+	case "double precision", "float8":
+		return "double"
+	}
+	return "string"
+}
+
+// avroName returns s with the characters Avro names can't hold replaced.
+func avroName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+// observe adds the columns of the table that weren't seen yet, and updates the
+// type of the columns whose type changed.
+func (e *avroEncoder) observe(table string, names, types []string) {
+	columns := e.columns[table]
+	for i, name := range names {
+		avroType := "string"
+		if i < len(types) {
+			avroType = avroPrimitiveType(types[i])
+		}
+		j := 0
+		for j < len(columns) && columns[j].name != name {
+			j++
+		}
+		if j < len(columns) {
+			columns[j].avroType = avroType
+			continue
+		}
+
+		field := avroName(name)
+		for n := 2; avroFieldTaken(columns, field); n++ {
+			field = avroName(name) + "_" + strconv.Itoa(n)
+		}
+		columns = append(columns, avroColumn{name: name, field: field, avroType: avroType})
+	}
+	e.columns[table] = columns
+}
+
+func avroFieldTaken(columns []avroColumn, field string) bool {
+	for _, c := range columns {
+		if c.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// schema returns the schema of the events of a table. Every column is
+// nullable, so rows missing columns, like the old keys of deletes, are
+// encoded with nulls, or their sentinels.
+func (e *avroEncoder) schema(namespace string, columns []avroColumn) (string, error) {
+	fields := make([]map[string]any, len(columns))
+	for i, c := range columns {
+		switch e.nullable {
+		case avroNullableUnion:
+			fields[i] = map[string]any{"name": c.field, "type": []any{"null", c.avroType}}
+		case avroNullableSentinel:
+			fields[i] = map[string]any{"name": c.field, "type": c.avroType, "default": avroSentinel(c.avroType)}
+		default:
+			fields[i] = map[string]any{"name": c.field, "type": []any{"null", c.avroType}, "default": nil}
+		}
+	}
+	row := map[string]any{"type": "record", "name": "row", "fields": fields}
+	b, err := json.Marshal(map[string]any{
+		"type":      "record",
+		"name":      "event",
+		"namespace": namespace,
+		"fields": []map[string]any{
+			{"name": "kind", "type": "string"},
+			{"name": "schema", "type": "string"},
+			{"name": "table", "type": "string"},
+			{"name": "lsn", "type": []any{"null", "string"}, "default": nil},
+			{"name": "timestamp", "type": []any{"null", map[string]any{"type": "long", "logicalType": "timestamp-micros"}}, "default": nil},
+			{"name": "xid", "type": []any{"null", "long"}, "default": nil},
+			{"name": "before", "type": []any{"null", row}, "default": nil},
+			{"name": "after", "type": []any{"null", namespace + ".row"}, "default": nil},
+		},
+	})
+	return string(b), err
+}
+
+func (e *avroEncoder) recordNamespace(schema, table string) string {
+	return avroName(e.namespace) + "." + avroName(schema) + "." + avroName(table)
+}
+
+// subject returns the `<topic>-value` subject of the schema of a table.
+func (e *avroEncoder) subject(schema, table string) string {
+	topic := schema + "." + table
+	if e.topics != nil {
+		topic = e.topics.topic(schema, table)
+	}
+	return topic + "-value"
+}
+
+// check generates the schemas of the tables from their catalog columns and
+// tests them against the latest versions of their subjects. The columns are
+// kept, so the first events of the tables register the checked schemas.
+func (e *avroEncoder) check(ctx context.Context, schema string, relations map[string]relationDescriptor) error {
+	tables := make([]string, 0, len(relations))
+	for table := range relations {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var incompatible []string
+	for _, table := range tables {
+		d := relations[table]
+		names := make([]string, len(d.Columns))
+		types := make([]string, len(d.Columns))
+		for i, c := range d.Columns {
+			names[i], types[i] = c.Name, c.Type
+		}
+		key := schema + "." + table
+		e.observe(key, names, types)
+		generated, err := e.schema(e.recordNamespace(schema, table), e.columns[key])
+		if err != nil {
+			return err
+		}
+
+		subject := e.subject(schema, table)
+		if e.compatibility != "" {
+			if err := e.registry.setCompatibility(ctx, subject, e.compatibility); err != nil {
+				return err
+			}
+		}
+		compatible, messages, err := e.registry.checkCompatibility(ctx, subject, generated)
+		if err != nil {
+			return err
+		}
+		if compatible {
+			continue
+		}
+		latest, err := e.registry.latestSchema(ctx, subject)
+		if err != nil {
+			return err
+		}
+		incompatible = append(incompatible, fmt.Sprintf("subject %s: %s\n%s", subject, strings.Join(messages, "; "), avroSchemaDiff(latest, generated)))
+	}
+	if len(incompatible) > 0 {
+		return fmt.Errorf("the avro schemas of the tables are incompatible with their subjects:\n%s", strings.Join(incompatible, "\n"))
+	}
+	return nil
+}
+
+// avroSchemaDiff lists the fields removed from, added to and changed in the
+// registered schema by the generated one, one per line.
+func avroSchemaDiff(registered, generated string) string {
+	before, after := avroSchemaFields(registered), avroSchemaFields(generated)
+	var lines []string
+	for name, t := range before {
+		if _, ok := after[name]; !ok {
+			lines = append(lines, fmt.Sprintf("- %s: %s", name, t))
+		}
+	}
+	for name, t := range after {
+		previous, ok := before[name]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", name, t))
+		case previous != t:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", name, previous, t))
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return strings.Join(lines, "\n")
+}
+
+// avroSchemaFields returns the JSON encoded types of the fields of a record
+// schema by path, with the fields of nested and nullable records flattened.
+func avroSchemaFields(schema string) map[string]string {
+	var root any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		return nil
+	}
+	fields := map[string]string{}
+	var walk func(path string, t any)
+	walk = func(path string, t any) {
+		switch tv := t.(type) {
+		case map[string]any:
+			if tv["type"] == "record" {
+				recordFields, _ := tv["fields"].([]any)
+				for _, f := range recordFields {
+					field, _ := f.(map[string]any)
+					name, _ := field["name"].(string)
+					if path != "" {
+						name = path + "." + name
+					}
+					walk(name, field["type"])
+				}
+				return
+			}
+		case []any:
+			if len(tv) == 2 && tv[0] == "null" {
+				if record, ok := tv[1].(map[string]any); ok && record["type"] == "record" {
+					walk(path, record)
+					return
+				}
+			}
+		}
+		b, _ := json.Marshal(t)
+		fields[path] = string(b)
+	}
+	walk("", root)
+	return fields
+}
+
+// encode serialises the change of a single change event, registering the
+// schema of its table under the `<topic>-value` subject.
+func (e *avroEncoder) encode(ctx context.Context, changes pglogicalstream.Wal2JsonChanges) (avroEvent, error) {
+	if len(changes.Changes) != 1 {
+		return avroEvent{}, fmt.Errorf("avro events hold a single change, got %d", len(changes.Changes))
+	}
+	change := changes.Changes[0]
+	table := change.Schema + "." + change.Table
+	e.observe(table, change.ColumnNames, change.ColumnTypes)
+	e.observe(table, change.OldKeys.KeyNames, change.OldKeys.KeyTypes)
+	columns := e.columns[table]
+
+	namespace := e.recordNamespace(change.Schema, change.Table)
+	schema, err := e.schema(namespace, columns)
+	if err != nil {
+		return avroEvent{}, err
+	}
+	codec, ok := e.codecs[schema]
+	if !ok {
+		if codec, err = goavro.NewCodec(schema); err != nil {
+			return avroEvent{}, fmt.Errorf("failed to create the avro schema of %s: %w", table, err)
+		}
+		e.codecs[schema] = codec
+	}
+
+	event := avroEvent{subject: e.subject(change.Schema, change.Table)}
+	if e.compatibility != "" {
+		if err := e.registry.setCompatibility(ctx, event.subject, e.compatibility); err != nil {
+			return avroEvent{}, err
+		}
+	}
+	if event.schemaID, err = e.registry.register(ctx, event.subject, schema); err != nil {
+		return avroEvent{}, err
+	}
+
+	record := map[string]any{
+		"kind":      change.Kind,
+		"schema":    change.Schema,
+		"table":     change.Table,
+		"lsn":       nil,
+		"timestamp": nil,
+		"xid":       nil,
+		"before":    nil,
+		"after":     nil,
+	}
+	if changes.Lsn != nil {
+		record["lsn"] = goavro.Union("string", *changes.Lsn)
+	}
+	if !changes.Timestamp.IsZero() {
+		record["timestamp"] = goavro.Union("long.timestamp-micros", changes.Timestamp)
+	}
+	if changes.Xid != 0 {
+		record["xid"] = goavro.Union("long", int64(changes.Xid))
+	}
+	if len(change.OldKeys.KeyNames) > 0 {
+		before, err := avroRow(columns, e.nullable, change.OldKeys.KeyNames, change.OldKeys.KeyValues)
+		if err != nil {
+			return avroEvent{}, fmt.Errorf("failed to encode the old keys of %s: %w", table, err)
+		}
+		record["before"] = goavro.Union(namespace+".row", before)
+	}
+	if change.Kind != "delete" && len(change.ColumnNames) > 0 {
+		after, err := avroRow(columns, e.nullable, change.ColumnNames, change.ColumnValues)
+		if err != nil {
+			return avroEvent{}, fmt.Errorf("failed to encode the row of %s: %w", table, err)
+		}
+		record["after"] = goavro.Union(namespace+".row", after)
+	}
+
+	if event.payload, err = codec.BinaryFromNative(avroHeader(event.schemaID), record); err != nil {
+		return avroEvent{}, fmt.Errorf("failed to encode the change of %s: %w", table, err)
+	}
+	if e.keySchemas {
+		if err := e.encodeKey(ctx, &event, change, namespace, columns); err != nil {
+			return avroEvent{}, err
+		}
+	}
+	return event, nil
+}
+
+// avroHeader returns the header of the wire format of the schema registry,
+// a zero magic byte followed by the schema id.
+func avroHeader(schemaID int) []byte {
+	header := make([]byte, 5, 256)
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaID))
+	return header
+}
+
+// encodeKey serialises the primary key of the change, registering the key
+// schema of its table under the `<topic>-key` subject. The key is left unset
+// for tables without a primary key and changes missing its columns.
+func (e *avroEncoder) encodeKey(ctx context.Context, event *avroEvent, change pglogicalstream.Wal2JsonChange, namespace string, columns []avroColumn) error {
+	keyColumns := e.primaryKeys[change.Table]
+	if len(keyColumns) == 0 {
+		return nil
+	}
+	values, ok := keyParts(change, keyColumns)
+	if !ok {
+		return nil
+	}
+
+	fields := make([]map[string]any, len(keyColumns))
+	key := make(map[string]any, len(keyColumns))
+	for i, name := range keyColumns {
+		j := 0
+		for j < len(columns) && columns[j].name != name {
+			j++
+		}
+		if j == len(columns) || values[i] == nil {
+			return nil
+		}
+		c := columns[j]
+		fields[i] = map[string]any{"name": c.field, "type": c.avroType}
+		v, err := avroValue(c.avroType, values[i])
+		if err != nil {
+			return fmt.Errorf("failed to encode the key column %s of %s.%s: %w", name, change.Schema, change.Table, err)
+		}
+		key[c.field] = v
+	}
+	b, err := json.Marshal(map[string]any{"type": "record", "name": "key", "namespace": namespace, "fields": fields})
+	if err != nil {
+		return err
+	}
+	schema := string(b)
+	codec, ok := e.codecs[schema]
+	if !ok {
+		if codec, err = goavro.NewCodec(schema); err != nil {
+			return fmt.Errorf("failed to create the avro key schema of %s.%s: %w", change.Schema, change.Table, err)
+		}
+		e.codecs[schema] = codec
+	}
+
+	event.keySubject = strings.TrimSuffix(e.subject(change.Schema, change.Table), "-value") + "-key"
+	if e.compatibility != "" {
+		if err := e.registry.setCompatibility(ctx, event.keySubject, e.compatibility); err != nil {
+			return err
+		}
+	}
+	if event.keySchemaID, err = e.registry.register(ctx, event.keySubject, schema); err != nil {
+		return err
+	}
+	if event.key, err = codec.BinaryFromNative(avroHeader(event.keySchemaID), key); err != nil {
+		return fmt.Errorf("failed to encode the key of %s.%s: %w", change.Schema, change.Table, err)
+	}
+	return nil
+}
+
+// avroRow returns the native row record of the values, with nulls, or their
+// sentinels, for the null columns and the columns of the table the row lacks.
+func avroRow(columns []avroColumn, nullable avroNullable, names []string, values []any) (map[string]any, error) {
+	row := make(map[string]any, len(columns))
+	for _, c := range columns {
+		if nullable == avroNullableSentinel {
+			row[c.field] = avroSentinel(c.avroType)
+		} else {
+			row[c.field] = nil
+		}
+	}
+	for i, name := range names {
+		if i >= len(values) || values[i] == nil {
+			continue
+		}
+		for _, c := range columns {
+			if c.name != name {
+				continue
+			}
+			v, err := avroValue(c.avroType, values[i])
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", name, err)
+			}
+			if nullable == avroNullableSentinel {
+				row[c.field] = v
+			} else {
+				row[c.field] = goavro.Union(c.avroType, v)
+			}
+		}
+	}
+	return row, nil
+}
+
+// avroSentinel returns the value null columns of the Avro type are encoded as
+// without a union with null.
+func avroSentinel(avroType string) any {
+	switch avroType {
+	case "boolean":
+		return false
+	case "int":
+		return int32(0)
+	case "long":
+		return int64(0)
+	case "float":
+		return float32(0)
+	case "double":
+		return float64(0)
+	}
+	return ""
+}
+
+// avroValue converts a decoded column value to the native value of the Avro
+// type.
+func avroValue(avroType string, v any) (any, error) {
+	switch avroType {
+	case "boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if s, ok := v.(string); ok {
+			return strconv.ParseBool(s)
+		}
+	case "int", "long":
+		var n int64
+		switch tv := v.(type) {
+		case int64:
+			n = tv
+		case int:
+			n = int64(tv)
+		case int32:
+			n = int64(tv)
+		case float64:
+			if tv != math.Trunc(tv) {
+				return nil, fmt.Errorf("%v is not an integer", tv)
+			}
+			n = int64(tv)
+		case json.Number:
+			var err error
+			if n, err = tv.Int64(); err != nil {
+				return nil, err
+			}
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(tv, 10, 64); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %T value", v)
+		}
+		if avroType == "int" {
+			if n > math.MaxInt32 || n < math.MinInt32 {
+				return nil, fmt.Errorf("%d overflows an int", n)
+			}
+			return int32(n), nil
+		}
+		return n, nil
+	case "float", "double":
+		var f float64
+		switch tv := v.(type) {
+		case float64:
+			f = tv
+		case float32:
+			f = float64(tv)
+		case int64:
+			f = float64(tv)
+		case json.Number:
+			var err error
+			if f, err = tv.Float64(); err != nil {
+				return nil, err
+			}
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(tv, 64); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %T value", v)
+		}
+		if avroType == "float" {
+			return float32(f), nil
+		}
+		return f, nil
+	case "string":
+		switch tv := v.(type) {
+		case string:
+			return tv, nil
+		case []byte:
+			return string(tv), nil
+		case time.Time:
+			return tv.Format(time.RFC3339Nano), nil
+		case json.Number:
+			return tv.String(), nil
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return nil, fmt.Errorf("unexpected %T value", v)
+}
+
+// apply sets the schema metadata fields of the event.
+func (a avroEvent) apply(msg *service.Message) {
+	msg.MetaSetMut("schema_subject", a.subject)
+	msg.MetaSetMut("schema_id", strconv.Itoa(a.schemaID))
+	if a.key != nil {
+		msg.MetaSetMut("pg_key_avro", string(a.key))
+		msg.MetaSetMut("key_schema_subject", a.keySubject)
+		msg.MetaSetMut("key_schema_id", strconv.Itoa(a.keySchemaID))
+	}
+}
@@ -0,0 +1,420 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// fakeSchemaRegistry assigns ids to the schemas registered per subject.
+type fakeSchemaRegistry struct {
+	mut           sync.Mutex
+	schemas       []string
+	subjects      map[string]int
+	compatibility map[string]string
+	// latest holds the latest schema by subject.
+	latest map[string]string
+	// incompatible holds the reasons schemas are incompatible by subject.
+	incompatible map[string][]string
+}
+
+func (f *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	var body map[string]string
+	if r.Method != http.MethodGet {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	subject := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/compatibility"), "/subjects/"), "/versions/latest")
+	switch {
+	case r.Method == http.MethodPut && len(r.URL.Path) > len("/config/"):
+		f.compatibility[r.URL.Path[len("/config/"):]] = body["compatibility"]
+		_ = json.NewEncoder(w).Encode(body)
+	case strings.HasPrefix(r.URL.Path, "/compatibility/"):
+		if _, ok := f.latest[subject]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(schemaRegistryError{ErrorCode: 40401, Message: "Subject not found"})
+			return
+		}
+		messages := f.incompatible[subject]
+		_ = json.NewEncoder(w).Encode(map[string]any{"is_compatible": len(messages) == 0, "messages": messages})
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/versions"):
+		_, hasLatest := f.latest[strings.TrimSuffix(subject, "/versions")]
+		if !hasLatest && f.subjects[r.URL.Path] == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(schemaRegistryError{ErrorCode: 40401, Message: "Subject not found"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]int{1})
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/versions/latest"):
+		_ = json.NewEncoder(w).Encode(map[string]string{"schema": f.latest[subject]})
+	case r.Method == http.MethodPost:
+		f.subjects[r.URL.Path]++
+		if f.latest != nil {
+			f.latest[strings.TrimSuffix(subject, "/versions")] = body["schema"]
+		}
+		for i, schema := range f.schemas {
+			if schema == body["schema"] {
+				_ = json.NewEncoder(w).Encode(map[string]int{"id": i + 1})
+				return
+			}
+		}
+		f.schemas = append(f.schemas, body["schema"])
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": len(f.schemas)})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(schemaRegistryError{ErrorCode: 40401, Message: "not found"})
+	}
+}
+
+func TestAvroEncoder(t *testing.T) {
+	registry := &fakeSchemaRegistry{subjects: map[string]int{}, compatibility: map[string]string{}}
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	e := &avroEncoder{
+		registry:      newSchemaRegistryClient(u, "", "", time.Second),
+		compatibility: "BACKWARD",
+		namespace:     "pg_stream",
+		columns:       map[string][]avroColumn{},
+		codecs:        map[string]*goavro.Codec{},
+	}
+
+	decode := func(event avroEvent) map[string]any {
+		require.Equal(t, byte(0), event.payload[0])
+		id := int(binary.BigEndian.Uint32(event.payload[1:5]))
+		require.Equal(t, event.schemaID, id)
+		codec, err := goavro.NewCodec(registry.schemas[id-1])
+		require.NoError(t, err)
+		native, rest, err := codec.NativeFromBinary(event.payload[5:])
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		return native.(map[string]any)
+	}
+
+	lsn := "0/16B3748"
+	commit := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	event, err := e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{
+		Lsn:       &lsn,
+		Timestamp: commit,
+		Xid:       42,
+		Changes: []pglogicalstream.Wal2JsonChange{{
+			Kind:         "update",
+			Schema:       "public",
+			Table:        "users",
+			ColumnNames:  []string{"id", "full name", "active", "score", "tags"},
+			ColumnTypes:  []string{"bigint", "character varying(64)", "boolean", "double precision", "text[]"},
+			ColumnValues: []any{json.Number("7"), "Ada", true, 1.5, []any{"a", "b"}},
+			OldKeys: pglogicalstream.Wal2JsonOldKeys{
+				KeyNames:  []string{"id"},
+				KeyTypes:  []string{"bigint"},
+				KeyValues: []any{int64(7)},
+			},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "public.users-value", event.subject)
+	assert.Equal(t, "BACKWARD", registry.compatibility["public.users-value"])
+
+	record := decode(event)
+	assert.Equal(t, "update", record["kind"])
+	assert.Equal(t, map[string]any{"string": lsn}, record["lsn"])
+	assert.Equal(t, map[string]any{"long": int64(42)}, record["xid"])
+	assert.Equal(t, map[string]any{
+		"id":        map[string]any{"long": int64(7)},
+		"full_name": map[string]any{"string": "Ada"},
+		"active":    map[string]any{"boolean": true},
+		"score":     map[string]any{"double": 1.5},
+		"tags":      map[string]any{"string": `["a","b"]`},
+	}, record["after"].(map[string]any)["pg_stream.public.users.row"])
+	assert.Equal(t, map[string]any{
+		"id":        map[string]any{"long": int64(7)},
+		"full_name": nil,
+		"active":    nil,
+		"score":     nil,
+		"tags":      nil,
+	}, record["before"].(map[string]any)["pg_stream.public.users.row"])
+
+	// Deletes only hold the old keys and reuse the schema.
+	event, err = e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:    "delete",
+		Schema:  "public",
+		Table:   "users",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyTypes: []string{"bigint"}, KeyValues: []any{int64(8)}},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, event.schemaID)
+	record = decode(event)
+	assert.Nil(t, record["after"])
+	assert.Nil(t, record["lsn"])
+
+	// An added column registers a new version of the schema.
+	event, err = e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "users",
+		ColumnNames:  []string{"id", "email"},
+		ColumnTypes:  []string{"bigint", "text"},
+		ColumnValues: []any{int64(9), "grace@example.com"},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, event.schemaID)
+	after := decode(event)["after"].(map[string]any)["pg_stream.public.users.row"].(map[string]any)
+	assert.Equal(t, map[string]any{"string": "grace@example.com"}, after["email"])
+	assert.Nil(t, after["full_name"])
+	assert.Equal(t, 2, registry.subjects["/subjects/public.users-value/versions"])
+
+	_, err = e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "users",
+		ColumnNames:  []string{"id"},
+		ColumnTypes:  []string{"bigint"},
+		ColumnValues: []any{"seven"},
+	}}})
+	require.Error(t, err)
+}
+
+func TestAvroNullableColumns(t *testing.T) {
+	tests := []struct {
+		nullable avroNullable
+		field    string
+		name     any
+		missing  any
+	}{
+		{
+			nullable: avroNullableOptional,
+			field:    `{"default":null,"name":"name","type":["null","string"]}`,
+			name:     nil,
+			missing:  nil,
+		},
+		{
+			nullable: avroNullableUnion,
+			field:    `{"name":"name","type":["null","string"]}`,
+			name:     nil,
+			missing:  nil,
+		},
+		{
+			nullable: avroNullableSentinel,
+			field:    `{"default":"","name":"name","type":"string"}`,
+			name:     "",
+			missing:  int32(0),
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.nullable), func(t *testing.T) {
+			registry := &fakeSchemaRegistry{subjects: map[string]int{}, compatibility: map[string]string{}}
+			srv := httptest.NewServer(registry)
+			defer srv.Close()
+			u, err := url.Parse(srv.URL)
+			require.NoError(t, err)
+
+			e := &avroEncoder{
+				registry:  newSchemaRegistryClient(u, "", "", time.Second),
+				nullable:  test.nullable,
+				namespace: "pg_stream",
+				columns:   map[string][]avroColumn{"public.users": {{name: "score", field: "score", avroType: "int"}}},
+				codecs:    map[string]*goavro.Codec{},
+			}
+			event, err := e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+				Kind:         "insert",
+				Schema:       "public",
+				Table:        "users",
+				ColumnNames:  []string{"id", "name"},
+				ColumnTypes:  []string{"bigint", "text"},
+				ColumnValues: []any{int64(7), nil},
+			}}})
+			require.NoError(t, err)
+
+			schema := registry.schemas[event.schemaID-1]
+			assert.Contains(t, schema, test.field)
+
+			codec, err := goavro.NewCodec(schema)
+			require.NoError(t, err)
+			native, _, err := codec.NativeFromBinary(event.payload[5:])
+			require.NoError(t, err)
+			after := native.(map[string]any)["after"].(map[string]any)["pg_stream.public.users.row"].(map[string]any)
+			assert.Equal(t, test.name, after["name"])
+			// Columns of the table the row lacks are encoded like nulls.
+			assert.Equal(t, test.missing, after["score"])
+			if test.nullable == avroNullableSentinel {
+				assert.Equal(t, int64(7), after["id"])
+			} else {
+				assert.Equal(t, map[string]any{"long": int64(7)}, after["id"])
+			}
+		})
+	}
+}
+
+func TestAvroName(t *testing.T) {
+	assert.Equal(t, "full_name", avroName("full name"))
+	assert.Equal(t, "_1st", avroName("1st"))
+	assert.Equal(t, "_", avroName(""))
+}
+
+func TestAvroCompatibilityCheck(t *testing.T) {
+	registry := &fakeSchemaRegistry{
+		subjects:      map[string]int{},
+		compatibility: map[string]string{},
+		latest:        map[string]string{},
+		incompatible:  map[string][]string{},
+	}
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	e := &avroEncoder{
+		registry:      newSchemaRegistryClient(u, "", "", time.Second),
+		compatibility: "BACKWARD",
+		namespace:     "pg_stream",
+		columns:       map[string][]avroColumn{},
+		codecs:        map[string]*goavro.Codec{},
+	}
+	registered, err := e.schema("pg_stream.public.orders", []avroColumn{
+		{name: "id", field: "id", avroType: "string"},
+		{name: "note", field: "note", avroType: "string"},
+	})
+	require.NoError(t, err)
+	registry.latest["public.orders-value"] = registered
+	registry.incompatible["public.orders-value"] = []string{"reader type: LONG not compatible with writer type: STRING"}
+
+	relations := map[string]relationDescriptor{
+		"orders": {Schema: "public", Table: "orders", Columns: []relationColumn{
+			{Name: "id", Type: "bigint"},
+			{Name: "total", Type: "double precision"},
+		}},
+		"users": {Schema: "public", Table: "users", Columns: []relationColumn{{Name: "id", Type: "integer"}}},
+	}
+	err = e.check(context.Background(), "public", relations)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "subject public.orders-value: reader type: LONG not compatible with writer type: STRING")
+	assert.Contains(t, err.Error(), `~ before.id: ["null","string"] -> ["null","long"]
+- before.note: ["null","string"]
++ before.total: ["null","double"]`)
+	assert.NotContains(t, err.Error(), "users")
+	// Only the level of the subjects without versions is set.
+	assert.NotContains(t, registry.compatibility, "public.orders-value")
+	assert.Equal(t, "BACKWARD", registry.compatibility["public.users-value"])
+	// Checks don't register schemas.
+	assert.Empty(t, registry.schemas)
+
+	// The checked schema is the one the first event registers.
+	delete(registry.incompatible, "public.orders-value")
+	require.NoError(t, e.check(context.Background(), "public", relations))
+	checked, err := e.schema("pg_stream.public.orders", e.columns["public.orders"])
+	require.NoError(t, err)
+	_, err = e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "total"},
+		ColumnTypes:  []string{"bigint", "double precision"},
+		ColumnValues: []any{int64(1), 9.5},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, checked, registry.latest["public.orders-value"])
+}
+
+func TestAvroKeySchemas(t *testing.T) {
+	registry := &fakeSchemaRegistry{subjects: map[string]int{}, compatibility: map[string]string{}}
+	srv := httptest.NewServer(registry)
+	defer srv.Close()
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	e := &avroEncoder{
+		registry:    newSchemaRegistryClient(u, "", "", time.Second),
+		keySchemas:  true,
+		namespace:   "pg_stream",
+		primaryKeys: map[string][]string{"order_lines": {"order id", "line"}},
+		columns:     map[string][]avroColumn{},
+		codecs:      map[string]*goavro.Codec{},
+	}
+
+	decodeKey := func(event avroEvent) map[string]any {
+		require.NotNil(t, event.key)
+		id := int(binary.BigEndian.Uint32(event.key[1:5]))
+		require.Equal(t, event.keySchemaID, id)
+		codec, err := goavro.NewCodec(registry.schemas[id-1])
+		require.NoError(t, err)
+		native, _, err := codec.NativeFromBinary(event.key[5:])
+		require.NoError(t, err)
+		return native.(map[string]any)
+	}
+
+	event, err := e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "order_lines",
+		ColumnNames:  []string{"order id", "line", "sku"},
+		ColumnTypes:  []string{"bigint", "integer", "text"},
+		ColumnValues: []any{json.Number("7"), 2.0, "A-1"},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, "public.order_lines-key", event.keySubject)
+	assert.Equal(t, map[string]any{"order_id": int64(7), "line": int32(2)}, decodeKey(event))
+	assert.NotEqual(t, event.schemaID, event.keySchemaID)
+
+	msg := service.NewMessage(event.payload)
+	event.apply(msg)
+	key, _ := msg.MetaGet("pg_key_avro")
+	assert.Equal(t, string(event.key), key)
+	subject, _ := msg.MetaGet("key_schema_subject")
+	assert.Equal(t, "public.order_lines-key", subject)
+
+	// Deletes are keyed by their old keys and reuse the key schema.
+	deleted, err := e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:    "delete",
+		Schema:  "public",
+		Table:   "order_lines",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"order id", "line"}, KeyTypes: []string{"bigint", "integer"}, KeyValues: []any{int64(7), int64(2)}},
+	}}})
+	require.NoError(t, err)
+	assert.Equal(t, event.keySchemaID, deleted.keySchemaID)
+	assert.Equal(t, event.key, deleted.key)
+
+	// Tables without a primary key have no key.
+	event, err = e.encode(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "events",
+		ColumnNames:  []string{"payload"},
+		ColumnTypes:  []string{"text"},
+		ColumnValues: []any{"x"},
+	}}})
+	require.NoError(t, err)
+	assert.Nil(t, event.key)
+	msg = service.NewMessage(event.payload)
+	event.apply(msg)
+	_, ok := msg.MetaGet("pg_key_avro")
+	assert.False(t, ok)
+}
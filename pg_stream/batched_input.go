@@ -0,0 +1,93 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func init() {
+	err := service.RegisterBatchInput(
+		"pg_stream_batched", pgStreamConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchInput, error) {
+			p, err := newPgStreamInput(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacksBatched(&pgStreamBatchedInput{pgStreamInput: p}), nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// pgStreamBatchedInput emits the events of pg_stream in batches, a batch
+// holding the events of a transaction or the snapshot rows that are buffered,
+// so batch-aware outputs write them together. Control messages are batched
+// with the events around them.
+//
+// Features that skip or reorder streamed changes, such as `priority_tables`
+// or dropping validation rules, may merge a transaction whose last change is
+// skipped into the batch of the next one.
+type pgStreamBatchedInput struct {
+	*pgStreamInput
+
+	// err is the error that ended the previous batch early, returned by the
+	// next read.
+	err error
+}
+
+func (p *pgStreamBatchedInput) ReadBatch(ctx context.Context) (service.MessageBatch, service.AckFunc, error) {
+	if err := p.err; err != nil {
+		p.err = nil
+		return nil, nil, err
+	}
+
+	var batch service.MessageBatch
+	var acks []service.AckFunc
+	for len(batch) == 0 || p.more(batch) {
+		msg, ack, err := p.Read(ctx)
+		if err != nil {
+			if len(batch) == 0 {
+				return nil, nil, err
+			}
+			p.err = err
+			break
+		}
+		batch = append(batch, msg)
+		acks = append(acks, ack)
+	}
+	return batch, func(ctx context.Context, err error) error {
+		// Nacks are retried automatically when we use service.AutoRetryNacksBatched
+		for _, ack := range acks {
+			if ackErr := ack(ctx, err); ackErr != nil {
+				return ackErr
+			}
+		}
+		return nil
+	}, nil
+}
+
+// more returns true when the batch continues with the next event: the rest of
+// the transaction of the last streamed event, or further snapshot rows that
+// are already buffered.
+func (p *pgStreamBatchedInput) more(batch service.MessageBatch) bool {
+	if p.transactionOpen {
+		return true
+	}
+	if phase, _ := batch[len(batch)-1].MetaGet("phase"); phase != phaseSnapshot {
+		return false
+	}
+	if p.snapshotBatchSize > 0 && len(batch) >= p.snapshotBatchSize {
+		return false
+	}
+	return len(p.source.SnapshotMessageC()) > 0
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestBatchedInputBatchesTransactionsAndSnapshotChunks(t *testing.T) {
+	res := service.MockResources()
+	source, acks := newFakeSource(t, &pglogicalstream.FakeScript{
+		Snapshot:     []string{fakeInsert(1), fakeInsert(2), fakeInsert(3)},
+		Transactions: []string{fakeTransaction(4, 5, 6), fakeTransaction(7), fakeTransaction(8, 9)},
+		// A failure ends the last transaction early.
+		DisconnectEvery:          3,
+		DisconnectMidTransaction: true,
+	})
+	p := &pgStreamBatchedInput{pgStreamInput: &pgStreamInput{
+		source:            source,
+		backlog:           newChangeBacklog(nil, 0),
+		acks:              &lsnAckTracker{},
+		queue:             newQueueMetrics(res.Metrics()),
+		snapshotBatchSize: 2,
+		logger:            res.Logger(),
+		metrics:           res.Metrics(),
+	}}
+	ctx := context.Background()
+
+	batch, ack, err := p.ReadBatch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, batch, 2)
+	require.NoError(t, ack(ctx, nil))
+	batch, _, err = p.ReadBatch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, batch, 1)
+
+	batch, ack, err = p.ReadBatch(ctx)
+	require.NoError(t, err)
+	require.Len(t, batch, 3)
+	for _, msg := range batch {
+		phase, _ := msg.MetaGet("phase")
+		assert.Equal(t, "stream", phase)
+	}
+	require.NoError(t, ack(ctx, nil))
+	confirmed := acks.confirmed()
+	require.NotEmpty(t, confirmed)
+	assert.Equal(t, "0/1", confirmed[len(confirmed)-1])
+
+	batch, _, err = p.ReadBatch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, batch, 1)
+
+	// The failure is returned by the read after the partial transaction.
+	batch, _, err = p.ReadBatch(ctx)
+	require.NoError(t, err)
+	assert.Len(t, batch, 1)
+	_, _, err = p.ReadBatch(ctx)
+	assert.ErrorIs(t, err, service.ErrNotConnected)
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var catalogRetryConfigFields = []*service.ConfigField{
+	service.NewIntField("max_retries").
+		Description("The maximum number of times a failed catalog query is retried").
+		Default(5),
+	service.NewDurationField("initial_interval").
+		Description("The wait before the first retry, later retries wait exponentially longer with random jitter").
+		Default("200ms"),
+	service.NewDurationField("max_interval").
+		Description("The maximum wait between retries").
+		Default("5s"),
+	service.NewDurationField("max_staleness").
+		Description("When a catalog query keeps failing, the result of its last successful run is used instead if it is no older than this. Set to `0s` to never fall back to a previous result").
+		Default("1h"),
+}
+
+type catalogResult struct {
+	value any
+	at    time.Time
+}
+
+// catalogRetrier retries catalog queries that fail, typically because of lock
+// contention during migrations, and falls back to recent results of queries
+// that keep failing.
+type catalogRetrier struct {
+	maxRetries      int
+	initialInterval time.Duration
+	maxInterval     time.Duration
+	maxStaleness    time.Duration
+
+	results map[string]catalogResult
+	logger  *service.Logger
+}
+
+func newCatalogRetrierFromParsed(conf *service.ParsedConfig, logger *service.Logger) (r *catalogRetrier, err error) {
+	r = &catalogRetrier{
+		results: map[string]catalogResult{},
+		logger:  logger,
+	}
+	if r.maxRetries, err = conf.FieldInt("max_retries"); err != nil {
+		return nil, err
+	}
+	if r.initialInterval, err = conf.FieldDuration("initial_interval"); err != nil {
+		return nil, err
+	}
+	if r.maxInterval, err = conf.FieldDuration("max_interval"); err != nil {
+		return nil, err
+	}
+	if r.maxStaleness, err = conf.FieldDuration("max_staleness"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// queryCatalog runs the named catalog query with the retrier r, which may be
+// nil in which case the query runs once.
+func queryCatalog[T any](ctx context.Context, r *catalogRetrier, name string, query func(context.Context) (T, error)) (T, error) {
+	if r == nil {
+		return query(ctx)
+	}
+
+	boff := backoff.NewExponentialBackOff()
+	boff.InitialInterval = r.initialInterval
+	boff.MaxInterval = r.maxInterval
+	boff.MaxElapsedTime = 0
+
+	var result T
+	err := backoff.RetryNotify(func() (err error) {
+		result, err = query(ctx)
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(boff, uint64(r.maxRetries)), ctx), func(err error, wait time.Duration) {
+		r.logger.Warnf("Catalog query %s failed, retrying in %v: %v", name, wait, err)
+	})
+	if err == nil {
+		r.results[name] = catalogResult{value: result, at: time.Now()}
+		return result, nil
+	}
+
+	if cached, ok := r.results[name]; ok && time.Since(cached.at) <= r.maxStaleness {
+		r.logger.Warnf("Catalog query %s failed, using its result from %v ago: %v", name, time.Since(cached.at).Round(time.Second), err)
+		return cached.value.(T), nil
+	}
+	return result, err
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCatalogRetriesAndFallsBack(t *testing.T) {
+	r := &catalogRetrier{
+		maxRetries:      2,
+		initialInterval: time.Millisecond,
+		maxInterval:     time.Millisecond,
+		maxStaleness:    time.Hour,
+		results:         map[string]catalogResult{},
+	}
+	ctx := context.Background()
+
+	calls := 0
+	v, err := queryCatalog(ctx, r, "tables", func(context.Context) (int, error) {
+		if calls++; calls < 3 {
+			return 0, errors.New("lock timeout")
+		}
+		return 42, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	failing := func(context.Context) (int, error) {
+		return 0, errors.New("lock timeout")
+	}
+	v, err = queryCatalog(ctx, r, "tables", failing)
+	require.NoError(t, err)
+	assert.Equal(t, 42, v)
+
+	_, err = queryCatalog(ctx, r, "other", failing)
+	assert.Error(t, err)
+
+	r.results["tables"] = catalogResult{value: 42, at: time.Now().Add(-2 * time.Hour)}
+	_, err = queryCatalog(ctx, r, "tables", failing)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type updatePayload string
+
+const (
+	updatePayloadFull    updatePayload = "full"
+	updatePayloadChanged updatePayload = "changed"
+)
+
+// trimUnchangedColumns removes the columns of updated rows that hold the
+// same value in the before image, keeping the primary key columns. Columns
+// missing from the before image are kept since they may have changed.
+func trimUnchangedColumns(changes []pglogicalstream.Wal2JsonChange, primaryKeys map[string][]string) {
+	for i := range changes {
+		c := &changes[i]
+		if c.Kind != "update" || len(c.OldKeys.KeyNames) == 0 {
+			continue
+		}
+
+		keys := primaryKeys[c.Table]
+		var names, types []string
+		var values []interface{}
+		for j, name := range c.ColumnNames {
+			var value interface{}
+			if j < len(c.ColumnValues) {
+				value = c.ColumnValues[j]
+			}
+			if !slices.Contains(keys, name) {
+				before, ok := columnValue(c.OldKeys.KeyNames, c.OldKeys.KeyValues, name)
+				if ok && reflect.DeepEqual(before, value) {
+					continue
+				}
+			}
+			names = append(names, name)
+			if j < len(c.ColumnTypes) {
+				types = append(types, c.ColumnTypes[j])
+			}
+			values = append(values, value)
+		}
+		c.ColumnNames, c.ColumnTypes, c.ColumnValues = names, types, values
+	}
+}
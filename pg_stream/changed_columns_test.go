@@ -0,0 +1,47 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestTrimUnchangedColumns(t *testing.T) {
+	changes := []pglogicalstream.Wal2JsonChange{
+		{
+			Kind:         "update",
+			Table:        "users",
+			ColumnNames:  []string{"id", "name", "email", "bio"},
+			ColumnTypes:  []string{"integer", "text", "text", "text"},
+			ColumnValues: []interface{}{float64(1), "bob", "new@example.com", "long text"},
+			OldKeys: pglogicalstream.Wal2JsonOldKeys{
+				KeyNames:  []string{"id", "name", "email", "bio"},
+				KeyValues: []interface{}{float64(1), "bob", "old@example.com", "long text"},
+			},
+		},
+		{
+			// Without a before image every column is kept.
+			Kind:         "update",
+			Table:        "users",
+			ColumnNames:  []string{"id", "name"},
+			ColumnValues: []interface{}{float64(2), "alice"},
+		},
+	}
+
+	trimUnchangedColumns(changes, map[string][]string{"users": {"id"}})
+
+	assert.Equal(t, []string{"id", "email"}, changes[0].ColumnNames)
+	assert.Equal(t, []string{"integer", "text"}, changes[0].ColumnTypes)
+	assert.Equal(t, []interface{}{float64(1), "new@example.com"}, changes[0].ColumnValues)
+	assert.Equal(t, []string{"id", "name"}, changes[1].ColumnNames)
+}
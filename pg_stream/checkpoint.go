@@ -0,0 +1,246 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// Checkpointer stores the last LSN acknowledged by the pipeline outside of the
+// replication slot, so that a restarted pipeline resumes from it when it is
+// ahead of the slot's confirmed position.
+type Checkpointer interface {
+	// Set stores the LSN of the key.
+	Set(ctx context.Context, key string, lsn string) error
+	// Get returns the LSN stored for the key, or an empty string when none
+	// is stored.
+	Get(ctx context.Context, key string) (string, error)
+	// Close releases the resources of the checkpointer.
+	Close(ctx context.Context) error
+}
+
+// CheckpointerConstructor creates a Checkpointer from the `checkpoint` block
+// of the input config. Backends that aren't built in read their settings from
+// its `options` field.
+type CheckpointerConstructor func(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error)
+
+var (
+	checkpointBackendsMut sync.RWMutex
+	checkpointBackends    = map[string]CheckpointerConstructor{}
+)
+
+// RegisterCheckpointBackend makes a checkpoint backend selectable by name in
+// the `backend` field of the `checkpoint` block. It is meant to be called from
+// an init function, before configs are parsed.
+func RegisterCheckpointBackend(name string, ctor CheckpointerConstructor) {
+	checkpointBackendsMut.Lock()
+	defer checkpointBackendsMut.Unlock()
+	checkpointBackends[name] = ctor
+}
+
+func checkpointBackend(name string) (CheckpointerConstructor, error) {
+	checkpointBackendsMut.RLock()
+	defer checkpointBackendsMut.RUnlock()
+	if ctor, ok := checkpointBackends[name]; ok {
+		return ctor, nil
+	}
+	names := make([]string, 0, len(checkpointBackends))
+	for name := range checkpointBackends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return nil, fmt.Errorf("unknown checkpoint backend %q, registered backends are %v", name, names)
+}
+
+// checkpointBackendConfigFields returns the fields selecting and configuring
+// a checkpoint backend, shared by the primary and secondary backends.
+func checkpointBackendConfigFields() []*service.ConfigField {
+	return []*service.ConfigField{
+		service.NewStringField("backend").
+			Description("The name of the checkpoint backend"),
+		service.NewStringField("key").
+			Description("The key the LSN is stored under. Defaults to the slot name").
+			Default(""),
+		service.NewStringField("cache").
+			Description("The cache resource of the `cache` backend, which stores the LSN in any cache Benthos supports, such as `redis`, `memcached` or `aws_dynamodb`").
+			Optional(),
+		service.NewObjectField("file", fileCheckpointConfigFields...).
+			Description("Settings of the `file` backend, which stores the LSN in a local file for single node deployments. The file is replaced atomically and synced to disk on every update").
+			Optional(),
+		service.NewObjectField("postgres", postgresCheckpointConfigFields...).
+			Description("Settings of the `postgres` backend, which stores the LSN in a table of the source or another Postgres database, so it can be read and updated transactionally along with other bookkeeping").
+			Optional(),
+		service.NewObjectField("s3", s3CheckpointConfigFields...).
+			Description("Settings of the `s3` backend, which stores the LSN in an object per key of an S3 bucket or S3 compatible store, for deployments with no database or cache to keep state in. Objects are written with conditional requests, so a pipeline whose checkpoint object was written by another pipeline fails to store checkpoints rather than overwriting them").
+			Optional(),
+		service.NewStringMapField("options").
+			Description("Settings of backends registered with `RegisterCheckpointBackend` that aren't built in").
+			Default(map[string]any{}),
+	}
+}
+
+type checkpointFailurePolicy string
+
+const (
+	checkpointFailureBuffer checkpointFailurePolicy = "buffer"
+	checkpointFailurePause  checkpointFailurePolicy = "pause"
+	checkpointFailureFail   checkpointFailurePolicy = "fail"
+)
+
+var checkpointConfigFields = append(checkpointBackendConfigFields(),
+	service.NewStringAnnotatedEnumField("on_failure", map[string]string{
+		string(checkpointFailureBuffer): "Keep consuming and hold the latest acknowledged LSN back, it is stored and confirmed to the slot once the backend is reachable again.",
+		string(checkpointFailurePause):  "Hold the latest acknowledged LSN back and stop emitting events until it is stored.",
+		string(checkpointFailureFail):   "Stop the stream and reconnect, which fails until the backend is reachable again. Unconfirmed changes are delivered again.",
+	}).
+		Description("What to do when an acknowledged LSN fails to be stored in the checkpoint backend. LSNs that aren't stored are never confirmed to the slot, so that the slot doesn't move past the checkpoint").
+		Default(string(checkpointFailureBuffer)),
+	service.NewDurationField("retry_interval").
+		Description("How often an LSN that failed to be stored is stored again when no later acknowledgement comes in").
+		Default("1s"),
+	service.NewObjectField("secondary", append(checkpointBackendConfigFields(),
+		service.NewDurationField("sync_interval").
+			Description("How often the last acknowledged LSN is copied to the secondary backend, which bounds how far it lags behind the primary one").
+			Default("1s"),
+	)...).
+		Description("A second checkpoint backend, typically in another region, the LSN is copied to in the background so that the pipeline can resume from it after a regional failover. The primary backend is written before the LSN is confirmed to the slot, the secondary one lags behind it by up to `sync_interval`, and its failures are logged without holding back acknowledgements. On connect both backends are read and streaming resumes from the later of their LSNs, or from the one that is reachable, so that resuming from the secondary backend alone redelivers at most the changes acknowledged during the last `sync_interval`").
+		Optional(),
+)
+
+// checkpointConfig creates the checkpointer of the input on every connect, so
+// that it is closed along with the other connections.
+type checkpointConfig struct {
+	key  string
+	ctor CheckpointerConstructor
+	conf *service.ParsedConfig
+	mgr  *service.Resources
+
+	secondary    *checkpointConfig
+	syncInterval time.Duration
+
+	onFailure     checkpointFailurePolicy
+	retryInterval time.Duration
+}
+
+func newCheckpointConfigFromParsed(conf *service.ParsedConfig, mgr *service.Resources, slotName string) (c *checkpointConfig, err error) {
+	c = &checkpointConfig{conf: conf, mgr: mgr}
+	var backend string
+	if backend, err = conf.FieldString("backend"); err != nil {
+		return nil, err
+	}
+	if c.ctor, err = checkpointBackend(backend); err != nil {
+		return nil, err
+	}
+	if c.key, err = conf.FieldString("key"); err != nil {
+		return nil, err
+	}
+	if c.key == "" {
+		c.key = slotName
+	}
+	// The secondary backend shares the failure policy of the primary one.
+	if conf.Contains("on_failure") {
+		var onFailure string
+		if onFailure, err = conf.FieldString("on_failure"); err != nil {
+			return nil, err
+		}
+		c.onFailure = checkpointFailurePolicy(onFailure)
+		if c.retryInterval, err = conf.FieldDuration("retry_interval"); err != nil {
+			return nil, err
+		}
+		if c.retryInterval <= 0 {
+			return nil, fmt.Errorf("checkpoint retry_interval must be positive, got %v", c.retryInterval)
+		}
+	}
+	if conf.Contains("secondary") {
+		if c.secondary, err = newCheckpointConfigFromParsed(conf.Namespace("secondary"), mgr, slotName); err != nil {
+			return nil, err
+		}
+		if c.syncInterval, err = conf.FieldDuration("secondary", "sync_interval"); err != nil {
+			return nil, err
+		}
+		if c.syncInterval <= 0 {
+			return nil, fmt.Errorf("secondary checkpoint sync_interval must be positive, got %v", c.syncInterval)
+		}
+	}
+	return c, nil
+}
+
+func (c *checkpointConfig) open() (Checkpointer, error) {
+	primary, err := c.ctor(c.conf, c.mgr)
+	if err != nil || c.secondary == nil {
+		return primary, err
+	}
+	secondary, err := c.secondary.open()
+	if err != nil {
+		_ = primary.Close(context.Background())
+		return nil, fmt.Errorf("failed to open the secondary checkpoint backend: %w", err)
+	}
+	return newReplicatedCheckpointer(primary, secondary, c.secondary.key, c.syncInterval, c.mgr.Logger()), nil
+}
+
+// checkpointingSource stores every position acknowledged to a source in a
+// checkpointer before confirming it to the slot. A position that fails to be
+// stored is held back until it, or a later position, is stored, and the input
+// applies the failure policy meanwhile.
+type checkpointingSource struct {
+	pglogicalstream.ReplicationSource
+	checkpointer  Checkpointer
+	key           string
+	retryInterval time.Duration
+	logger        *service.Logger
+
+	mut sync.Mutex
+	// unstored is the latest position that failed to be stored.
+	unstored  string
+	err       error
+	attempted time.Time
+}
+
+func (s *checkpointingSource) AckLSN(lsn string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.store(lsn)
+}
+
+func (s *checkpointingSource) store(lsn string) {
+	s.attempted = time.Now()
+	if err := s.checkpointer.Set(context.Background(), s.key, lsn); err != nil {
+		if s.err == nil {
+			s.logger.Errorf("Failed to store the checkpoint %s, holding back its confirmation: %v", lsn, err)
+		}
+		s.unstored, s.err = lsn, err
+		return
+	}
+	if s.err != nil {
+		s.logger.Infof("Stored the checkpoint %s after failures", lsn)
+	}
+	s.unstored, s.err = "", nil
+	s.ReplicationSource.AckLSN(lsn)
+}
+
+// retry stores the position held back once the retry interval elapsed since
+// the last attempt, and returns the error of the last attempt while it still
+// fails to be stored.
+func (s *checkpointingSource) retry() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.err != nil && time.Since(s.attempted) >= s.retryInterval {
+		s.store(s.unstored)
+	}
+	return s.err
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func init() {
+	RegisterCheckpointBackend("cache", newCacheCheckpointerFromParsed)
+}
+
+// cacheCheckpointer stores checkpoints in a Benthos cache resource, such as
+// a redis, memcached or dynamodb cache.
+type cacheCheckpointer struct {
+	cache string
+	res   *service.Resources
+}
+
+func newCacheCheckpointerFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error) {
+	if !conf.Contains("cache") {
+		return nil, errors.New("the cache checkpoint backend requires the cache field")
+	}
+	cache, err := conf.FieldString("cache")
+	if err != nil {
+		return nil, err
+	}
+	if !mgr.HasCache(cache) {
+		return nil, errors.New("checkpoint cache resource " + strconv.Quote(cache) + " doesn't exist")
+	}
+	return &cacheCheckpointer{cache: cache, res: mgr}, nil
+}
+
+func (c *cacheCheckpointer) Set(ctx context.Context, key string, lsn string) (err error) {
+	if aerr := c.res.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		err = cache.Set(ctx, key, []byte(lsn), nil)
+	}); aerr != nil {
+		return aerr
+	}
+	return err
+}
+
+func (c *cacheCheckpointer) Get(ctx context.Context, key string) (lsn string, err error) {
+	var value []byte
+	if aerr := c.res.AccessCache(ctx, c.cache, func(cache service.Cache) {
+		value, err = cache.Get(ctx, key)
+	}); aerr != nil {
+		return "", aerr
+	}
+	if errors.Is(err, service.ErrKeyNotFound) {
+		return "", nil
+	}
+	return string(value), err
+}
+
+// Close leaves the cache open, as its resource is owned by the pipeline.
+func (c *cacheCheckpointer) Close(ctx context.Context) error {
+	return nil
+}
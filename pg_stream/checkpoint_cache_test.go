@@ -0,0 +1,53 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheCheckpointer(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("checkpoints"))
+	ctx := context.Background()
+
+	spec := service.NewConfigSpec().Fields(checkpointConfigFields...)
+	conf, err := spec.ParseYAML(`
+backend: cache
+cache: checkpoints
+`, nil)
+	require.NoError(t, err)
+	c, err := newCheckpointConfigFromParsed(conf, res, "orders_slot")
+	require.NoError(t, err)
+
+	checkpointer, err := c.open()
+	require.NoError(t, err)
+	lsn, err := checkpointer.Get(ctx, "orders_slot")
+	require.NoError(t, err)
+	assert.Empty(t, lsn)
+
+	require.NoError(t, checkpointer.Set(ctx, "orders_slot", "0/16B3748"))
+	lsn, err = checkpointer.Get(ctx, "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3748", lsn)
+
+	conf, err = spec.ParseYAML(`
+backend: cache
+cache: nope
+`, nil)
+	require.NoError(t, err)
+	c, err = newCheckpointConfigFromParsed(conf, res, "orders_slot")
+	require.NoError(t, err)
+	_, err = c.open()
+	assert.ErrorContains(t, err, `"nope" doesn't exist`)
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func init() {
+	RegisterCheckpointBackend("file", newFileCheckpointerFromParsed)
+}
+
+var fileCheckpointConfigFields = []*service.ConfigField{
+	service.NewStringField("path").
+		Description("The path of the file the LSNs are stored in, as a JSON object by key. Its directory must exist"),
+}
+
+// fileCheckpointer stores checkpoints in a local file. Every update replaces
+// the file by renaming a synced temporary file over it, so a crash leaves
+// either the previous or the new checkpoints behind and never a torn write.
+type fileCheckpointer struct {
+	path string
+
+	mut  sync.Mutex
+	lsns map[string]string
+}
+
+func newFileCheckpointerFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error) {
+	if !conf.Contains("file") {
+		return nil, errors.New("the file checkpoint backend requires the file.path field")
+	}
+	path, err := conf.FieldString("file", "path")
+	if err != nil {
+		return nil, err
+	}
+	return newFileCheckpointer(path)
+}
+
+func newFileCheckpointer(path string) (*fileCheckpointer, error) {
+	c := &fileCheckpointer{path: path, lsns: map[string]string{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &c.lsns); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints from %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *fileCheckpointer) Set(ctx context.Context, key string, lsn string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	previous, existed := c.lsns[key]
+	c.lsns[key] = lsn
+	if err := c.write(); err != nil {
+		if existed {
+			c.lsns[key] = previous
+		} else {
+			delete(c.lsns, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *fileCheckpointer) Get(ctx context.Context, key string) (string, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.lsns[key], nil
+}
+
+func (c *fileCheckpointer) Close(ctx context.Context) error {
+	return nil
+}
+
+// write atomically replaces the file with the checkpoints.
+func (c *fileCheckpointer) write() error {
+	b, err := json.Marshal(c.lsns)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(c.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	// The rename is only durable once the directory entry is synced.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCheckpointer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "checkpoints.json")
+
+	spec := service.NewConfigSpec().Fields(checkpointConfigFields...)
+	conf, err := spec.ParseYAML(`
+backend: file
+file:
+  path: `+path+`
+`, nil)
+	require.NoError(t, err)
+	c, err := newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	require.NoError(t, err)
+
+	checkpointer, err := c.open()
+	require.NoError(t, err)
+	lsn, err := checkpointer.Get(context.Background(), "orders_slot")
+	require.NoError(t, err)
+	assert.Empty(t, lsn)
+
+	require.NoError(t, checkpointer.Set(context.Background(), "orders_slot", "0/16B3748"))
+	require.NoError(t, checkpointer.Set(context.Background(), "users_slot", "0/16B3800"))
+	require.NoError(t, checkpointer.Set(context.Background(), "orders_slot", "0/16B3900"))
+	require.NoError(t, checkpointer.Close(context.Background()))
+
+	// The checkpoints survive a restart, and no temporary files are left.
+	checkpointer, err = c.open()
+	require.NoError(t, err)
+	lsn, err = checkpointer.Get(context.Background(), "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3900", lsn)
+	lsn, err = checkpointer.Get(context.Background(), "users_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3800", lsn)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	conf, err = spec.ParseYAML(`backend: file`, nil)
+	require.NoError(t, err)
+	c, err = newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	require.NoError(t, err)
+	_, err = c.open()
+	assert.ErrorContains(t, err, "file.path")
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresCheckpointerConfig(t *testing.T) {
+	assert.Equal(t, `"pg_stream_checkpoints"`, quoteQualifiedName("pg_stream_checkpoints"))
+	assert.Equal(t, `"bookkeeping"."CDC checkpoints"`, quoteQualifiedName("bookkeeping.CDC checkpoints"))
+
+	spec := service.NewConfigSpec().Fields(checkpointConfigFields...)
+	conf, err := spec.ParseYAML(`backend: postgres`, nil)
+	require.NoError(t, err)
+	c, err := newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	require.NoError(t, err)
+	_, err = c.open()
+	assert.ErrorContains(t, err, "postgres.dsn")
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// replicatedCheckpointer stores checkpoints in a primary checkpointer and
+// copies the last one to a secondary checkpointer in the background, so that
+// a slow or unreachable secondary never holds back acknowledgements.
+type replicatedCheckpointer struct {
+	primary      Checkpointer
+	secondary    Checkpointer
+	secondaryKey string
+	interval     time.Duration
+	logger       *service.Logger
+
+	mut     sync.Mutex
+	pending string
+	synced  string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newReplicatedCheckpointer(primary, secondary Checkpointer, secondaryKey string, interval time.Duration, logger *service.Logger) *replicatedCheckpointer {
+	r := &replicatedCheckpointer{
+		primary:      primary,
+		secondary:    secondary,
+		secondaryKey: secondaryKey,
+		interval:     interval,
+		logger:       logger,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+func (r *replicatedCheckpointer) loop() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.sync(context.Background())
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// sync copies the last checkpoint to the secondary checkpointer unless it is
+// there already. A failed copy is retried on the next sync.
+func (r *replicatedCheckpointer) sync(ctx context.Context) {
+	r.mut.Lock()
+	lsn := r.pending
+	r.mut.Unlock()
+	if lsn == "" || lsn == r.synced {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+	if err := r.secondary.Set(ctx, r.secondaryKey, lsn); err != nil {
+		r.logger.Warnf("Failed to copy the checkpoint %s to the secondary backend: %v", lsn, err)
+		return
+	}
+	r.synced = lsn
+}
+
+func (r *replicatedCheckpointer) Set(ctx context.Context, key string, lsn string) error {
+	r.mut.Lock()
+	r.pending = lsn
+	r.mut.Unlock()
+	return r.primary.Set(ctx, key, lsn)
+}
+
+// Get returns the later of the checkpoints of both checkpointers, or the one
+// of the checkpointer that is reachable when the other fails, as after the
+// failover of the region of the primary checkpointer.
+func (r *replicatedCheckpointer) Get(ctx context.Context, key string) (string, error) {
+	primary, perr := r.primary.Get(ctx, key)
+	secondary, serr := r.secondary.Get(ctx, r.secondaryKey)
+	switch {
+	case perr != nil && serr != nil:
+		return "", errors.Join(perr, fmt.Errorf("secondary backend: %w", serr))
+	case perr != nil:
+		r.logger.Warnf("Resuming from the checkpoint of the secondary backend, the primary backend failed: %v", perr)
+		return secondary, nil
+	case serr != nil:
+		r.logger.Warnf("Failed to read the checkpoint of the secondary backend: %v", serr)
+		return primary, nil
+	}
+	return laterLSN(primary, secondary)
+}
+
+// laterLSN returns the later of two LSNs, either of which may be empty.
+func laterLSN(a, b string) (string, error) {
+	if a == "" || b == "" {
+		return a + b, nil
+	}
+	aLSN, err := pglogrepl.ParseLSN(a)
+	if err != nil {
+		return "", err
+	}
+	bLSN, err := pglogrepl.ParseLSN(b)
+	if err != nil {
+		return "", err
+	}
+	if bLSN > aLSN {
+		return b, nil
+	}
+	return a, nil
+}
+
+// Close copies the last checkpoint to the secondary checkpointer before
+// closing both.
+func (r *replicatedCheckpointer) Close(ctx context.Context) error {
+	close(r.stop)
+	<-r.done
+	r.sync(ctx)
+	return errors.Join(r.primary.Close(ctx), r.secondary.Close(ctx))
+}
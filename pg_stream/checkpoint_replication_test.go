@@ -0,0 +1,113 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unreachableCheckpointer fails like the backend of a region that is down.
+type unreachableCheckpointer struct{}
+
+func (unreachableCheckpointer) Set(ctx context.Context, key string, lsn string) error {
+	return errors.New("region down")
+}
+
+func (unreachableCheckpointer) Get(ctx context.Context, key string) (string, error) {
+	return "", errors.New("region down")
+}
+
+func (unreachableCheckpointer) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestReplicatedCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	primary := &memoryCheckpointer{lsns: map[string]string{}}
+	secondary := &memoryCheckpointer{lsns: map[string]string{}}
+	r := newReplicatedCheckpointer(primary, secondary, "dr_slot", time.Millisecond, service.MockResources().Logger())
+
+	require.NoError(t, r.Set(ctx, "slot", "0/16B3748"))
+	assert.Equal(t, "0/16B3748", primary.lsns["slot"])
+	assert.Eventually(t, func() bool {
+		lsn, _ := secondary.Get(ctx, "dr_slot")
+		return lsn == "0/16B3748"
+	}, time.Second, time.Millisecond)
+
+	// The checkpoint copied last wins when the primary lags behind.
+	require.NoError(t, secondary.Set(ctx, "dr_slot", "0/16B9F20"))
+	lsn, err := r.Get(ctx, "slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B9F20", lsn)
+
+	require.NoError(t, r.Set(ctx, "slot", "0/17000000"))
+	require.NoError(t, r.Close(ctx))
+	lsn, _ = secondary.Get(ctx, "dr_slot")
+	assert.Equal(t, "0/17000000", lsn)
+}
+
+func TestReplicatedCheckpointerFailover(t *testing.T) {
+	ctx := context.Background()
+	logger := service.MockResources().Logger()
+	store := &memoryCheckpointer{lsns: map[string]string{"slot": "0/16B3748"}}
+
+	r := newReplicatedCheckpointer(unreachableCheckpointer{}, store, "slot", time.Hour, logger)
+	lsn, err := r.Get(ctx, "slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3748", lsn)
+	require.NoError(t, r.Close(ctx))
+
+	// A failing secondary doesn't hold back the primary.
+	r = newReplicatedCheckpointer(store, unreachableCheckpointer{}, "slot", time.Millisecond, logger)
+	require.NoError(t, r.Set(ctx, "slot", "0/16B9F20"))
+	lsn, err = r.Get(ctx, "slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B9F20", lsn)
+	require.NoError(t, r.Close(ctx))
+
+	r = newReplicatedCheckpointer(unreachableCheckpointer{}, unreachableCheckpointer{}, "slot", time.Hour, logger)
+	_, err = r.Get(ctx, "slot")
+	require.Error(t, err)
+	require.NoError(t, r.Close(ctx))
+}
+
+func TestSecondaryCheckpointConfig(t *testing.T) {
+	store := &memoryCheckpointer{lsns: map[string]string{}}
+	RegisterCheckpointBackend("test_secondary", func(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error) {
+		return store, nil
+	})
+
+	spec := service.NewConfigSpec().Fields(checkpointConfigFields...)
+	conf, err := spec.ParseYAML(`
+backend: test_secondary
+secondary:
+  backend: test_secondary
+  key: dr_slot
+  sync_interval: 5s
+`, nil)
+	require.NoError(t, err)
+	c, err := newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "orders_slot", c.key)
+	require.NotNil(t, c.secondary)
+	assert.Equal(t, "dr_slot", c.secondary.key)
+	assert.Equal(t, 5*time.Second, c.syncInterval)
+
+	checkpointer, err := c.open()
+	require.NoError(t, err)
+	assert.IsType(t, &replicatedCheckpointer{}, checkpointer)
+	require.NoError(t, checkpointer.Close(context.Background()))
+}
@@ -0,0 +1,338 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+func init() {
+	RegisterCheckpointBackend("s3", newS3CheckpointerFromParsed)
+}
+
+var s3CheckpointConfigFields = []*service.ConfigField{
+	service.NewStringField("bucket").
+		Description("The bucket the checkpoint objects are stored in"),
+	service.NewStringField("prefix").
+		Description("The prefix of the checkpoint objects, which are named after their key").
+		Default("pg_stream/checkpoints/"),
+	service.NewStringField("region").
+		Description("The region of the bucket").
+		Default("us-east-1"),
+	service.NewStringField("endpoint").
+		Description("The endpoint of an S3 compatible store. Defaults to the AWS endpoint of the region").
+		Example("http://localhost:9000").
+		Default(""),
+	service.NewBoolField("force_path_style").
+		Description("Address the bucket in the path rather than the host name of requests, as most S3 compatible stores require").
+		Default(false),
+	service.NewStringField("access_key_id").
+		Description("The access key. Defaults to the `AWS_ACCESS_KEY_ID` environment variable").
+		Default(""),
+	service.NewStringField("secret_access_key").
+		Description("The secret key. Defaults to the `AWS_SECRET_ACCESS_KEY` environment variable").
+		Secret().
+		Default(""),
+	service.NewStringField("session_token").
+		Description("The session token of temporary credentials. Defaults to the `AWS_SESSION_TOKEN` environment variable").
+		Secret().
+		Default(""),
+	service.NewDurationField("timeout").
+		Description("The timeout of requests to the store").
+		Default("10s"),
+}
+
+// s3Checkpoint is the document stored in a checkpoint object.
+type s3Checkpoint struct {
+	LSN       string    `json:"lsn"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// errCheckpointFenced is returned when a checkpoint object was written by
+// another pipeline since it was last read or written.
+var errCheckpointFenced = errors.New("checkpoint object was written by another pipeline")
+
+// s3Checkpointer stores checkpoints in an object per key of an S3 bucket,
+// for deployments with no database or cache to keep state in. Objects are
+// written with conditional requests on the ETag last read or written, so a
+// pipeline that lost ownership of a key, such as a zombie left behind by a
+// failover, fails to overwrite the checkpoints of its successor.
+type s3Checkpointer struct {
+	bucketURL *url.URL
+	prefix    string
+	region    string
+	keyID     string
+	secret    string
+	token     string
+	client    *http.Client
+
+	mut sync.Mutex
+	// etags holds the ETag of the objects last read or written, an empty
+	// ETag marks an object that didn't exist.
+	etags map[string]string
+}
+
+func newS3CheckpointerFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error) {
+	if !conf.Contains("s3") {
+		return nil, errors.New("the s3 checkpoint backend requires the s3.bucket field")
+	}
+	conf = conf.Namespace("s3")
+
+	bucket, err := conf.FieldString("bucket")
+	if err != nil {
+		return nil, err
+	}
+	c := &s3Checkpointer{etags: map[string]string{}}
+	if c.prefix, err = conf.FieldString("prefix"); err != nil {
+		return nil, err
+	}
+	if c.region, err = conf.FieldString("region"); err != nil {
+		return nil, err
+	}
+	endpoint, err := conf.FieldString("endpoint")
+	if err != nil {
+		return nil, err
+	}
+	pathStyle, err := conf.FieldBool("force_path_style")
+	if err != nil {
+		return nil, err
+	}
+	if c.bucketURL, err = s3BucketURL(endpoint, c.region, bucket, pathStyle); err != nil {
+		return nil, err
+	}
+	if c.keyID, err = conf.FieldString("access_key_id"); err != nil {
+		return nil, err
+	}
+	if c.secret, err = conf.FieldString("secret_access_key"); err != nil {
+		return nil, err
+	}
+	if c.token, err = conf.FieldString("session_token"); err != nil {
+		return nil, err
+	}
+	if c.keyID == "" {
+		c.keyID, c.secret, c.token = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if c.keyID == "" || c.secret == "" {
+		return nil, errors.New("the s3 checkpoint backend requires credentials")
+	}
+	timeout, err := conf.FieldDuration("timeout")
+	if err != nil {
+		return nil, err
+	}
+	c.client = &http.Client{Timeout: timeout}
+	return c, nil
+}
+
+// s3BucketURL returns the URL of the bucket, whose object keys are appended
+// to its path.
+func s3BucketURL(endpoint, region, bucket string, pathStyle bool) (*url.URL, error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the s3 endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("the s3 endpoint %q must be an absolute URL", endpoint)
+	}
+	if pathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	return u, nil
+}
+
+func (c *s3Checkpointer) Set(ctx context.Context, key string, lsn string) error {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	etag, known := c.etags[key]
+	if !known {
+		// The first write is conditional on the object read now, so that
+		// writes racing with another pipeline are fenced as well.
+		if _, err := c.get(ctx, key); err != nil {
+			return err
+		}
+		etag = c.etags[key]
+	}
+
+	body, err := json.Marshal(s3Checkpoint{LSN: lsn, UpdatedAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+	resp, err := c.do(ctx, http.MethodPut, key, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		c.etags[key] = resp.Header.Get("ETag")
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// The ETag is kept so that every later write fails as well.
+		return fmt.Errorf("failed to store checkpoint %s: %w", key, errCheckpointFenced)
+	}
+	return s3Error(resp, "store", key)
+}
+
+func (c *s3Checkpointer) Get(ctx context.Context, key string) (string, error) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.get(ctx, key)
+}
+
+func (c *s3Checkpointer) get(ctx context.Context, key string) (string, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		c.etags[key] = ""
+		return "", nil
+	case http.StatusOK:
+	default:
+		return "", s3Error(resp, "read", key)
+	}
+
+	var checkpoint s3Checkpoint
+	if err := json.NewDecoder(resp.Body).Decode(&checkpoint); err != nil {
+		return "", fmt.Errorf("failed to read checkpoint %s: %w", key, err)
+	}
+	c.etags[key] = resp.Header.Get("ETag")
+	return checkpoint.LSN, nil
+}
+
+func (c *s3Checkpointer) Close(ctx context.Context) error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func s3Error(resp *http.Response, op, key string) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("failed to %s checkpoint %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(b)))
+}
+
+// do sends a request for the checkpoint object of the key, signed with
+// signature version 4.
+func (c *s3Checkpointer) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.bucketURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.prefix + key
+	u.RawPath = s3EscapePath(u.Path)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+	signS3Request(req, body, c.region, c.keyID, c.secret, time.Now())
+	return c.client.Do(req)
+}
+
+// signS3Request adds the signature version 4 authorization of the request,
+// signing all of its headers.
+func signS3Request(req *http.Request, body []byte, region, keyID, secret string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, signature))
+}
+
+// s3EscapePath escapes every byte of the path except the unreserved
+// characters and slashes, as signature version 4 requires.
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type memoryCheckpointer struct {
+	mut  sync.Mutex
+	lsns map[string]string
+}
+
+func (m *memoryCheckpointer) Set(ctx context.Context, key string, lsn string) error {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.lsns[key] = lsn
+	return nil
+}
+
+func (m *memoryCheckpointer) Get(ctx context.Context, key string) (string, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	return m.lsns[key], nil
+}
+
+func (m *memoryCheckpointer) Close(ctx context.Context) error {
+	return nil
+}
+
+// failingCheckpointer fails to store checkpoints while it is down.
+type failingCheckpointer struct {
+	memoryCheckpointer
+	down bool
+}
+
+func (f *failingCheckpointer) Set(ctx context.Context, key string, lsn string) error {
+	f.mut.Lock()
+	down := f.down
+	f.mut.Unlock()
+	if down {
+		return errors.New("checkpoint store unreachable")
+	}
+	return f.memoryCheckpointer.Set(ctx, key, lsn)
+}
+
+func (f *failingCheckpointer) setDown(down bool) {
+	f.mut.Lock()
+	f.down = down
+	f.mut.Unlock()
+}
+
+func TestCheckpointBackendRegistry(t *testing.T) {
+	var options map[string]string
+	store := &memoryCheckpointer{lsns: map[string]string{}}
+	RegisterCheckpointBackend("test_memory", func(conf *service.ParsedConfig, mgr *service.Resources) (Checkpointer, error) {
+		var err error
+		options, err = conf.FieldStringMap("options")
+		return store, err
+	})
+
+	spec := service.NewConfigSpec().Fields(checkpointConfigFields...)
+	conf, err := spec.ParseYAML(`
+backend: test_memory
+options:
+  region: eu
+`, nil)
+	require.NoError(t, err)
+	c, err := newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "orders_slot", c.key)
+
+	checkpointer, err := c.open()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"region": "eu"}, options)
+
+	// Acknowledged positions are stored before they are confirmed.
+	source, acks := newFakeSource(t, &pglogicalstream.FakeScript{})
+	checkpointing := &checkpointingSource{ReplicationSource: source, checkpointer: checkpointer, key: c.key}
+	checkpointing.AckLSN("0/16B3748")
+	assert.Equal(t, []string{"0/16B3748"}, acks.confirmed())
+	lsn, err := checkpointer.Get(context.Background(), "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "0/16B3748", lsn)
+
+	conf, err = spec.ParseYAML(`backend: nope`, nil)
+	require.NoError(t, err)
+	_, err = newCheckpointConfigFromParsed(conf, service.MockResources(), "orders_slot")
+	assert.ErrorContains(t, err, `unknown checkpoint backend "nope"`)
+}
+
+func TestCheckpointFailurePolicies(t *testing.T) {
+	ctx := context.Background()
+	newInput := func(policy checkpointFailurePolicy) (*pgStreamInput, *failingCheckpointer, *ackRecorder) {
+		store := &failingCheckpointer{memoryCheckpointer: memoryCheckpointer{lsns: map[string]string{}}}
+		source, acks := newFakeSource(t, &pglogicalstream.FakeScript{})
+		checkpointing := &checkpointingSource{
+			ReplicationSource: source,
+			checkpointer:      store,
+			key:               "orders_slot",
+			retryInterval:     time.Millisecond,
+		}
+		return &pgStreamInput{
+			checkpoint:    &checkpointConfig{key: "orders_slot", onFailure: policy, retryInterval: time.Millisecond},
+			checkpointing: checkpointing,
+			source:        checkpointing,
+		}, store, acks
+	}
+
+	t.Run("buffer", func(t *testing.T) {
+		p, store, acks := newInput(checkpointFailureBuffer)
+		store.setDown(true)
+		p.source.AckLSN("0/10")
+		p.source.AckLSN("0/20")
+
+		// Consumption continues while the positions are held back.
+		paused, err := p.checkCheckpoints(ctx)
+		require.NoError(t, err)
+		assert.False(t, paused)
+		assert.Empty(t, acks.confirmed())
+
+		// The latest position is stored and confirmed once the store recovers.
+		store.setDown(false)
+		time.Sleep(2 * time.Millisecond)
+		paused, err = p.checkCheckpoints(ctx)
+		require.NoError(t, err)
+		assert.False(t, paused)
+		assert.Equal(t, []string{"0/20"}, acks.confirmed())
+		lsn, err := store.Get(ctx, "orders_slot")
+		require.NoError(t, err)
+		assert.Equal(t, "0/20", lsn)
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		p, store, acks := newInput(checkpointFailurePause)
+		store.setDown(true)
+		p.source.AckLSN("0/10")
+
+		paused, err := p.checkCheckpoints(ctx)
+		require.NoError(t, err)
+		assert.True(t, paused)
+		assert.Empty(t, acks.confirmed())
+
+		store.setDown(false)
+		time.Sleep(2 * time.Millisecond)
+		paused, err = p.checkCheckpoints(ctx)
+		require.NoError(t, err)
+		assert.False(t, paused)
+		assert.Equal(t, []string{"0/10"}, acks.confirmed())
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		p, store, acks := newInput(checkpointFailureFail)
+		store.setDown(true)
+		p.source.AckLSN("0/10")
+
+		_, err := p.checkCheckpoints(ctx)
+		require.ErrorIs(t, err, service.ErrNotConnected)
+		assert.Empty(t, acks.confirmed())
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+
+	"github.com/OneOfOne/xxhash"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type checksumAlgorithm string
+
+const (
+	checksumNone     checksumAlgorithm = "none"
+	checksumXXHash64 checksumAlgorithm = "xxhash64"
+	checksumSHA256   checksumAlgorithm = "sha256"
+)
+
+// sum hashes the after-image of the changes, or the old keys of deletes which
+// have no after-image. Columns are hashed as a JSON object so the result
+// doesn't depend on the column order of the table.
+func (c checksumAlgorithm) sum(changes []pglogicalstream.Wal2JsonChange) string {
+	var h hash.Hash
+	switch c {
+	case checksumSHA256:
+		h = sha256.New()
+	default:
+		h = xxhash.New64()
+	}
+
+	for _, change := range changes {
+		names, values := change.ColumnNames, change.ColumnValues
+		if change.Kind == "delete" {
+			names, values = change.OldKeys.KeyNames, change.OldKeys.KeyValues
+		}
+		row := make(map[string]any, len(names))
+		for i, name := range names {
+			if i < len(values) {
+				row[name] = values[i]
+			}
+		}
+		// Column values are plain scalars so marshalling them can't fail.
+		b, _ := json.Marshal(row)
+		_, _ = h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
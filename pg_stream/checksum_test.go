@@ -0,0 +1,91 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestChecksum(t *testing.T) {
+	insert := pglogicalstream.Wal2JsonChange{
+		Kind:         "insert",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "status"},
+		ColumnValues: []any{1.0, "paid"},
+	}
+	reordered := pglogicalstream.Wal2JsonChange{
+		Kind:         "update",
+		Table:        "orders",
+		ColumnNames:  []string{"status", "id"},
+		ColumnValues: []any{"paid", 1.0},
+	}
+	deleteOf := func(id float64) pglogicalstream.Wal2JsonChange {
+		return pglogicalstream.Wal2JsonChange{
+			Kind:    "delete",
+			Table:   "orders",
+			OldKeys: pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyValues: []any{id}},
+		}
+	}
+
+	for _, algorithm := range []checksumAlgorithm{checksumXXHash64, checksumSHA256} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			sum := algorithm.sum([]pglogicalstream.Wal2JsonChange{insert})
+			assert.Equal(t, sum, algorithm.sum([]pglogicalstream.Wal2JsonChange{reordered}))
+			assert.NotEqual(t, sum, algorithm.sum([]pglogicalstream.Wal2JsonChange{deleteOf(1)}))
+
+			// Deletes of different rows don't share the hash of an empty row.
+			assert.NotEqual(t, algorithm.sum([]pglogicalstream.Wal2JsonChange{deleteOf(1)}), algorithm.sum([]pglogicalstream.Wal2JsonChange{deleteOf(2)}))
+			assert.Equal(t, algorithm.sum([]pglogicalstream.Wal2JsonChange{deleteOf(1)}), algorithm.sum([]pglogicalstream.Wal2JsonChange{deleteOf(1)}))
+		})
+	}
+	assert.Len(t, checksumXXHash64.sum(nil), 16)
+	assert.Len(t, checksumSHA256.sum(nil), 64)
+}
+
+func TestChecksumCoversUntrimmedRow(t *testing.T) {
+	update := pglogicalstream.Wal2JsonChange{
+		Kind:         "update",
+		Schema:       "public",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "status", "total"},
+		ColumnValues: []any{1.0, "shipped", 12.5},
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  []string{"id", "status", "total"},
+			KeyValues: []any{1.0, "paid", 12.5},
+		},
+	}
+	checksum := func(payload updatePayload) (string, []byte) {
+		p := &pgStreamInput{
+			checksum:      checksumXXHash64,
+			updatePayload: payload,
+			primaryKeys:   map[string][]string{"orders": {"id"}},
+		}
+		msg, err := p.newMessage(context.Background(), pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{update}})
+		require.NoError(t, err)
+		sum, _ := msg.MetaGet("checksum")
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		return sum, b
+	}
+
+	full, fullPayload := checksum(updatePayloadFull)
+	changed, changedPayload := checksum(updatePayloadChanged)
+	// The payload of the changed columns hashes the whole row, like the
+	// payload of the whole row does.
+	assert.NotEqual(t, string(fullPayload), string(changedPayload))
+	assert.NotContains(t, string(changedPayload), "12.5")
+	assert.Equal(t, full, changed)
+	assert.Equal(t, checksumXXHash64.sum([]pglogicalstream.Wal2JsonChange{update}), changed)
+}
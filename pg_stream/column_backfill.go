@@ -0,0 +1,249 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var columnBackfillConfigFields = []*service.ConfigField{
+	service.NewStringListField("tables").
+		Description("Tables whose added columns are backfilled. Empty means all the replicated tables").
+		Default([]string{}),
+	service.NewIntField("batch_size").
+		Description("The maximum number of rows read per backfill query").
+		Default(1000),
+	service.NewStringField("rate_limit").
+		Description("An optional rate limit resource to throttle the backfill queries").
+		Optional(),
+}
+
+// backfillJob reads the values of the columns added to a table for its
+// existing rows, paging through them by primary key.
+type backfillJob struct {
+	table      string
+	columns    []string
+	keyColumns []string
+	// after holds the key of the last row read, nil before the first batch.
+	after []any
+}
+
+// columnBackfill detects columns added to the replicated tables from the
+// streamed changes and emits their values for the rows that existed before,
+// whose events lack them.
+type columnBackfill struct {
+	tables    map[string]struct{}
+	batchSize int
+	rateLimit string
+	res       *service.Resources
+
+	// columns are the known columns of each table, extended with the added
+	// columns as they are detected.
+	columns map[string][]string
+	jobs    []*backfillJob
+
+	backfilled *service.MetricCounter
+}
+
+func newColumnBackfillFromParsed(conf *service.ParsedConfig, res *service.Resources) (b *columnBackfill, err error) {
+	b = &columnBackfill{
+		tables:     map[string]struct{}{},
+		res:        res,
+		backfilled: res.Metrics().NewCounter("pg_stream_backfilled_rows", "table"),
+	}
+
+	var tables []string
+	if tables, err = conf.FieldStringList("tables"); err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		b.tables[table] = struct{}{}
+	}
+	if b.batchSize, err = conf.FieldInt("batch_size"); err != nil {
+		return nil, err
+	}
+	if b.batchSize < 1 {
+		return nil, fmt.Errorf("column backfill batch_size must be at least 1, got %d", b.batchSize)
+	}
+	if conf.Contains("rate_limit") {
+		if b.rateLimit, err = conf.FieldString("rate_limit"); err != nil {
+			return nil, err
+		}
+		if !res.HasRateLimit(b.rateLimit) {
+			return nil, fmt.Errorf("rate limit resource %q doesn't exist", b.rateLimit)
+		}
+	}
+	return b, nil
+}
+
+// reset sets the known columns of the tables. Backfills that didn't complete
+// during a previous connection aren't resumed, as the columns are known by
+// now.
+func (b *columnBackfill) reset(columns map[string][]string) {
+	b.columns = columns
+	b.jobs = nil
+}
+
+func (b *columnBackfill) backfills(table string) bool {
+	if len(b.tables) == 0 {
+		return true
+	}
+	_, ok := b.tables[table]
+	return ok
+}
+
+// observe schedules a backfill of the columns of inserted and updated rows
+// that aren't known yet. Tables without a primary key can't be paged through
+// and are skipped.
+func (b *columnBackfill) observe(changes []pglogicalstream.Wal2JsonChange, primaryKeys map[string][]string) []*backfillJob {
+	var scheduled []*backfillJob
+	for _, change := range changes {
+		if change.Kind != "insert" && change.Kind != "update" {
+			continue
+		}
+		known, ok := b.columns[change.Table]
+		if !ok || !b.backfills(change.Table) {
+			continue
+		}
+		var added []string
+		for _, name := range change.ColumnNames {
+			if !slices.Contains(known, name) {
+				added = append(added, name)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		b.columns[change.Table] = append(known, added...)
+
+		keyColumns, ok := primaryKeys[change.Table]
+		if !ok {
+			continue
+		}
+		job := &backfillJob{table: change.Table, columns: added, keyColumns: keyColumns}
+		b.jobs = append(b.jobs, job)
+		scheduled = append(scheduled, job)
+	}
+	return scheduled
+}
+
+func (b *columnBackfill) pending() bool {
+	return len(b.jobs) > 0
+}
+
+// query returns the query of the next batch of rows of the job, which only
+// reads rows holding a value in one of the added columns.
+func (j *backfillJob) query(schema string, limit int) (string, []any) {
+	quotedKeys := make([]string, len(j.keyColumns))
+	for i, column := range j.keyColumns {
+		quotedKeys[i] = pq.QuoteIdentifier(column)
+	}
+	selected := slices.Clone(quotedKeys)
+	notNull := make([]string, len(j.columns))
+	for i, column := range j.columns {
+		selected = append(selected, pq.QuoteIdentifier(column))
+		notNull[i] = pq.QuoteIdentifier(column) + " IS NOT NULL"
+	}
+
+	conditions := []string{"(" + strings.Join(notNull, " OR ") + ")"}
+	var args []any
+	if j.after != nil {
+		placeholders := make([]string, len(j.after))
+		for i, v := range j.after {
+			args = append(args, keyValueString(v))
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s) > (%s)", strings.Join(quotedKeys, ", "), strings.Join(placeholders, ", ")))
+	}
+	return fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s ORDER BY %s LIMIT %d",
+		strings.Join(selected, ", "),
+		pq.QuoteIdentifier(schema), pq.QuoteIdentifier(j.table),
+		strings.Join(conditions, " AND "),
+		strings.Join(quotedKeys, ", "), limit), args
+}
+
+// backfillPatch is the payload of a backfill event, the values of the added
+// columns of a row identified by its primary key.
+type backfillPatch struct {
+	Schema  string         `json:"schema"`
+	Table   string         `json:"table"`
+	Key     map[string]any `json:"key"`
+	Columns map[string]any `json:"columns"`
+}
+
+// backfillBatch reads the next batch of rows of the first pending job and
+// returns their patch events. The job completes with the first short batch.
+func (p *pgStreamInput) backfillBatch(ctx context.Context) ([]*service.Message, error) {
+	b := p.backfill
+	job := b.jobs[0]
+	if err := waitForRateLimit(ctx, b.res, b.rateLimit); err != nil {
+		return nil, err
+	}
+
+	query, args := job.query(p.schema, b.batchSize)
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to backfill columns %v of %s: %w", job.columns, job.table, err)
+	}
+	defer rows.Close()
+
+	var msgs []*service.Message
+	for rows.Next() {
+		values := make([]any, len(job.keyColumns)+len(job.columns))
+		scanArgs := make([]any, len(values))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if raw, isBytes := v.([]byte); isBytes {
+				values[i] = string(raw)
+			}
+		}
+
+		patch := backfillPatch{Schema: p.schema, Table: job.table, Key: map[string]any{}, Columns: map[string]any{}}
+		for i, column := range job.keyColumns {
+			patch.Key[column] = values[i]
+		}
+		for i, column := range job.columns {
+			patch.Columns[column] = values[len(job.keyColumns)+i]
+		}
+		body, err := json.Marshal(patch)
+		if err != nil {
+			return nil, err
+		}
+		msg := service.NewMessage(body)
+		msg.MetaSetMut("event_type", "column_backfill")
+		msg.MetaSetMut("schema", p.schema)
+		msg.MetaSetMut("table", job.table)
+		msgs = append(msgs, msg)
+		job.after = values[:len(job.keyColumns)]
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	b.backfilled.Incr(int64(len(msgs)), job.table)
+
+	if len(msgs) < b.batchSize {
+		p.logger.Infof("Backfilled columns %v of table %s", job.columns, job.table)
+		b.jobs = b.jobs[1:]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestColumnBackfill(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(columnBackfillConfigFields...)
+	conf, err := spec.ParseYAML("batch_size: 500", nil)
+	require.NoError(t, err)
+	b, err := newColumnBackfillFromParsed(conf, service.MockResources())
+	require.NoError(t, err)
+	b.reset(map[string][]string{
+		"orders":    {"id", "status"},
+		"audit_log": {"message"},
+	})
+	primaryKeys := map[string][]string{"orders": {"tenant_id", "id"}}
+
+	change := func(kind, table string, columns ...string) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{Kind: kind, Table: table, ColumnNames: columns}}
+	}
+
+	assert.Empty(t, b.observe(change("insert", "orders", "id", "status"), primaryKeys))
+	// Deletes only hold the old keys.
+	assert.Empty(t, b.observe(change("delete", "orders", "id", "priority"), primaryKeys))
+
+	jobs := b.observe(change("update", "orders", "id", "status", "priority", "region"), primaryKeys)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, []string{"priority", "region"}, jobs[0].columns)
+	assert.True(t, b.pending())
+
+	// Added columns are backfilled once.
+	assert.Empty(t, b.observe(change("insert", "orders", "id", "status", "priority", "region"), primaryKeys))
+	// Tables without a primary key aren't backfilled.
+	assert.Empty(t, b.observe(change("insert", "audit_log", "message", "level"), primaryKeys))
+	assert.Len(t, b.jobs, 1)
+
+	query, args := jobs[0].query("public", 500)
+	assert.Equal(t, `SELECT "tenant_id", "id", "priority", "region" FROM "public"."orders" WHERE ("priority" IS NOT NULL OR "region" IS NOT NULL) ORDER BY "tenant_id", "id" LIMIT 500`, query)
+	assert.Empty(t, args)
+
+	jobs[0].after = []any{"acme", int64(42)}
+	query, args = jobs[0].query("public", 500)
+	assert.Equal(t, `SELECT "tenant_id", "id", "priority", "region" FROM "public"."orders" WHERE ("priority" IS NOT NULL OR "region" IS NOT NULL) AND ("tenant_id", "id") > ($1, $2) ORDER BY "tenant_id", "id" LIMIT 500`, query)
+	assert.Equal(t, []any{"acme", "42"}, args)
+
+	// Reconnecting drops the pending backfills.
+	b.reset(map[string][]string{"orders": {"id", "status", "priority", "region"}})
+	assert.False(t, b.pending())
+}
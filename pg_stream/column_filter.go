@@ -0,0 +1,89 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"reflect"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var columnFilterConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table the filter applies to").
+		Example("orders"),
+	service.NewStringListField("columns").
+		Description("Updates of the table are only emitted when one of these columns changed").
+		Example([]string{"status"}),
+}
+
+// columnChangeFilter skips updates that don't touch any of the subscribed
+// columns of a table. The before image is only complete for tables with
+// REPLICA IDENTITY FULL, when a subscribed column is missing from either image
+// the update is emitted, so that a misspelled column never drops updates.
+type columnChangeFilter struct {
+	tables map[string][]string
+}
+
+func newColumnChangeFilterFromParsed(confs []*service.ParsedConfig) (*columnChangeFilter, error) {
+	f := &columnChangeFilter{tables: map[string][]string{}}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		columns, err := conf.FieldStringList("columns")
+		if err != nil {
+			return nil, err
+		}
+		f.tables[table] = append(f.tables[table], columns...)
+	}
+	return f, nil
+}
+
+// matches returns false when every change is an update that left all the
+// subscribed columns of its table untouched.
+func (f *columnChangeFilter) matches(changes []pglogicalstream.Wal2JsonChange) bool {
+	for _, change := range changes {
+		if f.changeMatches(change) {
+			return true
+		}
+	}
+	return len(changes) == 0
+}
+
+func (f *columnChangeFilter) changeMatches(change pglogicalstream.Wal2JsonChange) bool {
+	columns, ok := f.tables[change.Table]
+	if !ok || change.Kind != "update" {
+		return true
+	}
+
+	for _, column := range columns {
+		after, ok := columnValue(change.ColumnNames, change.ColumnValues, column)
+		if !ok {
+			return true
+		}
+		before, ok := columnValue(change.OldKeys.KeyNames, change.OldKeys.KeyValues, column)
+		if !ok || !reflect.DeepEqual(before, after) {
+			return true
+		}
+	}
+	return false
+}
+
+func columnValue(names []string, values []interface{}, column string) (interface{}, bool) {
+	for i, name := range names {
+		if name == column && i < len(values) {
+			return values[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestColumnChangeFilter(t *testing.T) {
+	f := &columnChangeFilter{tables: map[string][]string{"orders": {"status"}}}
+
+	update := func(after, before []any, names ...string) pglogicalstream.Wal2JsonChange {
+		return pglogicalstream.Wal2JsonChange{
+			Kind:         "update",
+			Table:        "orders",
+			ColumnNames:  names,
+			ColumnValues: after,
+			OldKeys:      pglogicalstream.Wal2JsonOldKeys{KeyNames: names, KeyValues: before},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		change  pglogicalstream.Wal2JsonChange
+		matches bool
+	}{
+		{
+			name:    "subscribed column changed",
+			change:  update([]any{1.0, "shipped"}, []any{1.0, "paid"}, "id", "status"),
+			matches: true,
+		},
+		{
+			name:    "subscribed column unchanged",
+			change:  update([]any{1.0, "paid", 2.0}, []any{1.0, "paid", 1.0}, "id", "status", "total"),
+			matches: false,
+		},
+		{
+			name: "missing from the before image",
+			change: pglogicalstream.Wal2JsonChange{
+				Kind:         "update",
+				Table:        "orders",
+				ColumnNames:  []string{"id", "status"},
+				ColumnValues: []any{1.0, "paid"},
+				OldKeys:      pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyValues: []any{1.0}},
+			},
+			matches: true,
+		},
+		{
+			name:    "missing from the after image",
+			change:  update([]any{1.0, 2.0}, []any{1.0, 1.0}, "id", "total"),
+			matches: true,
+		},
+		{
+			name:    "insert",
+			change:  pglogicalstream.Wal2JsonChange{Kind: "insert", Table: "orders"},
+			matches: true,
+		},
+		{
+			name:    "other table",
+			change:  pglogicalstream.Wal2JsonChange{Kind: "update", Table: "payments"},
+			matches: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.matches, f.matches([]pglogicalstream.Wal2JsonChange{test.change}))
+		})
+	}
+
+	unchanged := update([]any{1.0, "paid"}, []any{1.0, "paid"}, "id", "status")
+	assert.True(t, f.matches([]pglogicalstream.Wal2JsonChange{unchanged, {Kind: "delete", Table: "orders"}}))
+	assert.True(t, f.matches(nil))
+}
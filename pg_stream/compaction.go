@@ -0,0 +1,207 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+const primaryKeysQuery = `
+SELECT c.relname, a.attname
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indrelid
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(i.indkey)
+WHERE i.indisprimary
+  AND ns.nspname = $1
+  AND c.relname = ANY($2)
+ORDER BY c.relname, array_position(i.indkey::int2[], a.attnum)`
+
+var compactionConfigFields = []*service.ConfigField{
+	service.NewDurationField("window").
+		Description("How long changes are held back to be collapsed with later changes of the same row").
+		Example("100ms"),
+}
+
+type compactionEntry struct {
+	changes  trackedChanges
+	key      string
+	deadline time.Time
+	dropped  bool
+}
+
+// changeCompactor holds changes back for a short window and collapses the
+// changes of a row within it into its latest state. Rows are identified by
+// their primary key, changes of tables without one are never collapsed.
+type changeCompactor struct {
+	window      time.Duration
+	primaryKeys map[string][]string
+
+	pending []*compactionEntry
+	byKey   map[string]*compactionEntry
+
+	compacted *service.MetricCounter
+}
+
+func newChangeCompactorFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (c *changeCompactor, err error) {
+	c = &changeCompactor{
+		byKey:     map[string]*compactionEntry{},
+		compacted: metrics.NewCounter("pg_stream_compacted_changes"),
+	}
+	if c.window, err = conf.FieldDuration("window"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func queryPrimaryKeys(ctx context.Context, db *sql.DB, schema string, tables []string) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, primaryKeysQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query primary keys: %w", err)
+	}
+	defer rows.Close()
+
+	primaryKeys := map[string][]string{}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		primaryKeys[table] = append(primaryKeys[table], column)
+	}
+	return primaryKeys, rows.Err()
+}
+
+// reset sets the primary keys of the replicated tables and discards the
+// changes held back from a previous connection, which haven't been
+// acknowledged and are therefore streamed again.
+func (c *changeCompactor) reset(primaryKeys map[string][]string) {
+	c.primaryKeys = primaryKeys
+	c.pending = nil
+	c.byKey = map[string]*compactionEntry{}
+}
+
+// add holds back the changes. It returns the sequence numbers of changes that
+// cancelled each other out, such as an insert followed by a delete, which
+// must be acknowledged without being emitted.
+func (c *changeCompactor) add(changes trackedChanges, now time.Time) (cancelled []uint64) {
+	if len(changes.Changes) != 1 {
+		c.pending = append(c.pending, &compactionEntry{changes: changes, deadline: now.Add(c.window)})
+		return nil
+	}
+
+	change := changes.Changes[0]
+	oldKey, newKey := c.keys(change)
+	existing := c.byKey[oldKey]
+	if oldKey == "" || existing == nil {
+		entry := &compactionEntry{changes: changes, key: newKey, deadline: now.Add(c.window)}
+		c.pending = append(c.pending, entry)
+		if newKey != "" {
+			c.byKey[newKey] = entry
+		}
+		return nil
+	}
+
+	c.compacted.Incr(1)
+	delete(c.byKey, oldKey)
+
+	prev := existing.changes.Changes[0]
+	merged := change
+	switch {
+	case prev.Kind == "insert" && change.Kind == "delete":
+		existing.dropped = true
+		return append(existing.changes.seqs(), changes.seq)
+	case prev.Kind == "insert":
+		merged.Kind = "insert"
+		merged.OldKeys = pglogicalstream.Wal2JsonOldKeys{}
+	case change.Kind == "update" || change.Kind == "insert":
+		// The before image is the one of the first change in the window.
+		merged.Kind = "update"
+		merged.OldKeys = prev.OldKeys
+	}
+
+	existing.changes.merged = existing.changes.seqs()
+	existing.changes.seq = changes.seq
+	existing.changes.Wal2JsonChanges = changes.Wal2JsonChanges
+	existing.changes.Changes = []pglogicalstream.Wal2JsonChange{merged}
+	existing.key = newKey
+	if newKey != "" && merged.Kind != "delete" {
+		c.byKey[newKey] = existing
+	}
+	return nil
+}
+
+// flush returns the changes whose window elapsed, in the order they were
+// first received.
+func (c *changeCompactor) flush(now time.Time) (ready []trackedChanges) {
+	for len(c.pending) > 0 {
+		entry := c.pending[0]
+		if entry.dropped {
+			c.pending = c.pending[1:]
+			continue
+		}
+		if entry.deadline.After(now) {
+			break
+		}
+		c.pending = c.pending[1:]
+		if entry.key != "" && c.byKey[entry.key] == entry {
+			delete(c.byKey, entry.key)
+		}
+		ready = append(ready, entry.changes)
+	}
+	return ready
+}
+
+// nextDeadline returns when the oldest held back changes are due.
+func (c *changeCompactor) nextDeadline() (time.Time, bool) {
+	for _, entry := range c.pending {
+		if !entry.dropped {
+			return entry.deadline, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// keys returns the key of the row before and after the change. The before key
+// is taken from the old keys of updates and deletes so that changes of the
+// primary key are followed.
+func (c *changeCompactor) keys(change pglogicalstream.Wal2JsonChange) (oldKey, newKey string) {
+	columns, ok := c.primaryKeys[change.Table]
+	if !ok {
+		return "", ""
+	}
+	newKey = rowKey(change.Table, columns, change.ColumnNames, change.ColumnValues)
+	oldKey = newKey
+	if len(change.OldKeys.KeyNames) > 0 {
+		oldKey = rowKey(change.Table, columns, change.OldKeys.KeyNames, change.OldKeys.KeyValues)
+	}
+	return oldKey, newKey
+}
+
+func rowKey(table string, columns, names []string, values []interface{}) string {
+	var b strings.Builder
+	b.WriteString(table)
+	for _, column := range columns {
+		v, ok := columnValue(names, values, column)
+		if !ok {
+			return ""
+		}
+		fmt.Fprintf(&b, "\x00%v", v)
+	}
+	return b.String()
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestChangeCompactor(t *testing.T) {
+	c := &changeCompactor{
+		window:      time.Second,
+		primaryKeys: map[string][]string{"users": {"id"}},
+		byKey:       map[string]*compactionEntry{},
+		compacted:   service.MockResources().Metrics().NewCounter("compacted"),
+	}
+
+	seq := uint64(0)
+	change := func(kind string, id float64, name string) trackedChanges {
+		seq++
+		change := pglogicalstream.Wal2JsonChange{
+			Kind:         kind,
+			Table:        "users",
+			ColumnNames:  []string{"id", "name"},
+			ColumnValues: []interface{}{id, name},
+		}
+		if kind != "insert" {
+			change.OldKeys = pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyValues: []interface{}{id}}
+		}
+		return trackedChanges{
+			Wal2JsonChanges: pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{change}},
+			seq:             seq,
+		}
+	}
+
+	now := time.Now()
+	assert.Empty(t, c.add(change("insert", 1, "a"), now))
+	assert.Empty(t, c.add(change("update", 1, "b"), now))
+	assert.Empty(t, c.add(change("update", 2, "x"), now))
+	assert.Empty(t, c.add(change("delete", 2, ""), now))
+	assert.Empty(t, c.add(change("insert", 3, "c"), now))
+	assert.Equal(t, []uint64{5, 6}, c.add(change("delete", 3, ""), now))
+
+	assert.Empty(t, c.flush(now))
+	ready := c.flush(now.Add(time.Second))
+	require.Len(t, ready, 2)
+
+	assert.Equal(t, "insert", ready[0].Changes[0].Kind)
+	assert.Equal(t, []interface{}{float64(1), "b"}, ready[0].Changes[0].ColumnValues)
+	assert.Equal(t, []uint64{1, 2}, ready[0].seqs())
+
+	assert.Equal(t, "delete", ready[1].Changes[0].Kind)
+	assert.Equal(t, []uint64{3, 4}, ready[1].seqs())
+
+	_, ok := c.nextDeadline()
+	assert.False(t, ok)
+}
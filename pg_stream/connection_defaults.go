@@ -0,0 +1,118 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jackc/pgpassfile"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// libpqEnv holds the connection settings of the libpq environment variables.
+type libpqEnv struct {
+	host     string
+	port     string
+	user     string
+	password string
+	database string
+	sslMode  string
+	passFile string
+}
+
+func readLibpqEnv(getenv func(string) string) libpqEnv {
+	return libpqEnv{
+		host:     getenv("PGHOST"),
+		port:     getenv("PGPORT"),
+		user:     getenv("PGUSER"),
+		password: getenv("PGPASSWORD"),
+		database: getenv("PGDATABASE"),
+		sslMode:  getenv("PGSSLMODE"),
+		passFile: getenv("PGPASSFILE"),
+	}
+}
+
+// fill sets the connection settings left empty in the config from the
+// environment.
+func (e libpqEnv) fill(c *pgconn.Config, tlsSetting *string) error {
+	if c.Host == "" {
+		c.Host = e.host
+	}
+	if c.Port == 0 && e.port != "" {
+		port, err := strconv.ParseUint(e.port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid PGPORT %q: %w", e.port, err)
+		}
+		c.Port = uint16(port)
+	}
+	if c.User == "" {
+		c.User = e.user
+	}
+	if c.Database == "" {
+		c.Database = e.database
+	}
+	if *tlsSetting == "" && e.sslMode != "" {
+		switch e.sslMode {
+		case "disable", "allow", "prefer":
+			*tlsSetting = "none"
+		case "require", "verify-ca", "verify-full":
+			*tlsSetting = "require"
+		default:
+			return fmt.Errorf("invalid PGSSLMODE %q", e.sslMode)
+		}
+	}
+	if c.Password == "" {
+		c.Password = e.password
+	}
+	return nil
+}
+
+// defaultPassfile returns the path of the password file libpq reads when
+// PGPASSFILE isn't set.
+func defaultPassfile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".pgpass")
+}
+
+// lookupPassfile returns the password of the first entry of a .pgpass file
+// matching the connection, or an empty string. A missing file isn't an error,
+// like for libpq.
+func lookupPassfile(path string, c *pgconn.Config) (string, error) {
+	passfile, err := pgpassfile.ReadPassfile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file %s: %w", path, err)
+	}
+	return passfile.FindPassword(c.Host, strconv.Itoa(int(c.Port)), c.Database, c.User), nil
+}
+
+// checkConnectionFields reports the connection fields that are required but
+// weren't set by either the config or the environment.
+func checkConnectionFields(c *pgconn.Config) error {
+	var missing []error
+	for _, f := range []struct{ field, value, env string }{
+		{"host", c.Host, "PGHOST"},
+		{"user", c.User, "PGUSER"},
+		{"database", c.Database, "PGDATABASE"},
+	} {
+		if f.value == "" {
+			missing = append(missing, fmt.Errorf("field %s is required, or %s with connection_defaults_from_env", f.field, f.env))
+		}
+	}
+	return errors.Join(missing...)
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getenvFrom(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestLibpqEnvFillsEmptyFields(t *testing.T) {
+	env := readLibpqEnv(getenvFrom(map[string]string{
+		"PGHOST":     "db.internal",
+		"PGPORT":     "6432",
+		"PGUSER":     "ignored",
+		"PGDATABASE": "shop",
+		"PGSSLMODE":  "verify-full",
+		"PGPASSWORD": "secret",
+	}))
+
+	c := pgconn.Config{User: "replicator"}
+	tlsSetting := ""
+	require.NoError(t, env.fill(&c, &tlsSetting))
+	assert.Equal(t, "db.internal", c.Host)
+	assert.Equal(t, uint16(6432), c.Port)
+	assert.Equal(t, "replicator", c.User)
+	assert.Equal(t, "shop", c.Database)
+	assert.Equal(t, "secret", c.Password)
+	assert.Equal(t, "require", tlsSetting)
+	assert.NoError(t, checkConnectionFields(&c))
+
+	// Settings of the config take precedence.
+	c = pgconn.Config{Host: "other", Port: 5432, Password: "inline"}
+	tlsSetting = "none"
+	require.NoError(t, env.fill(&c, &tlsSetting))
+	assert.Equal(t, "other", c.Host)
+	assert.Equal(t, uint16(5432), c.Port)
+	assert.Equal(t, "inline", c.Password)
+	assert.Equal(t, "none", tlsSetting)
+
+	err := readLibpqEnv(getenvFrom(map[string]string{"PGSSLMODE": "sometimes"})).fill(&c, new(string))
+	assert.Error(t, err)
+}
+
+func TestLookupPassfile(t *testing.T) {
+	passFile := filepath.Join(t.TempDir(), "pgpass")
+	require.NoError(t, os.WriteFile(passFile, []byte("# comment\ndb.internal:6432:shop:*:secret\n*:*:*:admin:fallback\n"), 0o600))
+
+	password, err := lookupPassfile(passFile, &pgconn.Config{Host: "db.internal", Port: 6432, Database: "shop", User: "replicator"})
+	require.NoError(t, err)
+	assert.Equal(t, "secret", password)
+
+	password, err = lookupPassfile(passFile, &pgconn.Config{Host: "other", Port: 5432, Database: "shop", User: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, "fallback", password)
+
+	password, err = lookupPassfile(passFile, &pgconn.Config{Host: "other", Port: 5432, Database: "shop", User: "replicator"})
+	require.NoError(t, err)
+	assert.Empty(t, password)
+
+	password, err = lookupPassfile(filepath.Join(t.TempDir(), "missing"), &pgconn.Config{})
+	require.NoError(t, err)
+	assert.Empty(t, password)
+}
+
+func TestCheckConnectionFields(t *testing.T) {
+	err := checkConnectionFields(&pgconn.Config{Host: "db.internal"})
+	assert.ErrorContains(t, err, "field user is required")
+	assert.ErrorContains(t, err, "field database is required")
+	assert.NotContains(t, err.Error(), "field host")
+}
@@ -0,0 +1,101 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// dialing holds the settings of how database connections are dialed.
+type dialing struct {
+	dns   *dnsResolution
+	proxy *proxyDialer
+}
+
+// lookupFunc returns the function resolving the host of the replication
+// connection, or nil for the default resolver.
+func (d dialing) lookupFunc() pgconn.LookupFunc {
+	switch {
+	case d.proxy != nil:
+		return d.proxy.lookupHost
+	case d.dns != nil:
+		return d.dns.lookupHost
+	}
+	return nil
+}
+
+// dialFunc returns the function dialing the replication connection, or nil
+// for the default dialer.
+func (d dialing) dialFunc() pgconn.DialFunc {
+	if d.proxy != nil {
+		return d.proxy.DialContext
+	}
+	return nil
+}
+
+// openSQL opens a regular (non replication) connection pool to the source
+// database for catalog queries and lookups.
+func openSQL(dbConfig pgconn.Config, d dialing) (*sql.DB, error) {
+	return openPool(sqlConnString(dbConfig), d)
+}
+
+// openPool opens a connection pool, which dials through the proxy or resolves
+// the host on every dial when configured.
+func openPool(connStr string, d dialing) (*sql.DB, error) {
+	if d.dns == nil && d.proxy == nil {
+		return sql.Open("postgres", connStr)
+	}
+
+	connector, err := pq.NewConnector(connStr)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxy != nil {
+		connector.Dialer(d.proxy)
+	} else {
+		connector.Dialer(resolvingDialer{dialer: net.Dialer{Resolver: d.dns.resolver}})
+	}
+	db := sql.OpenDB(connector)
+	if d.dns != nil {
+		db.SetConnMaxLifetime(d.dns.ttl)
+	}
+	return db, nil
+}
+
+func sqlConnString(dbConfig pgconn.Config) string {
+	sslMode := "disable"
+	if dbConfig.TLSConfig != nil {
+		sslMode = "require"
+	}
+
+	connStr := fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=%s",
+		quoteConnValue(dbConfig.User),
+		quoteConnValue(dbConfig.Password),
+		quoteConnValue(dbConfig.Host),
+		dbConfig.Port,
+		quoteConnValue(dbConfig.Database),
+		sslMode,
+	)
+	if name := dbConfig.RuntimeParams["application_name"]; name != "" {
+		connStr += " application_name=" + quoteConnValue(name)
+	}
+	return connStr
+}
+
+func quoteConnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var deadLetterConfigFields = []*service.ConfigField{
+	service.NewStringMapField("routes").
+		Description("The dead-letter route of each table, keyed by table name").
+		Example(map[string]string{"orders": "orders_dlq", "payments": "payments_dlq"}).
+		Default(map[string]any{}),
+	service.NewStringField("default_route").
+		Description("The dead-letter route of tables without an entry in `routes`. Left empty, the `dead_letter_route` metadata field isn't set for those tables").
+		Default(""),
+}
+
+// deadLetterRouter resolves the dead-letter route of the source table of
+// events that failed a check, so that an error output can fan out failures
+// by table.
+type deadLetterRouter struct {
+	routes       map[string]string
+	defaultRoute string
+}
+
+func newDeadLetterRouterFromParsed(conf *service.ParsedConfig) (r *deadLetterRouter, err error) {
+	r = &deadLetterRouter{}
+	if r.routes, err = conf.FieldStringMap("routes"); err != nil {
+		return nil, err
+	}
+	if r.defaultRoute, err = conf.FieldString("default_route"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *deadLetterRouter) route(table string) string {
+	if route, ok := r.routes[table]; ok {
+		return route
+	}
+	return r.defaultRoute
+}
+
+// markDeadLetter flags the message for a dead-letter output with the reason
+// it failed and, when configured, the route of its source table.
+func (p *pgStreamInput) markDeadLetter(msg *service.Message, changes []pglogicalstream.Wal2JsonChange, reason string) {
+	msg.MetaSetMut("dead_letter_reason", reason)
+	if p.deadLetter == nil || len(changes) == 0 {
+		return
+	}
+	if route := p.deadLetter.route(changes[0].Table); route != "" {
+		msg.MetaSetMut("dead_letter_route", route)
+	}
+}
+
+// markInvalid flags a message that failed a validation rule for a dead-letter
+// output.
+func (p *pgStreamInput) markInvalid(msg *service.Message, changes []pglogicalstream.Wal2JsonChange, reason string) {
+	p.markDeadLetter(msg, changes, "validation")
+	msg.MetaSetMut("validation_error", reason)
+}
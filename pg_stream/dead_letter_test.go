@@ -0,0 +1,73 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestDeadLetterRoutes(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders, payments ]
+slot_guard: false
+validation_rules:
+  - table: orders
+    column: id
+    not_null: true
+  - table: payments
+    column: id
+    not_null: true
+dead_letter:
+  routes:
+    orders: orders_dlq
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+	require.NotNil(t, input.deadLetter)
+
+	script := &pglogicalstream.FakeScript{Transactions: []string{
+		`{"change":[{"kind":"insert","schema":"public","table":"orders","columnnames":["id"],"columntypes":["integer"],"columnvalues":[null]}]}`,
+		`{"change":[{"kind":"insert","schema":"public","table":"payments","columnnames":["id"],"columntypes":["integer"],"columnvalues":[null]}]}`,
+	}}
+	input.newSource = script.Source
+
+	ctx := context.Background()
+	require.NoError(t, input.Connect(ctx))
+	t.Cleanup(func() { _ = input.Close(ctx) })
+
+	msg, ack, err := input.Read(ctx)
+	require.NoError(t, err)
+	reason, _ := msg.MetaGetMut("dead_letter_reason")
+	assert.Equal(t, "validation", reason)
+	route, _ := msg.MetaGetMut("dead_letter_route")
+	assert.Equal(t, "orders_dlq", route)
+	require.NoError(t, ack(ctx, nil))
+
+	// Tables without a route and no default route aren't routed.
+	msg, ack, err = input.Read(ctx)
+	require.NoError(t, err)
+	reason, _ = msg.MetaGetMut("dead_letter_reason")
+	assert.Equal(t, "validation", reason)
+	_, routed := msg.MetaGetMut("dead_letter_route")
+	assert.False(t, routed)
+	require.NoError(t, ack(ctx, nil))
+}
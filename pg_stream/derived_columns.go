@@ -0,0 +1,110 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"slices"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// derivedColumnType is reported as the column type of derived columns.
+const derivedColumnType = "derived"
+
+var derivedColumnConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table the column is added to").
+		Example("users"),
+	service.NewStringField("column").
+		Description("Name of the derived column").
+		Example("full_name"),
+	service.NewBloblangField("mapping").
+		Description("Bloblang mapping executed against the row as an object of column names to values. The result becomes the value of the column").
+		Example(`root = this.first_name + " " + this.last_name`).
+		Example(`root = this.created_at.ts_parse("2006-01-02 15:04:05").ts_format("2006-01-02")`),
+}
+
+type derivedColumn struct {
+	name    string
+	mapping *bloblang.Executor
+}
+
+// derivedColumns appends columns computed with Bloblang to inserted and
+// updated rows.
+type derivedColumns struct {
+	tables map[string][]derivedColumn
+	logger *service.Logger
+}
+
+func newDerivedColumnsFromParsed(confs []*service.ParsedConfig, logger *service.Logger) (*derivedColumns, error) {
+	d := &derivedColumns{
+		tables: map[string][]derivedColumn{},
+		logger: logger,
+	}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		column, err := conf.FieldString("column")
+		if err != nil {
+			return nil, err
+		}
+		mapping, err := conf.FieldBloblang("mapping")
+		if err != nil {
+			return nil, err
+		}
+		d.tables[table] = append(d.tables[table], derivedColumn{name: column, mapping: mapping})
+	}
+	return d, nil
+}
+
+// apply adds the derived columns to the changes. A mapping that fails sets
+// the column to null rather than holding back the stream.
+func (d *derivedColumns) apply(changes []pglogicalstream.Wal2JsonChange) {
+	for i := range changes {
+		change := &changes[i]
+		columns, ok := d.tables[change.Table]
+		if !ok || change.Kind == "delete" {
+			continue
+		}
+
+		row := make(map[string]any, len(change.ColumnNames))
+		for j, name := range change.ColumnNames {
+			if j < len(change.ColumnValues) {
+				row[name] = change.ColumnValues[j]
+			}
+		}
+
+		// Column name and type slices can be shared between rows, so they
+		// are clipped to force a copy on append.
+		change.ColumnNames = slices.Clip(change.ColumnNames)
+		change.ColumnValues = slices.Clip(change.ColumnValues)
+		hasTypes := len(change.ColumnTypes) > 0
+		if hasTypes {
+			change.ColumnTypes = slices.Clip(change.ColumnTypes)
+		}
+
+		for _, column := range columns {
+			value, err := column.mapping.Query(row)
+			if err != nil {
+				d.logger.Errorf("Failed to compute derived column %s of table %s: %v", column.name, change.Table, err)
+				value = nil
+			}
+			change.ColumnNames = append(change.ColumnNames, column.name)
+			change.ColumnValues = append(change.ColumnValues, value)
+			if hasTypes {
+				change.ColumnTypes = append(change.ColumnTypes, derivedColumnType)
+			}
+		}
+	}
+}
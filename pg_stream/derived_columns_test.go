@@ -0,0 +1,44 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/bloblang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestDerivedColumnsDoNotShareColumnNames(t *testing.T) {
+	mapping, err := bloblang.Parse(`root = this.first + " " + this.last`)
+	require.NoError(t, err)
+
+	d := &derivedColumns{tables: map[string][]derivedColumn{
+		"users": {{name: "full_name", mapping: mapping}},
+	}}
+
+	// Snapshot rows of a batch share the column names slice.
+	names := make([]string, 2, 4)
+	copy(names, []string{"first", "last"})
+	changes := []pglogicalstream.Wal2JsonChange{
+		{Kind: "insert", Table: "users", ColumnNames: names, ColumnValues: []interface{}{"Ada", "Lovelace"}},
+		{Kind: "insert", Table: "users", ColumnNames: names, ColumnValues: []interface{}{"Alan", "Turing"}},
+		{Kind: "delete", Table: "users", ColumnNames: names, ColumnValues: []interface{}{"Grace", "Hopper"}},
+	}
+	d.apply(changes)
+
+	assert.Equal(t, []string{"first", "last", "full_name"}, changes[0].ColumnNames)
+	assert.Equal(t, []interface{}{"Ada", "Lovelace", "Ada Lovelace"}, changes[0].ColumnValues)
+	assert.Equal(t, []interface{}{"Alan", "Turing", "Alan Turing"}, changes[1].ColumnValues)
+	assert.Equal(t, []string{"first", "last"}, changes[2].ColumnNames)
+	assert.Equal(t, []string{"first", "last"}, names)
+}
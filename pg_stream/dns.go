@@ -0,0 +1,82 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var dnsConfigFields = []*service.ConfigField{
+	service.NewDurationField("ttl").
+		Description("The maximum lifetime of pooled SQL connections, after which they are dialed again and follow the host to its new address. Set to `0s` to keep pooled connections open").
+		Default("0s"),
+}
+
+// dnsResolution resolves the database host on every dial, bypassing resolver
+// caches of the operating system, so that connections follow failovers that
+// move the host to a new address.
+type dnsResolution struct {
+	ttl      time.Duration
+	resolver *net.Resolver
+
+	addrs []string
+}
+
+func newDNSResolutionFromParsed(conf *service.ParsedConfig) (d *dnsResolution, err error) {
+	d = &dnsResolution{resolver: &net.Resolver{PreferGo: true}}
+	if d.ttl, err = conf.FieldDuration("ttl"); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// lookupHost is the lookup function of the replication connection.
+func (d *dnsResolution) lookupHost(ctx context.Context, host string) ([]string, error) {
+	return d.resolver.LookupHost(ctx, host)
+}
+
+// refresh resolves the host when connecting and logs when its addresses
+// changed since the previous connection.
+func (d *dnsResolution) refresh(ctx context.Context, host string, logger *service.Logger) {
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		logger.Warnf("Failed to resolve database host %s: %v", host, err)
+		return
+	}
+	sort.Strings(addrs)
+	if d.addrs != nil && !slices.Equal(d.addrs, addrs) {
+		logger.Infof("Database host %s moved from %v to %v", host, d.addrs, addrs)
+	}
+	d.addrs = addrs
+}
+
+// resolvingDialer dials SQL connections with a fresh resolution of the host.
+type resolvingDialer struct {
+	dialer net.Dialer
+}
+
+func (d resolvingDialer) Dial(network, address string) (net.Conn, error) {
+	return d.dialer.Dial(network, address)
+}
+
+func (d resolvingDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	dialer := d.dialer
+	dialer.Timeout = timeout
+	return dialer.Dial(network, address)
+}
+
+func (d resolvingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, network, address)
+}
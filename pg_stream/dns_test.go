@@ -0,0 +1,67 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSResolution(t *testing.T) {
+	conf, err := service.NewConfigSpec().Fields(dnsConfigFields...).ParseYAML(`ttl: 1m`, nil)
+	require.NoError(t, err)
+	d, err := newDNSResolutionFromParsed(conf)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, d.ttl)
+
+	ctx := context.Background()
+	addrs, err := d.lookupHost(ctx, "localhost")
+	require.NoError(t, err)
+	assert.NotEmpty(t, addrs)
+
+	logger := service.MockResources().Logger()
+	d.refresh(ctx, "localhost", logger)
+	assert.ElementsMatch(t, addrs, d.addrs)
+	assert.IsNonDecreasing(t, d.addrs)
+
+	// Failed resolutions keep the previous addresses.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	d.refresh(cancelled, "localhost", logger)
+	assert.ElementsMatch(t, addrs, d.addrs)
+}
+
+func TestResolvingDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	var d resolvingDialer
+	conn, err := d.DialContext(context.Background(), "tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_ = conn.Close()
+	conn, err = d.DialTimeout("tcp", ln.Addr().String(), time.Second)
+	require.NoError(t, err)
+	_ = conn.Close()
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+const tableStatsQuery = `
+SELECT c.relname, GREATEST(c.reltuples, 0)::bigint, pg_table_size(c.oid)
+FROM pg_class c
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+WHERE ns.nspname = $1
+  AND c.relname = ANY($2)`
+
+var dryRunConfigFields = []*service.ConfigField{
+	service.NewIntField("snapshot_rows_per_second").
+		Description("The snapshot throughput assumed to estimate the duration of the snapshot").
+		Default(10000),
+}
+
+type dryRunMode struct {
+	snapshotRowsPerSecond int
+}
+
+func newDryRunModeFromParsed(conf *service.ParsedConfig) (d *dryRunMode, err error) {
+	d = &dryRunMode{}
+	if d.snapshotRowsPerSecond, err = conf.FieldInt("snapshot_rows_per_second"); err != nil {
+		return nil, err
+	}
+	if d.snapshotRowsPerSecond < 1 {
+		return nil, fmt.Errorf("snapshot_rows_per_second must be at least 1, got %d", d.snapshotRowsPerSecond)
+	}
+	return d, nil
+}
+
+type dryRunTable struct {
+	Name          string   `json:"name"`
+	Columns       []string `json:"columns"`
+	PrimaryKey    []string `json:"primary_key"`
+	EstimatedRows int64    `json:"estimated_rows"`
+	Bytes         int64    `json:"bytes"`
+}
+
+// dryRunReport describes what the input would stream with its configuration.
+type dryRunReport struct {
+	Schema     string        `json:"schema"`
+	Slot       string        `json:"slot"`
+	SlotExists bool          `json:"slot_exists"`
+	WalLevel   string        `json:"wal_level"`
+	Tables     []dryRunTable `json:"tables"`
+	// Snapshot is true when a snapshot would be taken, which only happens
+	// when the slot is created.
+	Snapshot                  bool   `json:"snapshot"`
+	SnapshotRows              int64  `json:"snapshot_rows"`
+	SnapshotBytes             int64  `json:"snapshot_bytes"`
+	EstimatedSnapshotDuration string `json:"estimated_snapshot_duration"`
+	// Problems are the settings that would prevent the input from streaming.
+	Problems []string `json:"problems"`
+}
+
+// report inspects the server without creating a slot or a publication.
+func (d *dryRunMode) report(ctx context.Context, p *pgStreamInput) (*dryRunReport, error) {
+	r := &dryRunReport{
+		Schema:   p.schema,
+		Slot:     fmt.Sprintf("rs_%s", p.slotName),
+		Problems: []string{},
+	}
+
+	if err := p.db.QueryRowContext(ctx, "SHOW wal_level").Scan(&r.WalLevel); err != nil {
+		return nil, fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	if r.WalLevel != "logical" {
+		r.Problems = append(r.Problems, fmt.Sprintf("wal_level is %s but logical replication requires wal_level = logical", r.WalLevel))
+	}
+
+	var slotType, plugin string
+	err := p.db.QueryRowContext(ctx, "SELECT slot_type, COALESCE(plugin, '') FROM pg_replication_slots WHERE slot_name = $1", r.Slot).Scan(&slotType, &plugin)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		r.Snapshot = p.streamSnapshot
+	case err != nil:
+		return nil, fmt.Errorf("failed to query replication slot: %w", err)
+	default:
+		r.SlotExists = true
+		if slotType != "logical" || plugin != "wal2json" {
+			r.Problems = append(r.Problems, fmt.Sprintf("replication slot %s is a %s slot using the %q output plugin, a logical wal2json slot is required", r.Slot, slotType, plugin))
+		}
+	}
+
+	columns, err := queryTableColumns(ctx, p.db, p.schema, p.tables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table columns: %w", err)
+	}
+	primaryKeys, err := queryPrimaryKeys(ctx, p.db, p.schema, p.tables)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := queryTableStats(ctx, p.db, p.schema, p.tables)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range p.tables {
+		if _, ok := columns[table]; !ok {
+			r.Problems = append(r.Problems, fmt.Sprintf("table %s.%s doesn't exist", p.schema, table))
+			continue
+		}
+		if r.Snapshot && p.snapshotOrder == pglogicalstream.SnapshotOrderPrimaryKey && len(primaryKeys[table]) == 0 {
+			r.Problems = append(r.Problems, fmt.Sprintf("table %s.%s has no primary key to order its snapshot by", p.schema, table))
+		}
+		t := dryRunTable{
+			Name:          table,
+			Columns:       columns[table],
+			PrimaryKey:    primaryKeys[table],
+			EstimatedRows: stats[table].rows,
+			Bytes:         stats[table].bytes,
+		}
+		r.Tables = append(r.Tables, t)
+		if r.Snapshot {
+			r.SnapshotRows += t.EstimatedRows
+			r.SnapshotBytes += t.Bytes
+		}
+	}
+	r.EstimatedSnapshotDuration = (time.Duration(r.SnapshotRows) * time.Second / time.Duration(d.snapshotRowsPerSecond)).String()
+	return r, nil
+}
+
+type tableStats struct {
+	rows  int64
+	bytes int64
+}
+
+func queryTableStats(ctx context.Context, db *sql.DB, schema string, tables []string) (map[string]tableStats, error) {
+	rows, err := db.QueryContext(ctx, tableStatsQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	stats := map[string]tableStats{}
+	for rows.Next() {
+		var table string
+		var s tableStats
+		if err := rows.Scan(&table, &s.rows, &s.bytes); err != nil {
+			return nil, err
+		}
+		stats[table] = s
+	}
+	return stats, rows.Err()
+}
+
+func (r *dryRunReport) message() (*service.Message, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "dry_run")
+	return msg, nil
+}
+
+// runDryRun queues the report of the dry run, after which the input ends.
+func (p *pgStreamInput) runDryRun(ctx context.Context) error {
+	report, err := p.dryRun.report(ctx, p)
+	if err != nil {
+		return err
+	}
+	p.logger.Infof("Dry run would stream %d tables of schema %s from slot %s, snapshot of %d rows estimated to take %s, problems: %v",
+		len(report.Tables), report.Schema, report.Slot, report.SnapshotRows, report.EstimatedSnapshotDuration, report.Problems)
+
+	msg, err := report.message()
+	if err != nil {
+		return err
+	}
+	p.controlMessages = append(p.controlMessages, msg)
+	return nil
+}
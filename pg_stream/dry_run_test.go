@@ -0,0 +1,65 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunMode(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(dryRunConfigFields...)
+
+	conf, err := spec.ParseYAML(`{}`, nil)
+	require.NoError(t, err)
+	d, err := newDryRunModeFromParsed(conf)
+	require.NoError(t, err)
+	assert.Equal(t, 10000, d.snapshotRowsPerSecond)
+
+	conf, err = spec.ParseYAML(`snapshot_rows_per_second: 0`, nil)
+	require.NoError(t, err)
+	_, err = newDryRunModeFromParsed(conf)
+	assert.Error(t, err)
+}
+
+func TestDryRunReportMessage(t *testing.T) {
+	r := &dryRunReport{
+		Schema:                    "public",
+		Slot:                      "rs_shop",
+		WalLevel:                  "replica",
+		Tables:                    []dryRunTable{{Name: "orders", Columns: []string{"id", "total"}, PrimaryKey: []string{"id"}, EstimatedRows: 1000, Bytes: 65536}},
+		Snapshot:                  true,
+		Problems:                  []string{"wal_level is replica but logical replication requires wal_level = logical"},
+		SnapshotRows:              1000,
+		SnapshotBytes:             65536,
+		EstimatedSnapshotDuration: "100ms",
+	}
+	msg, err := r.message()
+	require.NoError(t, err)
+
+	eventType, _ := msg.MetaGet("event_type")
+	assert.Equal(t, "dry_run", eventType)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "schema": "public",
+  "slot": "rs_shop",
+  "slot_exists": false,
+  "wal_level": "replica",
+  "tables": [{"name": "orders", "columns": ["id", "total"], "primary_key": ["id"], "estimated_rows": 1000, "bytes": 65536}],
+  "snapshot": true,
+  "snapshot_rows": 1000,
+  "snapshot_bytes": 65536,
+  "estimated_snapshot_duration": "100ms",
+  "problems": ["wal_level is replica but logical replication requires wal_level = logical"]
+}`, string(b))
+}
@@ -0,0 +1,136 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// envelopeVersion is the version of the document events are serialised to,
+// set in the envelope_version metadata field.
+type envelopeVersion string
+
+const (
+	// envelopeV1 is the wal2json-shaped document with the LSN and changes.
+	envelopeV1 envelopeVersion = "1"
+	// envelopeV2 adds the envelope version and the commit timestamp and id
+	// of the transaction to the document.
+	envelopeV2 envelopeVersion = "2"
+	// envelopeMaxwell is the document of the Maxwell daemon, holding a
+	// single row.
+	envelopeMaxwell envelopeVersion = "maxwell"
+	// envelopeProtobuf is the pg_stream.v1.ChangeEvent protobuf message.
+	envelopeProtobuf envelopeVersion = "protobuf"
+)
+
+type envelopeV2Document struct {
+	EnvelopeVersion int                              `json:"envelope_version"`
+	Lsn             *string                          `json:"lsn"`
+	Timestamp       *time.Time                       `json:"timestamp,omitempty"`
+	Xid             uint32                           `json:"xid,omitempty"`
+	Changes         []pglogicalstream.Wal2JsonChange `json:"change"`
+}
+
+// maxwellDocument is the document of a row change emitted by the Maxwell
+// daemon. The schema of the table takes the place of the MySQL database.
+type maxwellDocument struct {
+	Database string         `json:"database"`
+	Table    string         `json:"table"`
+	Type     string         `json:"type"`
+	Ts       int64          `json:"ts"`
+	Xid      uint32         `json:"xid,omitempty"`
+	Commit   bool           `json:"commit,omitempty"`
+	Position string         `json:"position,omitempty"`
+	Data     map[string]any `json:"data"`
+	Old      map[string]any `json:"old,omitempty"`
+}
+
+// marshal serialises the changes to the envelope of the version.
+func (v envelopeVersion) marshal(changes pglogicalstream.Wal2JsonChanges) ([]byte, error) {
+	if v == envelopeV1 {
+		return json.Marshal(changes)
+	}
+	if v == envelopeMaxwell {
+		return marshalMaxwell(changes)
+	}
+	if v == envelopeProtobuf {
+		return marshalProtobuf(changes)
+	}
+
+	doc := envelopeV2Document{
+		EnvelopeVersion: 2,
+		Lsn:             changes.Lsn,
+		Xid:             changes.Xid,
+		Changes:         changes.Changes,
+	}
+	if !changes.Timestamp.IsZero() {
+		doc.Timestamp = &changes.Timestamp
+	}
+	return json.Marshal(doc)
+}
+
+// marshalMaxwell serialises a single change to the Maxwell document. Deletes
+// hold the old keys as their data, and updates the old values of the columns
+// that changed, which are only known for replica identity columns unless the
+// table uses REPLICA IDENTITY FULL. Snapshot rows are bootstrap inserts.
+func marshalMaxwell(changes pglogicalstream.Wal2JsonChanges) ([]byte, error) {
+	if len(changes.Changes) != 1 {
+		return nil, fmt.Errorf("the maxwell envelope holds a single change, got %d", len(changes.Changes))
+	}
+	change := changes.Changes[0]
+
+	doc := maxwellDocument{
+		Database: change.Schema,
+		Table:    change.Table,
+		Type:     change.Kind,
+		Ts:       changes.Timestamp.Unix(),
+		Xid:      changes.Xid,
+		Commit:   changes.TransactionEnd,
+		Data:     map[string]any{},
+	}
+	if changes.Lsn != nil {
+		doc.Position = *changes.Lsn
+	} else {
+		doc.Type = "bootstrap-" + change.Kind
+		doc.Ts = time.Now().Unix()
+	}
+
+	if change.Kind == "delete" {
+		for i, name := range change.OldKeys.KeyNames {
+			if i < len(change.OldKeys.KeyValues) {
+				doc.Data[name] = change.OldKeys.KeyValues[i]
+			}
+		}
+		return json.Marshal(doc)
+	}
+
+	for i, name := range change.ColumnNames {
+		if i < len(change.ColumnValues) {
+			doc.Data[name] = change.ColumnValues[i]
+		}
+	}
+	if change.Kind == "update" {
+		for i, name := range change.OldKeys.KeyNames {
+			value, ok := doc.Data[name]
+			if !ok || i >= len(change.OldKeys.KeyValues) || reflect.DeepEqual(value, change.OldKeys.KeyValues[i]) {
+				continue
+			}
+			if doc.Old == nil {
+				doc.Old = map[string]any{}
+			}
+			doc.Old[name] = change.OldKeys.KeyValues[i]
+		}
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// The protobuf envelope is the pg_stream.v1.ChangeEvent message defined in
+// proto/change_event.proto. It is encoded by hand, which keeps the input free
+// of a protobuf runtime dependency.
+
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+// protoKinds are the values of the Kind enum.
+var protoKinds = map[string]uint64{
+	"insert":   1,
+	"update":   2,
+	"delete":   3,
+	"truncate": 4,
+}
+
+// protoBuffer appends protobuf wire format fields to a byte slice.
+type protoBuffer []byte
+
+func (b protoBuffer) tag(field, wireType int) protoBuffer {
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+func (b protoBuffer) varint(field int, v uint64) protoBuffer {
+	return binary.AppendUvarint(b.tag(field, protoVarint), v)
+}
+
+func (b protoBuffer) double(field int, v float64) protoBuffer {
+	return binary.LittleEndian.AppendUint64(b.tag(field, protoFixed64), math.Float64bits(v))
+}
+
+func (b protoBuffer) bytes(field int, v []byte) protoBuffer {
+	b = binary.AppendUvarint(b.tag(field, protoBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b protoBuffer) string(field int, v string) protoBuffer {
+	b = binary.AppendUvarint(b.tag(field, protoBytes), uint64(len(v)))
+	return append(b, v...)
+}
+
+// Scalar fields holding their zero value are omitted, as in proto3.
+
+func (b protoBuffer) optionalVarint(field int, v uint64) protoBuffer {
+	if v == 0 {
+		return b
+	}
+	return b.varint(field, v)
+}
+
+func (b protoBuffer) optionalString(field int, v string) protoBuffer {
+	if v == "" {
+		return b
+	}
+	return b.string(field, v)
+}
+
+// marshalProtobuf serialises the changes to a ChangeEvent message.
+func marshalProtobuf(changes pglogicalstream.Wal2JsonChanges) ([]byte, error) {
+	var b protoBuffer
+	if changes.Lsn != nil {
+		b = b.optionalString(1, *changes.Lsn)
+	}
+	if !changes.Timestamp.IsZero() {
+		b = b.optionalVarint(2, uint64(changes.Timestamp.UnixMicro()))
+	}
+	b = b.optionalVarint(3, uint64(changes.Xid))
+	if changes.TransactionEnd {
+		b = b.varint(4, 1)
+	}
+	for _, change := range changes.Changes {
+		c, err := marshalProtobufChange(change)
+		if err != nil {
+			return nil, err
+		}
+		b = b.bytes(5, c)
+	}
+	return b, nil
+}
+
+func marshalProtobufChange(change pglogicalstream.Wal2JsonChange) (protoBuffer, error) {
+	var b protoBuffer
+	b = b.optionalVarint(1, protoKinds[change.Kind])
+	b = b.optionalString(2, change.Schema)
+	b = b.optionalString(3, change.Table)
+	for i, name := range change.ColumnNames {
+		c, err := marshalProtobufColumn(name, change.ColumnTypes, change.ColumnValues, i)
+		if err != nil {
+			return nil, err
+		}
+		b = b.bytes(4, c)
+	}
+	for i, name := range change.OldKeys.KeyNames {
+		c, err := marshalProtobufColumn(name, change.OldKeys.KeyTypes, change.OldKeys.KeyValues, i)
+		if err != nil {
+			return nil, err
+		}
+		b = b.bytes(5, c)
+	}
+	return b, nil
+}
+
+func marshalProtobufColumn(name string, types []string, values []any, i int) (protoBuffer, error) {
+	var b protoBuffer
+	b = b.optionalString(1, name)
+	if i < len(types) {
+		b = b.optionalString(2, types[i])
+	}
+	if i >= len(values) || values[i] == nil {
+		return b, nil
+	}
+	v, err := marshalProtobufValue(values[i])
+	if err != nil {
+		return nil, err
+	}
+	return b.bytes(3, v), nil
+}
+
+// marshalProtobufValue serialises a decoded column value to a Value message.
+// The fields of the oneof are set even when they hold their zero value.
+func marshalProtobufValue(value any) (protoBuffer, error) {
+	var b protoBuffer
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return b.varint(1, 1), nil
+		}
+		return b.varint(1, 0), nil
+	case int64:
+		return b.varint(2, uint64(v)), nil
+	case int:
+		return b.varint(2, uint64(v)), nil
+	case int32:
+		return b.varint(2, uint64(v)), nil
+	case float64:
+		return b.double(3, v), nil
+	case float32:
+		return b.double(3, float64(v)), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return b.varint(2, uint64(n)), nil
+		}
+		// Integers that overflow an int64 are kept as strings.
+		if f, err := v.Float64(); err == nil && strings.ContainsAny(v.String(), ".eE") {
+			return b.double(3, f), nil
+		}
+		return b.string(4, v.String()), nil
+	case string:
+		return b.string(4, v), nil
+	case time.Time:
+		return b.string(4, v.Format(time.RFC3339Nano)), nil
+	case []byte:
+		return b.bytes(5, v), nil
+	}
+	j, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return b.bytes(6, j), nil
+}
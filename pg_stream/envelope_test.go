@@ -0,0 +1,155 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestEnvelopeVersions(t *testing.T) {
+	lsn := "0/16B3748"
+	changes := pglogicalstream.Wal2JsonChanges{
+		Lsn:       &lsn,
+		Xid:       5821,
+		Timestamp: time.Date(2024, 3, 1, 10, 15, 30, 0, time.UTC),
+		Changes: []pglogicalstream.Wal2JsonChange{{
+			Kind: "insert", Schema: "public", Table: "orders",
+			ColumnNames: []string{"id"}, ColumnTypes: []string{"integer"}, ColumnValues: []interface{}{1},
+		}},
+	}
+	change := `[{"kind":"insert","schema":"public","table":"orders","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]`
+
+	b, err := envelopeV1.marshal(changes)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"lsn":"0/16B3748","change":`+change+`}`, string(b))
+
+	b, err = envelopeV2.marshal(changes)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"envelope_version":2,"lsn":"0/16B3748","timestamp":"2024-03-01T10:15:30Z","xid":5821,"change":`+change+`}`, string(b))
+
+	// Snapshot rows have no transaction.
+	b, err = envelopeV2.marshal(pglogicalstream.Wal2JsonChanges{Changes: changes.Changes})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"envelope_version":2,"lsn":null,"change":`+change+`}`, string(b))
+}
+
+func TestMaxwellEnvelope(t *testing.T) {
+	lsn := "0/16B3748"
+	changes := pglogicalstream.Wal2JsonChanges{
+		Lsn:            &lsn,
+		Xid:            5821,
+		Timestamp:      time.Date(2024, 3, 1, 10, 15, 30, 0, time.UTC),
+		TransactionEnd: true,
+		Changes: []pglogicalstream.Wal2JsonChange{{
+			Kind: "update", Schema: "public", Table: "orders",
+			ColumnNames: []string{"id", "status"}, ColumnValues: []interface{}{float64(1), "shipped"},
+			OldKeys: pglogicalstream.Wal2JsonOldKeys{
+				KeyNames:  []string{"id", "status"},
+				KeyValues: []interface{}{float64(1), "pending"},
+			},
+		}},
+	}
+
+	b, err := envelopeMaxwell.marshal(changes)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"database":"public","table":"orders","type":"update","ts":1709288130,"xid":5821,"commit":true,"position":"0/16B3748","data":{"id":1,"status":"shipped"},"old":{"status":"pending"}}`, string(b))
+
+	changes.TransactionEnd = false
+	changes.Changes[0] = pglogicalstream.Wal2JsonChange{
+		Kind: "delete", Schema: "public", Table: "orders",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyValues: []interface{}{float64(1)}},
+	}
+	b, err = envelopeMaxwell.marshal(changes)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"database":"public","table":"orders","type":"delete","ts":1709288130,"xid":5821,"position":"0/16B3748","data":{"id":1}}`, string(b))
+
+	// Snapshot rows are bootstrap inserts.
+	b, err = envelopeMaxwell.marshal(pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind: "insert", Schema: "public", Table: "orders",
+		ColumnNames: []string{"id"}, ColumnValues: []interface{}{float64(2)},
+	}}})
+	require.NoError(t, err)
+	var doc maxwellDocument
+	require.NoError(t, json.Unmarshal(b, &doc))
+	assert.Equal(t, "bootstrap-insert", doc.Type)
+	assert.Equal(t, map[string]any{"id": float64(2)}, doc.Data)
+	assert.NotZero(t, doc.Ts)
+
+	_, err = envelopeMaxwell.marshal(pglogicalstream.Wal2JsonChanges{Changes: make([]pglogicalstream.Wal2JsonChange, 2)})
+	assert.EqualError(t, err, "the maxwell envelope holds a single change, got 2")
+}
+
+func TestProtobufEnvelope(t *testing.T) {
+	lsn := "0/1"
+	changes := pglogicalstream.Wal2JsonChanges{
+		Lsn:            &lsn,
+		Xid:            7,
+		TransactionEnd: true,
+		Changes: []pglogicalstream.Wal2JsonChange{{
+			Kind:         "insert",
+			Schema:       "public",
+			Table:        "t",
+			ColumnNames:  []string{"id", "ok", "note"},
+			ColumnTypes:  []string{"integer", "boolean", "text"},
+			ColumnValues: []interface{}{int64(5), false, nil},
+		}},
+	}
+	b, err := envelopeProtobuf.marshal(changes)
+	require.NoError(t, err)
+
+	column := func(name, typ string, value ...byte) []byte {
+		c := append([]byte{0x0a, byte(len(name))}, name...)
+		c = append(append(c, 0x12, byte(len(typ))), typ...)
+		if value != nil {
+			c = append(append(c, 0x1a, byte(len(value))), value...)
+		}
+		return append([]byte{0x22, byte(len(c))}, c...)
+	}
+	change := []byte{0x08, 0x01, 0x12, 0x06}
+	change = append(change, "public"...)
+	change = append(change, 0x1a, 0x01, 't')
+	change = append(change, column("id", "integer", 0x10, 0x05)...)
+	// The oneof holds false rather than being omitted, unlike NULL.
+	change = append(change, column("ok", "boolean", 0x08, 0x00)...)
+	change = append(change, column("note", "text")...)
+
+	expected := []byte{0x0a, 0x03, '0', '/', '1', 0x18, 0x07, 0x20, 0x01, 0x2a, byte(len(change))}
+	assert.Equal(t, append(expected, change...), b)
+
+	// Snapshot rows have no LSN nor transaction.
+	changes.Lsn, changes.Xid, changes.TransactionEnd = nil, 0, false
+	b, err = envelopeProtobuf.marshal(changes)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0x2a, byte(len(change))}, change...), b)
+}
+
+func TestProtobufValues(t *testing.T) {
+	for _, test := range []struct {
+		value    any
+		expected []byte
+	}{
+		{int64(-1), []byte{0x10, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{1.5, []byte{0x19, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		{json.Number("300"), []byte{0x10, 0xac, 0x02}},
+		{json.Number("18446744073709551616"), append([]byte{0x22, 20}, "18446744073709551616"...)},
+		{"", []byte{0x22, 0x00}},
+		{[]interface{}{"a"}, append([]byte{0x32, 5}, `["a"]`...)},
+	} {
+		b, err := marshalProtobufValue(test.value)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, []byte(b), "%v", test.value)
+	}
+}
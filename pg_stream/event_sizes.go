@@ -0,0 +1,133 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type oversizedEventAction string
+
+const (
+	oversizedEventDrop       oversizedEventAction = "drop"
+	oversizedEventDeadLetter oversizedEventAction = "dead_letter"
+	oversizedEventFail       oversizedEventAction = "fail"
+)
+
+// eventSizeBuckets are the upper bounds of the payload size buckets, in
+// bytes.
+var eventSizeBuckets = []int{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20}
+
+var eventSizesConfigFields = []*service.ConfigField{
+	service.NewIntMapField("max_bytes").
+		Description("The largest payload size of the events of a table, keyed by table name").
+		Example(map[string]any{"documents": 1048576}).
+		Default(map[string]any{}),
+	service.NewIntField("default_max_bytes").
+		Description("The largest payload size of the events of tables without an entry in `max_bytes`. Zero means no limit").
+		Default(0),
+	service.NewStringAnnotatedEnumField("action", map[string]string{
+		string(oversizedEventDrop):       "Acknowledge oversized events without emitting them.",
+		string(oversizedEventDeadLetter): "Emit oversized events with the metadata field `dead_letter_reason` set to `oversized` so they can be routed to a dead-letter output.",
+		string(oversizedEventFail):       "Fail to emit the event, which stops the input from making progress until the limit is raised.",
+	}).
+		Description("What to do with events larger than the limit of their table").
+		Default(string(oversizedEventDeadLetter)),
+}
+
+// eventSizes tracks the distribution of the payload sizes of the events of
+// each table and enforces the size limits. An event spanning several tables
+// is attributed to the table of its first change.
+type eventSizes struct {
+	maxBytes        map[string]int
+	defaultMaxBytes int
+	action          oversizedEventAction
+
+	bytes     *service.MetricCounter
+	buckets   *service.MetricCounter
+	oversized *service.MetricCounter
+}
+
+func newEventSizesFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (s *eventSizes, err error) {
+	s = &eventSizes{
+		bytes:     metrics.NewCounter("pg_stream_event_bytes", "table"),
+		buckets:   metrics.NewCounter("pg_stream_event_size_bucket", "table", "le"),
+		oversized: metrics.NewCounter("pg_stream_oversized_events", "table"),
+	}
+	if s.maxBytes, err = conf.FieldIntMap("max_bytes"); err != nil {
+		return nil, err
+	}
+	if s.defaultMaxBytes, err = conf.FieldInt("default_max_bytes"); err != nil {
+		return nil, err
+	}
+	var action string
+	if action, err = conf.FieldString("action"); err != nil {
+		return nil, err
+	}
+	s.action = oversizedEventAction(action)
+	return s, nil
+}
+
+func (s *eventSizes) limit(table string) int {
+	if limit, ok := s.maxBytes[table]; ok {
+		return limit
+	}
+	return s.defaultMaxBytes
+}
+
+// observe records the payload size of an event and returns the limit it
+// exceeds, or zero.
+func (s *eventSizes) observe(changes []pglogicalstream.Wal2JsonChange, size int) int {
+	if len(changes) == 0 {
+		return 0
+	}
+	table := changes[0].Table
+
+	s.bytes.Incr(int64(size), table)
+	// The buckets are cumulative like those of a Prometheus histogram.
+	for _, bound := range eventSizeBuckets {
+		if size <= bound {
+			s.buckets.Incr(1, table, strconv.Itoa(bound))
+		}
+	}
+	s.buckets.Incr(1, table, "+Inf")
+
+	if limit := s.limit(table); limit > 0 && size > limit {
+		s.oversized.Incr(1, table)
+		return limit
+	}
+	return 0
+}
+
+// checkSize records the payload size of a message and applies the action to
+// oversized ones. It returns true when the message must be dropped, and an
+// error when it must not be emitted.
+func (p *pgStreamInput) checkSize(msg *service.Message, changes []pglogicalstream.Wal2JsonChange) (drop bool, err error) {
+	b, err := msg.AsBytes()
+	if err != nil {
+		return false, err
+	}
+	limit := p.sizes.observe(changes, len(b))
+	if limit == 0 {
+		return false, nil
+	}
+	switch p.sizes.action {
+	case oversizedEventDrop:
+		return true, nil
+	case oversizedEventFail:
+		return false, fmt.Errorf("event of %d bytes of table %s exceeds the limit of %d bytes", len(b), changes[0].Table, limit)
+	}
+	p.markDeadLetter(msg, changes, "oversized")
+	return false, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestEventSizeLimits(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(eventSizesConfigFields...)
+	conf, err := spec.ParseYAML(`
+max_bytes:
+  documents: 100
+default_max_bytes: 1000
+`, nil)
+	require.NoError(t, err)
+	sizes, err := newEventSizesFromParsed(conf, service.MockResources().Metrics())
+	require.NoError(t, err)
+	p := &pgStreamInput{sizes: sizes}
+
+	changes := func(table string) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: table}}
+	}
+	msg := service.NewMessage([]byte(strings.Repeat("x", 500)))
+
+	drop, err := p.checkSize(msg, changes("orders"))
+	require.NoError(t, err)
+	assert.False(t, drop)
+	_, ok := msg.MetaGet("dead_letter_reason")
+	assert.False(t, ok)
+
+	drop, err = p.checkSize(msg, changes("documents"))
+	require.NoError(t, err)
+	assert.False(t, drop)
+	reason, _ := msg.MetaGet("dead_letter_reason")
+	assert.Equal(t, "oversized", reason)
+
+	sizes.action = oversizedEventDrop
+	drop, err = p.checkSize(msg, changes("documents"))
+	require.NoError(t, err)
+	assert.True(t, drop)
+
+	sizes.action = oversizedEventFail
+	_, err = p.checkSize(msg, changes("documents"))
+	assert.EqualError(t, err, "event of 500 bytes of table documents exceeds the limit of 100 bytes")
+}
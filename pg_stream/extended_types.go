@@ -0,0 +1,167 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// decodeExtendedTypes converts the text representation of money, tsvector and
+// network columns into values typed consumers can use. Values that can't be
+// parsed are left as they are.
+func decodeExtendedTypes(changes []pglogicalstream.Wal2JsonChange, numbers numberEncoding) {
+	for i := range changes {
+		change := &changes[i]
+		cloned := false
+		for j, v := range change.ColumnValues {
+			if j >= len(change.ColumnTypes) {
+				break
+			}
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			decoded, ok := decodeExtendedValue(baseTypeName(change.ColumnTypes[j]), s, numbers)
+			if !ok {
+				continue
+			}
+			if !cloned {
+				change.ColumnValues = append([]interface{}(nil), change.ColumnValues...)
+				cloned = true
+			}
+			change.ColumnValues[j] = decoded
+		}
+	}
+}
+
+// baseTypeName strips the type modifier, such as the length of bit(8).
+func baseTypeName(t string) string {
+	if i := strings.IndexByte(t, '('); i != -1 {
+		t = t[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(t))
+}
+
+func decodeExtendedValue(typ, s string, numbers numberEncoding) (interface{}, bool) {
+	switch typ {
+	case "money":
+		amount, ok := parseMoney(s)
+		if !ok {
+			return nil, false
+		}
+		return numbers.encode(json.Number(amount)), true
+	case "tsvector":
+		return parseTSVector(s), true
+	case "inet", "cidr":
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			if typ == "cidr" {
+				prefix = prefix.Masked()
+			}
+			return prefix.String(), true
+		}
+		if addr, err := netip.ParseAddr(s); err == nil {
+			return addr.String(), true
+		}
+	case "macaddr", "macaddr8":
+		if mac, err := net.ParseMAC(s); err == nil {
+			return mac.String(), true
+		}
+	case "bit", "bit varying", "varbit":
+		// Bit strings are already emitted as strings of 0 and 1.
+		return s, true
+	}
+	return nil, false
+}
+
+// parseMoney returns the decimal amount of a money value formatted with the
+// currency symbol and digit grouping of the lc_monetary locale of the server,
+// such as $1,234.56 or -$1,234.56. The currency symbol is dropped.
+func parseMoney(s string) (string, bool) {
+	negative := strings.Contains(s, "-") || (strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")"))
+
+	var digits strings.Builder
+	lastDot, lastComma, dots, commas := -1, -1, 0, 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '.':
+			lastDot = digits.Len()
+			dots++
+		case r == ',':
+			lastComma = digits.Len()
+			commas++
+		}
+	}
+	if digits.Len() == 0 {
+		return "", false
+	}
+
+	// The decimal separator is the last separator, unless it is repeated or
+	// followed by three digits like a group separator.
+	separator := -1
+	switch {
+	case dots > 0 && commas > 0:
+		separator = max(lastDot, lastComma)
+	case dots == 1:
+		separator = lastDot
+	case commas == 1 && digits.Len()-lastComma != 3:
+		separator = lastComma
+	}
+
+	amount := digits.String()
+	if separator != -1 {
+		amount = amount[:separator] + "." + amount[separator:]
+		if separator == 0 {
+			amount = "0" + amount
+		}
+	}
+	if negative {
+		amount = "-" + amount
+	}
+	return amount, true
+}
+
+// parseTSVector returns the lexemes of a tsvector such as 'fat':2 'rat':3,
+// without their positions and weights.
+func parseTSVector(s string) []interface{} {
+	lexemes := []interface{}{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\'' {
+			continue
+		}
+		var lexeme strings.Builder
+		for i++; i < len(s); i++ {
+			if s[i] == '\'' {
+				// Quotes within lexemes are doubled.
+				if i+1 < len(s) && s[i+1] == '\'' {
+					lexeme.WriteByte('\'')
+					i++
+					continue
+				}
+				break
+			}
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+			lexeme.WriteByte(s[i])
+		}
+		lexemes = append(lexemes, lexeme.String())
+		// Skip the positions up to the next lexeme.
+		for i+1 < len(s) && s[i+1] != ' ' {
+			i++
+		}
+	}
+	return lexemes
+}
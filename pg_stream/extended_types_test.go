@@ -0,0 +1,65 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestParseMoney(t *testing.T) {
+	for in, expected := range map[string]string{
+		"$1,234.56":     "1234.56",
+		"-$1,234.56":    "-1234.56",
+		"($12.00)":      "-12.00",
+		"1.234,56 €":    "1234.56",
+		"12,5 €":        "12.5",
+		"¥1,234":        "1234",
+		"$0.05":         "0.05",
+		"$1,234,567.89": "1234567.89",
+	} {
+		amount, ok := parseMoney(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, expected, amount, in)
+	}
+
+	_, ok := parseMoney("")
+	assert.False(t, ok)
+}
+
+func TestParseTSVector(t *testing.T) {
+	assert.Equal(t, []interface{}{"a", "fat", "it's", "rat"}, parseTSVector(`'a' 'fat':2,4A 'it''s':5 'rat':3`))
+	assert.Equal(t, []interface{}{}, parseTSVector(""))
+}
+
+func TestDecodeExtendedTypes(t *testing.T) {
+	values := []interface{}{"$1,000.50", "'cat':1 'dog':2", "2001:0db8:0000:0000:0000:0000:0000:0001", "192.168.1.7/24", "08-00-2B-01-02-03", "101", "text", nil}
+	changes := []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		ColumnNames:  []string{"price", "search", "host", "network", "mac", "flags", "note", "missing"},
+		ColumnTypes:  []string{"money", "tsvector", "inet", "cidr", "macaddr", "bit(3)", "text", "inet"},
+		ColumnValues: values,
+	}}
+
+	decodeExtendedTypes(changes, numberWrapped)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"$numberDecimal": "1000.50"},
+		[]interface{}{"cat", "dog"},
+		"2001:db8::1",
+		"192.168.1.0/24",
+		"08:00:2b:01:02:03",
+		"101",
+		"text",
+		nil,
+	}, changes[0].ColumnValues)
+	assert.Equal(t, "$1,000.50", values[0], "the original values are left untouched")
+}
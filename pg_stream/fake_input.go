@@ -0,0 +1,83 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var pgStreamFakeConfigSpec = service.NewConfigSpec().
+	Summary("Runs the pg_stream input against an in-process fake replication source streaming scripted transactions, to test the failure handling of pipelines deterministically").
+	Description("Transactions get the LSNs `0/1`, `0/2` and so on. Like a replication slot, the fake source remembers the acknowledged position and resumes after it when the input reconnects, so unacknowledged transactions are delivered again.").
+	Field(service.NewStringField("schema").
+		Description("Schema of the replicated tables").
+		Default("public")).
+	Field(service.NewStringListField("tables").
+		Description("Tables whose changes are emitted").
+		Example([]string{"users"})).
+	Field(service.NewStringListField("transactions").
+		Description("Transactions in the wal2json format version 1. Malformed payloads fail the source like they would fail a real one").
+		Example([]string{`{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}`})).
+	Field(service.NewIntField("duplicate_every").
+		Description("Delivers every nth transaction twice with the same LSN. Set to `0` to never duplicate").
+		Default(0)).
+	Field(service.NewIntField("disconnect_every").
+		Description("Disconnects the source after every nth transaction, forcing the input to reconnect. Set to `0` to never disconnect").
+		Default(0)).
+	Field(service.NewBoolField("separate_changes").
+		Description("Emit a message per changed row rather than per transaction").
+		Default(true))
+
+func newPgStreamFakeInput(conf *service.ParsedConfig, mgr *service.Resources) (p *pgStreamInput, err error) {
+	script := &pglogicalstream.FakeScript{}
+	p = &pgStreamInput{
+		checksum:        checksumNone,
+		numbers:         numberFloat,
+		nonFiniteFloats: nonFiniteString,
+		newSource:       script.Source,
+		logger:          mgr.Logger(),
+	}
+
+	if p.schema, err = conf.FieldString("schema"); err != nil {
+		return nil, err
+	}
+	if p.tables, err = conf.FieldStringList("tables"); err != nil {
+		return nil, err
+	}
+	if script.Transactions, err = conf.FieldStringList("transactions"); err != nil {
+		return nil, err
+	}
+	if script.DuplicateEvery, err = conf.FieldInt("duplicate_every"); err != nil {
+		return nil, err
+	}
+	if script.DisconnectEvery, err = conf.FieldInt("disconnect_every"); err != nil {
+		return nil, err
+	}
+	if p.separateChanges, err = conf.FieldBool("separate_changes"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func init() {
+	err := service.RegisterInput(
+		"pg_stream_fake", pgStreamFakeConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			p, err := newPgStreamFakeInput(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacks(p), nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
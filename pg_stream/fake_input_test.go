@@ -0,0 +1,156 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestFakeInputRedeliversAfterDisconnect(t *testing.T) {
+	conf, err := pgStreamFakeConfigSpec.ParseYAML(`
+tables: [ users ]
+disconnect_every: 2
+transactions:
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}'
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[2]}]}'
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[3]}]}'
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamFakeInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	readID := func() (float64, service.AckFunc) {
+		msg, ack, err := input.Read(ctx)
+		require.NoError(t, err)
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		var changes struct {
+			Change []struct {
+				ColumnValues []float64 `json:"columnvalues"`
+			} `json:"change"`
+		}
+		require.NoError(t, json.Unmarshal(b, &changes))
+		return changes.Change[0].ColumnValues[0], ack
+	}
+
+	require.NoError(t, input.Connect(ctx))
+	id, ack := readID()
+	assert.Equal(t, float64(1), id)
+	require.NoError(t, ack(ctx, nil))
+	id, _ = readID()
+	assert.Equal(t, float64(2), id)
+
+	_, _, err = input.Read(ctx)
+	assert.ErrorIs(t, err, service.ErrNotConnected)
+
+	require.NoError(t, input.Connect(ctx))
+	id, ack = readID()
+	assert.Equal(t, float64(2), id)
+	require.NoError(t, ack(ctx, nil))
+	id, _ = readID()
+	assert.Equal(t, float64(3), id)
+
+	require.NoError(t, input.Close(ctx))
+}
+
+func TestFakeInputEmptyTransactions(t *testing.T) {
+	conf, err := pgStreamFakeConfigSpec.ParseYAML(`
+tables: [ users ]
+disconnect_every: 2
+transactions:
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}'
+  - '{"change":[]}'
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[3]}]}'
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamFakeInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	readID := func() (float64, service.AckFunc) {
+		msg, ack, err := input.Read(ctx)
+		require.NoError(t, err)
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		var changes struct {
+			Change []struct {
+				ColumnValues []float64 `json:"columnvalues"`
+			} `json:"change"`
+		}
+		require.NoError(t, json.Unmarshal(b, &changes))
+		return changes.Change[0].ColumnValues[0], ack
+	}
+
+	// The empty transaction isn't confirmed ahead of the unacknowledged
+	// event received before it, which is delivered again.
+	require.NoError(t, input.Connect(ctx))
+	id, _ := readID()
+	assert.Equal(t, float64(1), id)
+	_, _, err = input.Read(ctx)
+	assert.ErrorIs(t, err, service.ErrNotConnected)
+
+	// Acknowledging the event releases the empty transaction as well.
+	require.NoError(t, input.Connect(ctx))
+	id, ack := readID()
+	assert.Equal(t, float64(1), id)
+	require.NoError(t, ack(ctx, nil))
+	_, _, err = input.Read(ctx)
+	assert.ErrorIs(t, err, service.ErrNotConnected)
+
+	require.NoError(t, input.Connect(ctx))
+	id, _ = readID()
+	assert.Equal(t, float64(3), id)
+
+	require.NoError(t, input.Close(ctx))
+}
+
+func TestFakeInputFilteredTransactions(t *testing.T) {
+	conf, err := pgStreamFakeConfigSpec.ParseYAML(`
+tables: [ users ]
+transactions: []
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamFakeInput(conf, service.MockResources())
+	require.NoError(t, err)
+	script := &pglogicalstream.FakeScript{Transactions: []string{
+		`{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}`,
+		`{"change":[{"kind":"insert","schema":"public","table":"orders","columnnames":["id"],"columntypes":["integer"],"columnvalues":[2]}]}`,
+		`{"change":[{"kind":"insert","schema":"audit","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[3]}]}`,
+		`{"change":[{"kind":"message","transactional":true,"prefix":"trace","content":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}]}`,
+		`{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[5]}]}`,
+	}}
+	input.newSource = script.Source
+
+	ctx := context.Background()
+	require.NoError(t, input.Connect(ctx))
+	_, ack, err := input.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0/0", script.Acknowledged())
+	require.NoError(t, ack(ctx, nil))
+	assert.Equal(t, "0/1", script.Acknowledged())
+
+	// Transactions with no changes of the tables emit nothing but are
+	// confirmed once the changes received before them are acknowledged.
+	_, ack, err = input.Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "0/4", script.Acknowledged())
+	require.NoError(t, ack(ctx, nil))
+	assert.Equal(t, "0/5", script.Acknowledged())
+
+	require.NoError(t, input.Close(ctx))
+}
@@ -0,0 +1,103 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var faultInjectionConfigFields = []*service.ConfigField{
+	service.NewFloatField("decode_delay_probability").
+		Description("The probability of delaying the decoding of an event, between 0 and 1").
+		Default(0.0),
+	service.NewDurationField("decode_delay").
+		Description("The longest delay of a delayed event, the delay is picked at random up to it").
+		Default("100ms"),
+	service.NewFloatField("reconnect_probability").
+		Description("The probability of dropping the replication connection and reconnecting before emitting a streamed event, between 0 and 1. Snapshot rows are not affected").
+		Default(0.0),
+	service.NewFloatField("drop_ack_probability").
+		Description("The probability of ignoring the acknowledgement of a streamed event, between 0 and 1. The slot then stops advancing until the input reconnects and the unconfirmed events are redelivered").
+		Default(0.0),
+}
+
+// faultInjector injects failures into an input to exercise the alerting and
+// recovery of a pipeline. It must never be configured in production.
+type faultInjector struct {
+	delayProbability     float64
+	delay                time.Duration
+	reconnectProbability float64
+	dropAckProbability   float64
+
+	injected *service.MetricCounter
+}
+
+func newFaultInjectorFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (f *faultInjector, err error) {
+	f = &faultInjector{
+		injected: metrics.NewCounter("pg_stream_injected_faults", "fault"),
+	}
+	if f.delayProbability, err = conf.FieldFloat("decode_delay_probability"); err != nil {
+		return nil, err
+	}
+	if f.delay, err = conf.FieldDuration("decode_delay"); err != nil {
+		return nil, err
+	}
+	if f.reconnectProbability, err = conf.FieldFloat("reconnect_probability"); err != nil {
+		return nil, err
+	}
+	if f.dropAckProbability, err = conf.FieldFloat("drop_ack_probability"); err != nil {
+		return nil, err
+	}
+	for name, p := range map[string]float64{
+		"decode_delay_probability": f.delayProbability,
+		"reconnect_probability":    f.reconnectProbability,
+		"drop_ack_probability":     f.dropAckProbability,
+	} {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("%s must be between 0 and 1, got %v", name, p)
+		}
+	}
+	return f, nil
+}
+
+func (f *faultInjector) inject(probability float64, fault string) bool {
+	if probability <= 0 || rand.Float64() >= probability {
+		return false
+	}
+	f.injected.Incr(1, fault)
+	return true
+}
+
+// delayDecode sleeps for a random delay when the fault is injected.
+func (f *faultInjector) delayDecode(ctx context.Context) error {
+	if f.delay <= 0 || !f.inject(f.delayProbability, "decode_delay") {
+		return nil
+	}
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(f.delay)))):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reconnect returns whether the replication connection should be dropped.
+func (f *faultInjector) reconnect() bool {
+	return f.inject(f.reconnectProbability, "reconnect")
+}
+
+// dropAck returns whether an acknowledgement should be ignored.
+func (f *faultInjector) dropAck() bool {
+	return f.inject(f.dropAckProbability, "dropped_ack")
+}
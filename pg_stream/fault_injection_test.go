@@ -0,0 +1,46 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultInjection(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(faultInjectionConfigFields...)
+
+	conf, err := spec.ParseYAML(`
+reconnect_probability: 1
+decode_delay_probability: 1
+decode_delay: 1ms
+`, nil)
+	require.NoError(t, err)
+	f, err := newFaultInjectorFromParsed(conf, service.MockResources().Metrics())
+	require.NoError(t, err)
+
+	assert.True(t, f.reconnect())
+	assert.False(t, f.dropAck())
+	assert.NoError(t, f.delayDecode(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f.delay = time.Hour
+	assert.ErrorIs(t, f.delayDecode(ctx), context.Canceled)
+
+	conf, err = spec.ParseYAML(`drop_ack_probability: 1.5`, nil)
+	require.NoError(t, err)
+	_, err = newFaultInjectorFromParsed(conf, service.MockResources().Metrics())
+	assert.ErrorContains(t, err, "drop_ack_probability must be between 0 and 1")
+}
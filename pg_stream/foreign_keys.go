@@ -0,0 +1,150 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const foreignKeysQuery = `
+SELECT con.conname,
+       src.relname,
+       tgt.relname,
+       ARRAY(SELECT a.attname
+             FROM unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+             JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+             ORDER BY k.ord),
+       ARRAY(SELECT a.attname
+             FROM unnest(con.confkey) WITH ORDINALITY AS k(attnum, ord)
+             JOIN pg_attribute a ON a.attrelid = con.confrelid AND a.attnum = k.attnum
+             ORDER BY k.ord)
+FROM pg_constraint con
+JOIN pg_class src ON src.oid = con.conrelid
+JOIN pg_class tgt ON tgt.oid = con.confrelid
+JOIN pg_namespace ns ON ns.oid = src.relnamespace
+WHERE con.contype = 'f'
+  AND ns.nspname = $1
+  AND src.relname = ANY($2)
+ORDER BY src.relname, con.conname`
+
+type foreignKey struct {
+	Name              string   `json:"name"`
+	Table             string   `json:"table"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+}
+
+// foreignKeyGraph describes the foreign keys between the replicated tables.
+type foreignKeyGraph struct {
+	Schema      string       `json:"schema"`
+	Tables      []string     `json:"tables"`
+	ForeignKeys []foreignKey `json:"foreign_keys"`
+	// Order lists the tables so that every table comes after the tables it
+	// references. Tables that are part of a reference cycle are appended at
+	// the end in name order.
+	Order []string `json:"order"`
+}
+
+func queryForeignKeyGraph(ctx context.Context, db *sql.DB, schema string, tables []string) (*foreignKeyGraph, error) {
+	rows, err := db.QueryContext(ctx, foreignKeysQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	graph := &foreignKeyGraph{
+		Schema:      schema,
+		Tables:      tables,
+		ForeignKeys: []foreignKey{},
+	}
+	for rows.Next() {
+		var fk foreignKey
+		if err := rows.Scan(&fk.Name, &fk.Table, &fk.ReferencedTable, pq.Array(&fk.Columns), pq.Array(&fk.ReferencedColumns)); err != nil {
+			return nil, err
+		}
+		graph.ForeignKeys = append(graph.ForeignKeys, fk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	graph.Order = graph.writeOrder()
+	return graph, nil
+}
+
+// writeOrder sorts the replicated tables topologically by their foreign
+// keys. Self references and references to tables that aren't replicated are
+// ignored.
+func (g *foreignKeyGraph) writeOrder() []string {
+	dependsOn := make(map[string]map[string]struct{}, len(g.Tables))
+	for _, table := range g.Tables {
+		dependsOn[table] = map[string]struct{}{}
+	}
+	for _, fk := range g.ForeignKeys {
+		if _, ok := dependsOn[fk.ReferencedTable]; !ok || fk.Table == fk.ReferencedTable {
+			continue
+		}
+		dependsOn[fk.Table][fk.ReferencedTable] = struct{}{}
+	}
+
+	order := make([]string, 0, len(g.Tables))
+	done := make(map[string]struct{}, len(g.Tables))
+	for len(order) < len(g.Tables) {
+		var ready []string
+		for table, deps := range dependsOn {
+			if _, ok := done[table]; ok {
+				continue
+			}
+			resolved := true
+			for dep := range deps {
+				if _, ok := done[dep]; !ok {
+					resolved = false
+					break
+				}
+			}
+			if resolved {
+				ready = append(ready, table)
+			}
+		}
+		if len(ready) == 0 {
+			break
+		}
+		sort.Strings(ready)
+		for _, table := range ready {
+			done[table] = struct{}{}
+		}
+		order = append(order, ready...)
+	}
+
+	var cyclic []string
+	for table := range dependsOn {
+		if _, ok := done[table]; !ok {
+			cyclic = append(cyclic, table)
+		}
+	}
+	sort.Strings(cyclic)
+	return append(order, cyclic...)
+}
+
+func (g *foreignKeyGraph) message() (*service.Message, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "foreign_keys")
+	return msg, nil
+}
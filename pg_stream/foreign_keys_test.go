@@ -0,0 +1,32 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForeignKeyGraphWriteOrder(t *testing.T) {
+	graph := &foreignKeyGraph{
+		Tables: []string{"order_items", "orders", "users", "products", "a", "b"},
+		ForeignKeys: []foreignKey{
+			{Table: "order_items", ReferencedTable: "orders"},
+			{Table: "order_items", ReferencedTable: "products"},
+			{Table: "orders", ReferencedTable: "users"},
+			{Table: "users", ReferencedTable: "users"},
+			{Table: "users", ReferencedTable: "tenants"},
+			{Table: "a", ReferencedTable: "b"},
+			{Table: "b", ReferencedTable: "a"},
+		},
+	}
+
+	assert.Equal(t, []string{"products", "users", "orders", "order_items", "a", "b"}, graph.writeOrder())
+}
@@ -30,9 +30,10 @@ import (
 	"github.com/ory/dockertest/v3/docker"
 )
 
-func TestIntegrationPgCDC(t *testing.T) {
-	t.Parallel()
-	tmpDir := t.TempDir()
+// startPostgres runs a Postgres server with the wal2json plugin and the
+// flights table, and returns its host, port and a connection to it.
+func startPostgres(t *testing.T) (string, string, *sql.DB) {
+	t.Helper()
 	pool, err := dockertest.NewPool("")
 	require.NoError(t, err)
 
@@ -99,7 +100,19 @@ func TestIntegrationPgCDC(t *testing.T) {
 		log.Fatalf("Could not connect to docker: %s", err)
 	}
 
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return hostAndPortSplited[0], hostAndPortSplited[1], db
+}
+
+func TestIntegrationPgCDC(t *testing.T) {
+	t.Parallel()
+	tmpDir := t.TempDir()
+	host, port, db := startPostgres(t)
+
 	fake := faker.New()
+	var err error
 	for i := 0; i < 1000; i++ {
 		_, err = db.Exec("INSERT INTO flights (name, created_at) VALUES ($1, $2);", fake.Address().City(), fake.Time().RFC1123(time.Now()))
 		require.NoError(t, err)
@@ -118,7 +131,7 @@ pg_stream:
     database: dbname
     tables:
        - flights
-`, hostAndPortSplited[0], hostAndPortSplited[1])
+`, host, port)
 
 	cacheConf := fmt.Sprintf(`
 label: pg_stream_cache
@@ -208,8 +221,64 @@ file:
 
 	require.NoError(t, streamOut.StopWithin(time.Second*10))
 	t.Log("All the conditions are met 🎉")
+}
 
-	t.Cleanup(func() {
-		db.Close()
-	})
+func TestIntegrationSharedPoolSlotGuard(t *testing.T) {
+	t.Parallel()
+	host, port, db := startPostgres(t)
+
+	fake := faker.New()
+	for i := 0; i < 100; i++ {
+		_, err := db.Exec("INSERT INTO flights (name, created_at) VALUES ($1, $2);", fake.Address().City(), fake.Time().RFC1123(time.Now()))
+		require.NoError(t, err)
+	}
+
+	// Both inputs hold their slot guard while snapshotting and querying the
+	// catalog through a pool of two connections.
+	input := func(slotName string) string {
+		return fmt.Sprintf(`
+pg_stream:
+    host: %s
+    port: %s
+    user: user_name
+    password: secret
+    database: dbname
+    schema: public
+    tls: none
+    slot_name: %s
+    stream_snapshot: true
+    tables: [ flights ]
+    shared_pool:
+        name: shared
+        max_connections: 2
+`, host, port, slotName)
+	}
+
+	builder := service.NewStreamBuilder()
+	require.NoError(t, builder.SetLoggerYAML(`level: OFF`))
+	require.NoError(t, builder.AddInputYAML(input("shared_pool_a")))
+	require.NoError(t, builder.AddInputYAML(input("shared_pool_b")))
+
+	var received int
+	var receivedMut sync.Mutex
+	require.NoError(t, builder.AddConsumerFunc(func(c context.Context, m *service.Message) error {
+		receivedMut.Lock()
+		received++
+		receivedMut.Unlock()
+		return nil
+	}))
+
+	stream, err := builder.Build()
+	require.NoError(t, err)
+	go func() {
+		_ = stream.Run(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		receivedMut.Lock()
+		defer receivedMut.Unlock()
+		return received == 200
+	}, time.Second*25, time.Millisecond*100)
+
+	require.NoError(t, stream.StopWithin(time.Second*10))
 }
@@ -0,0 +1,109 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+type TlsVerify string
+
+const TlsNoVerify TlsVerify = "none"
+const TlsRequireVerify TlsVerify = "require"
+
+// The snapshot orders with a special meaning, any other order is the name of
+// the column to order snapshot rows by.
+const (
+	SnapshotOrderPrimaryKey = "pk"
+	SnapshotOrderNone       = "none"
+)
+
+// The ways the snapshot of the tables is planned.
+const (
+	// SnapshotPlanningUniform snapshots tables in the configured order, and
+	// scans each table to find its average row size.
+	SnapshotPlanningUniform = "uniform"
+	// SnapshotPlanningSize snapshots the largest tables first, and derives
+	// the average row size of each table from its statistics.
+	SnapshotPlanningSize = "size"
+)
+
+type Config struct {
+	DbHost                     string    `yaml:"db_host"`
+	DbPassword                 string    `yaml:"db_password"`
+	DbUser                     string    `yaml:"db_user"`
+	DbPort                     int       `yaml:"db_port"`
+	DbName                     string    `yaml:"db_name"`
+	DbSchema                   string    `yaml:"db_schema"`
+	DbTables                   []string  `yaml:"db_tables"`
+	ReplicationSlotName        string    `yaml:"replication_slot_name"`
+	TlsVerify                  TlsVerify `yaml:"tls_verify"`
+	StreamOldData              bool      `yaml:"stream_old_data"`
+	SeparateChanges            bool      `yaml:"separate_changes"`
+	SnapshotMemorySafetyFactor float64   `yaml:"snapshot_memory_safety_factor"`
+	BatchSize                  int       `yaml:"batch_size"`
+	// SnapshotBufferSize is the number of snapshot rows read ahead of the
+	// consumer, defaults to 100.
+	SnapshotBufferSize int `yaml:"snapshot_buffer_size"`
+	// StandbyMessageTimeout is the interval of standby status updates sent
+	// to the server, defaults to 10 seconds.
+	StandbyMessageTimeout time.Duration `yaml:"standby_message_timeout"`
+	// KeepaliveResponseDeadline is how late standby status updates may be
+	// sent, later updates are counted as keepalive deadline misses. Defaults
+	// to 1 second.
+	KeepaliveResponseDeadline time.Duration `yaml:"keepalive_response_deadline"`
+	// PluginOptions are passed to the output plugin on START_REPLICATION.
+	PluginOptions map[string]string `yaml:"plugin_options"`
+	// SnapshotOrder is the order snapshot rows of each table are emitted in.
+	SnapshotOrder string `yaml:"snapshot_order"`
+	// UseNumber decodes numbers of streamed changes as json.Number rather
+	// than float64 so that callers can handle them without precision loss.
+	UseNumber bool `yaml:"use_number"`
+	// SnapshotPlanning is how the snapshot of the tables is planned, defaults
+	// to SnapshotPlanningUniform.
+	SnapshotPlanning string `yaml:"snapshot_planning"`
+	// SnapshotProgress emits a progress report on the snapshot channel after
+	// each chunk of snapshot rows.
+	SnapshotProgress bool `yaml:"snapshot_progress"`
+	// StartLSN, when later than the confirmed position of an existing slot,
+	// is where streaming resumes from. It is ignored for new slots.
+	StartLSN string `yaml:"start_lsn"`
+	// ApplicationName, when set, is reported as the application_name of the
+	// replication and snapshot connections in pg_stat_activity.
+	ApplicationName string `yaml:"application_name"`
+	// SnapshotStatementTimeout, when set, cancels statements of the snapshot
+	// transaction running for longer.
+	SnapshotStatementTimeout time.Duration `yaml:"snapshot_statement_timeout"`
+	// SnapshotMaxTxDuration, when set, bounds how long a snapshot
+	// transaction stays open. Longer snapshots are re-anchored on a fresh
+	// transaction and page through rows by primary key, which requires
+	// SnapshotOrderPrimaryKey.
+	SnapshotMaxTxDuration time.Duration `yaml:"snapshot_max_transaction_duration"`
+	// SnapshotFilters are SQL conditions by table name that restrict the
+	// rows of the tables read by the snapshot.
+	SnapshotFilters map[string]string `yaml:"snapshot_filters"`
+	// DegradeColumns emits snapshot columns whose values can't be decoded
+	// into their Go type as raw text for the rest of the table, rather than
+	// failing the snapshot.
+	DegradeColumns bool `yaml:"degrade_columns"`
+	// LookupFunc, when set, resolves the host of the replication connection.
+	LookupFunc pgconn.LookupFunc `yaml:"-"`
+	// DialFunc, when set, dials the replication connection.
+	DialFunc pgconn.DialFunc `yaml:"-"`
+	// SnapshotPool, when set, provides the connection for the snapshot
+	// transaction instead of a dedicated pool.
+	SnapshotPool *sql.DB `yaml:"-"`
+
+	Logger  *service.Logger  `yaml:"-"`
+	Metrics *service.Metrics `yaml:"-"`
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pglogrepl"
+)
+
+// ErrFakeDisconnect is reported by a FakeSource when its script schedules a
+// disconnect.
+var ErrFakeDisconnect = errors.New("fake replication source disconnected")
+
+// FakeScript scripts the transactions streamed by fake replication sources.
+// Like a replication slot it remembers the acknowledged position, sources
+// created after a disconnect resume after the last acknowledged transaction.
+type FakeScript struct {
+	// Snapshot holds the rows of the initial snapshot as wal2json format
+	// version 1 change objects. They are sent as snapshot rows by sources
+	// created while no transaction is acknowledged, before the transactions.
+	Snapshot []string
+	// Transactions are wal2json format version 1 payloads. The LSN of a
+	// transaction is its position in the list plus LSNOffset, starting at
+	// 0/1. Malformed payloads fail the source like they would fail a Stream.
+	Transactions []string
+	// LSNOffset shifts the LSNs of the transactions, so that the LSNs of the
+	// sources of several scripts don't collide.
+	LSNOffset int
+	// DuplicateEvery sends every nth transaction twice with the same LSN.
+	DuplicateEvery int
+	// DisconnectEvery fails the source with ErrFakeDisconnect after every
+	// nth transaction sent.
+	DisconnectEvery int
+	// DisconnectMidTransaction fails the source before the last change of
+	// the transactions DisconnectEvery disconnects after is sent, like a
+	// connection lost in the middle of a transaction. The transactions are
+	// delivered whole again after reconnecting.
+	DisconnectMidTransaction bool
+	// OnAck is called with every position acknowledged to the sources of
+	// the script, in order.
+	OnAck func(lsn string)
+
+	mut   sync.Mutex
+	acked int
+	sent  int
+}
+
+// Source creates a FakeSource streaming the script. It has the signature of
+// a SourceConstructor.
+func (f *FakeScript) Source(config Config) (ReplicationSource, error) {
+	f.mut.Lock()
+	start := f.acked
+	f.mut.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &FakeSource{
+		script:           f,
+		config:           config,
+		changeFilter:     NewChangeFilter(config.DbTables, config.DbSchema),
+		messages:         make(chan Wal2JsonChanges),
+		snapshotMessages: make(chan Wal2JsonChanges, len(f.Snapshot)),
+		errors:           make(chan error, 1),
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+	go s.run(start)
+	return s, nil
+}
+
+// FakeSource is an in-process ReplicationSource streaming the transactions of
+// a FakeScript, for deterministic tests of failure handling.
+type FakeSource struct {
+	script       *FakeScript
+	config       Config
+	changeFilter ChangeFilter
+
+	messages         chan Wal2JsonChanges
+	snapshotMessages chan Wal2JsonChanges
+	errors           chan error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *FakeSource) run(start int) {
+	if start == 0 && !s.sendSnapshot() {
+		return
+	}
+	for i := start; i < len(s.script.Transactions); i++ {
+		var tx WallMessage
+		decoder := json.NewDecoder(bytes.NewReader([]byte(s.script.Transactions[i])))
+		if s.config.UseNumber {
+			decoder.UseNumber()
+		}
+		if err := decoder.Decode(&tx); err != nil {
+			s.errors <- fmt.Errorf("can't parse change from database to filter it: %w", err)
+			return
+		}
+
+		s.script.mut.Lock()
+		s.script.sent++
+		sent := s.script.sent
+		s.script.mut.Unlock()
+
+		sends := 1
+		if s.script.DuplicateEvery > 0 && sent%s.script.DuplicateEvery == 0 {
+			sends = 2
+		}
+		disconnect := s.script.DisconnectEvery > 0 && sent%s.script.DisconnectEvery == 0
+		lsn := pglogrepl.LSN(s.script.LSNOffset + i + 1).String()
+		for ; sends > 0; sends-- {
+			s.changeFilter.filterTransaction(lsn, tx, s.config.SeparateChanges, func(change Wal2JsonChanges) {
+				if disconnect && s.script.DisconnectMidTransaction && change.TransactionEnd {
+					return
+				}
+				select {
+				case s.messages <- change:
+				case <-s.ctx.Done():
+				}
+			})
+		}
+
+		if disconnect {
+			s.errors <- ErrFakeDisconnect
+			return
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// sendSnapshot sends the snapshot rows and returns false when the source
+// failed or was stopped.
+func (s *FakeSource) sendSnapshot() bool {
+	for _, row := range s.script.Snapshot {
+		var change WallMessage
+		decoder := json.NewDecoder(bytes.NewReader([]byte(`{"change":[` + row + `]}`)))
+		if s.config.UseNumber {
+			decoder.UseNumber()
+		}
+		if err := decoder.Decode(&change); err != nil {
+			s.errors <- fmt.Errorf("can't parse snapshot row: %w", err)
+			return false
+		}
+		s.changeFilter.FilterChange("", change, func(changes Wal2JsonChanges) {
+			changes.Lsn, changes.TransactionEnd = nil, false
+			select {
+			case s.snapshotMessages <- changes:
+			case <-s.ctx.Done():
+			}
+		})
+	}
+	return s.ctx.Err() == nil
+}
+
+// Acknowledged returns the position acknowledged by the sources of the
+// script, as a replication slot would have confirmed it.
+func (f *FakeScript) Acknowledged() string {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if f.acked == 0 {
+		return pglogrepl.LSN(0).String()
+	}
+	return pglogrepl.LSN(f.LSNOffset + f.acked).String()
+}
+
+func (s *FakeSource) SnapshotMessageC() <-chan Wal2JsonChanges {
+	return s.snapshotMessages
+}
+
+func (s *FakeSource) LrMessageC() <-chan Wal2JsonChanges {
+	return s.messages
+}
+
+func (s *FakeSource) ErrorC() <-chan error {
+	return s.errors
+}
+
+// AckLSN records the position of the script acknowledged.
+func (s *FakeSource) AckLSN(lsn string) {
+	if s.script.OnAck != nil {
+		s.script.OnAck(lsn)
+	}
+	pos, err := pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		return
+	}
+	s.script.mut.Lock()
+	if acked := int(pos) - s.script.LSNOffset; acked > s.script.acked {
+		s.script.acked = acked
+	}
+	s.script.mut.Unlock()
+}
+
+func (s *FakeSource) Stop() error {
+	s.cancel()
+	return nil
+}
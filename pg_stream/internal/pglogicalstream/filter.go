@@ -0,0 +1,126 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import "time"
+
+type ChangeFilter struct {
+	tablesWhiteList map[string]bool
+	schemaWhiteList string
+	interner        *stringInterner
+}
+
+type Filtered func(change Wal2JsonChanges)
+
+func NewChangeFilter(tableSchemas []string, schema string) ChangeFilter {
+	tablesMap := map[string]bool{}
+	for _, table := range tableSchemas {
+		tablesMap[table] = true
+	}
+
+	return ChangeFilter{
+		tablesWhiteList: tablesMap,
+		schemaWhiteList: schema,
+		interner:        newStringInterner(),
+	}
+}
+
+func (c ChangeFilter) FilterChange(lsn string, changes WallMessage, OnFiltered Filtered) {
+	if len(changes.Change) == 0 {
+		return
+	}
+
+	var commitTime time.Time
+	if changes.Timestamp != "" {
+		commitTime, _ = parseWal2JsonTimestamp(changes.Timestamp)
+	}
+
+	var messages []LogicalMessage
+	for _, ch := range changes.Change {
+		if ch.Kind == "message" {
+			messages = append(messages, LogicalMessage{Prefix: ch.Prefix, Content: ch.Content})
+		}
+	}
+
+	var filtered []Wal2JsonChanges
+	for _, ch := range changes.Change {
+		var filteredChanges = Wal2JsonChanges{
+			Lsn:       &lsn,
+			Xid:       changes.Xid,
+			Timestamp: commitTime,
+			Messages:  messages,
+			Changes:   []Wal2JsonChange{},
+		}
+		if ch.Schema != c.schemaWhiteList {
+			continue
+		}
+
+		if _, tableExist := c.tablesWhiteList[ch.Table]; !tableExist {
+			continue
+		}
+
+		if ch.Kind == "delete" {
+			ch.Columnvalues = make([]interface{}, len(ch.Oldkeys.KeyValues))
+			copy(ch.Columnvalues, ch.Oldkeys.KeyValues)
+		}
+
+		change := Wal2JsonChange{
+			Kind:         ch.Kind,
+			Schema:       ch.Schema,
+			Table:        ch.Table,
+			ColumnNames:  ch.Columnnames,
+			ColumnTypes:  ch.Columntypes,
+			ColumnValues: ch.Columnvalues,
+			OldKeys:      ch.Oldkeys,
+		}
+		if c.interner != nil {
+			c.interner.internChange(&change)
+		}
+		filteredChanges.Changes = append(filteredChanges.Changes, change)
+
+		filtered = append(filtered, filteredChanges)
+	}
+
+	for i, filteredChanges := range filtered {
+		filteredChanges.TransactionEnd = i == len(filtered)-1
+		OnFiltered(filteredChanges)
+	}
+}
+
+// filterTransaction filters the changes of a transaction like FilterChange.
+// Unless separateChanges is set all the changes are passed on as one.
+// Transactions with no changes left once filtered, such as empty transactions
+// or transactions of other tables, are passed on without changes, so that
+// their LSN is confirmed in order with the changes received before them.
+func (c ChangeFilter) filterTransaction(lsn string, changes WallMessage, separateChanges bool, onFiltered Filtered) {
+	var tx Wal2JsonChanges
+	c.FilterChange(lsn, changes, func(change Wal2JsonChanges) {
+		switch {
+		case separateChanges:
+			onFiltered(change)
+			tx = change
+		case tx.Lsn == nil:
+			tx = change
+		default:
+			tx.Changes = append(tx.Changes, change.Changes...)
+		}
+	})
+	if tx.Lsn == nil {
+		empty := Wal2JsonChanges{Lsn: &lsn, Xid: changes.Xid, TransactionEnd: true}
+		if changes.Timestamp != "" {
+			empty.Timestamp, _ = parseWal2JsonTimestamp(changes.Timestamp)
+		}
+		onFiltered(empty)
+		return
+	}
+	if !separateChanges {
+		tx.TransactionEnd = true
+		onFiltered(tx)
+	}
+}
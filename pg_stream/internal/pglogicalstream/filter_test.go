@@ -0,0 +1,58 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterChangeCarriesCommitTimestamp(t *testing.T) {
+	raw := `{
+		"xid": 5821,
+		"timestamp": "2024-03-01 10:15:30.123456+00",
+		"change": [
+			{"kind": "insert", "schema": "public", "table": "flights", "columnnames": ["id"], "columntypes": ["integer"], "columnvalues": [1]},
+			{"kind": "insert", "schema": "public", "table": "other", "columnnames": ["id"], "columntypes": ["integer"], "columnvalues": [2]},
+			{"kind": "delete", "schema": "public", "table": "flights", "oldkeys": {"keynames": ["id"], "keytypes": ["integer"], "keyvalues": [3]}}
+		]
+	}`
+
+	var msg WallMessage
+	require.NoError(t, json.Unmarshal([]byte(raw), &msg))
+
+	var filtered []Wal2JsonChanges
+	NewChangeFilter([]string{"flights"}, "public").FilterChange("0/16B3748", msg, func(change Wal2JsonChanges) {
+		filtered = append(filtered, change)
+	})
+
+	require.Len(t, filtered, 2)
+	expectedTime := time.Date(2024, 3, 1, 10, 15, 30, 123456000, time.UTC)
+	for _, f := range filtered {
+		assert.Equal(t, "0/16B3748", *f.Lsn)
+		assert.Equal(t, uint32(5821), f.Xid)
+		assert.True(t, expectedTime.Equal(f.Timestamp))
+	}
+	assert.Equal(t, []interface{}{float64(3)}, filtered[1].Changes[0].ColumnValues)
+	assert.False(t, filtered[0].TransactionEnd)
+	assert.True(t, filtered[1].TransactionEnd)
+}
+
+func TestParseWal2JsonTimestamp(t *testing.T) {
+	ts, err := parseWal2JsonTimestamp("2024-03-01 15:45:30.5+05:30")
+	require.NoError(t, err)
+	assert.True(t, time.Date(2024, 3, 1, 10, 15, 30, 500000000, time.UTC).Equal(ts))
+
+	_, err = parseWal2JsonTimestamp("not a timestamp")
+	assert.Error(t, err)
+}
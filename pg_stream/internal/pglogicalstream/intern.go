@@ -0,0 +1,80 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import "slices"
+
+// maxInternedStrings bounds the interned strings, so that tables created on
+// the fly can't grow the interner without limit.
+const maxInternedStrings = 100000
+
+// stringInterner deduplicates the kind, schema, table, column name and column
+// type strings of decoded changes, which repeat in every change of a table.
+// The column names and types of consecutive changes of a table share a single
+// slice when they are equal, clipped so that appending to it copies. It isn't
+// safe for concurrent use.
+type stringInterner struct {
+	strings map[string]string
+	names   map[string][]string
+	types   map[string][]string
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{
+		strings: map[string]string{},
+		names:   map[string][]string{},
+		types:   map[string][]string{},
+	}
+}
+
+func (i *stringInterner) intern(s string) string {
+	if interned, ok := i.strings[s]; ok {
+		return interned
+	}
+	if len(i.strings) < maxInternedStrings {
+		i.strings[s] = s
+	}
+	return s
+}
+
+// internList returns the last list of the table when it is equal, otherwise
+// the list with its strings interned, which becomes the last list.
+func (i *stringInterner) internList(last map[string][]string, table string, list []string) []string {
+	if len(list) == 0 {
+		return list
+	}
+	if prev, ok := last[table]; ok && slices.Equal(prev, list) {
+		return prev
+	}
+	for j, s := range list {
+		list[j] = i.intern(s)
+	}
+	list = slices.Clip(list)
+	if _, ok := last[table]; ok || len(last) < maxInternedStrings {
+		last[table] = list
+	}
+	return list
+}
+
+// internChange interns the strings of a decoded change in place.
+func (i *stringInterner) internChange(ch *Wal2JsonChange) {
+	ch.Kind = i.intern(ch.Kind)
+	ch.Schema = i.intern(ch.Schema)
+	ch.Table = i.intern(ch.Table)
+
+	// Changes are filtered to a single schema, tables are keyed by name.
+	ch.ColumnNames = i.internList(i.names, ch.Table, ch.ColumnNames)
+	ch.ColumnTypes = i.internList(i.types, ch.Table, ch.ColumnTypes)
+	for j, s := range ch.OldKeys.KeyNames {
+		ch.OldKeys.KeyNames[j] = i.intern(s)
+	}
+	for j, s := range ch.OldKeys.KeyTypes {
+		ch.OldKeys.KeyTypes[j] = i.intern(s)
+	}
+}
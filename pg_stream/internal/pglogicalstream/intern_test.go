@@ -0,0 +1,51 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"encoding/json"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterChangeInternsStrings(t *testing.T) {
+	filter := NewChangeFilter([]string{"flights"}, "public")
+	decode := func(raw string) Wal2JsonChange {
+		var msg WallMessage
+		require.NoError(t, json.Unmarshal([]byte(raw), &msg))
+		var filtered []Wal2JsonChanges
+		filter.FilterChange("0/1", msg, func(change Wal2JsonChanges) {
+			filtered = append(filtered, change)
+		})
+		require.Len(t, filtered, 1)
+		return filtered[0].Changes[0]
+	}
+
+	raw := `{"change":[{"kind":"insert","schema":"public","table":"flights","columnnames":["id","code"],"columntypes":["integer","text"],"columnvalues":[1,"LH"]}]}`
+	first, second := decode(raw), decode(raw)
+
+	assert.Equal(t, unsafe.StringData(first.Table), unsafe.StringData(second.Table))
+	assert.Equal(t, unsafe.StringData(first.Kind), unsafe.StringData(second.Kind))
+	assert.Equal(t, unsafe.SliceData(first.ColumnNames), unsafe.SliceData(second.ColumnNames))
+	assert.Equal(t, unsafe.SliceData(first.ColumnTypes), unsafe.SliceData(second.ColumnTypes))
+	assert.Equal(t, []interface{}{float64(1), "LH"}, second.ColumnValues)
+
+	// Appending to a shared list doesn't affect the other changes.
+	extended := append(second.ColumnNames, "extra")
+	assert.Equal(t, []string{"id", "code", "extra"}, extended)
+	assert.Equal(t, []string{"id", "code"}, first.ColumnNames)
+
+	// A changed column list replaces the shared one.
+	third := decode(`{"change":[{"kind":"insert","schema":"public","table":"flights","columnnames":["id"],"columntypes":["integer"],"columnvalues":[2]}]}`)
+	assert.Equal(t, []string{"id"}, third.ColumnNames)
+	assert.Equal(t, unsafe.StringData(first.ColumnNames[0]), unsafe.StringData(third.ColumnNames[0]))
+}
@@ -0,0 +1,997 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+// Package pglogicalstream is an in-tree fork of
+// github.com/usedatabrew/pglogicalstream. It streams wal2json changes from a
+// logical replication slot, optionally preceded by a consistent snapshot of
+// the replicated tables.
+package pglogicalstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// defaultPluginOptions are the wal2json options the stream relies on.
+var defaultPluginOptions = map[string]string{
+	"pretty-print":      "true",
+	"include-timestamp": "true",
+	"include-xids":      "true",
+}
+
+// ResolvePluginOptions returns the output plugin options sent on
+// START_REPLICATION. Options override the defaults with the same name.
+func ResolvePluginOptions(options map[string]string) map[string]string {
+	merged := make(map[string]string, len(defaultPluginOptions)+len(options))
+	for k, v := range defaultPluginOptions {
+		merged[k] = v
+	}
+	for k, v := range options {
+		merged[k] = v
+	}
+	return merged
+}
+
+// PublicationName returns the name of the publication created for the slot.
+func PublicationName(slotName string) string {
+	return "pglog_stream_" + slotName
+}
+
+// pluginArguments renders the output plugin options for START_REPLICATION.
+func pluginArguments(options map[string]string) []string {
+	merged := ResolvePluginOptions(options)
+
+	keys := make([]string, 0, len(merged))
+	for k := range merged {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	args := make([]string, 0, len(keys))
+	for _, k := range keys {
+		args = append(args, fmt.Sprintf("%q '%s'", k, strings.ReplaceAll(merged[k], "'", "''")))
+	}
+	return args
+}
+
+type Stream struct {
+	pgConn *pgconn.PgConn
+	// extra copy of db config is required to establish a new db connection
+	// which is required to take snapshot data
+	dbConfig     pgconn.Config
+	streamCtx    context.Context
+	streamCancel context.CancelFunc
+
+	standbyCtxCancel           context.CancelFunc
+	clientXLogPos              pglogrepl.LSN
+	standbyMessageTimeout      time.Duration
+	nextStandbyMessageDeadline time.Time
+	messages                   chan Wal2JsonChanges
+	snapshotMessages           chan Wal2JsonChanges
+	errors                     chan error
+	snapshotName               string
+	changeFilter               ChangeFilter
+	lsnrestart                 pglogrepl.LSN
+	slotName                   string
+	schema                     string
+	tableNames                 []string
+	separateChanges            bool
+	snapshotBatchSize          int
+	snapshotMemorySafetyFactor float64
+	pluginOptions              map[string]string
+	snapshotPool               *sql.DB
+	useNumber                  bool
+	snapshotOrder              string
+	snapshotProgress           bool
+	snapshotPlanning           string
+	snapshotStatementTimeout   time.Duration
+	snapshotMaxTxDuration      time.Duration
+	snapshotFilters            map[string]string
+	degradeColumns             bool
+	degradedColumns            *service.MetricGauge
+	keepaliveResponseDeadline  time.Duration
+	keepaliveMisses            *service.MetricCounter
+	logger                     *service.Logger
+
+	// standbyMut guards writes to the replication connection and the standby
+	// bookkeeping, which are shared between the receive loop and AckLSN.
+	standbyMut sync.Mutex
+	// replyRequestedAt is when the server last requested a standby status
+	// update, it is zero once the update is sent.
+	replyRequestedAt time.Time
+
+	m       sync.Mutex
+	stopped bool
+}
+
+func NewPgStream(config Config) (*Stream, error) {
+	var (
+		cfg *pgconn.Config
+		err error
+	)
+
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(config.DbUser, config.DbPassword),
+		Host:     fmt.Sprintf("%s:%d", config.DbHost, config.DbPort),
+		Path:     "/" + config.DbName,
+		RawQuery: "replication=database",
+	}
+	if config.ApplicationName != "" {
+		connURL.RawQuery += "&application_name=" + url.QueryEscape(config.ApplicationName)
+	}
+	if config.TlsVerify == TlsRequireVerify {
+		connURL.RawQuery += "&sslmode=verify-full"
+	}
+
+	if cfg, err = pgconn.ParseConfig(connURL.String()); err != nil {
+		return nil, err
+	}
+
+	if config.LookupFunc != nil {
+		cfg.LookupFunc = config.LookupFunc
+	}
+	if config.DialFunc != nil {
+		cfg.DialFunc = config.DialFunc
+	}
+
+	if config.TlsVerify == TlsRequireVerify {
+		cfg.TLSConfig = &tls.Config{
+			InsecureSkipVerify: true,
+			ServerName:         config.DbHost,
+		}
+	} else {
+		cfg.TLSConfig = nil
+	}
+
+	dbConn, err := pgconn.ConnectConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tableNames := make([]string, len(config.DbTables))
+	copy(tableNames, config.DbTables)
+
+	// Filters are looked up by the schema qualified table names.
+	snapshotFilters := make(map[string]string, len(config.SnapshotFilters))
+	for table, filter := range config.SnapshotFilters {
+		snapshotFilters[fmt.Sprintf("%s.%s", config.DbSchema, table)] = filter
+	}
+
+	snapshotBufferSize := config.SnapshotBufferSize
+	if snapshotBufferSize <= 0 {
+		snapshotBufferSize = 100
+	}
+
+	stream := &Stream{
+		pgConn:                     dbConn,
+		dbConfig:                   *cfg,
+		messages:                   make(chan Wal2JsonChanges),
+		snapshotMessages:           make(chan Wal2JsonChanges, snapshotBufferSize),
+		errors:                     make(chan error, 1),
+		slotName:                   config.ReplicationSlotName,
+		schema:                     config.DbSchema,
+		snapshotMemorySafetyFactor: config.SnapshotMemorySafetyFactor,
+		separateChanges:            config.SeparateChanges,
+		snapshotBatchSize:          config.BatchSize,
+		tableNames:                 tableNames,
+		pluginOptions:              config.PluginOptions,
+		snapshotPool:               config.SnapshotPool,
+		useNumber:                  config.UseNumber,
+		snapshotOrder:              config.SnapshotOrder,
+		snapshotProgress:           config.SnapshotProgress,
+		snapshotPlanning:           config.SnapshotPlanning,
+		snapshotStatementTimeout:   config.SnapshotStatementTimeout,
+		snapshotMaxTxDuration:      config.SnapshotMaxTxDuration,
+		snapshotFilters:            snapshotFilters,
+		degradeColumns:             config.DegradeColumns,
+		degradedColumns:            config.Metrics.NewGauge("pg_stream_degraded_columns", "table", "column"),
+		keepaliveMisses:            config.Metrics.NewCounter("pg_stream_keepalive_deadline_misses"),
+		changeFilter:               NewChangeFilter(tableNames, config.DbSchema),
+		logger:                     config.Logger,
+	}
+
+	// The publication is recreated from the configured table list on every
+	// connect, so it never accumulates tables that are no longer replicated.
+	// Tables are listed explicitly rather than matched by pattern and wal2json
+	// doesn't read the publication, so there is nothing to prune while
+	// streaming either; dropped tables leave the publication automatically.
+	result := stream.pgConn.Exec(context.Background(), fmt.Sprintf("DROP PUBLICATION IF EXISTS %s;", PublicationName(config.ReplicationSlotName)))
+	if _, err = result.ReadAll(); err != nil {
+		stream.logger.Errorf("drop publication if exists error %s", err.Error())
+	}
+
+	for i, table := range tableNames {
+		tableNames[i] = fmt.Sprintf("%s.%s", config.DbSchema, table)
+	}
+
+	createPublication := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s;", PublicationName(config.ReplicationSlotName), strings.Join(tableNames, ","))
+	stream.logger.Infof("Create publication for table schemas with query %s", createPublication)
+	result = stream.pgConn.Exec(context.Background(), createPublication)
+	if _, err = result.ReadAll(); err != nil {
+		return nil, stream.closeOnError(fmt.Errorf("create publication error: %w", err))
+	}
+	stream.logger.Infof("Created Postgresql publication %s", PublicationName(config.ReplicationSlotName))
+
+	sysident, err := pglogrepl.IdentifySystem(context.Background(), stream.pgConn)
+	if err != nil {
+		return nil, stream.closeOnError(fmt.Errorf("failed to identify the system: %w", err))
+	}
+
+	stream.logger.Infof("System identification result SystemID=%s Timeline=%d XLogPos=%s DBName=%s", sysident.SystemID, sysident.Timeline, sysident.XLogPos, sysident.DBName)
+
+	// Settings are read before the slot is created, as any command on the
+	// replication connection drops the snapshot exported by the slot.
+	stream.standbyMessageTimeout = config.StandbyMessageTimeout
+	if stream.standbyMessageTimeout <= 0 {
+		stream.standbyMessageTimeout = time.Second * 10
+	}
+	if walSenderTimeout, err := stream.walSenderTimeout(); err != nil {
+		stream.logger.Warnf("Failed to read wal_sender_timeout: %v", err)
+	} else if limit := walSenderTimeout / 3; walSenderTimeout > 0 && stream.standbyMessageTimeout > limit {
+		stream.logger.Infof("Sending standby status updates every %v, a third of the wal_sender_timeout of %v", limit, walSenderTimeout)
+		stream.standbyMessageTimeout = limit
+	}
+
+	var freshlyCreatedSlot = false
+	var confirmedLSNFromDB string
+	// check is replication slot exist to get last restart SLN
+	connExecResult := stream.pgConn.Exec(context.Background(), fmt.Sprintf("SELECT confirmed_flush_lsn, slot_type, plugin FROM pg_replication_slots WHERE slot_name = '%s'", config.ReplicationSlotName))
+	slotCheckResults, err := connExecResult.ReadAll()
+	if err != nil {
+		return nil, stream.closeOnError(err)
+	}
+
+	if len(slotCheckResults) == 0 || len(slotCheckResults[0].Rows) == 0 {
+		if err = checkLogicalDecoding(stream.pgConn); err != nil {
+			return nil, stream.closeOnError(err)
+		}
+
+		// here we create a new replication slot because there is no slot found
+		var createSlotResult pglogrepl.CreateReplicationSlotResult
+		createSlotResult, err = pglogrepl.CreateReplicationSlot(context.Background(), stream.pgConn, stream.slotName, outputPlugin,
+			pglogrepl.CreateReplicationSlotOptions{
+				Temporary:      false,
+				SnapshotAction: "EXPORT_SNAPSHOT",
+			})
+		if err != nil {
+			return nil, stream.closeOnError(fmt.Errorf("failed to create replication slot for the database: %w", explainSlotCreationError(err)))
+		}
+		stream.snapshotName = createSlotResult.SnapshotName
+		freshlyCreatedSlot = true
+	} else {
+		slotCheckRow := slotCheckResults[0].Rows[0]
+		if err = checkSlotPlugin(stream.slotName, string(slotCheckRow[1]), string(slotCheckRow[2])); err != nil {
+			return nil, stream.closeOnError(err)
+		}
+		confirmedLSNFromDB = string(slotCheckRow[0])
+		stream.logger.Infof("Replication slot restart LSN extracted from DB: %s", confirmedLSNFromDB)
+	}
+
+	var lsnrestart pglogrepl.LSN
+	if freshlyCreatedSlot {
+		lsnrestart = sysident.XLogPos
+	} else if lsnrestart, err = pglogrepl.ParseLSN(confirmedLSNFromDB); err != nil {
+		return nil, stream.closeOnError(err)
+	}
+	if config.StartLSN != "" {
+		startLSN, err := pglogrepl.ParseLSN(config.StartLSN)
+		if err != nil {
+			return nil, stream.closeOnError(fmt.Errorf("failed to parse the start LSN: %w", err))
+		}
+		switch {
+		case freshlyCreatedSlot:
+			stream.logger.Warnf("Ignoring the start LSN %s as the replication slot was just created", startLSN)
+		case startLSN > lsnrestart:
+			stream.logger.Infof("Resuming from the start LSN %s ahead of the slot's confirmed LSN %s", startLSN, lsnrestart)
+			lsnrestart = startLSN
+		}
+	}
+
+	stream.lsnrestart = lsnrestart
+	stream.clientXLogPos = lsnrestart
+
+	stream.keepaliveResponseDeadline = config.KeepaliveResponseDeadline
+	if stream.keepaliveResponseDeadline <= 0 {
+		stream.keepaliveResponseDeadline = time.Second
+	}
+	stream.nextStandbyMessageDeadline = time.Now().Add(stream.standbyMessageTimeout)
+	stream.streamCtx, stream.streamCancel = context.WithCancel(context.Background())
+
+	if !freshlyCreatedSlot || !config.StreamOldData {
+		if err = stream.startLr(); err != nil {
+			return nil, stream.closeOnError(err)
+		}
+		go stream.streamMessagesAsync()
+	} else {
+		// New messages will be streamed after the snapshot has been processed.
+		go stream.processSnapshot()
+	}
+
+	return stream, nil
+}
+
+func (s *Stream) closeOnError(err error) error {
+	_ = s.pgConn.Close(context.Background())
+	return err
+}
+
+// fail reports an error that terminated the background streaming, it is
+// surfaced to the consumer through ErrorC.
+func (s *Stream) fail(err error) {
+	s.m.Lock()
+	stopped := s.stopped
+	s.m.Unlock()
+	if stopped {
+		return
+	}
+
+	s.logger.Errorf("%v", err)
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+func (s *Stream) startLr() error {
+	err := pglogrepl.StartReplication(context.Background(), s.pgConn, s.slotName, s.lsnrestart, pglogrepl.StartReplicationOptions{PluginArgs: pluginArguments(s.pluginOptions)})
+	if err != nil {
+		return fmt.Errorf("starting replication slot failed: %w", err)
+	}
+	s.logger.Infof("Started logical replication on slot %s", s.slotName)
+	return nil
+}
+
+func (s *Stream) AckLSN(lsn string) {
+	clientXLogPos, err := pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		s.fail(fmt.Errorf("failed to parse LSN for acknowledge: %w", err))
+		return
+	}
+
+	s.standbyMut.Lock()
+	defer s.standbyMut.Unlock()
+
+	s.clientXLogPos = clientXLogPos
+	err = pglogrepl.SendStandbyStatusUpdate(context.Background(), s.pgConn, pglogrepl.StandbyStatusUpdate{
+		WALApplyPosition: s.clientXLogPos,
+		WALWritePosition: s.clientXLogPos,
+		ReplyRequested:   true,
+	})
+	if err != nil {
+		s.fail(fmt.Errorf("SendStandbyStatusUpdate failed: %w", err))
+		return
+	}
+	s.logger.Debugf("Sent Standby status message at LSN#%s", s.clientXLogPos.String())
+	s.nextStandbyMessageDeadline = time.Now().Add(s.standbyMessageTimeout)
+}
+
+func (s *Stream) sendStandbyStatusIfDue() (time.Time, error) {
+	s.standbyMut.Lock()
+	defer s.standbyMut.Unlock()
+
+	now := time.Now()
+	if now.After(s.nextStandbyMessageDeadline) {
+		late := now.Sub(s.nextStandbyMessageDeadline) > s.keepaliveResponseDeadline
+		if !s.replyRequestedAt.IsZero() {
+			late = now.Sub(s.replyRequestedAt) > s.keepaliveResponseDeadline
+		}
+		if late {
+			s.keepaliveMisses.Incr(1)
+		}
+
+		err := pglogrepl.SendStandbyStatusUpdate(context.Background(), s.pgConn, pglogrepl.StandbyStatusUpdate{
+			WALWritePosition: s.clientXLogPos,
+		})
+		if err != nil {
+			return time.Time{}, fmt.Errorf("SendStandbyStatusUpdate failed: %w", err)
+		}
+		s.logger.Debugf("Sent Standby status message at LSN#%s", s.clientXLogPos.String())
+		s.nextStandbyMessageDeadline = time.Now().Add(s.standbyMessageTimeout)
+		s.replyRequestedAt = time.Time{}
+	}
+	return s.nextStandbyMessageDeadline, nil
+}
+
+// keepalive sends standby status updates when they are due independently of
+// the receive loop, which blocks while the consumer applies backpressure.
+// Otherwise the server terminates the connection once wal_sender_timeout
+// elapses without an update.
+func (s *Stream) keepalive() {
+	ticker := time.NewTicker(s.keepaliveResponseDeadline / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.sendStandbyStatusIfDue(); err != nil {
+				s.fail(err)
+				return
+			}
+		case <-s.streamCtx.Done():
+			return
+		}
+	}
+}
+
+// walSenderTimeout reads the wal_sender_timeout setting of the server, zero
+// means the timeout is disabled.
+func (s *Stream) walSenderTimeout() (time.Duration, error) {
+	data, err := s.pgConn.Exec(context.Background(), "SHOW wal_sender_timeout;").ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 || len(data[0].Rows) == 0 {
+		return 0, errors.New("no value returned")
+	}
+	return parsePostgresDuration(string(data[0].Rows[0][0]))
+}
+
+// parsePostgresDuration parses a time setting as shown by the server, such as
+// 60s or 1min. Values without a unit are milliseconds.
+func parsePostgresDuration(v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	i := strings.IndexFunc(v, func(r rune) bool { return r < '0' || r > '9' })
+	if i == -1 {
+		i = len(v)
+	}
+	n, err := strconv.Atoi(v[:i])
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+
+	units := map[string]time.Duration{
+		"":    time.Millisecond,
+		"us":  time.Microsecond,
+		"ms":  time.Millisecond,
+		"s":   time.Second,
+		"min": time.Minute,
+		"h":   time.Hour,
+		"d":   24 * time.Hour,
+	}
+	unit, ok := units[strings.TrimSpace(v[i:])]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration unit in %q", v)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (s *Stream) streamMessagesAsync() {
+	go s.keepalive()
+
+	for {
+		select {
+		case <-s.streamCtx.Done():
+			s.logger.Warn("Stream was cancelled...exiting...")
+			return
+		default:
+			deadline, err := s.sendStandbyStatusIfDue()
+			if err != nil {
+				s.fail(err)
+				return
+			}
+
+			ctx, cancel := context.WithDeadline(s.streamCtx, deadline)
+			s.m.Lock()
+			s.standbyCtxCancel = cancel
+			s.m.Unlock()
+			rawMsg, err := s.pgConn.ReceiveMessage(ctx)
+			cancel()
+
+			s.m.Lock()
+			stopped := s.stopped
+			s.m.Unlock()
+			if err != nil && (errors.Is(err, context.Canceled) || stopped) {
+				s.logger.Warn("Service was interrupted....stop reading from replication slot")
+				return
+			}
+
+			if err != nil {
+				if pgconn.Timeout(err) {
+					continue
+				}
+				s.fail(fmt.Errorf("failed to receive messages from PostgreSQL: %w", err))
+				return
+			}
+
+			if errMsg, ok := rawMsg.(*pgproto3.ErrorResponse); ok {
+				s.fail(fmt.Errorf("received broken Postgres WAL. Error: %+v", errMsg))
+				return
+			}
+
+			msg, ok := rawMsg.(*pgproto3.CopyData)
+			if !ok {
+				s.logger.Warnf("Received unexpected message: %T", rawMsg)
+				continue
+			}
+
+			switch msg.Data[0] {
+			case pglogrepl.PrimaryKeepaliveMessageByteID:
+				pkm, err := pglogrepl.ParsePrimaryKeepaliveMessage(msg.Data[1:])
+				if err != nil {
+					s.fail(fmt.Errorf("ParsePrimaryKeepaliveMessage failed: %w", err))
+					return
+				}
+
+				if pkm.ReplyRequested {
+					s.standbyMut.Lock()
+					s.nextStandbyMessageDeadline = time.Time{}
+					s.replyRequestedAt = time.Now()
+					s.standbyMut.Unlock()
+				}
+
+			case pglogrepl.XLogDataByteID:
+				xld, err := pglogrepl.ParseXLogData(msg.Data[1:])
+				if err != nil {
+					s.fail(fmt.Errorf("ParseXLogData failed: %w", err))
+					return
+				}
+				clientXLogPos := xld.WALStart + pglogrepl.LSN(len(xld.WALData))
+				var changes WallMessage
+				decoder := json.NewDecoder(bytes.NewReader(xld.WALData))
+				if s.useNumber {
+					decoder.UseNumber()
+				}
+				if err := decoder.Decode(&changes); err != nil {
+					s.fail(fmt.Errorf("can't parse change from database to filter it: %w", err))
+					return
+				}
+
+				s.changeFilter.filterTransaction(clientXLogPos.String(), changes, s.separateChanges, func(change Wal2JsonChanges) {
+					select {
+					case s.messages <- change:
+					case <-s.streamCtx.Done():
+					}
+				})
+			}
+		}
+	}
+}
+
+func (s *Stream) processSnapshot() {
+	snapshotter, err := NewSnapshotter(s.dbConfig, s.snapshotPool, s.snapshotName, s.snapshotStatementTimeout, s.logger)
+	if err != nil {
+		s.cleanUpOnFailure()
+		s.fail(fmt.Errorf("failed to create database snapshot: %w", err))
+		return
+	}
+	if err = snapshotter.Prepare(); err != nil {
+		s.cleanUpOnFailure()
+		s.fail(fmt.Errorf("failed to prepare database snapshot: %w", err))
+		return
+	}
+	defer func() {
+		_ = snapshotter.ReleaseSnapshot()
+		_ = snapshotter.CloseConn()
+	}()
+
+	tables, stats, err := s.planSnapshot(snapshotter)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	for _, table := range tables {
+		if err := s.processSnapshotTable(snapshotter, table, stats[table]); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+
+	if err = s.startLr(); err != nil {
+		s.fail(err)
+		return
+	}
+	go s.streamMessagesAsync()
+}
+
+// planSnapshot returns the tables in the order they are snapshotted, along
+// with their statistics when the plan or the progress reports need them.
+// Tables are snapshotted one at a time on the snapshot connection, the plan
+// orders them and sizes their pages but doesn't split or group them.
+func (s *Stream) planSnapshot(snapshotter *Snapshotter) ([]string, map[string]TableStats, error) {
+	tables := make([]string, len(s.tableNames))
+	copy(tables, s.tableNames)
+	if s.snapshotPlanning != SnapshotPlanningSize && !s.snapshotProgress {
+		return tables, nil, nil
+	}
+
+	stats := make(map[string]TableStats, len(tables))
+	for _, table := range tables {
+		tableStats, err := snapshotter.FindTableStats(table)
+		if err != nil {
+			return nil, nil, err
+		}
+		stats[table] = tableStats
+	}
+	if s.snapshotPlanning == SnapshotPlanningSize {
+		sortTablesBySize(tables, stats)
+		s.logger.Infof("Planned snapshot of tables by size: %v", tables)
+	}
+	return tables, stats, nil
+}
+
+// sortTablesBySize orders the tables largest first, which avoids a long tail
+// where a huge table is left once everything else is done.
+func sortTablesBySize(tables []string, stats map[string]TableStats) {
+	sort.SliceStable(tables, func(i, j int) bool {
+		return stats[tables[i]].Bytes > stats[tables[j]].Bytes
+	})
+}
+
+func (s *Stream) processSnapshotTable(snapshotter *Snapshotter, table string, stats TableStats) error {
+	s.logger.Infof("Processing snapshot for table %s", table)
+
+	var avgRowSize int64
+	if s.snapshotPlanning == SnapshotPlanningSize {
+		avgRowSize = stats.AvgRowSize()
+	}
+	if avgRowSize == 0 {
+		// Tables that were never analyzed are scanned instead.
+		avgRowSizeBytes, err := snapshotter.FindAvgRowSize(table)
+		if err != nil {
+			return err
+		}
+		avgRowSize = avgRowSizeBytes.Int64
+	}
+
+	availableMemory := getAvailableMemory()
+	batchSize := snapshotter.CalculateBatchSize(availableMemory, uint64(avgRowSize), s.snapshotMemorySafetyFactor)
+	if s.snapshotBatchSize > 0 && batchSize > s.snapshotBatchSize {
+		batchSize = s.snapshotBatchSize
+	}
+	s.logger.Infof("Querying snapshot batch_size=%d available_memory=%d avg_row_size=%d", batchSize, availableMemory, avgRowSize)
+
+	orderBy, err := s.snapshotOrderBy(table)
+	if err != nil {
+		return err
+	}
+
+	columnTypes, err := snapshotter.FindColumnTypes(table)
+	if err != nil {
+		return err
+	}
+
+	// Bounded snapshots page through rows by key, as rows may be inserted or
+	// deleted between the transactions reading the pages.
+	var keyset *SnapshotKeyset
+	if s.snapshotMaxTxDuration > 0 {
+		if keyset, err = s.snapshotKeyset(table, columnTypes); err != nil {
+			return err
+		}
+	}
+
+	filter := s.snapshotFilters[table]
+	progress := SnapshotProgress{Table: unqualifiedTableName(s.schema, table), RowsEstimated: stats.Rows}
+	started := time.Now()
+
+	// Columns degraded to raw text stay degraded for the rest of the table.
+	degraded := map[string]bool{}
+
+	var after []interface{}
+	for offset := 0; ; offset += batchSize {
+		if s.snapshotMaxTxDuration > 0 && snapshotter.TransactionAge() >= s.snapshotMaxTxDuration {
+			if err = snapshotter.Reanchor(); err != nil {
+				return fmt.Errorf("can't re-anchor the snapshot transaction: %w", err)
+			}
+			s.logger.Infof("Re-anchored the snapshot transaction of table %s after %d rows", table, offset)
+		}
+
+		var snapshotRows *sql.Rows
+		if keyset != nil {
+			snapshotRows, err = snapshotter.QuerySnapshotDataAfter(table, filter, *keyset, after, batchSize)
+		} else {
+			snapshotRows, err = snapshotter.QuerySnapshotData(table, filter, orderBy, batchSize, offset)
+		}
+		if err != nil {
+			return fmt.Errorf("can't query snapshot data: %w", err)
+		}
+
+		rowsCount, lastRow, err := s.emitSnapshotRows(table, columnTypes, degraded, snapshotRows)
+		_ = snapshotRows.Close()
+		if err != nil {
+			return err
+		}
+		if keyset != nil && rowsCount > 0 {
+			if after = keyset.After(lastRow); after == nil {
+				return fmt.Errorf("snapshot rows of table %s lack primary key columns %v", table, keyset.Columns)
+			}
+		}
+
+		done := batchSize != rowsCount
+		if s.snapshotProgress {
+			progress.RowsDone += rowsCount
+			progress.RowsPerSecond = float64(progress.RowsDone) / time.Since(started).Seconds()
+			progress.Done = done
+			if err = s.emitSnapshotProgress(progress); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// emitSnapshotProgress sends the progress after the rows it reports on, so
+// consumers receive it in order.
+func (s *Stream) emitSnapshotProgress(progress SnapshotProgress) error {
+	select {
+	case s.snapshotMessages <- Wal2JsonChanges{Progress: &progress}:
+		return nil
+	case <-s.streamCtx.Done():
+		return s.streamCtx.Err()
+	}
+}
+
+// unqualifiedTableName returns the name of a table snapshotted by its schema
+// qualified name as streamed changes carry it, so that snapshot rows and
+// changes of a table are told apart by their phase only.
+func unqualifiedTableName(schema, table string) string {
+	return strings.TrimPrefix(table, schema+".")
+}
+
+// emitSnapshotRows sends the rows as insert changes and returns the last one.
+// The column types are those of the catalog, formatted like the types of
+// streamed changes.
+func (s *Stream) emitSnapshotRows(table string, catalogTypes map[string]string, degraded map[string]bool, snapshotRows *sql.Rows) (int, Wal2JsonChange, error) {
+	var lastRow Wal2JsonChange
+	tableName := unqualifiedTableName(s.schema, table)
+	columnTypes, err := snapshotRows.ColumnTypes()
+	if err != nil {
+		return 0, lastRow, err
+	}
+	columnNames, err := snapshotRows.Columns()
+	if err != nil {
+		return 0, lastRow, err
+	}
+
+	var columnTypesString = make([]string, len(columnTypes))
+	for i, name := range columnNames {
+		columnTypesString[i] = catalogTypes[name]
+	}
+
+	count := len(columnTypes)
+	var rowsCount = 0
+	for snapshotRows.Next() {
+		rowsCount += 1
+		scanArgs := make([]interface{}, count)
+		for i, v := range columnTypes {
+			if degraded[columnNames[i]] {
+				scanArgs[i] = new(sql.NullString)
+				continue
+			}
+			switch v.DatabaseTypeName() {
+			case "VARCHAR", "TEXT", "UUID", "TIMESTAMP":
+				scanArgs[i] = new(sql.NullString)
+			case "BOOL":
+				scanArgs[i] = new(sql.NullBool)
+			case "INT4":
+				scanArgs[i] = new(sql.NullInt64)
+			case "FLOAT4", "FLOAT8":
+				scanArgs[i] = new(sql.NullFloat64)
+			default:
+				scanArgs[i] = new(sql.NullString)
+			}
+		}
+
+		if err := s.scanSnapshotRow(table, columnNames, degraded, snapshotRows, scanArgs); err != nil {
+			return rowsCount, lastRow, err
+		}
+
+		var columnValues = make([]interface{}, len(columnTypes))
+		for i := range columnTypes {
+			columnValues[i] = snapshotColumnValue(scanArgs[i])
+		}
+
+		snapshotChangePacket := Wal2JsonChanges{
+			Changes: []Wal2JsonChange{{
+				Kind:         "insert",
+				Schema:       s.schema,
+				Table:        tableName,
+				ColumnNames:  columnNames,
+				ColumnTypes:  columnTypesString,
+				ColumnValues: columnValues,
+			}},
+		}
+
+		select {
+		case s.snapshotMessages <- snapshotChangePacket:
+		case <-s.streamCtx.Done():
+			return rowsCount, lastRow, s.streamCtx.Err()
+		}
+		lastRow = snapshotChangePacket.Changes[0]
+	}
+	return rowsCount, lastRow, snapshotRows.Err()
+}
+
+// snapshotColumnValue returns the value of a scanned snapshot column, nil
+// for NULLs like streamed changes hold them.
+func snapshotColumnValue(scanned interface{}) interface{} {
+	switch z := scanned.(type) {
+	case *sql.NullBool:
+		if z.Valid {
+			return z.Bool
+		}
+		return nil
+	case *sql.NullString:
+		if z.Valid {
+			return z.String
+		}
+		return nil
+	case *sql.NullInt64:
+		if z.Valid {
+			return z.Int64
+		}
+		return nil
+	case *sql.NullFloat64:
+		if z.Valid {
+			return z.Float64
+		}
+		return nil
+	}
+	return scanned
+}
+
+func (s *Stream) SnapshotMessageC() <-chan Wal2JsonChanges {
+	return s.snapshotMessages
+}
+
+func (s *Stream) LrMessageC() <-chan Wal2JsonChanges {
+	return s.messages
+}
+
+// ErrorC returns a channel that receives an error when streaming stopped
+// unexpectedly.
+func (s *Stream) ErrorC() <-chan error {
+	return s.errors
+}
+
+// cleanUpOnFailure drops replication slot and publication if database snapshotting was failed for any reason
+func (s *Stream) cleanUpOnFailure() {
+	s.logger.Warnf("Cleaning up resources on accident, replication-slot=%s", s.slotName)
+	err := pglogrepl.DropReplicationSlot(context.Background(), s.pgConn, s.slotName, pglogrepl.DropReplicationSlotOptions{Wait: true})
+	if err != nil {
+		s.logger.Errorf("Failed to drop replication slot: %s", err.Error())
+	}
+	_ = s.pgConn.Close(context.Background())
+}
+
+// getPrimaryKeyColumns returns the primary key columns of the table in key
+// order.
+func (s *Stream) getPrimaryKeyColumns(tableName string) ([]string, error) {
+	q := fmt.Sprintf(`
+		SELECT a.attname
+		FROM   pg_index i
+		JOIN   pg_attribute a ON a.attrelid = i.indrelid
+							 AND a.attnum = ANY(i.indkey)
+		WHERE  i.indrelid = '%s'::regclass
+		AND    i.indisprimary
+		ORDER BY array_position(i.indkey::int2[], a.attnum);
+	`, tableName)
+
+	s.standbyMut.Lock()
+	reader := s.pgConn.Exec(context.Background(), q)
+	data, err := reader.ReadAll()
+	s.standbyMut.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 || len(data[0].Rows) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", tableName)
+	}
+
+	columns := make([]string, 0, len(data[0].Rows))
+	for _, row := range data[0].Rows {
+		columns = append(columns, string(row[0]))
+	}
+	return columns, nil
+}
+
+// snapshotKeyset returns the primary key of the table along with the catalog
+// types of its columns.
+func (s *Stream) snapshotKeyset(tableName string, columnTypes map[string]string) (*SnapshotKeyset, error) {
+	columns, err := s.getPrimaryKeyColumns(tableName)
+	if err != nil {
+		return nil, err
+	}
+	keyset := &SnapshotKeyset{Columns: columns, Types: make([]string, len(columns))}
+	for i, column := range columns {
+		keyset.Types[i] = columnTypes[column]
+	}
+	return keyset, nil
+}
+
+// scanSnapshotRow scans the current row. When degrading columns, a column
+// whose value can't be scanned into its type is scanned as raw text instead
+// and the row is scanned again.
+func (s *Stream) scanSnapshotRow(table string, columnNames []string, degraded map[string]bool, snapshotRows *sql.Rows, scanArgs []interface{}) error {
+	for {
+		err := snapshotRows.Scan(scanArgs...)
+		if err == nil || !s.degradeColumns {
+			return err
+		}
+		i, ok := scanErrorColumn(err)
+		if !ok || i >= len(columnNames) || degraded[columnNames[i]] {
+			return err
+		}
+		degraded[columnNames[i]] = true
+		s.degradedColumns.Set(1, table, columnNames[i])
+		s.logger.Warnf("Emitting column %s of table %s as raw text as it can't be decoded: %v", columnNames[i], table, err)
+		scanArgs[i] = new(sql.NullString)
+	}
+}
+
+// scanErrorColumn returns the index of the column a database/sql scan error
+// is about.
+func scanErrorColumn(err error) (int, bool) {
+	var i int
+	if _, serr := fmt.Sscanf(err.Error(), "sql: Scan error on column index %d", &i); serr != nil {
+		return 0, false
+	}
+	return i, true
+}
+
+// snapshotOrderBy returns the ORDER BY clause used to page through the rows
+// of a table. Every clause is a total order so that pages don't overlap.
+func (s *Stream) snapshotOrderBy(tableName string) (string, error) {
+	switch s.snapshotOrder {
+	case "", SnapshotOrderPrimaryKey:
+		columns, err := s.getPrimaryKeyColumns(tableName)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(quoteIdentifiers(columns), ", "), nil
+	case SnapshotOrderNone:
+		// The physical location is stable within the snapshot and doesn't
+		// require a primary key.
+		return "ctid", nil
+	default:
+		return pq.QuoteIdentifier(s.snapshotOrder) + ", ctid", nil
+	}
+}
+
+func (s *Stream) Stop() error {
+	s.m.Lock()
+	if s.stopped {
+		s.m.Unlock()
+		return nil
+	}
+	s.stopped = true
+	standbyCtxCancel := s.standbyCtxCancel
+	s.m.Unlock()
+
+	if s.pgConn != nil {
+		if s.streamCtx != nil {
+			s.streamCancel()
+			if standbyCtxCancel != nil {
+				standbyCtxCancel()
+			}
+		}
+		return s.pgConn.Close(context.Background())
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginArguments(t *testing.T) {
+	assert.Equal(t, []string{
+		`"include-timestamp" 'true'`,
+		`"include-xids" 'true'`,
+		`"pretty-print" 'true'`,
+	}, pluginArguments(nil))
+
+	assert.Equal(t, []string{
+		`"actions" 'insert,update'`,
+		`"filter-tables" 'public.o''brien'`,
+		`"include-timestamp" 'true'`,
+		`"include-xids" 'true'`,
+		`"pretty-print" 'false'`,
+	}, pluginArguments(map[string]string{
+		"actions":       "insert,update",
+		"filter-tables": "public.o'brien",
+		"pretty-print":  "false",
+	}))
+}
+
+func TestParsePostgresDuration(t *testing.T) {
+	for input, expected := range map[string]time.Duration{
+		"60s":   time.Minute,
+		"1min":  time.Minute,
+		"500ms": 500 * time.Millisecond,
+		"2500":  2500 * time.Millisecond,
+		"0":     0,
+	} {
+		d, err := parsePostgresDuration(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, expected, d, input)
+	}
+
+	_, err := parsePostgresDuration("1 fortnight")
+	assert.Error(t, err)
+}
+
+func TestCheckSlotPlugin(t *testing.T) {
+	assert.NoError(t, checkSlotPlugin("rs_orders", "logical", "wal2json"))
+	assert.ErrorContains(t, checkSlotPlugin("rs_orders", "logical", "pgoutput"), "uses the pgoutput output plugin")
+	assert.ErrorContains(t, checkSlotPlugin("rs_orders", "physical", ""), "is a physical slot")
+}
+
+func TestExplainSlotCreationError(t *testing.T) {
+	err := explainSlotCreationError(&pgconn.PgError{Code: "58P01", Message: `could not access file "wal2json": No such file or directory`})
+	assert.ErrorContains(t, err, "output plugin isn't installed")
+
+	other := errors.New("boom")
+	assert.Equal(t, other, explainSlotCreationError(other))
+}
+
+func TestScanErrorColumn(t *testing.T) {
+	i, ok := scanErrorColumn(errors.New(`sql: Scan error on column index 3, name "ratio": converting driver.Value type string ("n/a") to a float64: invalid syntax`))
+	assert.True(t, ok)
+	assert.Equal(t, 3, i)
+
+	_, ok = scanErrorColumn(errors.New("driver: bad connection"))
+	assert.False(t, ok)
+}
+
+func TestUnqualifiedTableName(t *testing.T) {
+	assert.Equal(t, "orders", unqualifiedTableName("public", "public.orders"))
+	assert.Equal(t, "orders", unqualifiedTableName("public", "orders"))
+	assert.Equal(t, "public.orders", unqualifiedTableName("sales", "public.orders"))
+}
+
+func TestSnapshotOrderBy(t *testing.T) {
+	tests := []struct {
+		order   string
+		orderBy string
+	}{
+		{order: SnapshotOrderNone, orderBy: "ctid"},
+		{order: "created_at", orderBy: `"created_at", ctid`},
+		{order: "Created At", orderBy: `"Created At", ctid`},
+	}
+	for _, test := range tests {
+		s := &Stream{snapshotOrder: test.order}
+		orderBy, err := s.snapshotOrderBy("public.orders")
+		require.NoError(t, err)
+		assert.Equal(t, test.orderBy, orderBy, test.order)
+	}
+}
+
+func TestSnapshotColumnValue(t *testing.T) {
+	assert.Nil(t, snapshotColumnValue(&sql.NullString{}))
+	assert.Nil(t, snapshotColumnValue(&sql.NullBool{}))
+	assert.Nil(t, snapshotColumnValue(&sql.NullInt64{}))
+	assert.Nil(t, snapshotColumnValue(&sql.NullFloat64{}))
+
+	assert.Equal(t, "", snapshotColumnValue(&sql.NullString{Valid: true}))
+	assert.Equal(t, false, snapshotColumnValue(&sql.NullBool{Valid: true}))
+	assert.Equal(t, int64(0), snapshotColumnValue(&sql.NullInt64{Valid: true}))
+	assert.Equal(t, 1.5, snapshotColumnValue(&sql.NullFloat64{Float64: 1.5, Valid: true}))
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"errors"
+	"sync"
+)
+
+// MultiSource merges the changes of several sources, such as one source per
+// table each consuming its own replication slot. The snapshot rows of a
+// source are still emitted before its streamed changes.
+type MultiSource struct {
+	sources []ReplicationSource
+
+	snapshotMessages chan Wal2JsonChanges
+	messages         chan Wal2JsonChanges
+	errors           chan error
+	done             chan struct{}
+	stopOnce         sync.Once
+
+	// sendMut orders the forwarded changes, so that forwarded matches the
+	// order the changes are received in.
+	sendMut   sync.Mutex
+	forwarded []forwardedChange
+	ackMut    sync.Mutex
+}
+
+type forwardedChange struct {
+	lsn    string
+	source int
+}
+
+var _ ReplicationSource = (*MultiSource)(nil)
+
+// NewMultiSource starts merging the sources.
+func NewMultiSource(sources []ReplicationSource) *MultiSource {
+	m := &MultiSource{
+		sources:          sources,
+		snapshotMessages: make(chan Wal2JsonChanges),
+		messages:         make(chan Wal2JsonChanges),
+		errors:           make(chan error, len(sources)),
+		done:             make(chan struct{}),
+	}
+	for i, source := range sources {
+		go m.forward(i, source)
+	}
+	return m
+}
+
+// forward passes on the changes of a source. Snapshot rows still buffered by
+// the source are passed on first, as the snapshot of a source completes
+// before it streams changes.
+func (m *MultiSource) forward(i int, source ReplicationSource) {
+	for {
+		lrC := source.LrMessageC()
+		if len(source.SnapshotMessageC()) > 0 {
+			lrC = nil
+		}
+
+		select {
+		case changes := <-source.SnapshotMessageC():
+			select {
+			case m.snapshotMessages <- changes:
+			case <-m.done:
+				return
+			}
+		case changes := <-lrC:
+			if !m.send(i, changes) {
+				return
+			}
+		case err := <-source.ErrorC():
+			m.errors <- err
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *MultiSource) send(i int, changes Wal2JsonChanges) bool {
+	m.sendMut.Lock()
+	defer m.sendMut.Unlock()
+
+	if changes.Lsn != nil {
+		m.ackMut.Lock()
+		m.forwarded = append(m.forwarded, forwardedChange{lsn: *changes.Lsn, source: i})
+		m.ackMut.Unlock()
+	}
+	select {
+	case m.messages <- changes:
+		return true
+	case <-m.done:
+		return false
+	}
+}
+
+func (m *MultiSource) SnapshotMessageC() <-chan Wal2JsonChanges {
+	return m.snapshotMessages
+}
+
+func (m *MultiSource) LrMessageC() <-chan Wal2JsonChanges {
+	return m.messages
+}
+
+func (m *MultiSource) ErrorC() <-chan error {
+	return m.errors
+}
+
+// AckLSN confirms the changes received up to the change with the LSN. Each
+// source is acknowledged the LSN of its latest confirmed change, as the LSNs
+// of the sources advance independently.
+func (m *MultiSource) AckLSN(lsn string) {
+	m.ackMut.Lock()
+	end := -1
+	for i, f := range m.forwarded {
+		if f.lsn == lsn {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		m.ackMut.Unlock()
+		return
+	}
+	// Changes split from the same transaction share its LSN.
+	for end+1 < len(m.forwarded) && m.forwarded[end+1].lsn == lsn {
+		end++
+	}
+
+	latest := map[int]string{}
+	for _, f := range m.forwarded[:end+1] {
+		latest[f.source] = f.lsn
+	}
+	m.forwarded = m.forwarded[end+1:]
+	m.ackMut.Unlock()
+
+	for i, lsn := range latest {
+		m.sources[i].AckLSN(lsn)
+	}
+}
+
+func (m *MultiSource) Stop() error {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+	var errs []error
+	for _, source := range m.sources {
+		errs = append(errs, source.Stop())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeInsert(table string, id int) string {
+	return fmt.Sprintf(`{"kind":"insert","schema":"public","table":%q,"columnnames":["id"],"columntypes":["integer"],"columnvalues":[%d]}`, table, id)
+}
+
+func fakeTransaction(table string, id int) string {
+	return `{"change":[` + fakeInsert(table, id) + `]}`
+}
+
+func fakeTableSource(t *testing.T, script *FakeScript, table string) ReplicationSource {
+	t.Helper()
+	source, err := script.Source(Config{DbSchema: "public", DbTables: []string{table}, SeparateChanges: true})
+	require.NoError(t, err)
+	return source
+}
+
+func receive(t *testing.T, c <-chan Wal2JsonChanges) Wal2JsonChanges {
+	t.Helper()
+	select {
+	case changes := <-c:
+		return changes
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for changes")
+		return Wal2JsonChanges{}
+	}
+}
+
+func TestMultiSourceEmitsSnapshotBeforeChanges(t *testing.T) {
+	orders := fakeTableSource(t, &FakeScript{
+		Snapshot:     []string{fakeInsert("orders", 1), fakeInsert("orders", 2)},
+		Transactions: []string{fakeTransaction("orders", 3)},
+	}, "orders")
+
+	m := NewMultiSource([]ReplicationSource{orders})
+	defer m.Stop()
+
+	// Streamed changes are only forwarded once the snapshot rows were taken.
+	receive(t, m.SnapshotMessageC())
+	select {
+	case <-m.LrMessageC():
+		require.FailNow(t, "change forwarded before the snapshot rows")
+	case <-time.After(10 * time.Millisecond):
+	}
+	receive(t, m.SnapshotMessageC())
+	assert.Equal(t, "0/1", *receive(t, m.LrMessageC()).Lsn)
+}
+
+func TestMultiSourceAcknowledgesEachSource(t *testing.T) {
+	var acks int
+	onAck := func(string) { acks++ }
+	ordersScript := &FakeScript{
+		Transactions: []string{fakeTransaction("orders", 1), fakeTransaction("orders", 2)},
+		OnAck:        onAck,
+	}
+	eventsScript := &FakeScript{
+		Transactions: []string{fakeTransaction("events", 1)},
+		LSNOffset:    0x10,
+		OnAck:        onAck,
+	}
+	scripts := map[string]*FakeScript{"orders": ordersScript, "events": eventsScript}
+	m := NewMultiSource([]ReplicationSource{
+		fakeTableSource(t, ordersScript, "orders"),
+		fakeTableSource(t, eventsScript, "events"),
+	})
+	defer m.Stop()
+
+	var received []Wal2JsonChanges
+	for i := 0; i < 3; i++ {
+		received = append(received, receive(t, m.LrMessageC()))
+	}
+
+	// Only the source of the changes received up to the position is
+	// acknowledged.
+	first := received[0]
+	m.AckLSN(*first.Lsn)
+	for table, script := range scripts {
+		if table == first.Changes[0].Table {
+			assert.Equal(t, *first.Lsn, script.Acknowledged())
+		} else {
+			assert.Equal(t, "0/0", script.Acknowledged())
+		}
+	}
+
+	// Each source is acknowledged the LSN of its latest confirmed change.
+	m.AckLSN(*received[2].Lsn)
+	assert.Equal(t, "0/2", ordersScript.Acknowledged())
+	assert.Equal(t, "0/11", eventsScript.Acknowledged())
+
+	// Unknown positions aren't acknowledged.
+	before := acks
+	m.AckLSN("0/99")
+	assert.Equal(t, before, acks)
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// outputPlugin is the logical decoding output plugin the stream decodes.
+const outputPlugin = "wal2json"
+
+// minServerVersion is the first server version with logical decoding.
+const minServerVersion = 90400
+
+// checkLogicalDecoding verifies that the server supports logical decoding, so
+// that misconfigured servers are reported before creating a slot.
+func checkLogicalDecoding(conn *pgconn.PgConn) error {
+	if version, err := strconv.Atoi(conn.ParameterStatus("server_version_num")); err == nil && version < minServerVersion {
+		return fmt.Errorf("server version %s doesn't support logical decoding, PostgreSQL 9.4 or later is required", conn.ParameterStatus("server_version"))
+	}
+
+	data, err := conn.Exec(context.Background(), "SHOW wal_level;").ReadAll()
+	if err != nil {
+		return fmt.Errorf("failed to read wal_level: %w", err)
+	}
+	if len(data) == 0 || len(data[0].Rows) == 0 {
+		return errors.New("failed to read wal_level: no value returned")
+	}
+	if walLevel := string(data[0].Rows[0][0]); walLevel != "logical" {
+		return fmt.Errorf("wal_level is %s but logical replication requires wal_level = logical, set it in postgresql.conf (or the rds.logical_replication parameter on RDS) and restart the server", walLevel)
+	}
+	return nil
+}
+
+// checkSlotPlugin verifies that an existing slot decodes with the output
+// plugin of the stream.
+func checkSlotPlugin(slotName, slotType, plugin string) error {
+	if slotType != "logical" {
+		return fmt.Errorf("replication slot %s is a %s slot, drop it or configure another slot_name to create a logical slot", slotName, slotType)
+	}
+	if plugin != outputPlugin {
+		return fmt.Errorf("replication slot %s uses the %s output plugin but %s is required, drop it or configure another slot_name", slotName, plugin, outputPlugin)
+	}
+	return nil
+}
+
+// explainSlotCreationError adds guidance to the error of a failed slot
+// creation when the output plugin isn't installed on the server.
+func explainSlotCreationError(err error) error {
+	var pgErr *pgconn.PgError
+	// undefined_file is returned when the plugin library can't be loaded.
+	if errors.As(err, &pgErr) && pgErr.Code == "58P01" {
+		return fmt.Errorf("the %s output plugin isn't installed on the server, install the wal2json package matching the server version (such as postgresql-16-wal2json) or use a managed service that ships it: %w", outputPlugin, err)
+	}
+	return err
+}
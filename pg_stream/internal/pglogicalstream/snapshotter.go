@@ -0,0 +1,304 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+type Snapshotter struct {
+	// pgConnection is a single connection pinned for the lifetime of the
+	// snapshot transaction. ownedPool is only set when the snapshotter opened
+	// its own pool rather than borrowing from a shared one.
+	pgConnection *sql.Conn
+	ownedPool    *sql.DB
+	snapshotName string
+	// statementTimeout, when set, cancels statements of the snapshot
+	// transaction running for longer.
+	statementTimeout time.Duration
+	// began is when the current snapshot transaction started.
+	began  time.Time
+	logger *service.Logger
+}
+
+// NewSnapshotter pins a connection for the snapshot transaction. When pool is
+// nil a dedicated pool is opened from dbConf, otherwise a connection is
+// borrowed from pool and returned to it by CloseConn.
+func NewSnapshotter(dbConf pgconn.Config, pool *sql.DB, snapshotName string, statementTimeout time.Duration, logger *service.Logger) (*Snapshotter, error) {
+	s := &Snapshotter{
+		snapshotName:     snapshotName,
+		statementTimeout: statementTimeout,
+		logger:           logger,
+	}
+	if pool == nil {
+		var err error
+		if pool, err = openSnapshotPool(dbConf); err != nil {
+			return nil, err
+		}
+		s.ownedPool = pool
+	}
+
+	conn, err := pool.Conn(context.Background())
+	if err != nil {
+		_ = s.CloseConn()
+		return nil, err
+	}
+	s.pgConnection = conn
+	return s, nil
+}
+
+func openSnapshotPool(dbConf pgconn.Config) (*sql.DB, error) {
+	var sslMode = "disable"
+	if dbConf.TLSConfig != nil {
+		sslMode = "require"
+	}
+	connStr := fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=%s", dbConf.User,
+		dbConf.Password, dbConf.Host, dbConf.Port, dbConf.Database, sslMode,
+	)
+	if name := dbConf.RuntimeParams["application_name"]; name != "" {
+		connStr += fmt.Sprintf(" application_name='%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(name))
+	}
+
+	pgConn, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	pgConn.SetMaxOpenConns(1)
+	return pgConn, nil
+}
+
+// Prepare begins the snapshot transaction on the snapshot exported by the
+// replication slot.
+func (s *Snapshotter) Prepare() error {
+	return s.begin(true)
+}
+
+// Reanchor commits the snapshot transaction and begins a new one on a fresh
+// snapshot, which releases the xmin horizon the old one held back. Rows read
+// afterwards may include changes committed after the consistent point of the
+// slot, which are streamed again once the snapshot completes.
+func (s *Snapshotter) Reanchor() error {
+	if err := s.ReleaseSnapshot(); err != nil {
+		return err
+	}
+	return s.begin(false)
+}
+
+// TransactionAge returns how long the current snapshot transaction is open.
+func (s *Snapshotter) TransactionAge() time.Duration {
+	return time.Since(s.began)
+}
+
+func (s *Snapshotter) begin(importSnapshot bool) error {
+	if _, err := s.pgConnection.ExecContext(context.Background(), "BEGIN TRANSACTION ISOLATION LEVEL REPEATABLE READ;"); err != nil {
+		return err
+	}
+	if importSnapshot {
+		if _, err := s.pgConnection.ExecContext(context.Background(), fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s';", s.snapshotName)); err != nil {
+			return err
+		}
+	}
+	// The timeout is local to the transaction so that it doesn't outlive
+	// the snapshot on connections borrowed from a pool.
+	if s.statementTimeout > 0 {
+		if _, err := s.pgConnection.ExecContext(context.Background(), fmt.Sprintf("SET LOCAL statement_timeout = %d;", s.statementTimeout.Milliseconds())); err != nil {
+			return err
+		}
+	}
+	s.began = time.Now()
+
+	return nil
+}
+
+func (s *Snapshotter) FindAvgRowSize(table string) (sql.NullInt64, error) {
+	var avgRowSize sql.NullInt64
+
+	rows, err := s.pgConnection.QueryContext(context.Background(), fmt.Sprintf(`SELECT SUM(pg_column_size('%s.*')) / COUNT(*) FROM %s;`, table, table))
+	if err != nil {
+		return avgRowSize, fmt.Errorf("can't get avg row size: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return avgRowSize, fmt.Errorf("can't get avg row size: 0 rows returned")
+	}
+	if err = rows.Scan(&avgRowSize); err != nil {
+		return avgRowSize, fmt.Errorf("can't get avg row size: %w", err)
+	}
+	return avgRowSize, nil
+}
+
+// TableStats are the size of a table and its row count estimated by the
+// planner statistics.
+type TableStats struct {
+	// Rows is zero when the table was never analyzed.
+	Rows  int64
+	Bytes int64
+}
+
+// AvgRowSize returns the average row size derived from the statistics, or
+// zero when the row count is unknown.
+func (t TableStats) AvgRowSize() int64 {
+	if t.Rows == 0 {
+		return 0
+	}
+	return t.Bytes / t.Rows
+}
+
+// FindTableStats reads the statistics of the table from the catalog, which
+// unlike FindAvgRowSize doesn't scan the table.
+func (s *Snapshotter) FindTableStats(table string) (TableStats, error) {
+	var stats TableStats
+	if err := s.pgConnection.QueryRowContext(context.Background(), fmt.Sprintf(`SELECT GREATEST(reltuples, 0)::bigint, pg_table_size(oid) FROM pg_class WHERE oid = '%s'::regclass;`, table)).Scan(&stats.Rows, &stats.Bytes); err != nil {
+		return stats, fmt.Errorf("can't get table statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// FindColumnTypes returns the types of the columns of the table by column
+// name, formatted like the types of streamed changes.
+func (s *Snapshotter) FindColumnTypes(table string) (map[string]string, error) {
+	rows, err := s.pgConnection.QueryContext(context.Background(), fmt.Sprintf(`SELECT attname, format_type(atttypid, atttypmod) FROM pg_attribute WHERE attrelid = '%s'::regclass AND attnum > 0 AND NOT attisdropped;`, table))
+	if err != nil {
+		return nil, fmt.Errorf("can't get column types: %w", err)
+	}
+	defer rows.Close()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, fmt.Errorf("can't get column types: %w", err)
+		}
+		types[name] = typ
+	}
+	return types, rows.Err()
+}
+
+func (s *Snapshotter) CalculateBatchSize(availableMemory uint64, estimatedRowSize uint64, safetyFactor float64) int {
+	if estimatedRowSize == 0 {
+		estimatedRowSize = 1
+	}
+	batchSize := int(float64(availableMemory) * safetyFactor / float64(estimatedRowSize))
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize
+}
+
+// QuerySnapshotData queries a page of rows matching the filter, which is
+// ignored when empty.
+func (s *Snapshotter) QuerySnapshotData(table string, filter string, orderBy string, limit, offset int) (rows *sql.Rows, err error) {
+	s.logger.Infof("Query snapshot table=%s limit=%d offset=%d order_by=%s", table, limit, offset, orderBy)
+	return s.pgConnection.QueryContext(context.Background(), fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d OFFSET %d;", table, whereClause(filter), orderBy, limit, offset))
+}
+
+func whereClause(conditions ...string) string {
+	var nonEmpty []string
+	for _, condition := range conditions {
+		if condition != "" {
+			nonEmpty = append(nonEmpty, condition)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return ""
+	}
+	if len(nonEmpty) == 1 {
+		return " WHERE " + nonEmpty[0]
+	}
+	return " WHERE (" + strings.Join(nonEmpty, ") AND (") + ")"
+}
+
+// SnapshotKeyset is the primary key of a table that snapshot rows are paged
+// through by, which unlike an offset stays correct when rows are inserted or
+// deleted between the snapshot transactions reading the pages.
+type SnapshotKeyset struct {
+	Columns []string
+	// Types are the catalog types of the columns, which the key values of
+	// the last row are cast to.
+	Types []string
+}
+
+// After returns the key values of the row, or nil when it isn't a row of the
+// table.
+func (k SnapshotKeyset) After(row Wal2JsonChange) []interface{} {
+	values := make([]interface{}, len(k.Columns))
+	for i, column := range k.Columns {
+		j := slices.Index(row.ColumnNames, column)
+		if j < 0 || j >= len(row.ColumnValues) {
+			return nil
+		}
+		values[i] = row.ColumnValues[j]
+	}
+	return values
+}
+
+// query returns the query of the page of rows matching the filter following
+// the key values, or of the first page when there are none.
+func (k SnapshotKeyset) query(table string, filter string, after []interface{}, limit int) string {
+	columns := strings.Join(quoteIdentifiers(k.Columns), ", ")
+	if len(after) == 0 {
+		return fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d;", table, whereClause(filter), columns, limit)
+	}
+
+	params := make([]string, len(k.Types))
+	for i, typ := range k.Types {
+		params[i] = fmt.Sprintf("$%d::%s", i+1, typ)
+	}
+	keyCondition := fmt.Sprintf("(%s) > (%s)", columns, strings.Join(params, ", "))
+	return fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT %d;", table, whereClause(filter, keyCondition), columns, limit)
+}
+
+// QuerySnapshotDataAfter queries the page of rows following the key values
+// of the last row of the previous page.
+func (s *Snapshotter) QuerySnapshotDataAfter(table string, filter string, keyset SnapshotKeyset, after []interface{}, limit int) (rows *sql.Rows, err error) {
+	s.logger.Infof("Query snapshot table=%s limit=%d after=%v", table, limit, after)
+	return s.pgConnection.QueryContext(context.Background(), keyset.query(table, filter, after, limit), after...)
+}
+
+func quoteIdentifiers(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = pq.QuoteIdentifier(name)
+	}
+	return quoted
+}
+
+func (s *Snapshotter) ReleaseSnapshot() error {
+	_, err := s.pgConnection.ExecContext(context.Background(), "COMMIT;")
+	return err
+}
+
+func (s *Snapshotter) CloseConn() error {
+	var err error
+	if s.pgConnection != nil {
+		err = s.pgConnection.Close()
+	}
+	if s.ownedPool != nil {
+		err = errors.Join(err, s.ownedPool.Close())
+	}
+	return err
+}
+
+func getAvailableMemory() uint64 {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return memStats.Sys - memStats.HeapInuse
+}
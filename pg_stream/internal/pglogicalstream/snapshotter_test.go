@@ -0,0 +1,53 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotKeysetPaging(t *testing.T) {
+	keyset := SnapshotKeyset{
+		Columns: []string{"tenant", "order id"},
+		Types:   []string{"uuid", "integer"},
+	}
+
+	assert.Equal(t, `SELECT * FROM public.orders ORDER BY "tenant", "order id" LIMIT 100;`, keyset.query("public.orders", "", nil, 100))
+
+	after := keyset.After(Wal2JsonChange{
+		ColumnNames:  []string{"order id", "total", "tenant"},
+		ColumnValues: []interface{}{int64(7), 9.5, "f2a1"},
+	})
+	assert.Equal(t, []interface{}{"f2a1", int64(7)}, after)
+	assert.Equal(t, `SELECT * FROM public.orders WHERE ("tenant", "order id") > ($1::uuid, $2::integer) ORDER BY "tenant", "order id" LIMIT 100;`, keyset.query("public.orders", "", after, 100))
+
+	// Filters restrict the rows of every page.
+	assert.Equal(t, `SELECT * FROM public.orders WHERE updated_at > now() - interval '1 day' ORDER BY "tenant", "order id" LIMIT 100;`, keyset.query("public.orders", "updated_at > now() - interval '1 day'", nil, 100))
+	assert.Equal(t, `SELECT * FROM public.orders WHERE (archived OR total > 0) AND (("tenant", "order id") > ($1::uuid, $2::integer)) ORDER BY "tenant", "order id" LIMIT 100;`, keyset.query("public.orders", "archived OR total > 0", after, 100))
+
+	assert.Nil(t, keyset.After(Wal2JsonChange{ColumnNames: []string{"total"}, ColumnValues: []interface{}{9.5}}))
+}
+
+func TestSnapshotPlanning(t *testing.T) {
+	stats := map[string]TableStats{
+		"public.orders":   {Rows: 1000, Bytes: 64000},
+		"public.events":   {Rows: 0, Bytes: 8192},
+		"public.payments": {Rows: 10, Bytes: 64000},
+	}
+	tables := []string{"public.events", "public.orders", "public.customers", "public.payments"}
+	sortTablesBySize(tables, stats)
+	assert.Equal(t, []string{"public.orders", "public.payments", "public.events", "public.customers"}, tables)
+
+	assert.Equal(t, int64(64), stats["public.orders"].AvgRowSize())
+	assert.Equal(t, int64(6400), stats["public.payments"].AvgRowSize())
+	// Tables that were never analyzed have no average row size.
+	assert.Zero(t, stats["public.events"].AvgRowSize())
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+// ReplicationSource is a replication engine streaming the changes of the
+// replicated tables, preceded by a snapshot of their rows when requested.
+// Stream is the wal2json implementation, other engines such as a native
+// pgoutput decoder or test fakes can be swapped in.
+type ReplicationSource interface {
+	// SnapshotMessageC returns the rows of the snapshot as insert changes.
+	// All the rows are sent before the first change is streamed.
+	SnapshotMessageC() <-chan Wal2JsonChanges
+	// LrMessageC returns the changes streamed from the replication slot.
+	// Empty transactions are sent without changes, and must be acknowledged
+	// like the others for the slot to advance past them.
+	LrMessageC() <-chan Wal2JsonChanges
+	// ErrorC returns errors that stopped the source.
+	ErrorC() <-chan error
+	// AckLSN confirms that the changes up to the LSN have been delivered.
+	AckLSN(lsn string)
+	// Stop stops the source and releases its connections. It is idempotent.
+	Stop() error
+}
+
+// SourceConstructor creates a ReplicationSource from a config.
+type SourceConstructor func(config Config) (ReplicationSource, error)
+
+var _ ReplicationSource = (*Stream)(nil)
+
+// NewReplicationSource creates the wal2json Stream as a ReplicationSource.
+func NewReplicationSource(config Config) (ReplicationSource, error) {
+	stream, err := NewPgStream(config)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pglogicalstream
+
+import (
+	"time"
+)
+
+type Wal2JsonChanges struct {
+	Lsn     *string          `json:"lsn"`
+	Changes []Wal2JsonChange `json:"change"`
+
+	// Timestamp is the commit timestamp of the transaction the changes belong
+	// to. It is zero for snapshot messages.
+	Timestamp time.Time `json:"-"`
+
+	// Messages are the transactional pg_logical_emit_message messages of the
+	// transaction the changes belong to.
+	Messages []LogicalMessage `json:"-"`
+
+	// Xid is the id of the transaction the changes belong to. It is zero
+	// for snapshot messages.
+	Xid uint32 `json:"-"`
+
+	// TransactionEnd is set on the last changes of their transaction to the
+	// replicated tables.
+	TransactionEnd bool `json:"-"`
+
+	// Progress is set on snapshot messages without changes that report the
+	// progress of the snapshot of a table.
+	Progress *SnapshotProgress `json:"-"`
+}
+
+// SnapshotProgress reports the progress of the snapshot of a table after each
+// chunk of rows.
+type SnapshotProgress struct {
+	Table string `json:"table"`
+	// RowsDone is the number of rows of the table read so far.
+	RowsDone int `json:"rows_done"`
+	// RowsEstimated is the row count estimated by the planner statistics of
+	// the table, it is zero when the table was never analyzed.
+	RowsEstimated int64   `json:"rows_estimated"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+	Done          bool    `json:"done"`
+}
+
+// LogicalMessage is a message written with pg_logical_emit_message.
+type LogicalMessage struct {
+	Prefix  string
+	Content string
+}
+
+type Wal2JsonChange struct {
+	Kind         string        `json:"kind"`
+	Schema       string        `json:"schema"`
+	Table        string        `json:"table"`
+	ColumnNames  []string      `json:"columnnames"`
+	ColumnTypes  []string      `json:"columntypes"`
+	ColumnValues []interface{} `json:"columnvalues"`
+
+	// OldKeys is the before image of updated and deleted rows. It only holds
+	// the replica identity columns unless the table uses REPLICA IDENTITY
+	// FULL.
+	OldKeys Wal2JsonOldKeys `json:"-"`
+}
+
+type Wal2JsonOldKeys struct {
+	KeyNames  []string      `json:"keynames"`
+	KeyTypes  []string      `json:"keytypes"`
+	KeyValues []interface{} `json:"keyvalues"`
+}
+
+// WallMessage is a single transaction as emitted by wal2json format version 1.
+type WallMessage struct {
+	Xid       uint32 `json:"xid"`
+	Timestamp string `json:"timestamp"`
+	Change    []struct {
+		Kind         string          `json:"kind"`
+		Schema       string          `json:"schema"`
+		Table        string          `json:"table"`
+		Columnnames  []string        `json:"columnnames"`
+		Columntypes  []string        `json:"columntypes"`
+		Columnvalues []interface{}   `json:"columnvalues"`
+		Oldkeys      Wal2JsonOldKeys `json:"oldkeys"`
+
+		// Prefix and Content are only set for changes of the message kind.
+		Prefix  string `json:"prefix"`
+		Content string `json:"content"`
+	} `json:"change"`
+}
+
+var wal2JsonTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999-07",
+	"2006-01-02 15:04:05.999999-07:00",
+}
+
+// parseWal2JsonTimestamp parses a timestamptz rendered by wal2json.
+func parseWal2JsonTimestamp(s string) (t time.Time, err error) {
+	for _, layout := range wal2JsonTimestampLayouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var latencySLOConfigFields = []*service.ConfigField{
+	service.NewDurationField("threshold").
+		Description("The longest a streamed change may take from its commit until the pipeline acknowledges it").
+		Example("30s"),
+	service.NewDurationField("interval").
+		Description("The length of the intervals the latency is evaluated over").
+		Default("1m"),
+	service.NewIntField("consecutive_intervals").
+		Description("How many intervals in a row must breach the threshold before the objective is reported as breached").
+		Default(3),
+}
+
+// latencySLO evaluates the commit-to-acknowledgement latency of streamed
+// changes over fixed intervals. An interval breaches the objective when its
+// slowest change exceeded the threshold, or when a change is still awaiting
+// acknowledgement for longer, so a stalled pipeline breaches it too.
+type latencySLO struct {
+	threshold   time.Duration
+	interval    time.Duration
+	consecutive int
+
+	breachedGauge *service.MetricGauge
+
+	// slowest is written by the acknowledgement callbacks.
+	mut     sync.Mutex
+	slowest time.Duration
+
+	breaches  int
+	breached  bool
+	lastCheck time.Time
+}
+
+func newLatencySLOFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (s *latencySLO, err error) {
+	s = &latencySLO{
+		breachedGauge: metrics.NewGauge("pg_stream_latency_slo_breached"),
+	}
+	if s.threshold, err = conf.FieldDuration("threshold"); err != nil {
+		return nil, err
+	}
+	if s.interval, err = conf.FieldDuration("interval"); err != nil {
+		return nil, err
+	}
+	if s.consecutive, err = conf.FieldInt("consecutive_intervals"); err != nil {
+		return nil, err
+	}
+	if s.threshold <= 0 || s.interval <= 0 {
+		return nil, errors.New("the latency objective requires a positive threshold and interval")
+	}
+	if s.consecutive < 1 {
+		return nil, errors.New("consecutive_intervals must be at least 1")
+	}
+	s.lastCheck = time.Now()
+	s.breachedGauge.Set(0)
+	return s, nil
+}
+
+// acked records the latency of changes committed at the given time.
+func (s *latencySLO) acked(commitTime, now time.Time) {
+	if s == nil || commitTime.IsZero() {
+		return
+	}
+	latency := now.Sub(commitTime)
+
+	s.mut.Lock()
+	if latency > s.slowest {
+		s.slowest = latency
+	}
+	s.mut.Unlock()
+}
+
+// nextCheck returns when the current interval ends.
+func (s *latencySLO) nextCheck() time.Time {
+	return s.lastCheck.Add(s.interval)
+}
+
+// due evaluates the interval once it ended, taking the time the oldest
+// unconfirmed event waits into account, and returns an alert event when the
+// objective became breached or recovered, or nil.
+func (s *latencySLO) due(acks *lsnAckTracker, now time.Time) (*service.Message, error) {
+	if now.Before(s.nextCheck()) {
+		return nil, nil
+	}
+	s.lastCheck = now
+
+	s.mut.Lock()
+	latency := s.slowest
+	s.slowest = 0
+	s.mut.Unlock()
+
+	if _, oldest, ok := acks.oldest(); ok && now.Sub(oldest) > latency {
+		latency = now.Sub(oldest)
+	}
+
+	if latency <= s.threshold {
+		s.breaches = 0
+		if !s.breached {
+			return nil, nil
+		}
+		s.breached = false
+		s.breachedGauge.Set(0)
+		return s.alert("recovered", latency)
+	}
+
+	s.breaches++
+	if s.breached || s.breaches < s.consecutive {
+		return nil, nil
+	}
+	s.breached = true
+	s.breachedGauge.Set(1)
+	return s.alert("breached", latency)
+}
+
+func (s *latencySLO) alert(state string, latency time.Duration) (*service.Message, error) {
+	b, err := json.Marshal(map[string]any{
+		"state":                 state,
+		"latency_ms":            latency.Milliseconds(),
+		"threshold_ms":          s.threshold.Milliseconds(),
+		"consecutive_intervals": s.breaches,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "latency_slo")
+	msg.MetaSetMut("slo_state", state)
+	return msg, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencySLOBreachAndRecovery(t *testing.T) {
+	start := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	s := &latencySLO{
+		threshold:     time.Second,
+		interval:      time.Minute,
+		consecutive:   2,
+		breachedGauge: service.MockResources().Metrics().NewGauge("breached"),
+		lastCheck:     start,
+	}
+	acks := &lsnAckTracker{}
+
+	// Nothing is evaluated before the interval ended.
+	s.acked(start, start.Add(5*time.Second))
+	msg, err := s.due(acks, start.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	// The first breaching interval isn't reported yet.
+	now := start.Add(time.Minute)
+	msg, err = s.due(acks, now)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	// The second one is, without acknowledged changes as the unconfirmed one
+	// waits for longer than the threshold.
+	seq := acks.track("0/64", true)
+	acks.pending[0].received = now
+	now = now.Add(time.Minute)
+	msg, err = s.due(acks, now)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	state, _ := msg.MetaGet("slo_state")
+	assert.Equal(t, "breached", state)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"state":"breached","latency_ms":60000,"threshold_ms":1000,"consecutive_intervals":2}`, string(b))
+
+	// Further breaching intervals aren't reported again.
+	now = now.Add(time.Minute)
+	msg, err = s.due(acks, now)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	acks.ack(seq)
+	s.acked(now, now.Add(100*time.Millisecond))
+	now = now.Add(time.Minute)
+	msg, err = s.due(acks, now)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	state, _ = msg.MetaGet("slo_state")
+	assert.Equal(t, "recovered", state)
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var leaderElectionConfigFields = []*service.ConfigField{
+	service.NewStringField("lock_name").
+		Description("The name of the lease. Replicas of a pipeline must use the same name. Defaults to the slot name").
+		Default(""),
+	service.NewDurationField("check_interval").
+		Description("How often a standby replica tries to take the lease, and how often the leader checks it still holds it").
+		Default("5s"),
+}
+
+// leaderElection lets a single replica of a pipeline consume the slot. The
+// lease is a session-level advisory lock held on a dedicated connection, which
+// the server releases as soon as the leader's session ends so a standby
+// replica can take over.
+type leaderElection struct {
+	lockName      string
+	checkInterval time.Duration
+
+	conn      *sql.Conn
+	lastCheck time.Time
+}
+
+func newLeaderElectionFromParsed(conf *service.ParsedConfig, slotName string) (l *leaderElection, err error) {
+	l = &leaderElection{}
+	if l.lockName, err = conf.FieldString("lock_name"); err != nil {
+		return nil, err
+	}
+	if l.lockName == "" {
+		l.lockName = slotName
+	}
+	if l.checkInterval, err = conf.FieldDuration("check_interval"); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *leaderElection) lockKey() int64 {
+	return int64(xxhash.ChecksumString64(l.lockName))
+}
+
+// acquire blocks until the lease is taken or the context is cancelled.
+func (l *leaderElection) acquire(ctx context.Context, db *sql.DB, logger *service.Logger) (err error) {
+	// The session of a previous connection may have been lost already.
+	_ = l.release()
+
+	if l.conn, err = db.Conn(ctx); err != nil {
+		return err
+	}
+	for waiting := false; ; waiting = true {
+		var acquired bool
+		if err = l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.lockKey()).Scan(&acquired); err != nil {
+			_ = l.release()
+			return err
+		}
+		if acquired {
+			logger.Infof("Acquired the %q lease, consuming the slot", l.lockName)
+			l.lastCheck = time.Now()
+			return nil
+		}
+		if !waiting {
+			logger.Infof("The %q lease is held by another replica, waiting to take over", l.lockName)
+		}
+
+		select {
+		case <-time.After(l.checkInterval):
+		case <-ctx.Done():
+			_ = l.release()
+			return ctx.Err()
+		}
+	}
+}
+
+// check verifies that the session holding the lease is still alive once the
+// check interval elapsed. A lost session means another replica may take over.
+func (l *leaderElection) check(ctx context.Context) error {
+	if time.Since(l.lastCheck) < l.checkInterval {
+		return nil
+	}
+	l.lastCheck = time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, l.checkInterval)
+	defer cancel()
+	if err := l.conn.PingContext(ctx); err != nil {
+		return errors.New("lost the session holding the lease: " + err.Error())
+	}
+	return nil
+}
+
+// release gives up the lease. The connection is discarded rather than
+// returned to the pool when the lock can't be released, ending its session.
+func (l *leaderElection) release() error {
+	if l.conn == nil {
+		return nil
+	}
+	conn := l.conn
+	l.conn = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.checkInterval)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.lockKey()); err != nil {
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		return errors.Join(err, conn.Close())
+	}
+	return conn.Close()
+}
@@ -0,0 +1,41 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderElectionLockNameDefaultsToSlot(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(leaderElectionConfigFields...)
+
+	conf, err := spec.ParseYAML(`check_interval: 1s`, nil)
+	require.NoError(t, err)
+	l, err := newLeaderElectionFromParsed(conf, "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "orders_slot", l.lockName)
+	assert.Equal(t, time.Second, l.checkInterval)
+
+	conf, err = spec.ParseYAML(`lock_name: orders`, nil)
+	require.NoError(t, err)
+	other, err := newLeaderElectionFromParsed(conf, "orders_slot")
+	require.NoError(t, err)
+	assert.Equal(t, "orders", other.lockName)
+
+	// Replicas derive the same advisory lock key from the same name.
+	again, err := newLeaderElectionFromParsed(conf, "another_slot")
+	require.NoError(t, err)
+	assert.Equal(t, other.lockKey(), again.lockKey())
+	assert.NotEqual(t, l.lockKey(), other.lockKey())
+}
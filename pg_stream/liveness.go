@@ -0,0 +1,106 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var livenessProbeConfigFields = []*service.ConfigField{
+	service.NewDurationField("interval").
+		Description("How often the server is probed").
+		Default("10s"),
+	service.NewDurationField("timeout").
+		Description("How long a probe may take before the server is considered unreachable").
+		Default("5s"),
+}
+
+// serverState is what the liveness probe observes of the server.
+type serverState struct {
+	inRecovery bool
+	readOnly   bool
+	startTime  time.Time
+}
+
+// changedFrom describes how the server changed since the previous state in a
+// way that breaks replication, or returns nil.
+func (s serverState) changedFrom(prev serverState) error {
+	switch {
+	case !s.startTime.Equal(prev.startTime):
+		return fmt.Errorf("the server restarted at %v", s.startTime)
+	case s.inRecovery && !prev.inRecovery:
+		return errors.New("the server is no longer the primary")
+	case s.readOnly && !prev.readOnly:
+		return errors.New("the server became read only")
+	}
+	return nil
+}
+
+// livenessProbe periodically queries the server on a pooled SQL connection,
+// which notices failovers and restarts sooner than the replication stream,
+// that may only fail once the TCP connection times out.
+type livenessProbe struct {
+	interval time.Duration
+	timeout  time.Duration
+
+	state     serverState
+	lastCheck time.Time
+}
+
+func newLivenessProbeFromParsed(conf *service.ParsedConfig) (l *livenessProbe, err error) {
+	l = &livenessProbe{}
+	if l.interval, err = conf.FieldDuration("interval"); err != nil {
+		return nil, err
+	}
+	if l.timeout, err = conf.FieldDuration("timeout"); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *livenessProbe) query(ctx context.Context, db *sql.DB) (s serverState, err error) {
+	ctx, cancel := context.WithTimeout(ctx, l.timeout)
+	defer cancel()
+	err = db.QueryRowContext(ctx, "SELECT pg_is_in_recovery(), current_setting('default_transaction_read_only') = 'on', pg_postmaster_start_time()").
+		Scan(&s.inRecovery, &s.readOnly, &s.startTime)
+	return s, err
+}
+
+// connect records the state of the server the stream connected to.
+func (l *livenessProbe) connect(ctx context.Context, db *sql.DB) (err error) {
+	if l.state, err = l.query(ctx, db); err != nil {
+		return fmt.Errorf("failed to probe the server: %w", err)
+	}
+	l.lastCheck = time.Now()
+	return nil
+}
+
+// check probes the server once the interval elapsed.
+func (l *livenessProbe) check(ctx context.Context, db *sql.DB) error {
+	if time.Since(l.lastCheck) < l.interval {
+		return nil
+	}
+	l.lastCheck = time.Now()
+
+	state, err := l.query(ctx, db)
+	if err != nil {
+		return fmt.Errorf("liveness probe failed: %w", err)
+	}
+	if err := state.changedFrom(l.state); err != nil {
+		return err
+	}
+	l.state = state
+	return nil
+}
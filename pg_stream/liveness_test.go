@@ -0,0 +1,30 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerStateChanges(t *testing.T) {
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	primary := serverState{startTime: started}
+
+	assert.NoError(t, primary.changedFrom(primary))
+	assert.ErrorContains(t, serverState{inRecovery: true, startTime: started}.changedFrom(primary), "no longer the primary")
+	assert.ErrorContains(t, serverState{readOnly: true, startTime: started}.changedFrom(primary), "read only")
+	assert.ErrorContains(t, serverState{startTime: started.Add(time.Minute)}.changedFrom(primary), "restarted")
+
+	// A standby the stream connected to isn't reported.
+	standby := serverState{inRecovery: true, readOnly: true, startTime: started}
+	assert.NoError(t, standby.changedFrom(standby))
+}
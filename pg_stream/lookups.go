@@ -0,0 +1,265 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var lookupConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table whose change events are enriched").
+		Example("users"),
+	service.NewStringField("column").
+		Description("Column of the table holding the value to look up").
+		Example("country_id"),
+	service.NewStringField("lookup_table").
+		Description("Table the value is looked up in, within the configured schema").
+		Example("countries"),
+	service.NewStringField("lookup_key").
+		Description("Column of the lookup table matched against the value").
+		Example("id"),
+	service.NewStringListField("lookup_columns").
+		Description("Columns of the lookup table added to the change event").
+		Example([]string{"name"}),
+	service.NewStringField("prefix").
+		Description("Prefix of the added column names. Defaults to the lookup table name followed by an underscore").
+		Example("country_").
+		Optional(),
+	service.NewIntField("cache_size").
+		Description("Number of looked up rows kept in an LRU cache").
+		Default(1000),
+}
+
+type lookupCache = lru.Cache[string, []interface{}]
+
+type lookup struct {
+	table         string
+	column        string
+	lookupTable   string
+	lookupKey     string
+	lookupColumns []string
+	prefix        string
+	cacheSize     int
+
+	stmt  *sql.Stmt
+	cache *lookupCache
+}
+
+// lookupEnricher joins change events against other tables of the source
+// database. When a lookup table is streamed as well its changes invalidate
+// the cached rows.
+type lookupEnricher struct {
+	schema  string
+	lookups []*lookup
+	logger  *service.Logger
+}
+
+func newLookupEnricherFromParsed(confs []*service.ParsedConfig, schema string, logger *service.Logger) (*lookupEnricher, error) {
+	e := &lookupEnricher{schema: schema, logger: logger}
+	for _, conf := range confs {
+		l := &lookup{}
+		var err error
+		if l.table, err = conf.FieldString("table"); err != nil {
+			return nil, err
+		}
+		if l.column, err = conf.FieldString("column"); err != nil {
+			return nil, err
+		}
+		if l.lookupTable, err = conf.FieldString("lookup_table"); err != nil {
+			return nil, err
+		}
+		if l.lookupKey, err = conf.FieldString("lookup_key"); err != nil {
+			return nil, err
+		}
+		if l.lookupColumns, err = conf.FieldStringList("lookup_columns"); err != nil {
+			return nil, err
+		}
+		l.prefix = l.lookupTable + "_"
+		if conf.Contains("prefix") {
+			if l.prefix, err = conf.FieldString("prefix"); err != nil {
+				return nil, err
+			}
+		}
+		if l.cacheSize, err = conf.FieldInt("cache_size"); err != nil {
+			return nil, err
+		}
+		e.lookups = append(e.lookups, l)
+	}
+	return e, nil
+}
+
+// connect prepares the lookup statements on the given connection pool.
+func (e *lookupEnricher) connect(ctx context.Context, db *sql.DB) error {
+	for _, l := range e.lookups {
+		columns := make([]string, len(l.lookupColumns))
+		for i, c := range l.lookupColumns {
+			columns[i] = pq.QuoteIdentifier(c)
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s.%s WHERE %s = $1",
+			strings.Join(columns, ", "),
+			pq.QuoteIdentifier(e.schema),
+			pq.QuoteIdentifier(l.lookupTable),
+			pq.QuoteIdentifier(l.lookupKey),
+		)
+
+		stmt, err := db.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to prepare lookup against %s: %w", l.lookupTable, err)
+		}
+		l.stmt = stmt
+
+		if l.cache, err = lru.New[string, []interface{}](l.cacheSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply enriches the events with looked up columns. Events are only modified
+// once every lookup succeeded so failed events can be retried.
+func (e *lookupEnricher) apply(ctx context.Context, changes []pglogicalstream.Wal2JsonChange) error {
+	type enrichment struct {
+		change int
+		lookup *lookup
+		values []interface{}
+	}
+	var enrichments []enrichment
+	for i, change := range changes {
+		if change.Kind == "delete" {
+			continue
+		}
+		for _, l := range e.lookups {
+			if l.table != change.Table {
+				continue
+			}
+			key, ok := columnValue(change.ColumnNames, change.ColumnValues, l.column)
+			if !ok {
+				continue
+			}
+			values, err := e.lookup(ctx, l, key)
+			if err != nil {
+				return err
+			}
+			enrichments = append(enrichments, enrichment{change: i, lookup: l, values: values})
+		}
+	}
+
+	for _, en := range enrichments {
+		change := &changes[en.change]
+		change.ColumnNames = slices.Clip(change.ColumnNames)
+		change.ColumnValues = slices.Clip(change.ColumnValues)
+		hasTypes := len(change.ColumnTypes) > 0
+		if hasTypes {
+			change.ColumnTypes = slices.Clip(change.ColumnTypes)
+		}
+		for i, column := range en.lookup.lookupColumns {
+			change.ColumnNames = append(change.ColumnNames, en.lookup.prefix+column)
+			change.ColumnValues = append(change.ColumnValues, en.values[i])
+			if hasTypes {
+				change.ColumnTypes = append(change.ColumnTypes, derivedColumnType)
+			}
+		}
+	}
+	return nil
+}
+
+// invalidate removes the cached rows changed by the changes. It is called as
+// changes are received, so that changes which are filtered, sampled or
+// compacted away invalidate the cache as well.
+func (e *lookupEnricher) invalidate(changes []pglogicalstream.Wal2JsonChange) {
+	for _, change := range changes {
+		for _, l := range e.lookups {
+			if l.lookupTable != change.Table || l.cache == nil {
+				continue
+			}
+			if v, ok := columnValue(change.ColumnNames, change.ColumnValues, l.lookupKey); ok {
+				l.cache.Remove(lookupCacheKey(v))
+			}
+			if v, ok := columnValue(change.OldKeys.KeyNames, change.OldKeys.KeyValues, l.lookupKey); ok {
+				l.cache.Remove(lookupCacheKey(v))
+			}
+		}
+	}
+}
+
+// lookupCacheKey formats a key value so that the same number is cached once
+// whether it was decoded as a float, an integer, a json.Number or a string,
+// as snapshot rows carry bigints.
+func lookupCacheKey(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		if n == math.Trunc(n) && math.Abs(n) < 1<<63 {
+			return strconv.FormatInt(int64(n), 10)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+		if f, err := n.Float64(); err == nil {
+			return lookupCacheKey(f)
+		}
+		return n.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// lookup returns the lookup columns of the row matching the key, all values
+// are null when no row matches.
+func (e *lookupEnricher) lookup(ctx context.Context, l *lookup, key interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(l.lookupColumns))
+	if key == nil {
+		return values, nil
+	}
+
+	cacheKey := lookupCacheKey(key)
+	if cached, ok := l.cache.Get(cacheKey); ok {
+		return cached, nil
+	}
+
+	scanArgs := make([]interface{}, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	err := l.stmt.QueryRowContext(ctx, key).Scan(scanArgs...)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up %s in %s: %w", cacheKey, l.lookupTable, err)
+	}
+	for i, v := range values {
+		if b, isBytes := v.([]byte); isBytes {
+			values[i] = string(b)
+		}
+	}
+	l.cache.Add(cacheKey, values)
+	return values, nil
+}
+
+func (e *lookupEnricher) close() {
+	for _, l := range e.lookups {
+		if l.stmt != nil {
+			_ = l.stmt.Close()
+			l.stmt = nil
+		}
+	}
+}
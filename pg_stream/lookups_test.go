@@ -0,0 +1,88 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestLookupCacheKey(t *testing.T) {
+	for _, key := range []any{int64(1000000), 1e6, json.Number("1000000"), json.Number("1e6"), "1000000"} {
+		assert.Equal(t, "1000000", lookupCacheKey(key), "%T %v", key, key)
+	}
+	assert.Equal(t, "1.5", lookupCacheKey(1.5))
+	assert.Equal(t, "abc", lookupCacheKey("abc"))
+}
+
+func newTestLookupEnricher(t *testing.T) (*lookupEnricher, *lookup) {
+	t.Helper()
+	cache, err := lru.New[string, []interface{}](10)
+	require.NoError(t, err)
+	l := &lookup{
+		table:         "orders",
+		column:        "customer_id",
+		lookupTable:   "customers",
+		lookupKey:     "id",
+		lookupColumns: []string{"name"},
+		prefix:        "customer_",
+		cache:         cache,
+	}
+	return &lookupEnricher{schema: "public", lookups: []*lookup{l}}, l
+}
+
+func TestLookupEnricherCache(t *testing.T) {
+	e, l := newTestLookupEnricher(t)
+
+	// Snapshot rows carry bigints and streamed rows floats, both hit the
+	// cached row.
+	l.cache.Add(lookupCacheKey(int64(1000000)), []interface{}{"Ada"})
+	changes := []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "customer_id"},
+		ColumnValues: []any{1.0, 1e6},
+	}}
+	require.NoError(t, e.apply(context.Background(), changes))
+	assert.Equal(t, []string{"id", "customer_id", "customer_name"}, changes[0].ColumnNames)
+	assert.Equal(t, []any{1.0, 1e6, "Ada"}, changes[0].ColumnValues)
+
+	e.invalidate([]pglogicalstream.Wal2JsonChange{{
+		Kind:         "update",
+		Table:        "customers",
+		ColumnNames:  []string{"id", "name"},
+		ColumnValues: []any{json.Number("1000000"), "Grace"},
+	}})
+	assert.False(t, l.cache.Contains("1000000"))
+}
+
+func TestLookupInvalidatedOnReceive(t *testing.T) {
+	e, l := newTestLookupEnricher(t)
+	l.cache.Add("7", []interface{}{"Ada"})
+	l.cache.Add("8", []interface{}{"Grace"})
+
+	// Changes are invalidated as they are received, before they can be
+	// filtered, sampled or compacted away.
+	p := &pgStreamInput{lookups: e, acks: &lsnAckTracker{}}
+	lsn := "0/16B3748"
+	p.receive(pglogicalstream.Wal2JsonChanges{Lsn: &lsn, Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:    "delete",
+		Table:   "customers",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{KeyNames: []string{"id"}, KeyValues: []any{7.0}},
+	}}})
+	assert.False(t, l.cache.Contains("7"))
+	assert.True(t, l.cache.Contains("8"))
+}
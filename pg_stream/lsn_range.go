@@ -0,0 +1,100 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var lsnRangeConfigSpec = service.NewConfigSpec().
+	Summary("Sets the `lsn_min` and `lsn_max` metadata fields of every message of a batch of `pg_stream` events to the lowest and highest LSN of the batch, simplifying offset bookkeeping of systems that track progress per batch").
+	Description("Use it in the `processors` of a batching policy. The LSN of an event is read from its `transaction_lsn` metadata field, or otherwise from the `lsn` field of its payload. Snapshot rows have no LSN and are ignored, a batch of snapshot rows only gets no metadata.").
+	Field(service.NewStringField("min_key").
+		Description("The metadata key of the lowest LSN").
+		Default("lsn_min")).
+	Field(service.NewStringField("max_key").
+		Description("The metadata key of the highest LSN").
+		Default("lsn_max"))
+
+type lsnRangeProcessor struct {
+	minKey string
+	maxKey string
+}
+
+func newLSNRangeProcessorFromParsed(conf *service.ParsedConfig) (p *lsnRangeProcessor, err error) {
+	p = &lsnRangeProcessor{}
+	if p.minKey, err = conf.FieldString("min_key"); err != nil {
+		return nil, err
+	}
+	if p.maxKey, err = conf.FieldString("max_key"); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func init() {
+	err := service.RegisterBatchProcessor(
+		"pg_stream_lsn_range", lsnRangeConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.BatchProcessor, error) {
+			return newLSNRangeProcessorFromParsed(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func messageLSN(msg *service.Message) (pglogrepl.LSN, bool) {
+	lsn, ok := msg.MetaGet("transaction_lsn")
+	if !ok {
+		structured, err := msg.AsStructured()
+		if err != nil {
+			return 0, false
+		}
+		obj, _ := structured.(map[string]any)
+		if lsn, ok = obj["lsn"].(string); !ok {
+			return 0, false
+		}
+	}
+	parsed, err := pglogrepl.ParseLSN(lsn)
+	return parsed, err == nil
+}
+
+func (p *lsnRangeProcessor) ProcessBatch(ctx context.Context, batch service.MessageBatch) ([]service.MessageBatch, error) {
+	var lowest, highest pglogrepl.LSN
+	found := false
+	for _, msg := range batch {
+		lsn, ok := messageLSN(msg)
+		if !ok {
+			continue
+		}
+		if !found || lsn < lowest {
+			lowest = lsn
+		}
+		if !found || lsn > highest {
+			highest = lsn
+		}
+		found = true
+	}
+	if !found {
+		return []service.MessageBatch{batch}, nil
+	}
+
+	for _, msg := range batch {
+		msg.MetaSetMut(p.minKey, lowest.String())
+		msg.MetaSetMut(p.maxKey, highest.String())
+	}
+	return []service.MessageBatch{batch}, nil
+}
+
+func (p *lsnRangeProcessor) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLSNRangeProcessor(t *testing.T) {
+	conf, err := lsnRangeConfigSpec.ParseYAML(``, nil)
+	require.NoError(t, err)
+	proc, err := newLSNRangeProcessorFromParsed(conf)
+	require.NoError(t, err)
+
+	withMeta := service.NewMessage([]byte(`{}`))
+	withMeta.MetaSetMut("transaction_lsn", "0/1A0")
+	batch := service.MessageBatch{
+		service.NewMessage([]byte(`{"lsn":"0/16B3748","change":[]}`)),
+		withMeta,
+		service.NewMessage([]byte(`{"lsn":null,"change":[]}`)),
+		service.NewMessage([]byte(`{"lsn":"1/0","change":[]}`)),
+	}
+
+	batches, err := proc.ProcessBatch(context.Background(), batch)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	for _, msg := range batches[0] {
+		lowest, _ := msg.MetaGet("lsn_min")
+		highest, _ := msg.MetaGet("lsn_max")
+		assert.Equal(t, "0/1A0", lowest)
+		assert.Equal(t, "1/0", highest)
+	}
+
+	snapshot := service.MessageBatch{service.NewMessage([]byte(`{"lsn":null,"change":[]}`))}
+	batches, err = proc.ProcessBatch(context.Background(), snapshot)
+	require.NoError(t, err)
+	_, ok := batches[0][0].MetaGet("lsn_min")
+	assert.False(t, ok)
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var keyColumnsConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table the key columns apply to").
+		Example("orders"),
+	service.NewStringListField("columns").
+		Description("The columns forming the message key, in order").
+		Example([]string{"tenant_id", "order_number"}),
+	service.NewIntField("salt_buckets").
+		Description("Spread the events of each key over this many buckets by appending the bucket to the key, such as `acme#3`, for tables where a few keys dominate the traffic. The bucket of an event is derived from the `salt_columns`, so the events of a row keep their order while the events of a key don't. Events carry the bucket and the bucket count in the `pg_key_bucket` and `pg_key_buckets` metadata fields, so consumers can merge the buckets of a key. Zero disables salting").
+		Default(0),
+	service.NewStringListField("salt_columns").
+		Description("The columns the bucket of an event is derived from, typically the primary key. Required with `salt_buckets`").
+		Example([]string{"id"}).
+		Default([]string{}),
+}
+
+// keySalt spreads the keys of a table over buckets.
+type keySalt struct {
+	columns []string
+	buckets int
+}
+
+// eventKey is the message key of an event, with its bucket when the keys of
+// its table are salted.
+type eventKey struct {
+	key     string
+	bucket  int
+	buckets int
+}
+
+// apply sets the key metadata fields, events without a key have none.
+func (k eventKey) apply(msg *service.Message) {
+	if k.key == "" {
+		return
+	}
+	msg.MetaSetMut("pg_key", k.key)
+	if k.buckets > 0 {
+		msg.MetaSetMut("pg_key_bucket", strconv.Itoa(k.bucket))
+		msg.MetaSetMut("pg_key_buckets", strconv.Itoa(k.buckets))
+	}
+}
+
+// messageKeys sets the message key of the changes of tables from the
+// configured columns, or from their primary key columns when set.
+type messageKeys struct {
+	columns     map[string][]string
+	salts       map[string]keySalt
+	primaryKeys map[string][]string
+}
+
+func newMessageKeysFromParsed(confs []*service.ParsedConfig) (*messageKeys, error) {
+	k := &messageKeys{columns: map[string][]string{}, salts: map[string]keySalt{}}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		columns, err := conf.FieldStringList("columns")
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("key columns of table %s must not be empty", table)
+		}
+		if _, exists := k.columns[table]; exists {
+			return nil, fmt.Errorf("key columns of table %s are configured twice", table)
+		}
+		k.columns[table] = columns
+
+		var salt keySalt
+		if salt.buckets, err = conf.FieldInt("salt_buckets"); err != nil {
+			return nil, err
+		}
+		if salt.columns, err = conf.FieldStringList("salt_columns"); err != nil {
+			return nil, err
+		}
+		switch {
+		case salt.buckets < 0:
+			return nil, fmt.Errorf("salt buckets of table %s must not be negative, got %d", table, salt.buckets)
+		case salt.buckets > 0 && len(salt.columns) == 0:
+			return nil, fmt.Errorf("salt columns of table %s must not be empty with salt buckets", table)
+		case salt.buckets == 0 && len(salt.columns) > 0:
+			return nil, fmt.Errorf("salt columns of table %s require salt buckets", table)
+		}
+		if salt.buckets > 0 {
+			k.salts[table] = salt
+		}
+	}
+	return k, nil
+}
+
+// key returns the message key of a change. A single column key is the column
+// value, a composite key a JSON array of the values. The key of a delete is
+// taken from the old keys, which only hold non key columns with REPLICA
+// IDENTITY FULL.
+func (k *messageKeys) key(change pglogicalstream.Wal2JsonChange) (string, bool) {
+	columns, ok := k.columns[change.Table]
+	if !ok {
+		columns, ok = k.primaryKeys[change.Table]
+	}
+	if !ok {
+		return "", false
+	}
+	parts, ok := keyParts(change, columns)
+	if !ok {
+		return "", false
+	}
+	if len(parts) == 1 {
+		return keyValueString(parts[0]), true
+	}
+	b, err := json.Marshal(parts)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// keyParts returns the values of the columns of a change, read from the old
+// keys of deletes.
+func keyParts(change pglogicalstream.Wal2JsonChange, columns []string) ([]interface{}, bool) {
+	names, values := change.ColumnNames, change.ColumnValues
+	if change.Kind == "delete" {
+		names, values = change.OldKeys.KeyNames, change.OldKeys.KeyValues
+	}
+
+	parts := make([]interface{}, len(columns))
+	for i, column := range columns {
+		var ok bool
+		if parts[i], ok = columnValue(names, values, column); !ok {
+			return nil, false
+		}
+	}
+	return parts, true
+}
+
+// messageKey returns the key of a message, which only messages holding a
+// single change have. The keys of changes of salted tables without their
+// salt columns are left unsalted, as their bucket is unknown.
+func (k *messageKeys) messageKey(changes []pglogicalstream.Wal2JsonChange) (eventKey, bool) {
+	if len(changes) != 1 {
+		return eventKey{}, false
+	}
+	key, ok := k.key(changes[0])
+	if !ok {
+		return eventKey{}, false
+	}
+	salt, salted := k.salts[changes[0].Table]
+	if !salted {
+		return eventKey{key: key}, true
+	}
+	parts, ok := keyParts(changes[0], salt.columns)
+	if !ok {
+		return eventKey{key: key}, true
+	}
+	b, err := json.Marshal(parts)
+	if err != nil {
+		return eventKey{key: key}, true
+	}
+	bucket := int(xxhash.Checksum32(b) % uint32(salt.buckets))
+	return eventKey{key: fmt.Sprintf("%s#%d", key, bucket), bucket: bucket, buckets: salt.buckets}, true
+}
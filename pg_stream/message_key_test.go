@@ -0,0 +1,165 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestMessageKeys(t *testing.T) {
+	spec := service.NewConfigSpec().Field(service.NewObjectListField("key_columns", keyColumnsConfigFields...))
+	conf, err := spec.ParseYAML(`
+key_columns:
+  - table: orders
+    columns: [ tenant_id, order_number ]
+  - table: customers
+    columns: [ email ]
+`, nil)
+	require.NoError(t, err)
+	confs, err := conf.FieldObjectList("key_columns")
+	require.NoError(t, err)
+	keys, err := newMessageKeysFromParsed(confs)
+	require.NoError(t, err)
+
+	key, ok := keys.key(pglogicalstream.Wal2JsonChange{
+		Kind:         "insert",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "tenant_id", "order_number"},
+		ColumnValues: []interface{}{float64(1), "acme", float64(1042)},
+	})
+	require.True(t, ok)
+	assert.Equal(t, `["acme",1042]`, key)
+
+	key, ok = keys.key(pglogicalstream.Wal2JsonChange{
+		Kind:         "delete",
+		Table:        "customers",
+		ColumnValues: []interface{}{"a@example.com"},
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  []string{"email"},
+			KeyValues: []interface{}{"a@example.com"},
+		},
+	})
+	require.True(t, ok)
+	assert.Equal(t, "a@example.com", key)
+
+	// Deletes without the key columns in their old keys have no key.
+	_, ok = keys.key(pglogicalstream.Wal2JsonChange{
+		Kind:  "delete",
+		Table: "orders",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  []string{"id"},
+			KeyValues: []interface{}{float64(1)},
+		},
+	})
+	assert.False(t, ok)
+
+	_, ok = keys.key(pglogicalstream.Wal2JsonChange{Kind: "insert", Table: "other"})
+	assert.False(t, ok)
+}
+
+func TestMessageKeySalting(t *testing.T) {
+	spec := service.NewConfigSpec().Field(service.NewObjectListField("key_columns", keyColumnsConfigFields...))
+	conf, err := spec.ParseYAML(`
+key_columns:
+  - table: orders
+    columns: [ tenant_id ]
+    salt_buckets: 8
+    salt_columns: [ id ]
+`, nil)
+	require.NoError(t, err)
+	confs, err := conf.FieldObjectList("key_columns")
+	require.NoError(t, err)
+	keys, err := newMessageKeysFromParsed(confs)
+	require.NoError(t, err)
+
+	change := func(kind string, id float64) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{
+			Kind:         kind,
+			Table:        "orders",
+			ColumnNames:  []string{"id", "tenant_id"},
+			ColumnValues: []interface{}{id, "acme"},
+		}}
+	}
+
+	// The events of a row share their bucket.
+	first, ok := keys.messageKey(change("insert", 1))
+	require.True(t, ok)
+	assert.Equal(t, 8, first.buckets)
+	assert.Equal(t, fmt.Sprintf("acme#%d", first.bucket), first.key)
+	update, ok := keys.messageKey(change("update", 1))
+	require.True(t, ok)
+	assert.Equal(t, first, update)
+
+	// The rows of a key are spread over the buckets.
+	buckets := map[int]bool{}
+	for id := 1; id <= 100; id++ {
+		key, ok := keys.messageKey(change("insert", float64(id)))
+		require.True(t, ok)
+		buckets[key.bucket] = true
+	}
+	assert.Len(t, buckets, 8)
+
+	msg := service.NewMessage(nil)
+	first.apply(msg)
+	bucket, _ := msg.MetaGet("pg_key_bucket")
+	assert.Equal(t, strconv.Itoa(first.bucket), bucket)
+	count, _ := msg.MetaGet("pg_key_buckets")
+	assert.Equal(t, "8", count)
+
+	conf, err = spec.ParseYAML(`
+key_columns:
+  - table: orders
+    columns: [ tenant_id ]
+    salt_buckets: 8
+`, nil)
+	require.NoError(t, err)
+	confs, err = conf.FieldObjectList("key_columns")
+	require.NoError(t, err)
+	_, err = newMessageKeysFromParsed(confs)
+	assert.EqualError(t, err, "salt columns of table orders must not be empty with salt buckets")
+}
+
+func TestPrimaryKeyMessageKeys(t *testing.T) {
+	keys, err := newMessageKeysFromParsed(nil)
+	require.NoError(t, err)
+	keys.primaryKeys = map[string][]string{"orders": {"id"}, "order_lines": {"order_id", "line"}}
+
+	key, ok := keys.messageKey([]pglogicalstream.Wal2JsonChange{{
+		Kind:         "update",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "status"},
+		ColumnValues: []interface{}{float64(7), "shipped"},
+	}})
+	require.True(t, ok)
+	assert.Equal(t, eventKey{key: "7"}, key)
+
+	// Deletes read their key from the old keys, which hold the primary key
+	// under the default replica identity.
+	key, ok = keys.messageKey([]pglogicalstream.Wal2JsonChange{{
+		Kind:  "delete",
+		Table: "order_lines",
+		OldKeys: pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  []string{"order_id", "line"},
+			KeyValues: []interface{}{float64(7), float64(2)},
+		},
+	}})
+	require.True(t, ok)
+	assert.Equal(t, eventKey{key: "[7,2]"}, key)
+
+	_, ok = keys.messageKey([]pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "audit_log"}})
+	assert.False(t, ok)
+}
@@ -0,0 +1,214 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+const tableColumnsQuery = `
+SELECT table_name, column_name
+FROM information_schema.columns
+WHERE table_schema = $1
+  AND table_name = ANY($2)
+ORDER BY table_name, ordinal_position`
+
+var migrationModeConfigFields = []*service.ConfigField{
+	service.NewStringField("cache").
+		Description("The cache resource holding the migration mode toggle"),
+	service.NewStringField("key").
+		Description("The cache key of the toggle. Migration mode is on while the key holds `true`, and off when it holds anything else or doesn't exist").
+		Default("pg_stream_migration_mode"),
+	service.NewDurationField("check_interval").
+		Description("How often the toggle is read").
+		Default("5s"),
+	service.NewIntField("max_buffered").
+		Description("The maximum number of schema-mismatched changes buffered during a migration. Once reached, the input stops reading until migration mode is turned off").
+		Default(10000),
+}
+
+// migrationMode is toggled at runtime through a cache key while planned DDL
+// runs on the source. While it is on the column schema of the replicated
+// tables isn't refreshed and changes that don't match it are buffered rather
+// than emitted. When it is turned off the schema is refreshed and the buffered
+// changes are emitted.
+type migrationMode struct {
+	cache         string
+	key           string
+	checkInterval time.Duration
+	maxBuffered   int
+
+	on        bool
+	lastCheck time.Time
+	buffered  []trackedChanges
+	columns   map[string][]string
+
+	res *service.Resources
+}
+
+func newMigrationModeFromParsed(conf *service.ParsedConfig, res *service.Resources) (m *migrationMode, err error) {
+	m = &migrationMode{res: res}
+	if m.cache, err = conf.FieldString("cache"); err != nil {
+		return nil, err
+	}
+	if m.key, err = conf.FieldString("key"); err != nil {
+		return nil, err
+	}
+	if m.checkInterval, err = conf.FieldDuration("check_interval"); err != nil {
+		return nil, err
+	}
+	if m.maxBuffered, err = conf.FieldInt("max_buffered"); err != nil {
+		return nil, err
+	}
+	if !res.HasCache(m.cache) {
+		return nil, errors.New("migration mode cache resource " + strconv.Quote(m.cache) + " doesn't exist")
+	}
+	return m, nil
+}
+
+func queryTableColumns(ctx context.Context, db *sql.DB, schema string, tables []string) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, tableColumnsQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string][]string{}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		columns[table] = append(columns[table], column)
+	}
+	return columns, rows.Err()
+}
+
+// poll reads the toggle once the check interval elapsed and returns whether
+// migration mode was just turned off. A missing toggle turns migration mode
+// off, a toggle that fails to be read leaves it as it was.
+func (m *migrationMode) poll(ctx context.Context) (ended bool, err error) {
+	if time.Since(m.lastCheck) < m.checkInterval {
+		return false, nil
+	}
+	m.lastCheck = time.Now()
+
+	var value []byte
+	if aerr := m.res.AccessCache(ctx, m.cache, func(c service.Cache) {
+		value, err = c.Get(ctx, m.key)
+	}); aerr != nil {
+		return false, aerr
+	}
+	if err != nil && !errors.Is(err, service.ErrKeyNotFound) {
+		return false, err
+	}
+
+	on, _ := strconv.ParseBool(string(value))
+	ended = m.on && !on
+	m.on = on
+	return ended, nil
+}
+
+// full returns true when migration mode is on and the buffer can't take more
+// changes.
+func (m *migrationMode) full() bool {
+	return m.on && len(m.buffered) >= m.maxBuffered
+}
+
+// matches returns false when an inserted or updated row doesn't have the
+// columns of its table.
+func (m *migrationMode) matches(changes []pglogicalstream.Wal2JsonChange) bool {
+	for _, change := range changes {
+		if change.Kind != "insert" && change.Kind != "update" {
+			continue
+		}
+		if columns, ok := m.columns[change.Table]; ok && !slices.Equal(columns, change.ColumnNames) {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshSchema reloads the column schema of the replicated tables along with
+// the catalog metadata derived from it.
+func (p *pgStreamInput) refreshSchema(ctx context.Context) (err error) {
+	if p.migration.columns, err = queryCatalog(ctx, p.catalogRetrier, "columns", func(ctx context.Context) (map[string][]string, error) {
+		return queryTableColumns(ctx, p.db, p.schema, p.tables)
+	}); err != nil {
+		return err
+	}
+	if p.relations != nil {
+		if err = p.queryRelations(ctx); err != nil {
+			return err
+		}
+	}
+	if p.partitionMetadata {
+		if p.partitions, err = queryCatalog(ctx, p.catalogRetrier, "partitions", func(ctx context.Context) (partitionMetadata, error) {
+			return queryPartitionMetadata(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollMigrationMode refreshes the schema and releases the buffered changes
+// once migration mode is turned off. While the buffer is full it waits for
+// the next check of the toggle.
+func (p *pgStreamInput) pollMigrationMode(ctx context.Context) error {
+	if p.migration.full() {
+		select {
+		case <-time.After(time.Until(p.migration.lastCheck.Add(p.migration.checkInterval))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	ended, err := p.migration.poll(ctx)
+	if err != nil {
+		return err
+	}
+	if !ended {
+		return nil
+	}
+
+	p.logger.Infof("Migration mode turned off, emitting %d buffered changes", len(p.migration.buffered))
+	if err := p.refreshSchema(ctx); err != nil {
+		return err
+	}
+	for i := len(p.migration.buffered) - 1; i >= 0; i-- {
+		p.backlog.requeue(p.migration.buffered[i])
+	}
+	p.migration.buffered = nil
+	return nil
+}
+
+// holdForMigration buffers changes that don't match the known schema while
+// migration mode is on, and refreshes the schema when it is off. It returns
+// true when the changes were buffered.
+func (p *pgStreamInput) holdForMigration(ctx context.Context, changes trackedChanges) (bool, error) {
+	if p.migration.matches(changes.Changes) {
+		return false, nil
+	}
+	if p.migration.on {
+		p.migration.buffered = append(p.migration.buffered, changes)
+		return true, nil
+	}
+	return false, p.refreshSchema(ctx)
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestMigrationModeToggle(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("toggles"))
+	m := &migrationMode{cache: "toggles", key: "migration", maxBuffered: 1, res: res}
+	ctx := context.Background()
+
+	setToggle := func(value string) {
+		require.NoError(t, res.AccessCache(ctx, "toggles", func(c service.Cache) {
+			require.NoError(t, c.Set(ctx, "migration", []byte(value), nil))
+		}))
+	}
+
+	ended, err := m.poll(ctx)
+	require.NoError(t, err)
+	assert.False(t, ended)
+	assert.False(t, m.on)
+
+	setToggle("true")
+	_, err = m.poll(ctx)
+	require.NoError(t, err)
+	assert.True(t, m.on)
+
+	m.buffered = append(m.buffered, trackedChanges{})
+	assert.True(t, m.full())
+
+	// A toggle that can't be read leaves migration mode on.
+	m.cache = "missing"
+	_, err = m.poll(ctx)
+	require.Error(t, err)
+	assert.True(t, m.on)
+	m.cache = "toggles"
+
+	setToggle("false")
+	ended, err = m.poll(ctx)
+	require.NoError(t, err)
+	assert.True(t, ended)
+	assert.False(t, m.full())
+}
+
+func TestMigrationModeMatchesSchema(t *testing.T) {
+	m := &migrationMode{columns: map[string][]string{"users": {"id", "name"}}}
+
+	change := func(kind string, columns ...string) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{Kind: kind, Table: "users", ColumnNames: columns}}
+	}
+	assert.True(t, m.matches(change("insert", "id", "name")))
+	assert.False(t, m.matches(change("update", "id", "name", "email")))
+	assert.True(t, m.matches(change("delete", "id")))
+}
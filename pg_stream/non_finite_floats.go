@@ -0,0 +1,88 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type nonFiniteFloatPolicy string
+
+const (
+	nonFiniteString nonFiniteFloatPolicy = "string"
+	nonFiniteNull   nonFiniteFloatPolicy = "null"
+	nonFiniteFail   nonFiniteFloatPolicy = "fail"
+	// nonFiniteDeadLetter encodes values as strings like nonFiniteString,
+	// but the event is flagged for a dead-letter output.
+	nonFiniteDeadLetter nonFiniteFloatPolicy = "dead_letter"
+)
+
+// apply replaces NaN and infinite float values, which can't be encoded as
+// JSON, according to the policy. It returns true if a value was replaced.
+func (n nonFiniteFloatPolicy) apply(changes []pglogicalstream.Wal2JsonChange) (found bool, err error) {
+	for i := range changes {
+		c := &changes[i]
+		if !slices.ContainsFunc(c.ColumnValues, isNonFiniteFloat) {
+			continue
+		}
+
+		found = true
+		c.ColumnValues = slices.Clone(c.ColumnValues)
+		for j, v := range c.ColumnValues {
+			if !isNonFiniteFloat(v) {
+				continue
+			}
+			switch n {
+			case nonFiniteNull:
+				c.ColumnValues[j] = nil
+			case nonFiniteFail:
+				column := ""
+				if j < len(c.ColumnNames) {
+					column = c.ColumnNames[j]
+				}
+				return found, fmt.Errorf("column %s of table %s holds the non-finite value %v", column, c.Table, v)
+			default:
+				c.ColumnValues[j] = formatNonFiniteFloat(v)
+			}
+		}
+	}
+	return found, nil
+}
+
+func isNonFiniteFloat(v interface{}) bool {
+	switch f := v.(type) {
+	case float64:
+		return math.IsNaN(f) || math.IsInf(f, 0)
+	case float32:
+		return math.IsNaN(float64(f)) || math.IsInf(float64(f), 0)
+	}
+	return false
+}
+
+// formatNonFiniteFloat renders the value the way Postgres does.
+func formatNonFiniteFloat(v interface{}) string {
+	var f float64
+	switch t := v.(type) {
+	case float64:
+		f = t
+	case float32:
+		f = float64(t)
+	}
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return "NaN"
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestNonFiniteFloatPolicy(t *testing.T) {
+	values := []interface{}{math.NaN(), math.Inf(1), math.Inf(-1), 1.5}
+	newChanges := func() []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{
+			Table:        "readings",
+			ColumnNames:  []string{"a", "b", "c", "d"},
+			ColumnValues: values,
+		}}
+	}
+
+	changes := newChanges()
+	found, err := nonFiniteString.apply(changes)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []interface{}{"NaN", "Infinity", "-Infinity", 1.5}, changes[0].ColumnValues)
+	assert.True(t, math.IsNaN(values[0].(float64)), "the original values must not be modified")
+
+	changes = newChanges()
+	_, err = nonFiniteNull.apply(changes)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, nil, nil, 1.5}, changes[0].ColumnValues)
+
+	_, err = nonFiniteFail.apply(newChanges())
+	assert.EqualError(t, err, "column a of table readings holds the non-finite value NaN")
+}
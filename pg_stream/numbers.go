@@ -0,0 +1,89 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type numberEncoding string
+
+const (
+	numberFloat   numberEncoding = "float"
+	numberString  numberEncoding = "string"
+	numberWrapped numberEncoding = "wrapped"
+)
+
+// maxSafeInteger is the largest integer a float64, and therefore a JavaScript
+// number, represents exactly.
+const maxSafeInteger = 1 << 53
+
+// apply converts the json.Number values of streamed changes. Integers that fit
+// in a float64 become int64 values, integers beyond 2^53 and numeric columns
+// are encoded as strings or wrapped, and other numbers become float64 values.
+func (n numberEncoding) apply(changes []pglogicalstream.Wal2JsonChange) {
+	for i := range changes {
+		changes[i].ColumnValues = n.convert(changes[i].ColumnTypes, changes[i].ColumnValues)
+	}
+}
+
+func (n numberEncoding) convert(types []string, values []interface{}) []interface{} {
+	if !slices.ContainsFunc(values, isJSONNumber) {
+		return values
+	}
+
+	values = slices.Clone(values)
+	for i, v := range values {
+		num, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if i < len(types) && isDecimalType(types[i]) {
+			values[i] = n.encode(num)
+			continue
+		}
+		if iv, err := num.Int64(); err == nil {
+			if iv > maxSafeInteger || iv < -maxSafeInteger {
+				values[i] = n.encode(num)
+			} else {
+				values[i] = iv
+			}
+			continue
+		}
+		// Integers that overflow an int64 end up here too, and must not be
+		// rounded into a float.
+		if fv, err := num.Float64(); err == nil && strings.ContainsAny(num.String(), ".eE") {
+			values[i] = fv
+		} else {
+			values[i] = n.encode(num)
+		}
+	}
+	return values
+}
+
+func (n numberEncoding) encode(num json.Number) interface{} {
+	if n == numberWrapped {
+		return map[string]interface{}{"$numberDecimal": num.String()}
+	}
+	return num.String()
+}
+
+func isJSONNumber(v interface{}) bool {
+	_, ok := v.(json.Number)
+	return ok
+}
+
+func isDecimalType(t string) bool {
+	t = strings.ToLower(t)
+	return strings.HasPrefix(t, "numeric") || strings.HasPrefix(t, "decimal")
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestNumberEncoding(t *testing.T) {
+	newChanges := func() []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{
+			ColumnNames: []string{"small", "big", "huge", "price", "ratio", "name"},
+			ColumnTypes: []string{"bigint", "bigint", "numeric", "numeric(10,2)", "double precision", "text"},
+			ColumnValues: []interface{}{
+				json.Number("42"),
+				json.Number("9007199254740993"),
+				json.Number("123456789012345678901234567890"),
+				json.Number("10.50"),
+				json.Number("0.25"),
+				"foo",
+			},
+		}}
+	}
+
+	changes := newChanges()
+	numberString.apply(changes)
+	assert.Equal(t, []interface{}{
+		int64(42), "9007199254740993", "123456789012345678901234567890", "10.50", 0.25, "foo",
+	}, changes[0].ColumnValues)
+
+	changes = newChanges()
+	numberWrapped.apply(changes)
+	assert.Equal(t, map[string]interface{}{"$numberDecimal": "9007199254740993"}, changes[0].ColumnValues[1])
+	assert.Equal(t, map[string]interface{}{"$numberDecimal": "10.50"}, changes[0].ColumnValues[3])
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// sequenceKeysQuery lists the tables whose primary key is a single column
+// filled from a sequence, either an identity column or a serial one.
+const sequenceKeysQuery = `
+SELECT c.relname, a.attname
+FROM pg_index i
+JOIN pg_class c ON c.oid = i.indrelid
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = i.indkey[0]
+LEFT JOIN pg_attrdef d ON d.adrelid = c.oid AND d.adnum = a.attnum
+WHERE i.indisprimary
+  AND i.indnatts = 1
+  AND ns.nspname = $1
+  AND c.relname = ANY($2)
+  AND (a.attidentity <> '' OR pg_get_expr(d.adbin, d.adrelid) LIKE 'nextval(%')`
+
+var partitionHintsConfigFields = []*service.ConfigField{
+	service.NewDurationField("interval").
+		Description("How often the change rates are sampled and a partition hints event is emitted").
+		Default("1m"),
+	service.NewFloatField("events_per_partition").
+		Description("The number of events per second a partition of the topic of a table is expected to sustain, which the suggested partition counts derive from").
+		Default(1000),
+	service.NewBoolField("suggest_keys").
+		Description("Suggest the primary key as the partition key of tables whose primary key is a single column filled from a sequence, as such keys spread evenly across hashed partitions").
+		Default(false),
+}
+
+// partitionHints samples the rate of the streamed changes of each table and
+// suggests partition counts for their topics.
+type partitionHints struct {
+	interval           time.Duration
+	eventsPerPartition float64
+	suggestKeys        bool
+
+	// counts are the changes of each table since the last sample, tables
+	// stay listed once seen.
+	counts       map[string]int
+	lastSample   time.Time
+	sequenceKeys map[string]string
+
+	changes    *service.MetricCounter
+	partitions *service.MetricGauge
+}
+
+// partitionHint is the hint of a table in a partition hints event.
+type partitionHint struct {
+	Table           string  `json:"table"`
+	EventsPerSecond float64 `json:"events_per_second"`
+	Partitions      int     `json:"partitions"`
+	PartitionKey    string  `json:"partition_key,omitempty"`
+}
+
+func newPartitionHintsFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (h *partitionHints, err error) {
+	h = &partitionHints{
+		counts:     map[string]int{},
+		lastSample: time.Now(),
+		changes:    metrics.NewCounter("pg_stream_table_changes", "table"),
+		partitions: metrics.NewGauge("pg_stream_table_partition_hint", "table"),
+	}
+	if h.interval, err = conf.FieldDuration("interval"); err != nil {
+		return nil, err
+	}
+	if h.eventsPerPartition, err = conf.FieldFloat("events_per_partition"); err != nil {
+		return nil, err
+	}
+	if h.suggestKeys, err = conf.FieldBool("suggest_keys"); err != nil {
+		return nil, err
+	}
+	if h.interval <= 0 {
+		return nil, fmt.Errorf("interval must be positive, got %v", h.interval)
+	}
+	if h.eventsPerPartition <= 0 {
+		return nil, fmt.Errorf("events_per_partition must be positive, got %v", h.eventsPerPartition)
+	}
+	return h, nil
+}
+
+func querySequenceKeys(ctx context.Context, db *sql.DB, schema string, tables []string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, sequenceKeysQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sequence keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]string{}
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, err
+		}
+		keys[table] = column
+	}
+	return keys, rows.Err()
+}
+
+// observe counts the streamed changes of each table.
+func (h *partitionHints) observe(changes []pglogicalstream.Wal2JsonChange) {
+	for _, change := range changes {
+		h.counts[change.Table]++
+		h.changes.Incr(1, change.Table)
+	}
+}
+
+// nextEmit returns when the next sample is due.
+func (h *partitionHints) nextEmit() time.Time {
+	return h.lastSample.Add(h.interval)
+}
+
+// due returns a partition hints event once the interval elapsed and changes
+// were streamed, or nil.
+func (h *partitionHints) due(now time.Time) (*service.Message, error) {
+	if now.Before(h.nextEmit()) {
+		return nil, nil
+	}
+	elapsed := now.Sub(h.lastSample).Seconds()
+	h.lastSample = now
+	if len(h.counts) == 0 {
+		return nil, nil
+	}
+
+	hints := make([]partitionHint, 0, len(h.counts))
+	for table, count := range h.counts {
+		rate := float64(count) / elapsed
+		hint := partitionHint{
+			Table:           table,
+			EventsPerSecond: rate,
+			Partitions:      max(1, int(math.Ceil(rate/h.eventsPerPartition))),
+			PartitionKey:    h.sequenceKeys[table],
+		}
+		h.partitions.Set(int64(hint.Partitions), table)
+		hints = append(hints, hint)
+		h.counts[table] = 0
+	}
+	slices.SortFunc(hints, func(a, b partitionHint) int {
+		return cmp.Compare(a.Table, b.Table)
+	})
+
+	b, err := json.Marshal(map[string]any{"interval": h.interval.String(), "tables": hints})
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "partition_hints")
+	return msg, nil
+}
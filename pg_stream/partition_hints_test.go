@@ -0,0 +1,67 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestPartitionHints(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(partitionHintsConfigFields...)
+	conf, err := spec.ParseYAML("interval: 10s\nevents_per_partition: 100", nil)
+	require.NoError(t, err)
+	h, err := newPartitionHintsFromParsed(conf, service.MockResources().Metrics())
+	require.NoError(t, err)
+	h.sequenceKeys = map[string]string{"orders": "id"}
+
+	start := h.lastSample
+	msg, err := h.due(start.Add(10 * time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, msg, "no changes were streamed")
+
+	changes := make([]pglogicalstream.Wal2JsonChange, 0, 2500)
+	for i := 0; i < 2500; i++ {
+		changes = append(changes, pglogicalstream.Wal2JsonChange{Table: "orders"})
+	}
+	h.observe(changes)
+	h.observe([]pglogicalstream.Wal2JsonChange{{Table: "audit_log"}})
+
+	msg, err = h.due(start.Add(15 * time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, msg, "the interval didn't elapse since the last sample")
+
+	msg, err = h.due(start.Add(20 * time.Second))
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	eventType, _ := msg.MetaGet("event_type")
+	assert.Equal(t, "partition_hints", eventType)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"interval":"10s","tables":[
+		{"table":"audit_log","events_per_second":0.1,"partitions":1},
+		{"table":"orders","events_per_second":250,"partitions":3,"partition_key":"id"}
+	]}`, string(b))
+
+	// Tables stay listed once seen.
+	msg, err = h.due(start.Add(30 * time.Second))
+	require.NoError(t, err)
+	b, err = msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"interval":"10s","tables":[
+		{"table":"audit_log","events_per_second":0,"partitions":1},
+		{"table":"orders","events_per_second":0,"partitions":1,"partition_key":"id"}
+	]}`, string(b))
+}
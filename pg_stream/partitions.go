@@ -0,0 +1,73 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+const partitionsQuery = `
+SELECT c.relname,
+       root.relname,
+       COALESCE(pg_get_expr(c.relpartbound, c.oid), '')
+FROM pg_class c
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+JOIN pg_class root ON root.oid = pg_partition_root(c.oid)
+WHERE c.relispartition
+  AND ns.nspname = $1
+  AND c.relname = ANY($2)`
+
+type partitionInfo struct {
+	root  string
+	bound string
+}
+
+// partitionMetadata maps replicated partitions to their root table so
+// downstream systems can mirror the partitioning.
+type partitionMetadata map[string]partitionInfo
+
+func queryPartitionMetadata(ctx context.Context, db *sql.DB, schema string, tables []string) (partitionMetadata, error) {
+	rows, err := db.QueryContext(ctx, partitionsQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	partitions := partitionMetadata{}
+	for rows.Next() {
+		var table string
+		var info partitionInfo
+		if err := rows.Scan(&table, &info.root, &info.bound); err != nil {
+			return nil, err
+		}
+		partitions[table] = info
+	}
+	return partitions, rows.Err()
+}
+
+// apply sets the partition metadata fields when the changes belong to a
+// partition.
+func (p partitionMetadata) apply(msg *service.Message, changes []pglogicalstream.Wal2JsonChange) {
+	if len(changes) == 0 {
+		return
+	}
+	info, ok := p[changes[0].Table]
+	if !ok {
+		return
+	}
+	msg.MetaSetMut("partition", changes[0].Table)
+	msg.MetaSetMut("partition_root", info.root)
+	msg.MetaSetMut("partition_bound", info.bound)
+}
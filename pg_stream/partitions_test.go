@@ -0,0 +1,72 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestPartitionMetadata(t *testing.T) {
+	partitions := partitionMetadata{
+		"orders_2024": {root: "orders", bound: "FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')"},
+		"orders_eu":   {root: "orders", bound: "FOR VALUES IN ('eu')"},
+	}
+
+	tests := []struct {
+		name    string
+		changes []pglogicalstream.Wal2JsonChange
+		meta    map[string]string
+	}{
+		{
+			name:    "partition",
+			changes: []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "orders_2024"}},
+			meta: map[string]string{
+				"partition":       "orders_2024",
+				"partition_root":  "orders",
+				"partition_bound": "FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')",
+			},
+		},
+		{
+			name:    "first change decides",
+			changes: []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "orders_eu"}, {Kind: "insert", Table: "orders_2024"}},
+			meta: map[string]string{
+				"partition":       "orders_eu",
+				"partition_root":  "orders",
+				"partition_bound": "FOR VALUES IN ('eu')",
+			},
+		},
+		{
+			name:    "plain table",
+			changes: []pglogicalstream.Wal2JsonChange{{Kind: "insert", Table: "payments"}},
+			meta:    map[string]string{},
+		},
+		{
+			name: "no changes",
+			meta: map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			msg := service.NewMessage(nil)
+			partitions.apply(msg, test.changes)
+
+			meta := map[string]string{}
+			_ = msg.MetaWalk(func(k, v string) error {
+				meta[k] = v
+				return nil
+			})
+			assert.Equal(t, test.meta, meta)
+		})
+	}
+}
@@ -11,49 +11,126 @@ package pg_stream
 import (
 	"context"
 	"crypto/tls"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/lucasepe/codename"
 	"github.com/redpanda-data/benthos/v4/public/service"
-	"github.com/usedatabrew/pglogicalstream"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
 )
 
 var randomSlotName string
 
 var pgStreamConfigSpec = service.NewConfigSpec().
 	Summary("Creates Postgres replication slot for CDC").
+	Description("Events carry the metadata fields `schema`, `table` and `operation` (`insert`, `update` or `delete`) of their first change, so they can be routed and filtered without parsing the payload. Streamed events also carry the `lsn` and the `commit_timestamp` of their transaction, in RFC 3339 format, for measuring the end-to-end latency or processing by event time. With `envelope_version` set to `2` the commit timestamp is part of the payload as well").
 	Field(service.NewStringField("host").
 		Description("PostgreSQL instance host").
-		Example("123.0.0.1")).
+		Example("123.0.0.1").
+		Default("")).
 	Field(service.NewIntField("port").
-		Description("PostgreSQL instance port").
+		Description("PostgreSQL instance port, 5432 when not set").
 		Example(5432).
-		Default(5432)).
+		Optional()).
 	Field(service.NewStringField("user").
 		Description("Username with permissions to start replication (RDS superuser)").
-		Example("postgres"),
+		Example("postgres").
+		Default(""),
 	).
 	Field(service.NewStringField("password").
-		Description("PostgreSQL database password")).
+		Description("PostgreSQL database password").
+		Secret().
+		Default("")).
 	Field(service.NewStringField("schema").
 		Description("Schema that will be used to create replication")).
 	Field(service.NewStringField("database").
-		Description("PostgreSQL database name")).
+		Description("PostgreSQL database name").
+		Default("")).
 	Field(service.NewStringEnumField("tls", "require", "none").
-		Description("Defines whether benthos need to verify (skipinsecure) TLS configuration").
+		Description("Defines whether benthos need to verify (skipinsecure) TLS configuration, `none` when not set").
 		Example("none").
-		Default("none")).
+		Optional()).
+	Field(service.NewBoolField("connection_defaults_from_env").
+		Description("Fill in the connection fields left empty from the libpq environment variables `PGHOST`, `PGPORT`, `PGUSER`, `PGPASSWORD`, `PGDATABASE` and `PGSSLMODE`, and read the password file from `PGPASSFILE`, like other Postgres tooling. The `host`, `user` and `database` fields are required otherwise").
+		Advanced().
+		Default(false)).
+	Field(service.NewStringField("pgpass_file").
+		Description("The path of a libpq password file to look up the password in when `password` is empty, using the first entry matching the host, port, database and user. Defaults to `PGPASSFILE` when `connection_defaults_from_env` is set, and to `~/.pgpass` otherwise. A missing file is ignored").
+		Advanced().
+		Default("")).
+	Field(service.NewStringField("application_name").
+		Description("The `application_name` of the SQL and replication connections, which tags every statement the input runs in `pg_stat_activity` and the server logs. Set to an empty string to leave it unset").
+		Advanced().
+		Default("benthos_pg_stream")).
 	Field(service.NewBoolField("stream_snapshot").
-		Description("Set `true` if you want to receive all the data that currently exist in database").
+		Description("Set `true` if you want to receive all the data that currently exist in database. All the snapshot rows are emitted before the changes streamed from the consistent point of the snapshot, and events carry the `phase` metadata field set to `snapshot` or `stream`").
 		Example(true).
 		Default(false)).
+	Field(service.NewStringField("snapshot_order").
+		Description("The order the snapshot rows of each table are emitted in, which some bulk loaders rely on for efficient ingestion. `pk` emits rows in primary key order and requires every table to have a primary key, `none` makes no ordering guarantee but supports tables without a primary key, and any other value is the name of a column to order the rows by").
+		Example("pk").
+		Example("none").
+		Example("created_at").
+		Advanced().
+		Default(pglogicalstream.SnapshotOrderPrimaryKey)).
+	Field(service.NewStringAnnotatedEnumField("snapshot_planning", map[string]string{
+		pglogicalstream.SnapshotPlanningUniform: "Snapshot tables in the configured order, scanning each table to find the average row size the chunk size is derived from.",
+		pglogicalstream.SnapshotPlanningSize:    "Snapshot the largest tables first by `pg_table_size`, and derive the average row size from `pg_table_size` and `pg_class.reltuples` without scanning the tables. Tables that were never analyzed are scanned.",
+	}).
+		Description("How the snapshot of the tables is planned. Tables are snapshotted one after another within the single snapshot transaction, in pages whose size is derived from the average row size, so planning only changes the order of the tables and how their row size is estimated. Tables aren't split across parallel workers, and small tables aren't grouped together").
+		Advanced().
+		Default(pglogicalstream.SnapshotPlanningUniform)).
 	Field(service.NewFloatField("snapshot_memory_safety_factor").
 		Description("Sets amout of memory that can be used to stream snapshot. If affects batch sizes. If we want to use only 25% of the memory available - put 0.25 factor. It will make initial streaming slower, but it will prevent your worker from OOM Kill").
 		Example(0.2).
 		Default(0.5)).
+	Field(service.NewIntField("snapshot_batch_size").
+		Description("The maximum number of rows read per snapshot query. The batch size is otherwise derived from the available memory and `snapshot_memory_safety_factor`. Set to `0` for no maximum").
+		Advanced().
+		Default(0)).
+	Field(service.NewIntField("snapshot_buffer_size").
+		Description("The number of snapshot rows read ahead of the pipeline").
+		Advanced().
+		Default(100)).
+	Field(service.NewBoolField("snapshot_progress").
+		Description("Emit a progress message after each chunk of snapshot rows of a table, with the `event_type` metadata field set to `snapshot_progress`. The message holds the `table`, the `rows_done` so far, the `rows_estimated` by the planner statistics, the `rows_per_second` throughput and whether the table is `done`").
+		Advanced().
+		Default(false)).
+	Field(service.NewDurationField("snapshot_statement_timeout").
+		Description("Cancel the statements of the snapshot transaction that run for longer, failing the snapshot, so that the input can't hold back vacuum with a runaway query. Set to `0s` for no limit").
+		Advanced().
+		Default("0s")).
+	Field(service.NewDurationField("snapshot_max_transaction_duration").
+		Description("Bound how long the snapshot transaction stays open, as it holds back the xmin horizon and causes table bloat. Once the duration elapsed the transaction is committed before the next chunk of rows, and the snapshot continues on a fresh transaction, paging through rows by primary key. Rows read after such a re-anchoring may already reflect changes committed after the snapshot started, which are streamed again afterwards, so consumers should apply events by key. Requires `snapshot_order` set to `pk`. Set to `0s` for no limit").
+		Advanced().
+		Default("0s")).
+	Field(service.NewBoolField("separate_changes").
+		Description("Emit a message per changed row. When `false`, a message holds all the changes of a transaction to the replicated tables. Metadata keyed by table, such as `dead_letter_route` and `partition`, is taken from the first change of a message").
+		Advanced().
+		Default(true)).
+	Field(service.NewBoolField("transaction_boundaries").
+		Description("Sets the `transaction_lsn` metadata field of streamed events to the LSN of their transaction, and the `transaction_end` metadata field to `true` on the last event of each transaction. Use it with a batching policy `check` such as `@transaction_end == \"true\"` to flush batches at commit boundaries, so transactional sinks can map one batch to one transaction. Don't combine it with features that reorder or skip changes, such as `priority_tables`, `compaction`, `sampling` or dropping validation rules, since skipping the last change of a transaction leaves it without an end").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("commit_boundary_acks").
+		Description("Only confirm the LSN of a transaction to the slot, and store it in the `checkpoint` backend, once every event of the transaction is acknowledged, so that a crash never leaves a partially acknowledged transaction behind and it is redelivered as a whole. Without it, the events of a transaction split by `separate_changes` share its LSN, which is confirmed as soon as the first of them and the events before it are acknowledged").
+		Advanced().
+		Default(false)).
+	Field(service.NewDurationField("standby_message_timeout").
+		Description("The interval of the standby status updates sent to the server, which report the acknowledged position and keep the replication connection alive. The interval is capped to a third of the `wal_sender_timeout` of the server").
+		Advanced().
+		Default("10s")).
+	Field(service.NewDurationField("keepalive_response_deadline").
+		Description("How late a standby status update, either due or requested by the server, may be sent. Later updates are counted by the `pg_stream_keepalive_deadline_misses` metric, which points at disconnects caused by `wal_sender_timeout`").
+		Advanced().
+		Default("1s")).
 	Field(service.NewStringListField("tables").
 		Example(`
 			- my_table
@@ -63,9 +140,302 @@ var pgStreamConfigSpec = service.NewConfigSpec().
 	Field(service.NewStringField("slot_name").
 		Description("PostgeSQL logical replication slot name. You can create it manually before starting the sync. If not provided will be replaced with a random one").
 		Example("my_test_slot").
-		Default(randomSlotName))
+		Default(randomSlotName)).
+	Field(service.NewStringAnnotatedEnumField("checksum", map[string]string{
+		string(checksumNone):     "Do not attach a checksum.",
+		string(checksumXXHash64): "Attach the hex encoded xxhash64 of the after-image of each event.",
+		string(checksumSHA256):   "Attach the hex encoded SHA-256 of the after-image of each event.",
+	}).
+		Description("Attaches a content hash of the row after-image to each event as the `checksum` metadata field, so downstream stores can skip no-op writes and reconciliation tools can compare rows cheaply. The hash covers the row as replicated, before `lookups`, `derived_columns` and soft deletes modify it and `update_payload` trims it. Deletes hash their old keys, the replica identity of the row").
+		Advanced().
+		Default(string(checksumNone))).
+	Field(service.NewBoolField("schema_fingerprint").
+		Description("Set the `schema_fingerprint` metadata field of inserted and updated rows to a hash of their column names and types, so sinks can detect schema changes of a table by comparing fingerprints. Snapshot rows carry the same column types as streamed rows and have the same fingerprint").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("decode_extended_types").
+		Description("Decode the text representation of some types into values typed consumers can use. `money` values become decimal amounts encoded as set by `json_numbers`, as strings unless `wrapped`. The currency symbol of the `lc_monetary` locale of the server is dropped, so amounts of a column are assumed to share a currency. `tsvector` values become arrays of their lexemes, without positions and weights. `inet` and `cidr` values are normalized, with IPv6 addresses in their canonical form and `cidr` networks masked. `macaddr` and `macaddr8` values are normalized to lower case colon separated bytes. `bit` and `bit varying` values stay strings of `0` and `1`").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("degrade_undecodable_columns").
+		Description("Emit a snapshot column whose values can't be decoded into their type as raw text for the rest of the table, logging a warning, rather than failing the snapshot and stalling the slot. Degraded columns are reported by the `pg_stream_degraded_columns` gauge with the `table` and `column` labels").
+		Advanced().
+		Default(false)).
+	Field(service.NewStringAnnotatedEnumField("update_payload", map[string]string{
+		string(updatePayloadFull):    "Updates hold the whole row.",
+		string(updatePayloadChanged): "Updates hold the primary key columns and the columns that changed, with patch semantics. Tables need REPLICA IDENTITY FULL for the before image to tell which columns changed, otherwise updates hold the whole row.",
+	}).
+		Description("The columns held by update events. Emitting changed columns only cuts the payload size of wide tables with single column updates").
+		Advanced().
+		Default(string(updatePayloadFull))).
+	Field(service.NewStringAnnotatedEnumField("envelope_version", map[string]string{
+		string(envelopeV1):       "The `lsn` and the `change` list, as emitted by wal2json.",
+		string(envelopeV2):       "Adds the `envelope_version`, and the commit `timestamp` and `xid` of the transaction of streamed events.",
+		string(envelopeMaxwell):  "The document of the Maxwell daemon, with the `database`, `table`, `type`, `ts`, `xid`, `commit`, `data` and `old` fields, for consumers migrated from Maxwell-based MySQL pipelines. The `database` is the schema of the table, the `position` the LSN, and snapshot rows have the `bootstrap-insert` type. The `old` values of updates are limited to the replica identity columns unless the table uses REPLICA IDENTITY FULL. Requires `separate_changes`.",
+		string(envelopeProtobuf): "The `pg_stream.v1.ChangeEvent` protobuf message defined in `proto/change_event.proto`, for consumers that can't afford parsing JSON at high throughputs. Column values keep the types they have in the JSON documents, and arrays and JSON columns are held as JSON.",
+	}).
+		Description("The version or format of the document events are serialised to, which is also set in the `envelope_version` metadata field. Keep emitting the previous version while consumers are upgraded, so connector and consumer upgrades don't have to happen at once").
+		Advanced().
+		Default(string(envelopeV1))).
+	Field(service.NewObjectField("avro", avroConfigFields...).
+		Description("Serialise events to Avro instead of JSON, in the wire format of Confluent compatible schema registries such as the one of Redpanda. The schema of each table is derived from its column types and registered under the `<topic>-value` subject, where the topic is the one of the `topics` naming, or `<schema>.<table>` otherwise. Columns added to a table register a new version of its schema, and removed columns stay in the schema with null values. Events hold the `kind`, `schema`, `table`, `lsn`, `timestamp` and `xid` fields and the `before` and `after` images of the row, and carry the `schema_subject` and `schema_id` metadata fields. The `envelope_version` doesn't apply, and captures written with `record` hold JSON documents still. Requires `separate_changes`").
+		Advanced().
+		Optional()).
+	Field(service.NewStringAnnotatedEnumField("json_numbers", map[string]string{
+		string(numberFloat):   "Encode all numbers as JSON numbers. Integers beyond 2^53 lose precision when decoded as 64-bit floats, for example by JavaScript services.",
+		string(numberString):  "Encode integers beyond 2^53 and `numeric` values as JSON strings, other numbers as JSON numbers.",
+		string(numberWrapped): "Encode integers beyond 2^53 and `numeric` values as `{\"$numberDecimal\": \"<value>\"}` objects, other numbers as JSON numbers.",
+	}).
+		Description("How numbers of streamed changes are encoded. Snapshot events already carry `bigint` and `numeric` values as strings").
+		Advanced().
+		Default(string(numberFloat))).
+	Field(service.NewStringAnnotatedEnumField("non_finite_floats", map[string]string{
+		string(nonFiniteString):     "Encode the values as the strings `NaN`, `Infinity` and `-Infinity`.",
+		string(nonFiniteNull):       "Encode the values as null.",
+		string(nonFiniteFail):       "Fail to emit the event, which stops the input from making progress until the value is fixed or the policy changed.",
+		string(nonFiniteDeadLetter): "Encode the values as strings and set the metadata field `dead_letter_reason` to `non_finite_float` so the event can be routed to a dead-letter output.",
+	}).
+		Description("How NaN and infinite float values, which JSON can't represent, are encoded. The policy applies to snapshot rows, looked up columns and derived columns alike. Note that wal2json already renders such values of streamed changes as null").
+		Advanced().
+		Default(string(nonFiniteString))).
+	Field(service.NewObjectField("record", recordConfigFields...).
+		Description("Records an LSN or time bounded slice of the emitted events to a file so it can be replayed later with the `pg_stream_replay` input. Events are recorded once acknowledged, so events delivered again are recorded once").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("archive", archiveConfigFields...).
+		Description("Emit every event as an archive record holding its LSN, commit timestamp, metadata and payload, with the `archive_path` metadata field set to a path partitioned by date and table, such as `pg_stream/2024-03-01/orders/00000000016B3748-000000.json`. Write the records with the `pg_stream_archive` output for compliance archiving, and replay them with the `pg_stream_archive_replay` input").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("stale_events", staleEventsConfigFields...).
+		Description("Drops or dead-letters change events whose transaction committed longer ago than `max_age`, for sinks that only care about recent state during massive catch-ups. Skipped events are counted by the `pg_stream_stale_events_dropped` and `pg_stream_stale_events_dead_lettered` metrics").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("dead_letter", deadLetterConfigFields...).
+		Description("Sets the `dead_letter_route` metadata field of events flagged for a dead-letter output, such as stale events, events failing validation or holding non-finite floats, to a route of their source table, so that an error output can fan out failures by table").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewStringListField("priority_tables").
+		Description("Tables whose changes are emitted ahead of the other tables while the input is catching up. Changes of a single table are never reordered. Requires `separate_changes`").
+		Example([]string{"orders"}).
+		Advanced().
+		Default([]string{})).
+	Field(service.NewIntField("priority_lookahead").
+		Description("Maximum number of pending changes that are searched for changes of `priority_tables`").
+		Advanced().
+		Default(1000)).
+	Field(service.NewObjectListField("column_filters", columnFilterConfigFields...).
+		Description("Only emit updates of a table when one of the listed columns changed, evaluated against the before and after images. Tables need REPLICA IDENTITY FULL for the before image to hold non key columns, otherwise such updates are always emitted. Updates missing one of the listed columns are emitted as well").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("sampling", samplingConfigFields...).
+		Description("Emits only a sample of the changes of telemetry-style tables where full fidelity isn't needed, either a fraction of the changes, at most one change per key within an interval, or both. Sampled out changes are acknowledged so the slot keeps advancing, and counted by the `pg_stream_sampled_out` metric. Snapshot rows are not sampled").
+		Example([]map[string]any{
+			{"table": "page_views", "rate": 0.01},
+			{"table": "device_metrics", "per_key_interval": "1m", "key_columns": []string{"device_id"}},
+		}).
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("topics", topicsConfigFields...).
+		Description("Sets the `topic` metadata field of events to a topic name derived from their schema and table, such as `cdc.public.orders`, for outputs writing each table to a topic of its own with `topic: ${! @topic }`. Characters Kafka topic names can't hold are replaced, and names are optionally case folded and truncated, so unusual Postgres identifiers don't create invalid topics. Events holding changes of several tables have no topic").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("key_columns", keyColumnsConfigFields...).
+		Description("Sets the `pg_key` metadata field of the events of tables to a message key formed by the listed columns, such as a natural key or a composite tenant and id key, for outputs partitioning by key. A single column key is the column value and a composite key a JSON array of the values. The key of a delete is read from its old keys, so key columns outside the replica identity need REPLICA IDENTITY FULL. Events holding several changes, as emitted without `separate_changes`, have no key").
+		Example([]map[string]any{
+			{"table": "orders", "columns": []string{"tenant_id", "order_number"}},
+		}).
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewBoolField("primary_key_message_keys").
+		Description("Set the `pg_key` metadata field of the events of tables without `key_columns` to a message key formed by their primary key columns, so outputs partitioning by key preserve the order of the events of each row. The key follows the format of `key_columns`. Tables without a primary key have no key").
+		Advanced().
+		Default(false)).
+	Field(service.NewObjectField("watermarks", watermarksConfigFields...).
+		Description("Derive event-time watermarks from commit timestamps, so windowed aggregations downstream can close windows deterministically. Streamed events carry the current watermark in the `watermark` metadata field, and when the watermark advanced a watermark event with the `event_type` metadata field `watermark` is emitted periodically. The watermark only advances while changes are streamed").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("partition_hints", partitionHintsConfigFields...).
+		Description("Sample the rate of the streamed changes of each table to help right-size the partitions of their topics. The changes are counted by the `pg_stream_table_changes` metric, and every interval an event with the `event_type` metadata field `partition_hints` lists the rate of each table with a suggested partition count, which the `pg_stream_table_partition_hint` metric reports as well. Snapshot rows aren't counted").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("event_sizes", eventSizesConfigFields...).
+		Description("Track the payload sizes of the events of each table and limit them, to find the tables that blow up the storage of a topic. The total bytes are counted by the `pg_stream_event_bytes` metric and the distribution by the cumulative `pg_stream_event_size_bucket` metric with an `le` label of 1KiB to 10MiB and `+Inf`, both with a `table` label. Events exceeding the limit of their table are counted by the `pg_stream_oversized_events` metric. An event holding the changes of several tables is attributed to the table of its first change").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("compaction", compactionConfigFields...).
+		Description("Holds changes back for a short window and collapses the changes of a row within it into its latest state, reducing the volume of events for hot rows. An insert followed by updates becomes an insert, updates followed by a delete become a delete, and an insert followed by a delete is not emitted at all. Rows are identified by their primary key, changes of tables without one are emitted as is. Collapsed changes are counted by the `pg_stream_compacted_changes` metric. Compaction reorders changes of different rows and breaks transaction boundaries").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectListField("derived_columns", derivedColumnConfigFields...).
+		Description("Columns computed with Bloblang that are appended to inserted and updated rows of a table, for simple enrichment without a processor per table. Derived columns are reported with the `derived` column type").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("soft_deletes", softDeleteConfigFields...).
+		Description("Translates the deletes of a table into updates setting a flag or timestamp column, for sinks that implement soft deletes rather than removing rows. The update holds the key columns of the deleted row, or the whole row for tables with `REPLICA IDENTITY FULL`, and events holding translated deletes have the `soft_deleted` metadata field set to `true`").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("source_soft_deletes", sourceSoftDeleteConfigFields...).
+		Description("Translates the updates marking rows of a table as deleted, such as setting `deleted_at`, into deletes of the rows, for sources that never physically delete rows. The deletes are identified by the primary key of the row, and events holding translated updates have the `source_soft_deleted` metadata field set to `true`. Tombstones follow their delete without being acknowledged themselves").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("lookups", lookupConfigFields...).
+		Description("Enriches inserted and updated rows with columns of another table of the source database, for example resolving `country_id` to the country name. Looked up rows are cached, when the lookup table is listed in `tables` its changes invalidate the cache").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectListField("validation_rules", validationRuleConfigFields...).
+		Description("Assertions evaluated on the inserted and updated rows of each table, such as non-null keys, enum domains and value ranges, to catch upstream data quality issues at the CDC boundary. Failures are counted by the `pg_stream_validation_failures` metric").
+		Example([]map[string]any{
+			{"table": "orders", "column": "id", "not_null": true, "action": "fail"},
+			{"table": "orders", "column": "status", "allowed_values": []string{"pending", "shipped"}},
+			{"table": "orders", "column": "quantity", "min": 1, "max": 1000, "action": "drop"},
+		}).
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewBoolField("emit_foreign_keys").
+		Description("Emit the foreign key graph of the replicated tables as the first message after connecting, with the `event_type` metadata field set to `foreign_keys`. The message lists the foreign keys and an `order` in which writes can be applied so referenced rows exist first").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("emit_resolved_config").
+		Description("Emit the resolved configuration, such as the tables after sharding, the slot and publication names, the output plugin options and the payload settings, as the first message after connecting with the `event_type` metadata field set to `resolved_config`. The resolved configuration is logged at info level either way. Credentials are never included").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("transaction_ids").
+		Description("Set the `xid` metadata field of streamed events to the id of their transaction, and the `txid` metadata field to the epoch-qualified id as returned by `txid_current()`, so events can be correlated with application-side transaction logging and grouped by transaction. With `envelope_version` set to `2` the payload holds the `xid` as well").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("relation_messages").
+		Description("Emit a descriptor of a table, listing its columns with their types and nullability and its primary key, before the first event of the table after connecting or after the schema was refreshed. Descriptor messages have the `event_type` metadata field set to `relation` and the `table` metadata field set to the table name, so schema-less consumers can bootstrap typed handling").
+		Advanced().
+		Default(false)).
+	Field(service.NewBoolField("partition_metadata").
+		Description("When a replicated table is a partition, set the `partition` (physical partition name), `partition_root` (logical root table) and `partition_bound` (partition bound expression) metadata fields on its events so downstream systems can mirror the partitioning").
+		Advanced().
+		Default(false)).
+	Field(service.NewStringMapField("plugin_options").
+		Description("Options passed to the wal2json output plugin when replication starts, to tune decoder behaviour without dedicated fields. Options override the `pretty-print`, `include-timestamp` and `include-xids` options set by the input, changing them may break features relying on them").
+		Example(map[string]string{"actions": "insert,update,delete", "filter-origins": "16"}).
+		Advanced().
+		Default(map[string]any{})).
+	Field(service.NewObjectField("trace_context", traceContextConfigFields...).
+		Description("Continues traces started by the application that wrote a change. The trace context is read from a column of the changed row or from a transactional `pg_logical_emit_message` message, and holds either a W3C `traceparent` value or a JSON object of propagation headers such as `traceparent`, `tracestate` and `baggage`").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("catalog_retries", catalogRetryConfigFields...).
+		Description("Retries the catalog queries run when connecting, such as the foreign key, partition and primary key queries, with jittered exponential backoff. Such queries can hit lock contention during migrations. When a query keeps failing the result of its last successful run is used, within `max_staleness`").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("migration_mode", migrationModeConfigFields...).
+		Description("A runtime toggle, read from a cache resource, for planned DDL on the source. While it is on the column schema of the replicated tables isn't refreshed and changes of rows that don't match it are buffered. Once it is turned off the schema is refreshed and the buffered changes are emitted. While it is off a change that doesn't match the schema triggers a refresh").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("reselect", reselectConfigFields...).
+		Description("Re-select the current state of inserted and updated rows of some tables by primary key, and emit it instead of the row of the change. Useful for consumers that need full documents from tables without REPLICA IDENTITY FULL or with TOAST-heavy rows, whose update events lack unchanged columns. Rows that no longer exist are emitted as they were received").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("column_backfill", columnBackfillConfigFields...).
+		Description("Backfill the columns added to the replicated tables, so downstream stores aren't left with nulls for the rows that existed before. Once a streamed change reveals an added column, the rows holding a value in it are read in batches by primary key while no changes are waiting, and emitted as events with the `event_type` metadata field set to `column_backfill` holding the `key` and the added `columns` of each row. Backfills are best effort: those that didn't complete before a reconnect aren't resumed. Tables without a primary key aren't backfilled").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewBoolField("slot_guard").
+		Description("Hold a Postgres advisory lock derived from `slot_name` for as long as the input is connected, on a dedicated SQL connection. A second pipeline accidentally deployed with the same slot then fails to connect with an explicit error, rather than both taking turns at the slot. Ignored when `leader_election` is set, whose standby replicas wait for the lease instead").
+		Advanced().
+		Default(true)).
+	Field(service.NewObjectField("leader_election", leaderElectionConfigFields...).
+		Description("Run replicas of a pipeline in active-passive pairs. Only the replica holding a lease, a Postgres advisory lock held on a dedicated SQL connection, consumes the slot while the others wait in `Connect`. When the leader stops or loses its session the lock is released and a standby replica takes over, resuming from the slot's confirmed position").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("liveness_probe", livenessProbeConfigFields...).
+		Description("Periodically probe the server on a separate SQL connection, reconnecting when it restarted, stopped being the primary or became read only, or when the probe fails. This detects failovers faster than waiting for the replication stream to error out").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("statement_monitor", statementMonitorConfigFields...).
+		Description("Periodically look up the statements of the input's SQL connections in `pg_stat_activity` by their `application_name`, and report the age of the longest running one in the `pg_stream_longest_statement_ms` gauge and of the oldest open transaction in the `pg_stream_longest_transaction_ms` gauge. The replication connection is not included").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("latency_slo", latencySLOConfigFields...).
+		Description("Evaluate a service level objective for the latency from the commit of a streamed change until the pipeline acknowledges it. An interval breaches the objective when a change acknowledged in it took longer than the threshold or a change still awaits acknowledgement for longer. When enough intervals in a row breached it, an alert event with the `event_type` metadata field set to `latency_slo` and the `slo_state` metadata field set to `breached` is emitted, and once an interval meets the objective again one with `slo_state` set to `recovered`. The events hold the `latency_ms` of the last interval and the `threshold_ms`, and can be routed to an alerting output with a `switch` output checking `@event_type`. The `pg_stream_latency_slo_breached` gauge is 1 while the objective is breached").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("sharding", shardingConfigFields...).
+		Description("Split the configured tables across several pipeline replicas, each streaming the tables of its shard from its own slot, named after `slot_name` with a `_shard<index>` suffix. Tables are assigned to shards by a hash of their name, so replicas agree on the split without coordinating. With a `checkpoint` backend, replicas also register their membership of their shard in it while connected, so that a replica deployed with the index of a connected one fails to connect, and a replica whose shard was taken over while its membership lapsed stops, rather than both streaming the same slot. A replica restarted after a crash joins its shard once its previous membership expired. Changing the shard count reassigns tables to other slots, which then start from scratch").
+		Advanced().
+		Optional()).
+	Field(service.NewBoolField("slot_per_table").
+		Description("Stream every table from a replication slot of its own, named after the slot with the table name appended, so that small critical tables are isolated from large noisy ones and a table whose slot stalls doesn't hold back the WAL of the others. The snapshot rows of a table are still emitted before its streamed changes, but the changes of different tables are merged in no particular order. Switching the mode on or off creates new slots, which then start from scratch").
+		Advanced().
+		Default(false)).
+	Field(service.NewObjectField("slot_recovery", slotRecoveryConfigFields...).
+		Description("Detect a replication slot that vanished since a previous connect, typically because a major version upgrade doesn't carry logical slots over, rather than silently creating a new one and skipping the changes made in between. Changes of the server major version are logged. The slot is known to have existed when it was seen on a previous connect of the pipeline or, across restarts, when a `checkpoint` is stored for it. When recreated, an event with the `event_type` metadata field set to `slot_recreated` reports the slot and the versions. Can't be combined with `slot_per_table`").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("quiesce", quiesceConfigFields...).
+		Description("Stop consuming for coordinated maintenance of the server, such as a major version upgrade. Once a cache key is set to `true`, the input stops at the next transaction boundary, waits until the emitted changes are acknowledged, confirms their position to the slot, closes its connections and emits an event with the `event_type` metadata field set to `quiesced` reporting the `slot` and the confirmed stop `lsn`. It then holds until the key is cleared and reconnects, resuming from the slot. When `stream_snapshot` is set the input only quiesces once a transaction was streamed after connecting, as an interrupted snapshot isn't resumed. The `pg_stream_quiesced` gauge is 1 while the input holds").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("fault_injection", faultInjectionConfigFields...).
+		Description("Inject failures at random, delaying the decoding of events, dropping the replication connection and ignoring acknowledgements, to verify the alerting and recovery procedures of a pipeline against realistic CDC failures. Injected faults are counted by the `pg_stream_injected_faults` metric. Never use it in production").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("dry_run", dryRunConfigFields...).
+		Description("Validate the configuration against the server without streaming. The input connects, checks `wal_level`, the replication slot and the replicated tables, emits a report with the `event_type` metadata field set to `dry_run` and ends. The report lists the tables and columns that would be streamed along with an estimate of the snapshot size and duration, and the problems that would prevent streaming. No slot or publication is created").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("dns", dnsConfigFields...).
+		Description("Resolve the database host afresh on every connection attempt, bypassing resolver caches of the operating system, so that reconnects follow managed database failovers that move the host to a new address behind the same name. Address changes are logged when reconnecting").
+		Advanced().
+		Optional().
+		Default(nil)).
+	Field(service.NewObjectField("proxy", proxyConfigFields...).
+		Description("Route the SQL and replication connections through a SOCKS5 or HTTP CONNECT proxy, for networks where only proxy egress is allowed. The proxy resolves the database host, so `dns` only affects the lifetime of pooled connections").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("shared_pool", sharedPoolConfigFields...).
+		Description("Borrow SQL connections for catalog queries, lookups and the snapshot from a pool shared with other `pg_stream` inputs in the same process, instead of opening dedicated ones. Useful to stay within strict `max_connections` limits on managed instances. The replication connection itself can't be shared, and neither can the connection holding the lock of `slot_guard` or `leader_election`, which is held for as long as the input is connected").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("checkpoint", checkpointConfigFields...).
+		Description("Store the last acknowledged LSN in a checkpoint backend as well as confirming it to the replication slot. On connect, streaming resumes from the stored LSN when it is ahead of the slot's confirmed position, for instance when confirmations to the slot are batched. Backends are selected by name: the built in `cache` backend stores it in a cache resource, the `file` backend in a local file and the `postgres` backend in a table, and Go programs can register their own with `RegisterCheckpointBackend`. With `ack_batching` the LSN is stored once per batch of acknowledgements rather than per message. Can't be combined with `slot_per_table`").
+		Advanced().
+		Optional()).
+	Field(service.NewObjectField("ack_batching", ackBatchingConfigFields...).
+		Description("Confirm acknowledged positions to the replication slot in batches from a background goroutine, at most every `interval` or `max_acks` acknowledgements, instead of sending a standby status update to the server for every acknowledged message. Reduces the round trips at high throughput, at the cost of redelivering up to a batch of events after a crash").
+		Advanced().
+		Optional().
+		Default(nil))
 
-func newPgStreamInput(conf *service.ParsedConfig) (s service.Input, err error) {
+// fieldSet returns true when the optional field name is set. Benthos fills in
+// unset optional objects whose fields all have defaults, and unset object
+// lists with an empty list, so such fields default to null instead.
+func fieldSet(conf *service.ParsedConfig, name string) bool {
+	v, err := conf.FieldAny(name)
+	return err == nil && v != nil
+}
+
+func newPgStreamInput(conf *service.ParsedConfig, mgr *service.Resources) (s *pgStreamInput, err error) {
 	var (
 		dbName                  string
 		dbPort                  int
@@ -74,10 +444,86 @@ func newPgStreamInput(conf *service.ParsedConfig) (s service.Input, err error) {
 		dbUser                  string
 		dbPassword              string
 		dbSlotName              string
+		slotPerTable            bool
+		guardSlot               bool
 		tlsSetting              string
+		envDefaults             bool
+		pgpassFile              string
+		applicationName         string
+		checksum                string
+		schemaFingerprints      bool
+		extendedTypes           bool
+		degradeColumns          bool
+		envelope                string
+		jsonNumbers             string
+		updatePayloadMode       string
+		nonFiniteFloats         string
 		tables                  []string
+		pluginOptions           map[string]string
+		priorityTables          []string
+		priorityLookahead       int
 		streamSnapshot          bool
+		emitForeignKeys         bool
+		relationMessages        bool
+		transactionIDs          bool
+		emitResolvedConfig      bool
+		relations               *relationAnnouncer
+		txids                   *txidEpochs
+		partitionMetadata       bool
+		primaryKeyMessageKeys   bool
 		snapshotMemSafetyFactor float64
+		snapshotOrder           string
+		snapshotPlanning        string
+		snapshotBatchSize       int
+		snapshotBufferSize      int
+		snapshotProgress        bool
+		snapshotStmtTimeout     time.Duration
+		snapshotMaxTxDuration   time.Duration
+		separateChanges         bool
+		transactionBoundaries   bool
+		commitBoundaryAcks      bool
+		standbyMessageTimeout   time.Duration
+		keepaliveDeadline       time.Duration
+		recorder                *streamRecorder
+		archiver                *changeArchiver
+		staleGuard              *staleEventGuard
+		sizes                   *eventSizes
+		deadLetter              *deadLetterRouter
+		columnFilter            *columnChangeFilter
+		sampler                 *changeSampler
+		keys                    *messageKeys
+		topics                  *topicNamer
+		avro                    *avroEncoder
+		provisioning            *topicProvisioning
+		watermarks              *watermarkTracker
+		partitionHints          *partitionHints
+		compactor               *changeCompactor
+		derived                 *derivedColumns
+		softDeletes             *softDeletes
+		sourceSoftDeletes       *sourceSoftDeletes
+		lookups                 *lookupEnricher
+		reselect                *rowReselector
+		backfill                *columnBackfill
+		validation              *validationRules
+		traceContext            *traceContextExtractor
+		sharedPool              *sharedPoolConfig
+		ackBatching             *ackBatchingConfig
+		checkpoint              *checkpointConfig
+		catalogRetrier          *catalogRetrier
+		migration               *migrationMode
+		leader                  *leaderElection
+		shard                   *tableShard
+		shardMembership         *shardMembership
+		guard                   *slotGuard
+		liveness                *livenessProbe
+		statements              *statementMonitor
+		latencySLO              *latencySLO
+		quiesce                 *quiesce
+		slotRecovery            *slotRecovery
+		dryRun                  *dryRunMode
+		faults                  *faultInjector
+		dns                     *dnsResolution
+		proxyDialer             *proxyDialer
 	)
 
 	dbSchema, err = conf.FieldString("schema")
@@ -104,7 +550,23 @@ func newPgStreamInput(conf *service.ParsedConfig) (s service.Input, err error) {
 		return nil, err
 	}
 
-	tlsSetting, err = conf.FieldString("tls")
+	if conf.Contains("tls") {
+		if tlsSetting, err = conf.FieldString("tls"); err != nil {
+			return nil, err
+		}
+	}
+
+	envDefaults, err = conf.FieldBool("connection_defaults_from_env")
+	if err != nil {
+		return nil, err
+	}
+
+	pgpassFile, err = conf.FieldString("pgpass_file")
+	if err != nil {
+		return nil, err
+	}
+
+	applicationName, err = conf.FieldString("application_name")
 	if err != nil {
 		return nil, err
 	}
@@ -119,12 +581,34 @@ func newPgStreamInput(conf *service.ParsedConfig) (s service.Input, err error) {
 		return nil, err
 	}
 
-	dbPort, err = conf.FieldInt("port")
+	if conf.Contains("port") {
+		if dbPort, err = conf.FieldInt("port"); err != nil {
+			return nil, err
+		}
+	}
+
+	tables, err = conf.FieldStringList("tables")
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Contains("sharding") {
+		shard = &tableShard{}
+		if *shard, err = newTableShardFromParsed(conf.Namespace("sharding")); err != nil {
+			return nil, err
+		}
+		if tables = shard.tables(tables); len(tables) == 0 {
+			return nil, fmt.Errorf("shard %d of %d has no tables to stream", shard.index, shard.count)
+		}
+		dbSlotName = shard.slotName(dbSlotName)
+	}
+
+	slotPerTable, err = conf.FieldBool("slot_per_table")
 	if err != nil {
 		return nil, err
 	}
 
-	tables, err = conf.FieldStringList("tables")
+	guardSlot, err = conf.FieldBool("slot_guard")
 	if err != nil {
 		return nil, err
 	}
@@ -139,120 +623,1700 @@ func newPgStreamInput(conf *service.ParsedConfig) (s service.Input, err error) {
 		return nil, err
 	}
 
-	pgconnConfig := pgconn.Config{
-		Host:     dbHost,
-		Port:     uint16(dbPort),
-		Database: dbName,
-		User:     dbUser,
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
-		Password: dbPassword,
+	snapshotOrder, err = conf.FieldString("snapshot_order")
+	if err != nil {
+		return nil, err
 	}
 
-	if tlsSetting == "none" {
-		pgconnConfig.TLSConfig = nil
+	snapshotPlanning, err = conf.FieldString("snapshot_planning")
+	if err != nil {
+		return nil, err
 	}
 
-	return service.AutoRetryNacks(&pgStreamInput{
-		dbConfig:                pgconnConfig,
-		streamSnapshot:          streamSnapshot,
-		snapshotMemSafetyFactor: snapshotMemSafetyFactor,
-		slotName:                dbSlotName,
-		schema:                  dbSchema,
-		tls:                     pglogicalstream.TlsVerify(tlsSetting),
-		tables:                  tables,
-	}), err
-}
+	snapshotBatchSize, err = conf.FieldInt("snapshot_batch_size")
+	if err != nil {
+		return nil, err
+	}
 
-func init() {
-	rng, _ := codename.DefaultRNG()
-	randomSlotName = fmt.Sprintf("%s", strings.ReplaceAll(codename.Generate(rng, 5), "-", "_"))
+	snapshotBufferSize, err = conf.FieldInt("snapshot_buffer_size")
+	if err != nil {
+		return nil, err
+	}
 
-	err := service.RegisterInput(
-		"pg_stream", pgStreamConfigSpec,
-		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
-			return newPgStreamInput(conf)
-		})
+	snapshotProgress, err = conf.FieldBool("snapshot_progress")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-}
 
-type pgStreamInput struct {
-	dbConfig                pgconn.Config
-	pglogicalStream         *pglogicalstream.Stream
-	redisUri                string
-	slotName                string
-	schema                  string
-	tables                  []string
-	streamSnapshot          bool
-	tls                     pglogicalstream.TlsVerify // none, require
-	snapshotMemSafetyFactor float64
-	logger                  *service.Logger
-}
+	snapshotStmtTimeout, err = conf.FieldDuration("snapshot_statement_timeout")
+	if err != nil {
+		return nil, err
+	}
 
-func (p *pgStreamInput) Connect(ctx context.Context) error {
-	pgStream, err := pglogicalstream.NewPgStream(pglogicalstream.Config{
-		DbHost:                     p.dbConfig.Host,
-		DbPassword:                 p.dbConfig.Password,
-		DbUser:                     p.dbConfig.User,
-		DbPort:                     int(p.dbConfig.Port),
-		DbTables:                   p.tables,
-		DbName:                     p.dbConfig.Database,
-		DbSchema:                   p.schema,
-		ReplicationSlotName:        fmt.Sprintf("rs_%s", p.slotName),
-		TlsVerify:                  p.tls,
-		StreamOldData:              p.streamSnapshot,
-		SnapshotMemorySafetyFactor: p.snapshotMemSafetyFactor,
-		SeparateChanges:            true,
-	})
+	snapshotMaxTxDuration, err = conf.FieldDuration("snapshot_max_transaction_duration")
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	if snapshotMaxTxDuration > 0 && snapshotOrder != pglogicalstream.SnapshotOrderPrimaryKey {
+		return nil, errors.New("snapshot_max_transaction_duration requires snapshot_order set to pk")
 	}
-	p.pglogicalStream = pgStream
-	return err
-}
 
-func (p *pgStreamInput) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
-	select {
-	case snapshotMessage := <-p.pglogicalStream.SnapshotMessageC():
-		var (
-			mb  []byte
-			err error
-		)
-		if mb, err = json.Marshal(snapshotMessage); err != nil {
-			return nil, nil, err
-		}
-		return service.NewMessage(mb), func(ctx context.Context, err error) error {
-			// Nacks are retried automatically when we use service.AutoRetryNacks
-			return nil
-		}, nil
-	case message := <-p.pglogicalStream.LrMessageC():
-		var (
-			mb  []byte
-			err error
-		)
-		if mb, err = json.Marshal(message); err != nil {
-			return nil, nil, err
-		}
-		return service.NewMessage(mb), func(ctx context.Context, err error) error {
-			// Nacks are retried automatically when we use service.AutoRetryNacks
-			//message.ServerHeartbeat.
-
-			if message.Lsn != nil {
-				p.pglogicalStream.AckLSN(*message.Lsn)
-			}
-			return nil
-		}, nil
-	case <-ctx.Done():
-		return nil, nil, p.pglogicalStream.Stop()
+	separateChanges, err = conf.FieldBool("separate_changes")
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (p *pgStreamInput) Close(ctx context.Context) error {
-	if p.pglogicalStream != nil {
-		return p.pglogicalStream.Stop()
+	transactionBoundaries, err = conf.FieldBool("transaction_boundaries")
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	commitBoundaryAcks, err = conf.FieldBool("commit_boundary_acks")
+	if err != nil {
+		return nil, err
+	}
+
+	standbyMessageTimeout, err = conf.FieldDuration("standby_message_timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	keepaliveDeadline, err = conf.FieldDuration("keepalive_response_deadline")
+	if err != nil {
+		return nil, err
+	}
+
+	emitForeignKeys, err = conf.FieldBool("emit_foreign_keys")
+	if err != nil {
+		return nil, err
+	}
+
+	emitResolvedConfig, err = conf.FieldBool("emit_resolved_config")
+	if err != nil {
+		return nil, err
+	}
+
+	transactionIDs, err = conf.FieldBool("transaction_ids")
+	if err != nil {
+		return nil, err
+	}
+	if transactionIDs {
+		txids = &txidEpochs{}
+	}
+
+	relationMessages, err = conf.FieldBool("relation_messages")
+	if err != nil {
+		return nil, err
+	}
+	if relationMessages {
+		relations = &relationAnnouncer{}
+	}
+
+	partitionMetadata, err = conf.FieldBool("partition_metadata")
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKeyMessageKeys, err = conf.FieldBool("primary_key_message_keys")
+	if err != nil {
+		return nil, err
+	}
+
+	checksum, err = conf.FieldString("checksum")
+	if err != nil {
+		return nil, err
+	}
+
+	schemaFingerprints, err = conf.FieldBool("schema_fingerprint")
+	if err != nil {
+		return nil, err
+	}
+
+	extendedTypes, err = conf.FieldBool("decode_extended_types")
+	if err != nil {
+		return nil, err
+	}
+
+	degradeColumns, err = conf.FieldBool("degrade_undecodable_columns")
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err = conf.FieldString("envelope_version")
+	if err != nil {
+		return nil, err
+	}
+	if envelopeVersion(envelope) == envelopeMaxwell && !separateChanges {
+		return nil, errors.New("envelope_version maxwell requires separate_changes")
+	}
+
+	jsonNumbers, err = conf.FieldString("json_numbers")
+	if err != nil {
+		return nil, err
+	}
+
+	updatePayloadMode, err = conf.FieldString("update_payload")
+	if err != nil {
+		return nil, err
+	}
+
+	nonFiniteFloats, err = conf.FieldString("non_finite_floats")
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldSet(conf, "archive") {
+		if envelopeVersion(envelope) == envelopeProtobuf {
+			return nil, errors.New("archive can't be combined with envelope_version protobuf, archive records embed JSON payloads")
+		}
+		if archiver, err = newChangeArchiverFromParsed(conf.Namespace("archive")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("record") {
+		if envelopeVersion(envelope) == envelopeProtobuf {
+			return nil, errors.New("record can't be combined with envelope_version protobuf, captures embed JSON payloads")
+		}
+		if recorder, err = newStreamRecorderFromParsed(conf.Namespace("record")); err != nil {
+			return nil, err
+		}
+	}
+
+	pluginOptions, err = conf.FieldStringMap("plugin_options")
+	if err != nil {
+		return nil, err
+	}
+
+	priorityTables, err = conf.FieldStringList("priority_tables")
+	if err != nil {
+		return nil, err
+	}
+	// Events holding changes of several tables can't be moved ahead of the
+	// others without reordering the changes of some table.
+	if len(priorityTables) > 0 && !separateChanges {
+		return nil, errors.New("priority_tables requires separate_changes")
+	}
+
+	priorityLookahead, err = conf.FieldInt("priority_lookahead")
+	if err != nil {
+		return nil, err
+	}
+
+	if fieldSet(conf, "dead_letter") {
+		if deadLetter, err = newDeadLetterRouterFromParsed(conf.Namespace("dead_letter")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("stale_events") {
+		if staleGuard, err = newStaleEventGuardFromParsed(conf.Namespace("stale_events"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "column_filters") {
+		var filterConfs []*service.ParsedConfig
+		if filterConfs, err = conf.FieldObjectList("column_filters"); err != nil {
+			return nil, err
+		}
+		if columnFilter, err = newColumnChangeFilterFromParsed(filterConfs); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "sampling") {
+		var samplingConfs []*service.ParsedConfig
+		if samplingConfs, err = conf.FieldObjectList("sampling"); err != nil {
+			return nil, err
+		}
+		if sampler, err = newChangeSamplerFromParsed(samplingConfs, mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "topics") {
+		if topics, err = newTopicNamerFromParsed(conf.Namespace("topics")); err != nil {
+			return nil, err
+		}
+		if conf.Contains("topics", "provisioning") {
+			if provisioning, err = newTopicProvisioningFromParsed(conf.Namespace("topics", "provisioning"), mgr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if fieldSet(conf, "key_columns") {
+		var keyConfs []*service.ParsedConfig
+		if keyConfs, err = conf.FieldObjectList("key_columns"); err != nil {
+			return nil, err
+		}
+		if keys, err = newMessageKeysFromParsed(keyConfs); err != nil {
+			return nil, err
+		}
+	}
+	if primaryKeyMessageKeys && keys == nil {
+		if keys, err = newMessageKeysFromParsed(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "partition_hints") {
+		if partitionHints, err = newPartitionHintsFromParsed(conf.Namespace("partition_hints"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "watermarks") {
+		if watermarks, err = newWatermarkTrackerFromParsed(conf.Namespace("watermarks")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("compaction") {
+		if compactor, err = newChangeCompactorFromParsed(conf.Namespace("compaction"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "derived_columns") {
+		var derivedConfs []*service.ParsedConfig
+		if derivedConfs, err = conf.FieldObjectList("derived_columns"); err != nil {
+			return nil, err
+		}
+		if derived, err = newDerivedColumnsFromParsed(derivedConfs, mgr.Logger()); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("avro") {
+		if !separateChanges {
+			return nil, errors.New("avro requires separate_changes")
+		}
+		if archiver != nil {
+			return nil, errors.New("avro can't be combined with archive, archive records embed JSON payloads")
+		}
+		if avro, err = newAvroEncoderFromParsed(conf.Namespace("avro"), topics); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "soft_deletes") {
+		var softDeleteConfs []*service.ParsedConfig
+		if softDeleteConfs, err = conf.FieldObjectList("soft_deletes"); err != nil {
+			return nil, err
+		}
+		if softDeletes, err = newSoftDeletesFromParsed(softDeleteConfs); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "source_soft_deletes") {
+		var sourceSoftDeleteConfs []*service.ParsedConfig
+		if sourceSoftDeleteConfs, err = conf.FieldObjectList("source_soft_deletes"); err != nil {
+			return nil, err
+		}
+		if sourceSoftDeletes, err = newSourceSoftDeletesFromParsed(sourceSoftDeleteConfs); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "lookups") {
+		var lookupConfs []*service.ParsedConfig
+		if lookupConfs, err = conf.FieldObjectList("lookups"); err != nil {
+			return nil, err
+		}
+		if lookups, err = newLookupEnricherFromParsed(lookupConfs, dbSchema, mgr.Logger()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "column_backfill") {
+		if backfill, err = newColumnBackfillFromParsed(conf.Namespace("column_backfill"), mgr); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "reselect") {
+		if reselect, err = newRowReselectorFromParsed(conf.Namespace("reselect"), mgr); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "validation_rules") {
+		var ruleConfs []*service.ParsedConfig
+		if ruleConfs, err = conf.FieldObjectList("validation_rules"); err != nil {
+			return nil, err
+		}
+		if validation, err = newValidationRulesFromParsed(ruleConfs, mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "trace_context") {
+		if traceContext, err = newTraceContextExtractorFromParsed(conf.Namespace("trace_context")); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "catalog_retries") {
+		if catalogRetrier, err = newCatalogRetrierFromParsed(conf.Namespace("catalog_retries"), mgr.Logger()); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("migration_mode") {
+		if migration, err = newMigrationModeFromParsed(conf.Namespace("migration_mode"), mgr); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "leader_election") {
+		if leader, err = newLeaderElectionFromParsed(conf.Namespace("leader_election"), dbSlotName); err != nil {
+			return nil, err
+		}
+	}
+
+	if guardSlot && leader == nil {
+		guard = &slotGuard{slotName: dbSlotName}
+	}
+
+	if fieldSet(conf, "liveness_probe") {
+		if liveness, err = newLivenessProbeFromParsed(conf.Namespace("liveness_probe")); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "statement_monitor") {
+		if statements, err = newStatementMonitorFromParsed(conf.Namespace("statement_monitor"), applicationName, mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "event_sizes") {
+		if sizes, err = newEventSizesFromParsed(conf.Namespace("event_sizes"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("latency_slo") {
+		if latencySLO, err = newLatencySLOFromParsed(conf.Namespace("latency_slo"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "slot_recovery") {
+		if slotPerTable {
+			return nil, errors.New("slot_recovery can't be combined with slot_per_table")
+		}
+		if slotRecovery, err = newSlotRecoveryFromParsed(conf.Namespace("slot_recovery")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("quiesce") {
+		if quiesce, err = newQuiesceFromParsed(conf.Namespace("quiesce"), mgr); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "fault_injection") {
+		if faults, err = newFaultInjectorFromParsed(conf.Namespace("fault_injection"), mgr.Metrics()); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "dry_run") {
+		if dryRun, err = newDryRunModeFromParsed(conf.Namespace("dry_run")); err != nil {
+			return nil, err
+		}
+	}
+
+	if fieldSet(conf, "dns") {
+		if dns, err = newDNSResolutionFromParsed(conf.Namespace("dns")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("proxy") {
+		if proxyDialer, err = newProxyDialerFromParsed(conf.Namespace("proxy")); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("shared_pool") {
+		var poolConf sharedPoolConfig
+		if poolConf, err = newSharedPoolConfigFromParsed(conf.Namespace("shared_pool")); err != nil {
+			return nil, err
+		}
+		sharedPool = &poolConf
+	}
+
+	if conf.Contains("checkpoint") {
+		if slotPerTable {
+			return nil, errors.New("checkpoint can't be combined with slot_per_table, whose slots advance independently")
+		}
+		if checkpoint, err = newCheckpointConfigFromParsed(conf.Namespace("checkpoint"), mgr, dbSlotName); err != nil {
+			return nil, err
+		}
+		if shard != nil {
+			shardMembership = newShardMembership(*shard, checkpoint.key)
+		}
+	}
+
+	if fieldSet(conf, "ack_batching") {
+		var batchingConf ackBatchingConfig
+		if batchingConf, err = newAckBatchingConfigFromParsed(conf.Namespace("ack_batching")); err != nil {
+			return nil, err
+		}
+		ackBatching = &batchingConf
+	}
+
+	pgconnConfig := pgconn.Config{
+		Host:     dbHost,
+		Port:     uint16(dbPort),
+		Database: dbName,
+		User:     dbUser,
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: true,
+		},
+		Password: dbPassword,
+	}
+	if applicationName != "" {
+		pgconnConfig.RuntimeParams = map[string]string{"application_name": applicationName}
+	}
+
+	var env libpqEnv
+	if envDefaults {
+		env = readLibpqEnv(os.Getenv)
+		if err = env.fill(&pgconnConfig, &tlsSetting); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkConnectionFields(&pgconnConfig); err != nil {
+		return nil, err
+	}
+	if pgconnConfig.Port == 0 {
+		pgconnConfig.Port = 5432
+	}
+	if pgconnConfig.Password == "" {
+		if pgpassFile == "" {
+			pgpassFile = env.passFile
+		}
+		if pgpassFile == "" {
+			pgpassFile = defaultPassfile()
+		}
+		if pgpassFile != "" {
+			if pgconnConfig.Password, err = lookupPassfile(pgpassFile, &pgconnConfig); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tlsSetting == "" {
+		tlsSetting = "none"
+	}
+
+	if tlsSetting == "none" {
+		pgconnConfig.TLSConfig = nil
+	}
+
+	return &pgStreamInput{
+		dbConfig:                pgconnConfig,
+		streamSnapshot:          streamSnapshot,
+		snapshotMemSafetyFactor: snapshotMemSafetyFactor,
+		snapshotOrder:           snapshotOrder,
+		snapshotPlanning:        snapshotPlanning,
+		snapshotBatchSize:       snapshotBatchSize,
+		snapshotBufferSize:      snapshotBufferSize,
+		snapshotProgress:        snapshotProgress,
+		snapshotStmtTimeout:     snapshotStmtTimeout,
+		snapshotMaxTxDuration:   snapshotMaxTxDuration,
+		separateChanges:         separateChanges,
+		transactionBoundaries:   transactionBoundaries,
+		commitBoundaryAcks:      commitBoundaryAcks,
+		standbyMessageTimeout:   standbyMessageTimeout,
+		keepaliveDeadline:       keepaliveDeadline,
+		slotName:                dbSlotName,
+		slotPerTable:            slotPerTable,
+		schema:                  dbSchema,
+		tls:                     pglogicalstream.TlsVerify(tlsSetting),
+		tables:                  tables,
+		pluginOptions:           pluginOptions,
+		priorityTables:          priorityTables,
+		priorityLookahead:       priorityLookahead,
+		checksum:                checksumAlgorithm(checksum),
+		schemaFingerprints:      schemaFingerprints,
+		extendedTypes:           extendedTypes,
+		degradeColumns:          degradeColumns,
+		envelope:                envelopeVersion(envelope),
+		numbers:                 numberEncoding(jsonNumbers),
+		updatePayload:           updatePayload(updatePayloadMode),
+		nonFiniteFloats:         nonFiniteFloatPolicy(nonFiniteFloats),
+		recorder:                recorder,
+		archiver:                archiver,
+		staleGuard:              staleGuard,
+		sizes:                   sizes,
+		deadLetter:              deadLetter,
+		columnFilter:            columnFilter,
+		sampler:                 sampler,
+		keys:                    keys,
+		topics:                  topics,
+		avro:                    avro,
+		provisioning:            provisioning,
+		watermarks:              watermarks,
+		partitionHints:          partitionHints,
+		compactor:               compactor,
+		derived:                 derived,
+		softDeletes:             softDeletes,
+		sourceSoftDeletes:       sourceSoftDeletes,
+		lookups:                 lookups,
+		reselect:                reselect,
+		backfill:                backfill,
+		validation:              validation,
+		emitForeignKeys:         emitForeignKeys,
+		relations:               relations,
+		txids:                   txids,
+		emitResolvedConfig:      emitResolvedConfig,
+		partitionMetadata:       partitionMetadata,
+		primaryKeyMessageKeys:   primaryKeyMessageKeys,
+		traceContext:            traceContext,
+		sharedPool:              sharedPool,
+		ackBatching:             ackBatching,
+		checkpoint:              checkpoint,
+		catalogRetrier:          catalogRetrier,
+		migration:               migration,
+		leader:                  leader,
+		shardMembership:         shardMembership,
+		guard:                   guard,
+		liveness:                liveness,
+		statements:              statements,
+		latencySLO:              latencySLO,
+		quiesce:                 quiesce,
+		slotRecovery:            slotRecovery,
+		dryRun:                  dryRun,
+		faults:                  faults,
+		dialing:                 dialing{dns: dns, proxy: proxyDialer},
+		newSource:               pglogicalstream.NewReplicationSource,
+		logger:                  mgr.Logger(),
+		metrics:                 mgr.Metrics(),
+		queue:                   newQueueMetrics(mgr.Metrics()),
+	}, err
+}
+
+func init() {
+	rng, _ := codename.DefaultRNG()
+	randomSlotName = fmt.Sprintf("%s", strings.ReplaceAll(codename.Generate(rng, 5), "-", "_"))
+
+	err := service.RegisterInput(
+		"pg_stream", pgStreamConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			p, err := newPgStreamInput(conf, mgr)
+			if err != nil {
+				return nil, err
+			}
+			return service.AutoRetryNacks(p), nil
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type pgStreamInput struct {
+	dbConfig                pgconn.Config
+	source                  pglogicalstream.ReplicationSource
+	newSource               pglogicalstream.SourceConstructor
+	slotName                string
+	slotPerTable            bool
+	schema                  string
+	tables                  []string
+	pluginOptions           map[string]string
+	priorityTables          []string
+	priorityLookahead       int
+	backlog                 *changeBacklog
+	acks                    *lsnAckTracker
+	streamSnapshot          bool
+	tls                     pglogicalstream.TlsVerify // none, require
+	snapshotMemSafetyFactor float64
+	snapshotOrder           string
+	snapshotPlanning        string
+	snapshotBatchSize       int
+	snapshotBufferSize      int
+	snapshotProgress        bool
+	snapshotStmtTimeout     time.Duration
+	snapshotMaxTxDuration   time.Duration
+	separateChanges         bool
+	transactionBoundaries   bool
+	commitBoundaryAcks      bool
+	standbyMessageTimeout   time.Duration
+	keepaliveDeadline       time.Duration
+	checksum                checksumAlgorithm
+	schemaFingerprints      bool
+	extendedTypes           bool
+	degradeColumns          bool
+	envelope                envelopeVersion
+	numbers                 numberEncoding
+	updatePayload           updatePayload
+	primaryKeys             map[string][]string
+	nonFiniteFloats         nonFiniteFloatPolicy
+	recorder                *streamRecorder
+	archiver                *changeArchiver
+	staleGuard              *staleEventGuard
+	sizes                   *eventSizes
+	deadLetter              *deadLetterRouter
+	columnFilter            *columnChangeFilter
+	sampler                 *changeSampler
+	keys                    *messageKeys
+	topics                  *topicNamer
+	avro                    *avroEncoder
+	provisioning            *topicProvisioning
+	watermarks              *watermarkTracker
+	partitionHints          *partitionHints
+	compactor               *changeCompactor
+	derived                 *derivedColumns
+	softDeletes             *softDeletes
+	sourceSoftDeletes       *sourceSoftDeletes
+	lookups                 *lookupEnricher
+	reselect                *rowReselector
+	backfill                *columnBackfill
+	validation              *validationRules
+	emitForeignKeys         bool
+	relations               *relationAnnouncer
+	txids                   *txidEpochs
+	emitResolvedConfig      bool
+	partitionMetadata       bool
+	primaryKeyMessageKeys   bool
+	partitions              partitionMetadata
+	traceContext            *traceContextExtractor
+	sharedPool              *sharedPoolConfig
+	ackBatching             *ackBatchingConfig
+	checkpoint              *checkpointConfig
+	checkpointer            Checkpointer
+	checkpointing           *checkpointingSource
+	catalogRetrier          *catalogRetrier
+	migration               *migrationMode
+	leader                  *leaderElection
+	shardMembership         *shardMembership
+	guard                   *slotGuard
+	liveness                *livenessProbe
+	statements              *statementMonitor
+	latencySLO              *latencySLO
+	quiesce                 *quiesce
+	slotRecovery            *slotRecovery
+	dryRun                  *dryRunMode
+	faults                  *faultInjector
+	dialing                 dialing
+	db                      *sql.DB
+	lockDB                  *sql.DB // holds the lock of leader or guard outside a shared pool
+	controlMessages         []*service.Message
+	transactionOpen         bool // the last streamed event isn't the last of its transaction
+	logger                  *service.Logger
+	metrics                 *service.Metrics
+	queue                   *queueMetrics
+}
+
+// needsSQL returns true when features query the source database through a
+// regular connection.
+func (p *pgStreamInput) needsSQL() bool {
+	return p.dialing.proxy != nil || p.dryRun != nil || p.leader != nil || p.guard != nil || p.slotRecovery != nil || p.liveness != nil || p.statements != nil || p.lookups != nil || p.emitForeignKeys || p.relations != nil || p.txids != nil || p.partitionMetadata || p.primaryKeyMessageKeys ||
+		(p.partitionHints != nil && p.partitionHints.suggestKeys) ||
+		p.compactor != nil || p.migration != nil || p.reselect != nil || p.backfill != nil || p.sourceSoftDeletes != nil || p.updatePayload == updatePayloadChanged ||
+		(p.avro != nil && (p.avro.checkCompatibility || p.avro.keySchemas))
+}
+
+func (p *pgStreamInput) Connect(ctx context.Context) (err error) {
+	defer func() {
+		if err != nil {
+			_ = p.Close(ctx)
+		}
+	}()
+
+	p.controlMessages = nil
+	p.transactionOpen = false
+
+	if p.dialing.dns != nil && p.dialing.proxy == nil {
+		p.dialing.dns.refresh(ctx, p.dbConfig.Host, p.logger)
+	}
+
+	if p.sharedPool != nil {
+		if p.db, err = acquireSharedPool(*p.sharedPool, p.dbConfig, p.dialing); err != nil {
+			return err
+		}
+	} else if p.needsSQL() {
+		if p.db, err = openSQL(p.dbConfig, p.dialing); err != nil {
+			return err
+		}
+	}
+
+	if p.dryRun != nil {
+		return p.runDryRun(ctx)
+	}
+
+	// The locks of leader election and the slot guard pin a connection for
+	// as long as the input is connected, which would starve the inputs of a
+	// shared pool, so they are held on a connection of their own.
+	lockDB := p.db
+	if p.sharedPool != nil && (p.leader != nil || p.guard != nil) {
+		if p.lockDB == nil {
+			if p.lockDB, err = openSQL(p.dbConfig, p.dialing); err != nil {
+				return err
+			}
+			p.lockDB.SetMaxOpenConns(1)
+		}
+		lockDB = p.lockDB
+	}
+
+	if p.leader != nil {
+		if err = p.leader.acquire(ctx, lockDB, p.logger); err != nil {
+			return err
+		}
+	}
+
+	if p.guard != nil {
+		if err = p.guard.acquire(ctx, lockDB); err != nil {
+			return err
+		}
+	}
+
+	if p.liveness != nil {
+		if err = p.liveness.connect(ctx, p.db); err != nil {
+			return err
+		}
+	}
+
+	if p.lookups != nil {
+		if err = p.lookups.connect(ctx, p.db); err != nil {
+			return err
+		}
+	}
+
+	if p.emitForeignKeys {
+		var graph *foreignKeyGraph
+		if graph, err = queryCatalog(ctx, p.catalogRetrier, "foreign_keys", func(ctx context.Context) (*foreignKeyGraph, error) {
+			return queryForeignKeyGraph(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+		p.logger.Infof("Foreign key write order of the replicated tables: %v", graph.Order)
+
+		var msg *service.Message
+		if msg, err = graph.message(); err != nil {
+			return err
+		}
+		p.controlMessages = append(p.controlMessages, msg)
+	}
+
+	avroKeys := p.avro != nil && p.avro.keySchemas
+	if p.compactor != nil || p.reselect != nil || p.backfill != nil || p.relations != nil || p.sourceSoftDeletes != nil || p.primaryKeyMessageKeys || p.updatePayload == updatePayloadChanged || avroKeys {
+		if p.primaryKeys, err = queryCatalog(ctx, p.catalogRetrier, "primary_keys", func(ctx context.Context) (map[string][]string, error) {
+			return queryPrimaryKeys(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+	}
+	if p.compactor != nil {
+		p.compactor.reset(p.primaryKeys)
+	}
+	if p.primaryKeyMessageKeys {
+		p.keys.primaryKeys = p.primaryKeys
+	}
+	if avroKeys {
+		p.avro.primaryKeys = p.primaryKeys
+	}
+	if p.reselect != nil {
+		p.reselect.reset()
+	}
+	if p.backfill != nil {
+		var columns map[string][]string
+		if columns, err = queryCatalog(ctx, p.catalogRetrier, "columns", func(ctx context.Context) (map[string][]string, error) {
+			return queryTableColumns(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+		p.backfill.reset(columns)
+	}
+	if p.relations != nil {
+		if err = p.queryRelations(ctx); err != nil {
+			return err
+		}
+	}
+	if p.avro != nil && p.avro.checkCompatibility {
+		var descriptors map[string]relationDescriptor
+		if descriptors, err = queryCatalog(ctx, p.catalogRetrier, "relations", func(ctx context.Context) (map[string]relationDescriptor, error) {
+			return queryRelationDescriptors(ctx, p.db, p.schema, p.tables, nil)
+		}); err != nil {
+			return err
+		}
+		if err = p.avro.check(ctx, p.schema, descriptors); err != nil {
+			return err
+		}
+	}
+
+	if p.txids != nil {
+		if p.txids.reference, err = queryNextTxid(ctx, p.db); err != nil {
+			// The 32-bit ids are still set.
+			p.logger.Warnf("Failed to read the transaction id epoch: %v", err)
+		}
+	}
+
+	if p.partitionMetadata {
+		if p.partitions, err = queryCatalog(ctx, p.catalogRetrier, "partitions", func(ctx context.Context) (partitionMetadata, error) {
+			return queryPartitionMetadata(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if p.partitionHints != nil && p.partitionHints.suggestKeys {
+		if p.partitionHints.sequenceKeys, err = queryCatalog(ctx, p.catalogRetrier, "sequence_keys", func(ctx context.Context) (map[string]string, error) {
+			return querySequenceKeys(ctx, p.db, p.schema, p.tables)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if p.migration != nil {
+		// Changes buffered during a previous connection weren't acknowledged
+		// and are streamed again.
+		p.migration.buffered = nil
+		if err = p.refreshSchema(ctx); err != nil {
+			return err
+		}
+	}
+
+	if p.provisioning != nil {
+		if err = p.provisioning.provision(ctx, p.topics, p.schema, p.tables); err != nil {
+			return err
+		}
+	}
+
+	if p.recorder != nil {
+		if err = p.recorder.open(); err != nil {
+			return err
+		}
+	}
+
+	if p.archiver != nil {
+		p.archiver.reset()
+	}
+
+	var startLSN string
+	if p.checkpoint != nil {
+		// The checkpointer of a stream that failed is replaced.
+		if p.checkpointer != nil {
+			_ = p.checkpointer.Close(ctx)
+		}
+		if p.checkpointer, err = p.checkpoint.open(); err != nil {
+			return fmt.Errorf("failed to open the checkpoint backend: %w", err)
+		}
+		if startLSN, err = p.checkpointer.Get(ctx, p.checkpoint.key); err != nil {
+			return fmt.Errorf("failed to load the checkpoint: %w", err)
+		}
+		if p.shardMembership != nil {
+			if err = p.shardMembership.join(ctx, p.checkpointer); err != nil {
+				return err
+			}
+		}
+	}
+
+	streamSnapshot, snapshotFilters := p.streamSnapshot, map[string]string(nil)
+	if p.slotRecovery != nil {
+		var resnapshot bool
+		if resnapshot, err = p.recoverSlot(ctx, startLSN != ""); err != nil {
+			return err
+		}
+		if resnapshot {
+			streamSnapshot, snapshotFilters = true, p.slotRecovery.snapshotFilters
+		}
+	}
+
+	// The snapshot borrows a connection from the pool when it can't open
+	// its own pool with the default dialer.
+	var snapshotPool *sql.DB
+	if p.sharedPool != nil || p.dialing.proxy != nil {
+		snapshotPool = p.db
+	}
+
+	config := pglogicalstream.Config{
+		DbHost:                     p.dbConfig.Host,
+		DbPassword:                 p.dbConfig.Password,
+		DbUser:                     p.dbConfig.User,
+		DbPort:                     int(p.dbConfig.Port),
+		DbTables:                   p.tables,
+		DbName:                     p.dbConfig.Database,
+		DbSchema:                   p.schema,
+		ReplicationSlotName:        fmt.Sprintf("rs_%s", p.slotName),
+		TlsVerify:                  p.tls,
+		StreamOldData:              streamSnapshot,
+		SnapshotMemorySafetyFactor: p.snapshotMemSafetyFactor,
+		SnapshotOrder:              p.snapshotOrder,
+		SnapshotPlanning:           p.snapshotPlanning,
+		SeparateChanges:            p.separateChanges,
+		BatchSize:                  p.snapshotBatchSize,
+		SnapshotBufferSize:         p.snapshotBufferSize,
+		SnapshotProgress:           p.snapshotProgress,
+		SnapshotStatementTimeout:   p.snapshotStmtTimeout,
+		SnapshotMaxTxDuration:      p.snapshotMaxTxDuration,
+		SnapshotFilters:            snapshotFilters,
+		DegradeColumns:             p.degradeColumns,
+		ApplicationName:            p.dbConfig.RuntimeParams["application_name"],
+		StartLSN:                   startLSN,
+		StandbyMessageTimeout:      p.standbyMessageTimeout,
+		KeepaliveResponseDeadline:  p.keepaliveDeadline,
+		PluginOptions:              p.pluginOptions,
+		UseNumber:                  p.numbers != numberFloat,
+		SnapshotPool:               snapshotPool,
+		LookupFunc:                 p.dialing.lookupFunc(),
+		DialFunc:                   p.dialing.dialFunc(),
+		Logger:                     p.logger,
+		Metrics:                    p.metrics,
+	}
+	var source pglogicalstream.ReplicationSource
+	if p.slotPerTable {
+		source, err = p.newTableSources(config)
+	} else {
+		source, err = p.newSource(config)
+	}
+	if err != nil {
+		return err
+	}
+	p.checkpointing = nil
+	if p.checkpointer != nil {
+		p.checkpointing = &checkpointingSource{
+			ReplicationSource: source,
+			checkpointer:      p.checkpointer,
+			key:               p.checkpoint.key,
+			retryInterval:     p.checkpoint.retryInterval,
+			logger:            p.logger,
+		}
+		source = p.checkpointing
+	}
+	if p.quiesce != nil {
+		p.quiesce.reset(streamSnapshot)
+		source = &quiescingSource{ReplicationSource: source, quiesce: p.quiesce}
+	}
+	if p.ackBatching != nil {
+		source = newAckBatcher(source, *p.ackBatching)
+	}
+	p.source = source
+	if err = p.logResolvedConfig(); err != nil {
+		return err
+	}
+	p.backlog = newChangeBacklog(p.priorityTables, p.priorityLookahead)
+	p.acks = &lsnAckTracker{commitBoundaries: p.commitBoundaryAcks}
+	if p.recorder != nil {
+		p.acks.record = func(event recordedEvent) {
+			if err := p.recorder.record(event); err != nil {
+				p.logger.Errorf("Failed to record event: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *pgStreamInput) Read(ctx context.Context) (_ *service.Message, _ service.AckFunc, err error) {
+	// readPhase is the phase of the event being read, errors reading it are
+	// counted in its metrics.
+	var readPhase string
+	defer func() {
+		if err != nil && readPhase != "" {
+			p.queue.failed(readPhase)
+		}
+	}()
+	for {
+		readPhase = ""
+		if len(p.controlMessages) > 0 {
+			msg := p.controlMessages[0]
+			p.controlMessages = p.controlMessages[1:]
+			return msg, func(ctx context.Context, err error) error {
+				p.recordAcked(msg, err)
+				return nil
+			}, nil
+		}
+		if p.dryRun != nil {
+			return nil, nil, service.ErrEndOfInput
+		}
+
+		if p.checkpointing != nil {
+			paused, err := p.checkCheckpoints(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			if paused {
+				continue
+			}
+		}
+
+		if p.quiesce != nil {
+			msg, err := p.pollQuiesce(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			if msg != nil {
+				return msg, func(ctx context.Context, err error) error {
+					return nil
+				}, nil
+			}
+			if p.quiesce.draining() {
+				select {
+				case <-time.After(quiesceDrainInterval):
+				case <-ctx.Done():
+					return nil, nil, ctx.Err()
+				}
+				continue
+			}
+		}
+
+		if p.leader != nil {
+			if err := p.leader.check(ctx); err != nil {
+				p.logger.Errorf("Stopping replication: %v", err)
+				_ = p.source.Stop()
+				return nil, nil, service.ErrNotConnected
+			}
+		}
+
+		if p.shardMembership != nil {
+			if err := p.shardMembership.check(ctx, p.checkpointer); err != nil {
+				p.logger.Errorf("Stopping replication: %v", err)
+				_ = p.source.Stop()
+				return nil, nil, service.ErrNotConnected
+			}
+		}
+
+		if p.liveness != nil {
+			if err := p.liveness.check(ctx, p.db); err != nil {
+				p.logger.Errorf("Reconnecting: %v", err)
+				_ = p.source.Stop()
+				return nil, nil, service.ErrNotConnected
+			}
+		}
+
+		if p.statements != nil {
+			if err := p.statements.check(ctx, p.db); err != nil {
+				p.logger.Warnf("Failed to monitor statements: %v", err)
+			}
+		}
+
+		if p.latencySLO != nil {
+			msg, err := p.latencySLO.due(p.acks, time.Now())
+			if err != nil {
+				return nil, nil, err
+			}
+			if msg != nil {
+				return msg, func(ctx context.Context, err error) error {
+					return nil
+				}, nil
+			}
+		}
+
+		if p.partitionHints != nil {
+			msg, err := p.partitionHints.due(time.Now())
+			if err != nil {
+				return nil, nil, err
+			}
+			if msg != nil {
+				return msg, func(ctx context.Context, err error) error {
+					return nil
+				}, nil
+			}
+		}
+
+		if p.watermarks != nil {
+			msg, err := p.watermarks.due(time.Now())
+			if err != nil {
+				return nil, nil, err
+			}
+			if msg != nil {
+				return msg, func(ctx context.Context, err error) error {
+					return nil
+				}, nil
+			}
+		}
+
+		if p.migration != nil {
+			if err := p.pollMigrationMode(ctx); err != nil {
+				return nil, nil, err
+			}
+			if p.migration.full() {
+				continue
+			}
+		}
+
+		p.queue.update(len(p.source.SnapshotMessageC()), p.backlog.len(), p.acks, time.Now())
+
+		if changes, ok := p.backlog.pop(); ok {
+			readPhase = phaseStream
+			// Empty transactions aren't emitted, their LSN is confirmed once
+			// the events received before them have been acknowledged.
+			if len(changes.Changes) == 0 {
+				ackChanges(p.source, p.acks, changes.seqs()...)
+				continue
+			}
+			p.quiesce.observe(changes.Wal2JsonChanges)
+			if p.migration != nil {
+				held, err := p.holdForMigration(ctx, changes)
+				if err != nil {
+					p.backlog.requeue(changes)
+					return nil, nil, err
+				}
+				if held {
+					continue
+				}
+			}
+			if p.relations != nil {
+				announcements, err := p.relations.announce(changes.Changes)
+				if err != nil {
+					p.backlog.requeue(changes)
+					return nil, nil, err
+				}
+				if len(announcements) > 0 {
+					p.backlog.requeue(changes)
+					p.controlMessages = append(p.controlMessages, announcements...)
+					continue
+				}
+			}
+			if p.columnFilter != nil && !p.columnFilter.matches(changes.Changes) {
+				ackChanges(p.source, p.acks, changes.seqs()...)
+				continue
+			}
+			if p.sampler != nil && !p.sampler.sample(changes.Changes, time.Now()) {
+				ackChanges(p.source, p.acks, changes.seqs()...)
+				continue
+			}
+
+			stale := p.staleGuard != nil && p.staleGuard.isStale(changes.Timestamp)
+			if stale && p.staleGuard.action == staleEventDrop {
+				p.staleGuard.dropped.Incr(1)
+				ackChanges(p.source, p.acks, changes.seqs()...)
+				continue
+			}
+
+			var invalid *validationRule
+			var invalidReason string
+			if p.validation != nil {
+				invalid, invalidReason = p.validation.check(changes.Changes)
+			}
+			if invalid != nil && invalid.action == validationDrop {
+				ackChanges(p.source, p.acks, changes.seqs()...)
+				continue
+			}
+			if invalid != nil && invalid.action == validationFail {
+				p.backlog.requeue(changes)
+				return nil, nil, fmt.Errorf("change failed validation, %s", invalidReason)
+			}
+
+			if p.faults != nil {
+				if p.faults.reconnect() {
+					p.logger.Warn("Reconnecting: injected fault")
+					_ = p.source.Stop()
+					return nil, nil, service.ErrNotConnected
+				}
+				if err := p.faults.delayDecode(ctx); err != nil {
+					p.backlog.requeue(changes)
+					return nil, nil, err
+				}
+			}
+
+			msg, err := p.newMessage(ctx, changes.Wal2JsonChanges)
+			if err != nil {
+				p.backlog.requeue(changes)
+				return nil, nil, err
+			}
+			if invalid != nil {
+				p.markInvalid(msg, changes.Changes, invalidReason)
+			}
+			if stale {
+				p.staleGuard.deadLettered.Incr(1)
+				p.markDeadLetter(msg, changes.Changes, "stale")
+			}
+			if p.sizes != nil {
+				drop, err := p.checkSize(msg, changes.Changes)
+				if err != nil {
+					p.backlog.requeue(changes)
+					return nil, nil, err
+				}
+				if drop {
+					ackChanges(p.source, p.acks, changes.seqs()...)
+					continue
+				}
+			}
+
+			if p.sourceSoftDeletes != nil {
+				if tombstone := p.sourceSoftDeletes.tombstone(msg); tombstone != nil {
+					p.controlMessages = append(p.controlMessages, tombstone)
+				}
+			}
+
+			source, acks, queue, slo, faults, emitted := p.source, p.acks, p.queue, p.latencySLO, p.faults, time.Now()
+			p.transactionOpen = !changes.TransactionEnd
+			queue.emitted(phaseStream)
+			quiesceAcked := p.quiesce.emit()
+			return msg, func(ctx context.Context, err error) error {
+				// Nacks are retried automatically when we use service.AutoRetryNacks
+				defer quiesceAcked()
+				queue.acked(phaseStream, emitted, err)
+				slo.acked(changes.Timestamp, time.Now())
+				if event, ok := captured(msg); ok && err == nil {
+					// Streamed events are recorded once released, in the
+					// order they were received.
+					acks.attach(changes.seq, event)
+				}
+				if faults != nil && faults.dropAck() {
+					return nil
+				}
+				ackChanges(source, acks, changes.seqs()...)
+				return nil
+			}, nil
+		}
+
+		var compactionC <-chan time.Time
+		if p.compactor != nil {
+			if deadline, ok := p.compactor.nextDeadline(); ok {
+				compactionC = time.After(time.Until(deadline))
+			}
+		}
+
+		var migrationC <-chan time.Time
+		if p.migration != nil && len(p.migration.buffered) > 0 {
+			migrationC = time.After(p.migration.checkInterval)
+		}
+
+		var leaderC <-chan time.Time
+		if p.leader != nil {
+			leaderC = time.After(time.Until(p.leader.lastCheck.Add(p.leader.checkInterval)))
+		}
+
+		var membershipC <-chan time.Time
+		if p.shardMembership != nil {
+			membershipC = time.After(time.Until(p.shardMembership.nextRenewal()))
+		}
+
+		var livenessC <-chan time.Time
+		if p.liveness != nil {
+			livenessC = time.After(time.Until(p.liveness.lastCheck.Add(p.liveness.interval)))
+		}
+
+		var statementsC <-chan time.Time
+		if p.statements != nil {
+			statementsC = time.After(time.Until(p.statements.lastCheck.Add(p.statements.interval)))
+		}
+
+		var latencySLOC <-chan time.Time
+		if p.latencySLO != nil {
+			latencySLOC = time.After(time.Until(p.latencySLO.nextCheck()))
+		}
+
+		var partitionHintsC <-chan time.Time
+		if p.partitionHints != nil {
+			partitionHintsC = time.After(time.Until(p.partitionHints.nextEmit()))
+		}
+
+		var watermarkC <-chan time.Time
+		if p.watermarks != nil && p.watermarks.interval > 0 {
+			watermarkC = time.After(time.Until(p.watermarks.nextEmit()))
+		}
+
+		// Streamed changes follow the snapshot rows that are still buffered,
+		// as the snapshot completes before streaming starts.
+		lrC := p.source.LrMessageC()
+		if len(p.source.SnapshotMessageC()) > 0 {
+			lrC = nil
+		}
+
+		// Added columns are backfilled while no events are waiting.
+		if p.backfill != nil && p.backfill.pending() && len(p.source.SnapshotMessageC()) == 0 && len(lrC) == 0 {
+			msgs, err := p.backfillBatch(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.controlMessages = append(p.controlMessages, msgs...)
+			continue
+		}
+
+		select {
+		case snapshotMessage := <-p.source.SnapshotMessageC():
+			readPhase = phaseSnapshot
+			if snapshotMessage.Progress != nil {
+				msg, err := snapshotProgressMessage(snapshotMessage.Progress)
+				if err != nil {
+					return nil, nil, err
+				}
+				return msg, func(ctx context.Context, err error) error {
+					return nil
+				}, nil
+			}
+
+			var invalid *validationRule
+			var invalidReason string
+			if p.validation != nil {
+				invalid, invalidReason = p.validation.check(snapshotMessage.Changes)
+			}
+			if invalid != nil && invalid.action == validationDrop {
+				continue
+			}
+			if invalid != nil && invalid.action == validationFail {
+				return nil, nil, fmt.Errorf("snapshot row failed validation, %s", invalidReason)
+			}
+
+			if p.faults != nil {
+				if err := p.faults.delayDecode(ctx); err != nil {
+					return nil, nil, err
+				}
+			}
+
+			msg, err := p.newMessage(ctx, snapshotMessage)
+			if err != nil {
+				return nil, nil, err
+			}
+			if invalid != nil {
+				p.markInvalid(msg, snapshotMessage.Changes, invalidReason)
+			}
+			if p.sizes != nil {
+				drop, err := p.checkSize(msg, snapshotMessage.Changes)
+				if err != nil {
+					return nil, nil, err
+				}
+				if drop {
+					continue
+				}
+			}
+			if p.relations != nil {
+				announcements, err := p.relations.announce(snapshotMessage.Changes)
+				if err != nil {
+					return nil, nil, err
+				}
+				if len(announcements) > 0 {
+					// Snapshot rows aren't acknowledged, the row is emitted
+					// after the descriptors like the control messages.
+					p.controlMessages = append(p.controlMessages, announcements...)
+					p.controlMessages = append(p.controlMessages, msg)
+					p.queue.emitted(phaseSnapshot)
+					continue
+				}
+			}
+			queue, emitted := p.queue, time.Now()
+			queue.emitted(phaseSnapshot)
+			return msg, func(ctx context.Context, err error) error {
+				// Nacks are retried automatically when we use service.AutoRetryNacks
+				queue.acked(phaseSnapshot, emitted, err)
+				p.recordAcked(msg, err)
+				return nil
+			}, nil
+		case message := <-lrC:
+			if p.compactor != nil {
+				if cancelled := p.compactor.add(p.receive(message), time.Now()); len(cancelled) > 0 {
+					ackChanges(p.source, p.acks, cancelled...)
+				}
+				continue
+			}
+			p.backlog.push(p.receive(message))
+			p.backlog.fill(p.source.LrMessageC(), p.receive)
+		case <-migrationC:
+			// Polls the migration mode toggle at the start of the loop.
+		case <-leaderC:
+			// Checks the lease at the start of the loop.
+		case <-membershipC:
+			// Renews the shard membership at the start of the loop.
+		case <-livenessC:
+			// Probes the server at the start of the loop.
+		case <-statementsC:
+			// Looks up the statements at the start of the loop.
+		case <-latencySLOC:
+			// Evaluates the interval at the start of the loop.
+		case <-partitionHintsC:
+			// Samples the change rates at the start of the loop.
+		case <-watermarkC:
+			// Emits the watermark at the start of the loop.
+		case <-compactionC:
+			for _, changes := range p.compactor.flush(time.Now()) {
+				p.backlog.push(changes)
+			}
+		case err := <-p.source.ErrorC():
+			p.logger.Errorf("Replication stream failed: %v", err)
+			p.queue.failed("")
+			_ = p.source.Stop()
+			return nil, nil, service.ErrNotConnected
+		case <-ctx.Done():
+			return nil, nil, p.source.Stop()
+		}
+	}
+}
+
+// receive tracks a streamed event and invalidates the cached lookups of its
+// changes before any of them can be dropped.
+func (p *pgStreamInput) receive(changes pglogicalstream.Wal2JsonChanges) trackedChanges {
+	if p.lookups != nil {
+		p.lookups.invalidate(changes.Changes)
+	}
+	return p.track(changes)
+}
+
+func (p *pgStreamInput) track(changes pglogicalstream.Wal2JsonChanges) trackedChanges {
+	var lsn string
+	if changes.Lsn != nil {
+		lsn = *changes.Lsn
+	}
+	return trackedChanges{Wal2JsonChanges: changes, seq: p.acks.track(lsn, changes.TransactionEnd)}
+}
+
+// ackChanges confirms the LSN of the changes once all the changes received
+// before them have been acknowledged as well.
+func ackChanges(source pglogicalstream.ReplicationSource, acks *lsnAckTracker, seqs ...uint64) {
+	var released string
+	for _, seq := range seqs {
+		if lsn, ok := acks.ack(seq); ok && lsn != "" {
+			released = lsn
+		}
+	}
+	if released != "" {
+		source.AckLSN(released)
+	}
+}
+
+// checkCheckpoints applies the checkpoint failure policy while an
+// acknowledged position fails to be stored, and returns whether consumption
+// is paused.
+func (p *pgStreamInput) checkCheckpoints(ctx context.Context) (bool, error) {
+	err := p.checkpointing.retry()
+	if err == nil {
+		return false, nil
+	}
+	switch p.checkpoint.onFailure {
+	case checkpointFailurePause:
+		select {
+		case <-time.After(p.checkpoint.retryInterval):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+		return true, nil
+	case checkpointFailureFail:
+		p.logger.Errorf("Reconnecting: failed to store the checkpoint: %v", err)
+		_ = p.source.Stop()
+		return false, service.ErrNotConnected
+	}
+	return false, nil
+}
+
+// recordAcked records the event of a snapshot row or control message once it
+// is acknowledged, when recording. Streamed events are recorded as the ack
+// tracker releases them instead.
+func (p *pgStreamInput) recordAcked(msg *service.Message, err error) {
+	if p.recorder == nil || err != nil {
+		return
+	}
+	event, ok := captured(msg)
+	if !ok {
+		return
+	}
+	if err = p.recorder.record(event); err != nil {
+		p.logger.Errorf("Failed to record event: %v", err)
+	}
+}
+
+// newMessage serialises a batch of changes received from the replication
+// stream into a Benthos message.
+func (p *pgStreamInput) newMessage(ctx context.Context, changes pglogicalstream.Wal2JsonChanges) (*service.Message, error) {
+	// Enrichment modifies the changes, they are copied so that changes which
+	// fail to be emitted can be retried untouched.
+	changes.Changes = slices.Clone(changes.Changes)
+
+	if p.reselect != nil && changes.Lsn != nil {
+		if err := p.reselectRows(ctx, *changes.Lsn, changes.Changes); err != nil {
+			return nil, err
+		}
+	}
+
+	// The checksum covers the row as it is in the table, before it is
+	// enriched or trimmed.
+	var checksum string
+	if p.checksum != checksumNone {
+		checksum = p.checksum.sum(changes.Changes)
+	}
+
+	if p.numbers != numberFloat {
+		p.numbers.apply(changes.Changes)
+	}
+
+	if p.extendedTypes {
+		decodeExtendedTypes(changes.Changes, p.numbers)
+	}
+
+	if p.lookups != nil {
+		if err := p.lookups.apply(ctx, changes.Changes); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.derived != nil {
+		p.derived.apply(changes.Changes)
+	}
+
+	var softDeleted bool
+	if p.softDeletes != nil {
+		commitTime := changes.Timestamp
+		if commitTime.IsZero() {
+			commitTime = time.Now()
+		}
+		softDeleted = p.softDeletes.apply(changes.Changes, commitTime)
+	}
+
+	var sourceSoftDeleted bool
+	if p.sourceSoftDeletes != nil {
+		sourceSoftDeleted = p.sourceSoftDeletes.apply(changes.Changes, p.primaryKeys)
+	}
+
+	// The fingerprint covers all the columns of the table, even when
+	// unchanged columns are trimmed from the payload.
+	var fingerprint string
+	if p.schemaFingerprints {
+		fingerprint, _ = schemaFingerprint(changes.Changes)
+	}
+
+	// Key columns may be unchanged columns of updates.
+	var key eventKey
+	if p.keys != nil {
+		key, _ = p.keys.messageKey(changes.Changes)
+	}
+
+	if p.updatePayload == updatePayloadChanged {
+		trimUnchangedColumns(changes.Changes, p.primaryKeys)
+	}
+
+	nonFinite, err := p.nonFiniteFloats.apply(changes.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	mb, err := p.envelope.marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Captures hold the JSON payload whichever encoding is emitted.
+	capturedPayload := mb
+
+	var encoded avroEvent
+	if p.avro != nil {
+		if encoded, err = p.avro.encode(ctx, changes); err != nil {
+			return nil, err
+		}
+		mb = encoded.payload
+	}
+
+	msg := service.NewMessage(mb)
+	if p.avro != nil {
+		encoded.apply(msg)
+	} else {
+		msg.MetaSetMut("envelope_version", string(p.envelope))
+	}
+	if changes.Lsn != nil {
+		msg.MetaSetMut("phase", phaseStream)
+		msg.MetaSetMut("lsn", *changes.Lsn)
+		if !changes.Timestamp.IsZero() {
+			msg.MetaSetMut("commit_timestamp", changes.Timestamp.Format(time.RFC3339Nano))
+		}
+	} else {
+		msg.MetaSetMut("phase", phaseSnapshot)
+	}
+	if len(changes.Changes) > 0 {
+		msg.MetaSetMut("schema", changes.Changes[0].Schema)
+		msg.MetaSetMut("table", changes.Changes[0].Table)
+		msg.MetaSetMut("operation", changes.Changes[0].Kind)
+	}
+	if softDeleted {
+		msg.MetaSetMut("soft_deleted", "true")
+	}
+	if sourceSoftDeleted {
+		msg.MetaSetMut("source_soft_deleted", "true")
+	}
+	if nonFinite && p.nonFiniteFloats == nonFiniteDeadLetter {
+		p.markDeadLetter(msg, changes.Changes, "non_finite_float")
+	}
+	if checksum != "" {
+		msg.MetaSetMut("checksum", checksum)
+	}
+	if fingerprint != "" {
+		msg.MetaSetMut("schema_fingerprint", fingerprint)
+	}
+	if p.partitions != nil {
+		p.partitions.apply(msg, changes.Changes)
+	}
+	key.apply(msg)
+	if p.topics != nil {
+		p.topics.apply(msg, changes.Changes)
+	}
+	if p.txids != nil && changes.Lsn != nil {
+		p.txids.apply(msg, changes.Xid)
+	}
+	if p.partitionHints != nil && changes.Lsn != nil {
+		p.partitionHints.observe(changes.Changes)
+	}
+	if p.backfill != nil && changes.Lsn != nil {
+		for _, job := range p.backfill.observe(changes.Changes, p.primaryKeys) {
+			p.logger.Infof("Backfilling columns %v added to table %s", job.columns, job.table)
+		}
+	}
+	if p.watermarks != nil && changes.Lsn != nil {
+		p.watermarks.observe(changes.Timestamp)
+		p.watermarks.apply(msg)
+	}
+	if p.transactionBoundaries && changes.Lsn != nil {
+		msg.MetaSetMut("transaction_lsn", *changes.Lsn)
+		if changes.TransactionEnd {
+			msg.MetaSetMut("transaction_end", "true")
+		}
+	}
+	if p.traceContext != nil {
+		msg = p.traceContext.apply(msg, changes)
+	}
+	if p.archiver != nil {
+		if err = p.archiver.wrap(msg, changes); err != nil {
+			return nil, err
+		}
+	}
+	if p.recorder != nil {
+		msg = p.recorder.capture(msg, changes.Lsn, changes.Timestamp, capturedPayload)
+	}
+	return msg, nil
+}
+
+func (p *pgStreamInput) Close(ctx context.Context) error {
+	var errs []error
+	if p.lookups != nil {
+		p.lookups.close()
+	}
+	// The stream may still be reading a snapshot from a shared pool, so it
+	// is stopped before the pool is released.
+	if p.source != nil {
+		errs = append(errs, p.source.Stop())
+	}
+	if p.leader != nil {
+		errs = append(errs, p.leader.release())
+	}
+	if p.guard != nil {
+		errs = append(errs, p.guard.release())
+	}
+	if p.lockDB != nil {
+		errs = append(errs, p.lockDB.Close())
+		p.lockDB = nil
+	}
+	if p.db != nil {
+		if p.sharedPool != nil {
+			errs = append(errs, releaseSharedPool(p.sharedPool.name))
+		} else {
+			errs = append(errs, p.db.Close())
+		}
+		p.db = nil
+	}
+	if p.recorder != nil {
+		errs = append(errs, p.recorder.close())
+	}
+	if p.checkpointer != nil {
+		if p.shardMembership != nil {
+			errs = append(errs, p.shardMembership.leave(ctx, p.checkpointer))
+		}
+		errs = append(errs, p.checkpointer.Close(ctx))
+		p.checkpointer = nil
+		p.checkpointing = nil
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,259 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestMessageMetadata(t *testing.T) {
+	p := &pgStreamInput{}
+	changes := pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{
+		{Kind: "update", Schema: "public", Table: "orders"},
+		{Kind: "delete", Schema: "public", Table: "order_lines"},
+	}}
+
+	meta := func(changes pglogicalstream.Wal2JsonChanges) map[string]any {
+		msg, err := p.newMessage(context.Background(), changes)
+		require.NoError(t, err)
+		fields := map[string]any{}
+		require.NoError(t, msg.MetaWalkMut(func(key string, value any) error {
+			fields[key] = value
+			return nil
+		}))
+		return fields
+	}
+
+	fields := meta(changes)
+	assert.Equal(t, "public", fields["schema"])
+	assert.Equal(t, "orders", fields["table"])
+	assert.Equal(t, "update", fields["operation"])
+	assert.NotContains(t, fields, "lsn")
+	assert.NotContains(t, fields, "commit_timestamp")
+
+	lsn := "0/16B3748"
+	changes.Lsn = &lsn
+	changes.Timestamp = time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	fields = meta(changes)
+	assert.Equal(t, "0/16B3748", fields["lsn"])
+	assert.Equal(t, "2024-03-01T10:00:00.0000005Z", fields["commit_timestamp"])
+	assert.Equal(t, "stream", fields["phase"])
+}
+
+func TestOptionalFieldsUnset(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	assert.Nil(t, input.archiver)
+	assert.Nil(t, input.deadLetter)
+	assert.Nil(t, input.columnFilter)
+	assert.Nil(t, input.topics)
+	assert.Nil(t, input.traceContext)
+	assert.Nil(t, input.leader)
+	assert.Nil(t, input.liveness)
+	assert.Nil(t, input.dryRun)
+	assert.Nil(t, input.faults)
+	assert.Nil(t, input.ackBatching)
+
+	conf, err = pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+dry_run: {}
+`, nil)
+	require.NoError(t, err)
+	input, err = newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+	require.NotNil(t, input.dryRun)
+}
+
+func TestSnapshotRowsMatchTableSettings(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+key_columns:
+  - table: orders
+    columns: [ id ]
+derived_columns:
+  - table: orders
+    column: total
+    mapping: 'root = this.quantity * 2'
+topics:
+  prefix: cdc.
+event_sizes:
+  max_bytes:
+    orders: 10
+dead_letter:
+  routes:
+    orders: orders_dlq
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	// Snapshot rows carry the table name like streamed changes, and no LSN.
+	snapshotRow := pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		Kind:         "insert",
+		Schema:       "public",
+		Table:        "orders",
+		ColumnNames:  []string{"id", "quantity"},
+		ColumnTypes:  []string{"integer", "integer"},
+		ColumnValues: []interface{}{int64(7), int64(3)},
+	}}}
+	msg, err := input.newMessage(context.Background(), snapshotRow)
+	require.NoError(t, err)
+
+	meta := func(key string) any {
+		v, _ := msg.MetaGetMut(key)
+		return v
+	}
+	assert.Equal(t, "snapshot", meta("phase"))
+	assert.Equal(t, "orders", meta("table"))
+	assert.Equal(t, "7", meta("pg_key"))
+	assert.Equal(t, "cdc.public.orders", meta("topic"))
+
+	body, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"total"`)
+
+	drop, err := input.checkSize(msg, snapshotRow.Changes)
+	require.NoError(t, err)
+	assert.False(t, drop)
+	assert.Equal(t, "oversized", meta("dead_letter_reason"))
+	assert.Equal(t, "orders_dlq", meta("dead_letter_route"))
+}
+
+func TestTuningFields(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+slot_guard: false
+snapshot_batch_size: 500
+snapshot_buffer_size: 10
+separate_changes: false
+standby_message_timeout: 3s
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	var config pglogicalstream.Config
+	script := &pglogicalstream.FakeScript{}
+	input.newSource = func(c pglogicalstream.Config) (pglogicalstream.ReplicationSource, error) {
+		config = c
+		return script.Source(c)
+	}
+
+	ctx := context.Background()
+	require.NoError(t, input.Connect(ctx))
+	t.Cleanup(func() { _ = input.Close(ctx) })
+
+	assert.Equal(t, 500, config.BatchSize)
+	assert.Equal(t, 10, config.SnapshotBufferSize)
+	assert.False(t, config.SeparateChanges)
+	assert.Equal(t, 3*time.Second, config.StandbyMessageTimeout)
+}
+
+func TestConnectWrapsSource(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+slot_guard: false
+checkpoint:
+  backend: file
+  file:
+    path: `+filepath.Join(t.TempDir(), "checkpoints.json")+`
+quiesce:
+  cache: toggles
+ack_batching:
+  interval: 1h
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources(service.MockResourcesOptAddCache("toggles")))
+	require.NoError(t, err)
+
+	var created pglogicalstream.ReplicationSource
+	script := &pglogicalstream.FakeScript{}
+	input.newSource = func(c pglogicalstream.Config) (pglogicalstream.ReplicationSource, error) {
+		created, err = script.Source(c)
+		return created, err
+	}
+
+	ctx := context.Background()
+	require.NoError(t, input.Connect(ctx))
+	t.Cleanup(func() { _ = input.Close(ctx) })
+
+	// Acknowledgements are batched, then held back while quiescing, then
+	// checkpointed before they reach the source.
+	batcher, ok := input.source.(*ackBatcher)
+	require.True(t, ok, "outermost source is %T", input.source)
+	quiescing, ok := batcher.ReplicationSource.(*quiescingSource)
+	require.True(t, ok, "batched source is %T", batcher.ReplicationSource)
+	require.Same(t, input.checkpointing, quiescing.ReplicationSource)
+	require.NotNil(t, created)
+	assert.Same(t, created, input.checkpointing.ReplicationSource)
+}
+
+func TestSnapshotRowsPrecedeStreamedChanges(t *testing.T) {
+	res := service.MockResources()
+	source, _ := newFakeSource(t, &pglogicalstream.FakeScript{
+		Snapshot:     []string{fakeInsert(1), fakeInsert(2)},
+		Transactions: []string{fakeTransaction(3)},
+	})
+	p := &pgStreamInput{
+		source:  source,
+		backlog: newChangeBacklog(nil, 0),
+		acks:    &lsnAckTracker{},
+		queue:   newQueueMetrics(res.Metrics()),
+		logger:  res.Logger(),
+		metrics: res.Metrics(),
+	}
+	ctx := context.Background()
+
+	for _, phase := range []string{"snapshot", "snapshot", "stream"} {
+		msg, ack, err := p.Read(ctx)
+		require.NoError(t, err)
+		got, _ := msg.MetaGet("phase")
+		assert.Equal(t, phase, got)
+		require.NoError(t, ack(ctx, nil))
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+// Package pgstream reads the changes of Postgres tables from a logical
+// replication slot, for Go applications that embed the CDC reader without
+// running a Benthos pipeline.
+//
+//	r, err := pgstream.New(pgstream.Config{...})
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Close()
+//	for event := range r.Events() {
+//		// Process the event, then confirm it to the slot.
+//		r.Ack(event)
+//	}
+//	return r.Err()
+package pgstream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// Phase is the phase of the stream an event was read in.
+type Phase string
+
+const (
+	// PhaseSnapshot events are rows of the tables as they were when the
+	// replication slot was created.
+	PhaseSnapshot Phase = "snapshot"
+	// PhaseStream events are changes streamed from the replication slot.
+	PhaseStream Phase = "stream"
+)
+
+// Config configures a Reader.
+type Config struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	// TLS requires a TLS connection, without verifying the certificate of
+	// the server.
+	TLS bool
+
+	// Schema is the schema of the replicated tables.
+	Schema string
+	// Tables are the replicated tables.
+	Tables []string
+	// SlotName is the name of the replication slot, which is created with
+	// the wal2json output plugin when it doesn't exist yet.
+	SlotName string
+	// Snapshot reads the existing rows of the tables before streaming when
+	// the replication slot is created.
+	Snapshot bool
+	// SeparateChanges emits an event per changed row rather than an event
+	// per transaction.
+	SeparateChanges bool
+	// ApplicationName is reported by the connections in pg_stat_activity.
+	ApplicationName string
+}
+
+// Event holds changes read from the slot, or a snapshot row.
+type Event struct {
+	Phase Phase
+	// LSN is the position of the transaction of the changes, it is empty
+	// for snapshot rows.
+	LSN string
+	// Xid is the id of the transaction of the changes, it is zero for
+	// snapshot rows.
+	Xid uint32
+	// CommitTime is when the transaction of the changes committed, it is
+	// zero for snapshot rows.
+	CommitTime time.Time
+	// TransactionEnd is set on the last event of a transaction.
+	TransactionEnd bool
+	// Changes is empty for transactions without changes, which are read so
+	// that acknowledging them advances the slot past them in order.
+	Changes []Change
+}
+
+// Change is a change of a row. Snapshot rows are inserts.
+type Change struct {
+	// Kind is insert, update or delete.
+	Kind    string
+	Schema  string
+	Table   string
+	Columns []Column
+	// OldKeys are the replica identity columns of updated and deleted rows
+	// before the change.
+	OldKeys []Column
+}
+
+// Column is a column value of a row along with its type.
+type Column struct {
+	Name  string
+	Type  string
+	Value any
+}
+
+// Reader reads the events of a replication slot. Events must be acknowledged
+// with Ack for the slot to advance, unacknowledged events are read again
+// after reconnecting.
+type Reader struct {
+	source pglogicalstream.ReplicationSource
+	events chan Event
+	stop   chan struct{}
+	done   chan struct{}
+
+	errMut sync.Mutex
+	err    error
+
+	closeOnce sync.Once
+}
+
+// New connects to the server and starts reading events.
+func New(conf Config) (*Reader, error) {
+	if conf.SlotName == "" {
+		return nil, errors.New("a slot name is required")
+	}
+	if conf.Port == 0 {
+		conf.Port = 5432
+	}
+	tlsVerify := pglogicalstream.TlsNoVerify
+	if conf.TLS {
+		tlsVerify = pglogicalstream.TlsRequireVerify
+	}
+
+	source, err := pglogicalstream.NewReplicationSource(pglogicalstream.Config{
+		DbHost:                     conf.Host,
+		DbPort:                     conf.Port,
+		DbUser:                     conf.User,
+		DbPassword:                 conf.Password,
+		DbName:                     conf.Database,
+		DbSchema:                   conf.Schema,
+		DbTables:                   conf.Tables,
+		ReplicationSlotName:        conf.SlotName,
+		TlsVerify:                  tlsVerify,
+		StreamOldData:              conf.Snapshot,
+		SeparateChanges:            conf.SeparateChanges,
+		SnapshotMemorySafetyFactor: 0.5,
+		SnapshotOrder:              pglogicalstream.SnapshotOrderPrimaryKey,
+		ApplicationName:            conf.ApplicationName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newReader(source), nil
+}
+
+func newReader(source pglogicalstream.ReplicationSource) *Reader {
+	r := &Reader{
+		source: source,
+		events: make(chan Event),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+// Events returns the events in the order they were read, all the snapshot
+// rows first. The channel is closed when the reader stops, after which Err
+// returns what stopped it.
+func (r *Reader) Events() <-chan Event {
+	return r.events
+}
+
+// Err returns the error that stopped the reader, or nil when it was closed.
+func (r *Reader) Err() error {
+	r.errMut.Lock()
+	defer r.errMut.Unlock()
+	return r.err
+}
+
+// Ack confirms to the slot that the event and all the events read before it
+// have been processed. Acknowledging snapshot rows has no effect.
+func (r *Reader) Ack(event Event) {
+	if event.LSN != "" {
+		r.source.AckLSN(event.LSN)
+	}
+}
+
+// Close stops reading events and closes the connections to the server.
+func (r *Reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+	return r.source.Stop()
+}
+
+func (r *Reader) loop() {
+	defer close(r.done)
+	defer close(r.events)
+
+	for {
+		// Streamed changes follow the snapshot rows that are still buffered,
+		// as the snapshot completes before streaming starts.
+		lrC := r.source.LrMessageC()
+		if len(r.source.SnapshotMessageC()) > 0 {
+			lrC = nil
+		}
+
+		var event Event
+		select {
+		case changes := <-r.source.SnapshotMessageC():
+			if changes.Progress != nil {
+				continue
+			}
+			event = newEvent(PhaseSnapshot, changes)
+		case changes := <-lrC:
+			event = newEvent(PhaseStream, changes)
+		case err := <-r.source.ErrorC():
+			r.errMut.Lock()
+			r.err = err
+			r.errMut.Unlock()
+			return
+		case <-r.stop:
+			return
+		}
+
+		select {
+		case r.events <- event:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func newEvent(phase Phase, changes pglogicalstream.Wal2JsonChanges) Event {
+	event := Event{
+		Phase:          phase,
+		Xid:            changes.Xid,
+		CommitTime:     changes.Timestamp,
+		TransactionEnd: changes.TransactionEnd,
+		Changes:        make([]Change, len(changes.Changes)),
+	}
+	if changes.Lsn != nil {
+		event.LSN = *changes.Lsn
+	}
+	for i, change := range changes.Changes {
+		event.Changes[i] = Change{
+			Kind:    change.Kind,
+			Schema:  change.Schema,
+			Table:   change.Table,
+			Columns: columns(change.ColumnNames, change.ColumnTypes, change.ColumnValues),
+			OldKeys: columns(change.OldKeys.KeyNames, change.OldKeys.KeyTypes, change.OldKeys.KeyValues),
+		}
+	}
+	return event
+}
+
+func columns(names, types []string, values []any) []Column {
+	if len(names) == 0 {
+		return nil
+	}
+	cols := make([]Column, len(names))
+	for i, name := range names {
+		cols[i].Name = name
+		if i < len(types) {
+			cols[i].Type = types[i]
+		}
+		if i < len(values) {
+			cols[i].Value = values[i]
+		}
+	}
+	return cols
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pgstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestReaderEvents(t *testing.T) {
+	script := &pglogicalstream.FakeScript{
+		Transactions: []string{
+			`{"xid":7,"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id","name"],"columntypes":["integer","text"],"columnvalues":[1,"ada"]}]}`,
+			`{"xid":8,"change":[{"kind":"delete","schema":"public","table":"users","oldkeys":{"keynames":["id"],"keytypes":["integer"],"keyvalues":[1]}}]}`,
+		},
+		DisconnectEvery: 2,
+	}
+	source, err := script.Source(pglogicalstream.Config{DbSchema: "public", DbTables: []string{"users"}})
+	require.NoError(t, err)
+
+	r := newReader(source)
+	defer r.Close()
+
+	var events []Event
+	for event := range r.Events() {
+		events = append(events, event)
+		r.Ack(event)
+	}
+	assert.ErrorIs(t, r.Err(), pglogicalstream.ErrFakeDisconnect)
+
+	require.Len(t, events, 2)
+	assert.Equal(t, Event{
+		Phase:          PhaseStream,
+		LSN:            "0/1",
+		Xid:            7,
+		TransactionEnd: true,
+		Changes: []Change{{
+			Kind:   "insert",
+			Schema: "public",
+			Table:  "users",
+			Columns: []Column{
+				{Name: "id", Type: "integer", Value: float64(1)},
+				{Name: "name", Type: "text", Value: "ada"},
+			},
+		}},
+	}, events[0])
+	assert.Equal(t, "0/2", events[1].LSN)
+	assert.Equal(t, []Column{{Name: "id", Type: "integer", Value: float64(1)}}, events[1].Changes[0].OldKeys)
+
+	// Closing the reader closes the events without an error.
+	source, err = script.Source(pglogicalstream.Config{DbSchema: "public", DbTables: []string{"users"}})
+	require.NoError(t, err)
+	resumed := newReader(source)
+	require.NoError(t, resumed.Close())
+	_, open := <-resumed.Events()
+	assert.False(t, open)
+	assert.NoError(t, resumed.Err())
+}
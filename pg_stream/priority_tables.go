@@ -0,0 +1,110 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"slices"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type trackedChanges struct {
+	pglogicalstream.Wal2JsonChanges
+	seq uint64
+	// merged holds the sequence numbers of changes compacted into these.
+	merged []uint64
+}
+
+// seqs returns the sequence numbers to acknowledge once the changes are
+// delivered.
+func (c trackedChanges) seqs() []uint64 {
+	return append(slices.Clip(c.merged), c.seq)
+}
+
+// changeBacklog holds change events that were received from the replication
+// stream but not emitted yet. When priority tables are configured and the
+// input is behind, events of those tables are emitted ahead of the others.
+// Events of the same table are always emitted in the order they were received
+// so per key ordering is preserved.
+type changeBacklog struct {
+	priorityTables map[string]struct{}
+	lookahead      int
+	queue          []trackedChanges
+}
+
+func newChangeBacklog(priorityTables []string, lookahead int) *changeBacklog {
+	b := &changeBacklog{
+		priorityTables: make(map[string]struct{}, len(priorityTables)),
+		lookahead:      lookahead,
+	}
+	for _, table := range priorityTables {
+		b.priorityTables[table] = struct{}{}
+	}
+	return b
+}
+
+func (b *changeBacklog) len() int {
+	return len(b.queue)
+}
+
+func (b *changeBacklog) push(changes trackedChanges) {
+	b.queue = append(b.queue, changes)
+}
+
+// fill pulls events that are already waiting on the channel into the backlog
+// without blocking. Nothing is pulled when no priority tables are configured.
+func (b *changeBacklog) fill(c <-chan pglogicalstream.Wal2JsonChanges, track func(pglogicalstream.Wal2JsonChanges) trackedChanges) {
+	if len(b.priorityTables) == 0 {
+		return
+	}
+	for len(b.queue) < b.lookahead {
+		select {
+		case changes := <-c:
+			b.push(track(changes))
+		default:
+			return
+		}
+	}
+}
+
+// requeue puts changes that failed to be emitted back to the front of the
+// backlog so they are retried first.
+func (b *changeBacklog) requeue(changes trackedChanges) {
+	b.queue = append([]trackedChanges{changes}, b.queue...)
+}
+
+// pop returns the next event to emit.
+func (b *changeBacklog) pop() (trackedChanges, bool) {
+	if len(b.queue) == 0 {
+		return trackedChanges{}, false
+	}
+
+	next := 0
+	for i, changes := range b.queue {
+		if b.isPriority(changes) {
+			next = i
+			break
+		}
+	}
+
+	changes := b.queue[next]
+	b.queue = append(b.queue[:next], b.queue[next+1:]...)
+	return changes, true
+}
+
+// isPriority returns true when the changes are all of priority tables. Events
+// without changes, such as empty transactions, are never moved ahead.
+func (b *changeBacklog) isPriority(changes trackedChanges) bool {
+	for _, change := range changes.Changes {
+		if _, ok := b.priorityTables[change.Table]; !ok {
+			return false
+		}
+	}
+	return len(changes.Changes) > 0
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestChangeBacklogEmitsPriorityTablesFirst(t *testing.T) {
+	acks := &lsnAckTracker{}
+	track := func(changes pglogicalstream.Wal2JsonChanges) trackedChanges {
+		return trackedChanges{Wal2JsonChanges: changes, seq: acks.track(*changes.Lsn, changes.TransactionEnd)}
+	}
+	change := func(lsn, table string) pglogicalstream.Wal2JsonChanges {
+		return pglogicalstream.Wal2JsonChanges{
+			Lsn:     &lsn,
+			Changes: []pglogicalstream.Wal2JsonChange{{Table: table}},
+		}
+	}
+
+	c := make(chan pglogicalstream.Wal2JsonChanges, 4)
+	c <- change("0/2", "orders")
+	c <- change("0/3", "logs")
+	c <- change("0/4", "orders")
+
+	backlog := newChangeBacklog([]string{"orders"}, 10)
+	backlog.push(track(change("0/1", "logs")))
+	backlog.fill(c, track)
+
+	var order []string
+	var seqs []uint64
+	for {
+		changes, ok := backlog.pop()
+		if !ok {
+			break
+		}
+		order = append(order, *changes.Lsn)
+		seqs = append(seqs, changes.seq)
+	}
+	assert.Equal(t, []string{"0/2", "0/4", "0/1", "0/3"}, order)
+
+	// Acking the priority changes must not confirm past the pending logs.
+	_, ok := acks.ack(seqs[0])
+	assert.False(t, ok)
+	_, ok = acks.ack(seqs[1])
+	assert.False(t, ok)
+
+	lsn, ok := acks.ack(seqs[2])
+	require.True(t, ok)
+	assert.Equal(t, "0/2", lsn)
+
+	lsn, ok = acks.ack(seqs[3])
+	require.True(t, ok)
+	assert.Equal(t, "0/4", lsn)
+}
+
+func TestChangeBacklogKeepsMixedEventsInOrder(t *testing.T) {
+	lsn := func(s string) *string { return &s }
+	events := []trackedChanges{
+		{Wal2JsonChanges: pglogicalstream.Wal2JsonChanges{Lsn: lsn("0/1"), Changes: []pglogicalstream.Wal2JsonChange{{Table: "logs"}}}},
+		{Wal2JsonChanges: pglogicalstream.Wal2JsonChanges{Lsn: lsn("0/2"), Changes: []pglogicalstream.Wal2JsonChange{{Table: "orders"}, {Table: "logs"}}}},
+		{Wal2JsonChanges: pglogicalstream.Wal2JsonChanges{Lsn: lsn("0/3"), TransactionEnd: true}},
+	}
+
+	backlog := newChangeBacklog([]string{"orders"}, 10)
+	for _, event := range events {
+		backlog.push(event)
+	}
+
+	// Neither the event holding logs changes nor the empty transaction are
+	// moved ahead.
+	var order []string
+	for {
+		changes, ok := backlog.pop()
+		if !ok {
+			break
+		}
+		order = append(order, *changes.Lsn)
+	}
+	assert.Equal(t, []string{"0/1", "0/2", "0/3"}, order)
+}
+
+func TestPriorityTablesRequireSeparateChanges(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders, logs ]
+priority_tables: [ orders ]
+separate_changes: false
+`, nil)
+	require.NoError(t, err)
+	_, err = newPgStreamInput(conf, service.MockResources())
+	assert.EqualError(t, err, "priority_tables requires separate_changes")
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	phaseSnapshot = "snapshot"
+	phaseStream   = "stream"
+)
+
+// phaseMetrics report the throughput, latency and errors of the snapshot or
+// of the streamed changes, so backfills don't skew the figures of steady
+// replication.
+type phaseMetrics struct {
+	events     *service.MetricCounter
+	nacks      *service.MetricCounter
+	errors     *service.MetricCounter
+	ackLatency *service.MetricTimer
+}
+
+func newPhaseMetrics(metrics *service.Metrics, phase string) *phaseMetrics {
+	return &phaseMetrics{
+		events:     metrics.NewCounter("pg_stream_" + phase + "_events"),
+		nacks:      metrics.NewCounter("pg_stream_" + phase + "_nacks"),
+		errors:     metrics.NewCounter("pg_stream_" + phase + "_errors"),
+		ackLatency: metrics.NewTimer("pg_stream_" + phase + "_ack_latency_ns"),
+	}
+}
+
+// queueMetrics report where events wait inside the input. Full buffers with
+// few unconfirmed events point at a slow pipeline reading from the input,
+// while many unconfirmed events and a slow acknowledgement latency point at a
+// slow sink. Empty buffers point at the server.
+type queueMetrics struct {
+	snapshotBuffer    *service.MetricGauge
+	backlog           *service.MetricGauge
+	unconfirmed       *service.MetricGauge
+	oldestUnconfirmed *service.MetricGauge
+	ackLatency        *service.MetricTimer
+
+	phases map[string]*phaseMetrics
+	// lastPhase is the phase of the last emitted event, errors of the
+	// replication stream are attributed to it.
+	lastPhase string
+}
+
+func newQueueMetrics(metrics *service.Metrics) *queueMetrics {
+	return &queueMetrics{
+		snapshotBuffer:    metrics.NewGauge("pg_stream_snapshot_buffer_rows"),
+		backlog:           metrics.NewGauge("pg_stream_backlog_events"),
+		unconfirmed:       metrics.NewGauge("pg_stream_unconfirmed_events"),
+		oldestUnconfirmed: metrics.NewGauge("pg_stream_oldest_unconfirmed_ms"),
+		ackLatency:        metrics.NewTimer("pg_stream_ack_latency_ns"),
+		phases: map[string]*phaseMetrics{
+			phaseSnapshot: newPhaseMetrics(metrics, phaseSnapshot),
+			phaseStream:   newPhaseMetrics(metrics, phaseStream),
+		},
+		lastPhase: phaseSnapshot,
+	}
+}
+
+// update sets the gauges from the buffered snapshot rows, the backlog of
+// received events and the events awaiting confirmation to the slot.
+func (m *queueMetrics) update(snapshotBuffer int, backlog int, acks *lsnAckTracker, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.snapshotBuffer.Set(int64(snapshotBuffer))
+	m.backlog.Set(int64(backlog))
+
+	unconfirmed, oldest, ok := acks.oldest()
+	m.unconfirmed.Set(int64(unconfirmed))
+	if ok {
+		m.oldestUnconfirmed.Set(now.Sub(oldest).Milliseconds())
+	} else {
+		m.oldestUnconfirmed.Set(0)
+	}
+}
+
+// emitted counts an event of the phase handed to the pipeline.
+func (m *queueMetrics) emitted(phase string) {
+	if m == nil {
+		return
+	}
+	m.lastPhase = phase
+	m.phases[phase].events.Incr(1)
+}
+
+// failed counts an error that stopped the input from reading an event of the
+// phase, or of the phase of the last emitted event when it's empty.
+func (m *queueMetrics) failed(phase string) {
+	if m == nil {
+		return
+	}
+	if phase == "" {
+		phase = m.lastPhase
+	}
+	m.phases[phase].errors.Incr(1)
+}
+
+// acked records how long the pipeline took to acknowledge or reject a message
+// of the phase emitted at the given time.
+func (m *queueMetrics) acked(phase string, emitted time.Time, err error) {
+	if m == nil {
+		return
+	}
+	latency := time.Since(emitted).Nanoseconds()
+	m.ackLatency.Timing(latency)
+	m.phases[phase].ackLatency.Timing(latency)
+	if err != nil {
+		m.phases[phase].nacks.Incr(1)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAckTrackerOldestUnconfirmed(t *testing.T) {
+	acks := &lsnAckTracker{}
+	_, _, ok := acks.oldest()
+	assert.False(t, ok)
+
+	first := acks.track("0/10", true)
+	second := acks.track("0/20", true)
+	acks.pending[0].received = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	acks.pending[1].received = time.Date(2024, 3, 1, 10, 0, 5, 0, time.UTC)
+
+	// The second event is acknowledged but still waits for the first one.
+	acks.ack(second)
+	count, oldest, ok := acks.oldest()
+	assert.True(t, ok)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), oldest)
+
+	acks.ack(first)
+	_, _, ok = acks.oldest()
+	assert.False(t, ok)
+
+	// The metrics of inputs built without resources are no-ops.
+	var queue *queueMetrics
+	queue.update(1, 2, acks, time.Now())
+	queue.emitted(phaseStream)
+	queue.failed("")
+	queue.acked(phaseStream, time.Now(), nil)
+	newQueueMetrics(service.MockResources().Metrics()).update(1, 2, acks, time.Now())
+}
+
+func TestQueueMetricsPhases(t *testing.T) {
+	m := newQueueMetrics(service.MockResources().Metrics())
+	assert.Equal(t, phaseSnapshot, m.lastPhase)
+
+	m.emitted(phaseSnapshot)
+	m.acked(phaseSnapshot, time.Now(), errors.New("nope"))
+	m.emitted(phaseStream)
+	assert.Equal(t, phaseStream, m.lastPhase)
+
+	// Failures of the replication stream count towards the last phase.
+	m.failed("")
+	m.failed(phaseSnapshot)
+	assert.Equal(t, phaseStream, m.lastPhase)
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// quiesceDrainInterval is how often the input checks whether the emitted
+// changes were acknowledged while quiescing.
+const quiesceDrainInterval = 100 * time.Millisecond
+
+var quiesceConfigFields = []*service.ConfigField{
+	service.NewStringField("cache").
+		Description("The cache resource holding the quiesce toggle"),
+	service.NewStringField("key").
+		Description("The cache key of the toggle. The input quiesces while the key holds `true`, and resumes once it holds anything else or doesn't exist").
+		Default("pg_stream_quiesce"),
+	service.NewDurationField("check_interval").
+		Description("How often the toggle is read").
+		Default("5s"),
+}
+
+// quiesce stops consuming the slot at a transaction boundary when toggled on
+// through a cache key, and holds without any connection to the server until
+// it is toggled off again, so the server can be taken down for maintenance.
+type quiesce struct {
+	cache         string
+	key           string
+	checkInterval time.Duration
+	res           *service.Resources
+
+	quiescedGauge *service.MetricGauge
+
+	requested bool
+	held      bool
+	lastCheck time.Time
+	// atBoundary is set when the last popped changes ended their
+	// transaction.
+	atBoundary bool
+	// inFlight counts the streamed events of the current connection that
+	// were emitted but not acknowledged yet.
+	inFlight *atomic.Int64
+
+	mut       sync.Mutex
+	confirmed string
+}
+
+func newQuiesceFromParsed(conf *service.ParsedConfig, res *service.Resources) (q *quiesce, err error) {
+	q = &quiesce{
+		res:           res,
+		quiescedGauge: res.Metrics().NewGauge("pg_stream_quiesced"),
+		inFlight:      &atomic.Int64{},
+	}
+	if q.cache, err = conf.FieldString("cache"); err != nil {
+		return nil, err
+	}
+	if q.key, err = conf.FieldString("key"); err != nil {
+		return nil, err
+	}
+	if q.checkInterval, err = conf.FieldDuration("check_interval"); err != nil {
+		return nil, err
+	}
+	if !res.HasCache(q.cache) {
+		return nil, errors.New("quiesce cache resource " + strconv.Quote(q.cache) + " doesn't exist")
+	}
+	return q, nil
+}
+
+// reset starts tracking a new connection. When a snapshot may be streamed
+// the first boundary is the end of the first streamed transaction, as an
+// interrupted snapshot isn't resumed.
+func (q *quiesce) reset(streamSnapshot bool) {
+	q.atBoundary = !streamSnapshot
+	q.inFlight = &atomic.Int64{}
+	q.mut.Lock()
+	q.confirmed = ""
+	q.mut.Unlock()
+}
+
+// poll reads the toggle once the check interval elapsed. A missing toggle
+// isn't a request to quiesce, a toggle that fails to be read leaves the
+// request as it was.
+func (q *quiesce) poll(ctx context.Context) (err error) {
+	if time.Since(q.lastCheck) < q.checkInterval {
+		return nil
+	}
+	q.lastCheck = time.Now()
+
+	var value []byte
+	if aerr := q.res.AccessCache(ctx, q.cache, func(c service.Cache) {
+		value, err = c.Get(ctx, q.key)
+	}); aerr != nil {
+		return aerr
+	}
+	if err != nil && !errors.Is(err, service.ErrKeyNotFound) {
+		return err
+	}
+	q.requested, _ = strconv.ParseBool(string(value))
+	return nil
+}
+
+func (q *quiesce) observe(changes pglogicalstream.Wal2JsonChanges) {
+	if q == nil {
+		return
+	}
+	q.atBoundary = changes.TransactionEnd
+}
+
+// emit counts an emitted event as in flight and returns the function that
+// counts its acknowledgement.
+func (q *quiesce) emit() func() {
+	if q == nil {
+		return func() {}
+	}
+	inFlight := q.inFlight
+	inFlight.Add(1)
+	return func() {
+		inFlight.Add(-1)
+	}
+}
+
+// draining returns true when no more changes may be emitted as the input
+// quiesces once the emitted ones are acknowledged.
+func (q *quiesce) draining() bool {
+	return q.requested && q.atBoundary
+}
+
+func (q *quiesce) stopLSN() string {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return q.confirmed
+}
+
+// pollQuiesce reads the toggle and stops the source once the changes emitted
+// up to the transaction boundary are acknowledged, returning the quiesced
+// event. While held, it waits for the toggle to be turned off and then
+// reconnects.
+func (p *pgStreamInput) pollQuiesce(ctx context.Context) (*service.Message, error) {
+	q := p.quiesce
+	if q.held {
+		for q.requested {
+			select {
+			case <-time.After(time.Until(q.lastCheck.Add(q.checkInterval))):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if err := q.poll(ctx); err != nil {
+				return nil, err
+			}
+		}
+		q.held = false
+		q.quiescedGauge.Set(0)
+		p.logger.Infof("Quiesce toggle turned off, resuming")
+		return nil, service.ErrNotConnected
+	}
+
+	if err := q.poll(ctx); err != nil {
+		return nil, err
+	}
+	if !q.draining() || q.inFlight.Load() > 0 {
+		return nil, nil
+	}
+
+	// Stopping the source flushes the acknowledgements still batched.
+	if err := p.source.Stop(); err != nil {
+		return nil, err
+	}
+	q.held = true
+	q.quiescedGauge.Set(1)
+
+	lsn := q.stopLSN()
+	p.logger.Infof("Quiesced at LSN %s, holding until the toggle is turned off", lsn)
+	b, err := json.Marshal(map[string]any{"slot": fmt.Sprintf("rs_%s", p.slotName), "lsn": lsn})
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "quiesced")
+	return msg, nil
+}
+
+// quiescingSource records the last position confirmed to a source, which is
+// reported as the stop position when the input quiesces.
+type quiescingSource struct {
+	pglogicalstream.ReplicationSource
+	quiesce *quiesce
+}
+
+func (s *quiescingSource) AckLSN(lsn string) {
+	s.quiesce.mut.Lock()
+	s.quiesce.confirmed = lsn
+	s.quiesce.mut.Unlock()
+	s.ReplicationSource.AckLSN(lsn)
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestQuiesceAtTransactionBoundary(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("toggles"))
+	ctx := context.Background()
+	setToggle := func(value string) {
+		require.NoError(t, res.AccessCache(ctx, "toggles", func(c service.Cache) {
+			require.NoError(t, c.Set(ctx, "quiesce", []byte(value), nil))
+		}))
+	}
+
+	q := &quiesce{
+		cache:         "toggles",
+		key:           "quiesce",
+		checkInterval: time.Millisecond,
+		res:           res,
+		quiescedGauge: res.Metrics().NewGauge("quiesced"),
+	}
+	q.reset(true)
+	recorded, acks := newFakeSource(t, &pglogicalstream.FakeScript{})
+	p := &pgStreamInput{
+		slotName: "orders",
+		quiesce:  q,
+		source:   newAckBatcher(&quiescingSource{ReplicationSource: recorded, quiesce: q}, ackBatchingConfig{interval: time.Hour}),
+	}
+
+	setToggle("true")
+	msg, err := p.pollQuiesce(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+	// Changes are emitted until the end of their transaction.
+	assert.False(t, q.draining())
+
+	q.observe(pglogicalstream.Wal2JsonChanges{TransactionEnd: true})
+	acked := q.emit()
+	p.source.AckLSN("0/64")
+	assert.True(t, q.draining())
+
+	// The input waits for the emitted changes to be acknowledged.
+	time.Sleep(2 * time.Millisecond)
+	msg, err = p.pollQuiesce(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	acked()
+	time.Sleep(2 * time.Millisecond)
+	msg, err = p.pollQuiesce(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"slot":"rs_orders","lsn":"0/64"}`, string(b))
+	assert.Equal(t, []string{"0/64"}, acks.confirmed())
+
+	// The input holds until the toggle is turned off, then reconnects.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		setToggle("false")
+	}()
+	_, err = p.pollQuiesce(ctx)
+	assert.ErrorIs(t, err, service.ErrNotConnected)
+	assert.False(t, q.held)
+}
+
+func TestQuiesceKeepsRequestOnFailedRead(t *testing.T) {
+	res := service.MockResources(service.MockResourcesOptAddCache("toggles"))
+	ctx := context.Background()
+	require.NoError(t, res.AccessCache(ctx, "toggles", func(c service.Cache) {
+		require.NoError(t, c.Set(ctx, "quiesce", []byte("true"), nil))
+	}))
+
+	q := &quiesce{cache: "toggles", key: "quiesce", res: res}
+	require.NoError(t, q.poll(ctx))
+	assert.True(t, q.requested)
+
+	q.cache = "missing"
+	require.Error(t, q.poll(ctx))
+	assert.True(t, q.requested)
+
+	// A missing toggle isn't a request to quiesce.
+	q.cache, q.key = "toggles", "other"
+	require.NoError(t, q.poll(ctx))
+	assert.False(t, q.requested)
+}
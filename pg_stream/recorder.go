@@ -0,0 +1,185 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// recordedEvent is a single line of a capture file written by the recorder
+// and consumed by the pg_stream_replay input. The timestamp is the commit
+// timestamp of streamed changes and the capture time of snapshot rows.
+type recordedEvent struct {
+	Lsn       *string           `json:"lsn"`
+	Timestamp time.Time         `json:"timestamp"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Payload   json.RawMessage   `json:"payload"`
+}
+
+var recordConfigFields = []*service.ConfigField{
+	service.NewStringField("path").
+		Description("File the captured events are appended to, one JSON document per line"),
+	service.NewStringField("start_lsn").
+		Description("Only record events at or after this LSN. Snapshot events carry no LSN and are skipped when set").
+		Example("0/16B3748").
+		Default(""),
+	service.NewStringField("end_lsn").
+		Description("Stop recording once an event beyond this LSN has been delivered, along with every event received before it").
+		Example("0/16B9F20").
+		Default(""),
+	service.NewDurationField("max_duration").
+		Description("Stop recording after this much time has passed since the input first connected. Leave empty to record without a time bound").
+		Example("10m").
+		Optional(),
+}
+
+type streamRecorder struct {
+	path        string
+	startLsn    pglogrepl.LSN
+	endLsn      pglogrepl.LSN
+	maxDuration time.Duration
+
+	mut      sync.Mutex
+	file     *os.File
+	enc      *json.Encoder
+	deadline time.Time
+	done     bool
+}
+
+func newStreamRecorderFromParsed(conf *service.ParsedConfig) (r *streamRecorder, err error) {
+	r = &streamRecorder{}
+	if r.path, err = conf.FieldString("path"); err != nil {
+		return nil, err
+	}
+
+	var startLsn, endLsn string
+	if startLsn, err = conf.FieldString("start_lsn"); err != nil {
+		return nil, err
+	}
+	if startLsn != "" {
+		if r.startLsn, err = pglogrepl.ParseLSN(startLsn); err != nil {
+			return nil, err
+		}
+	}
+
+	if endLsn, err = conf.FieldString("end_lsn"); err != nil {
+		return nil, err
+	}
+	if endLsn != "" {
+		if r.endLsn, err = pglogrepl.ParseLSN(endLsn); err != nil {
+			return nil, err
+		}
+	}
+
+	if conf.Contains("max_duration") {
+		if r.maxDuration, err = conf.FieldDuration("max_duration"); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// open opens the capture file unless it is open already. The recording bounds
+// carry over reconnects, the deadline is set when the input first connects.
+func (r *streamRecorder) open() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.file == nil {
+		file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		r.file = file
+		r.enc = json.NewEncoder(file)
+	}
+	if r.maxDuration > 0 && r.deadline.IsZero() {
+		r.deadline = time.Now().Add(r.maxDuration)
+	}
+	return nil
+}
+
+type capturedEventKey struct{}
+
+// capture attaches the payload and metadata of an event to its message,
+// which is recorded once the message is acknowledged, so that events
+// delivered again after a nack or a reconnect are recorded once.
+func (r *streamRecorder) capture(msg *service.Message, lsn *string, timestamp time.Time, payload []byte) *service.Message {
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	event := recordedEvent{Lsn: lsn, Timestamp: timestamp, Payload: payload, Metadata: map[string]string{}}
+	_ = msg.MetaWalk(func(key, value string) error {
+		event.Metadata[key] = value
+		return nil
+	})
+	return msg.WithContext(context.WithValue(msg.Context(), capturedEventKey{}, event))
+}
+
+// captured returns the event captured on a message, if any.
+func captured(msg *service.Message) (recordedEvent, bool) {
+	event, ok := msg.Context().Value(capturedEventKey{}).(recordedEvent)
+	return event, ok
+}
+
+// record appends the event to the capture file when it falls within the
+// configured bounds. Streamed events are recorded in the order they were
+// received, so the recording ends with the first event beyond the end LSN.
+func (r *streamRecorder) record(event recordedEvent) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.file == nil || r.done {
+		return nil
+	}
+
+	if !r.deadline.IsZero() && time.Now().After(r.deadline) {
+		r.done = true
+		return nil
+	}
+
+	if event.Lsn == nil {
+		if r.startLsn != 0 {
+			return nil
+		}
+	} else {
+		eventLsn, err := pglogrepl.ParseLSN(*event.Lsn)
+		if err != nil {
+			return err
+		}
+		if eventLsn < r.startLsn {
+			return nil
+		}
+		if r.endLsn != 0 && eventLsn > r.endLsn {
+			r.done = true
+			return nil
+		}
+	}
+
+	return r.enc.Encode(event)
+}
+
+func (r *streamRecorder) close() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
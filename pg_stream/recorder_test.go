@@ -0,0 +1,221 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderReplayRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	recorder := &streamRecorder{
+		path:     path,
+		startLsn: pglogrepl.LSN(0x20),
+		endLsn:   pglogrepl.LSN(0x40),
+	}
+	require.NoError(t, recorder.open())
+
+	lsn := func(s string) *string { return &s }
+	acks := &lsnAckTracker{record: func(event recordedEvent) {
+		require.NoError(t, recorder.record(event))
+	}}
+	require.NoError(t, recorder.record(recordedEvent{Payload: []byte(`{"snapshot":true}`)}))
+	var seqs []uint64
+	for i, l := range []string{"0/10", "0/20", "0/30", "0/50", "0/35"} {
+		seq := acks.track(l, true)
+		acks.attach(seq, recordedEvent{Lsn: lsn(l), Payload: []byte(fmt.Sprintf(`{"n":%d}`, i+1))})
+		seqs = append(seqs, seq)
+	}
+
+	// Events acknowledged out of order are recorded once released, in the
+	// order they were received, and acknowledging the event beyond the end
+	// LSN first doesn't drop the events before it.
+	for _, i := range []int{3, 2, 0, 1, 4} {
+		acks.ack(seqs[i])
+	}
+	require.NoError(t, recorder.close())
+
+	replay := &pgStreamReplayInput{path: path}
+	require.NoError(t, replay.Connect(context.Background()))
+	t.Cleanup(func() {
+		_ = replay.Close(context.Background())
+	})
+
+	var payloads []string
+	for {
+		msg, _, err := replay.Read(context.Background())
+		if err == service.ErrEndOfInput {
+			break
+		}
+		require.NoError(t, err)
+
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		payloads = append(payloads, string(b))
+	}
+
+	assert.Equal(t, []string{`{"n":2}`, `{"n":3}`}, payloads)
+}
+
+func TestRecorderKeepsBoundsAcrossReconnects(t *testing.T) {
+	recorder := &streamRecorder{
+		path:        filepath.Join(t.TempDir(), "capture.jsonl"),
+		maxDuration: time.Hour,
+	}
+	require.NoError(t, recorder.open())
+	file, deadline := recorder.file, recorder.deadline
+	recorder.done = true
+
+	require.NoError(t, recorder.open())
+	assert.Same(t, file, recorder.file)
+	assert.Equal(t, deadline, recorder.deadline)
+	assert.True(t, recorder.done)
+
+	// Reconnecting after a failed connect reopens the file only.
+	require.NoError(t, recorder.close())
+	require.NoError(t, recorder.open())
+	assert.NotNil(t, recorder.file)
+	assert.Equal(t, deadline, recorder.deadline)
+	require.NoError(t, recorder.close())
+}
+
+func TestRecorderRecordsAcknowledgedEventsOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	conf, err := pgStreamFakeConfigSpec.ParseYAML(`
+tables: [ users ]
+disconnect_every: 2
+transactions:
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}'
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[2]}]}'
+  - '{"change":[{"kind":"insert","schema":"public","table":"users","columnnames":["id"],"columntypes":["integer"],"columnvalues":[3]}]}'
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamFakeInput(conf, service.MockResources())
+	require.NoError(t, err)
+	input.recorder = &streamRecorder{path: path}
+
+	ctx := context.Background()
+	read := func() service.AckFunc {
+		_, ack, err := input.Read(ctx)
+		require.NoError(t, err)
+		return ack
+	}
+
+	require.NoError(t, input.Connect(ctx))
+	require.NoError(t, read()(ctx, nil))
+	_ = read()
+	_, _, err = input.Read(ctx)
+	require.ErrorIs(t, err, service.ErrNotConnected)
+
+	// The unacknowledged event is delivered again and recorded once.
+	require.NoError(t, input.Connect(ctx))
+	require.NoError(t, read()(ctx, nil))
+	require.NoError(t, read()(ctx, nil))
+	require.NoError(t, input.Close(ctx))
+
+	replay := &pgStreamReplayInput{path: path}
+	require.NoError(t, replay.Connect(ctx))
+	t.Cleanup(func() {
+		_ = replay.Close(ctx)
+	})
+
+	var ids []float64
+	for {
+		msg, _, err := replay.Read(ctx)
+		if err == service.ErrEndOfInput {
+			break
+		}
+		require.NoError(t, err)
+
+		var changes struct {
+			Change []struct {
+				ColumnValues []float64 `json:"columnvalues"`
+			} `json:"change"`
+		}
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(b, &changes))
+		ids = append(ids, changes.Change[0].ColumnValues[0])
+	}
+	assert.Equal(t, []float64{1, 2, 3}, ids)
+}
+
+func TestReplayPacingAndMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	recorder := &streamRecorder{path: path}
+	require.NoError(t, recorder.open())
+	committed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, lsn := range []string{"0/10", "0/20"} {
+		msg := service.NewMessage([]byte(fmt.Sprintf(`{"n":%d}`, i+1)))
+		msg.MetaSetMut("lsn", lsn)
+		msg.MetaSetMut("table", "users")
+		msg.MetaSetMut("operation", "insert")
+		msg.MetaSetMut("xid", "42")
+		b, err := msg.AsBytes()
+		require.NoError(t, err)
+		msg = recorder.capture(msg, &lsn, committed.Add(time.Duration(i)*time.Second), b)
+		event, ok := captured(msg)
+		require.True(t, ok)
+		require.NoError(t, recorder.record(event))
+	}
+	require.NoError(t, recorder.close())
+
+	replay := &pgStreamReplayInput{path: path, speed: 2}
+	require.NoError(t, replay.Connect(context.Background()))
+	// Reconnecting reads the capture from the start again.
+	require.NoError(t, replay.Connect(context.Background()))
+	t.Cleanup(func() {
+		_ = replay.Close(context.Background())
+	})
+
+	read := func() *service.Message {
+		msg, _, err := replay.Read(context.Background())
+		require.NoError(t, err)
+		return msg
+	}
+	first := read()
+	start := time.Now()
+	second := read()
+	// The commit timestamps are a second apart, replayed twice as fast.
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 500*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+
+	for i, msg := range []*service.Message{first, second} {
+		lsn, _ := msg.MetaGet("lsn")
+		assert.Equal(t, []string{"0/10", "0/20"}[i], lsn)
+		table, _ := msg.MetaGet("table")
+		assert.Equal(t, "users", table)
+		operation, _ := msg.MetaGet("operation")
+		assert.Equal(t, "insert", operation)
+		xid, _ := msg.MetaGet("xid")
+		assert.Equal(t, "42", xid)
+	}
+
+	_, _, err := replay.Read(context.Background())
+	require.ErrorIs(t, err, service.ErrEndOfInput)
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"timestamp":"2024-05-01T12:00:01Z"`)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+const relationColumnsQuery = `
+SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace ns ON ns.oid = c.relnamespace
+WHERE ns.nspname = $1
+  AND c.relname = ANY($2)
+  AND a.attnum > 0
+  AND NOT a.attisdropped
+ORDER BY c.relname, a.attnum`
+
+type relationColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// relationDescriptor describes the columns of a replicated table.
+type relationDescriptor struct {
+	Schema     string           `json:"schema"`
+	Table      string           `json:"table"`
+	Columns    []relationColumn `json:"columns"`
+	PrimaryKey []string         `json:"primary_key"`
+}
+
+// relationAnnouncer emits the descriptor of a table before its first event,
+// and again after the schema of the tables was refreshed.
+type relationAnnouncer struct {
+	descriptors map[string]relationDescriptor
+	announced   map[string]struct{}
+}
+
+func queryRelationDescriptors(ctx context.Context, db *sql.DB, schema string, tables []string, primaryKeys map[string][]string) (map[string]relationDescriptor, error) {
+	rows, err := db.QueryContext(ctx, relationColumnsQuery, schema, pq.Array(tables))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	descriptors := map[string]relationDescriptor{}
+	for rows.Next() {
+		var table string
+		var column relationColumn
+		if err := rows.Scan(&table, &column.Name, &column.Type, &column.Nullable); err != nil {
+			return nil, err
+		}
+		d, ok := descriptors[table]
+		if !ok {
+			d = relationDescriptor{Schema: schema, Table: table, PrimaryKey: primaryKeys[table]}
+		}
+		d.Columns = append(d.Columns, column)
+		descriptors[table] = d
+	}
+	return descriptors, rows.Err()
+}
+
+// reset replaces the known descriptors, which are announced again before the
+// next event of each table.
+func (r *relationAnnouncer) reset(descriptors map[string]relationDescriptor) {
+	r.descriptors = descriptors
+	r.announced = map[string]struct{}{}
+}
+
+// announce returns the descriptor messages of the tables of the changes that
+// weren't announced yet.
+func (r *relationAnnouncer) announce(changes []pglogicalstream.Wal2JsonChange) ([]*service.Message, error) {
+	var msgs []*service.Message
+	for _, change := range changes {
+		table := change.Table
+		if _, ok := r.announced[table]; ok {
+			continue
+		}
+		d, ok := r.descriptors[table]
+		if !ok {
+			continue
+		}
+
+		b, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		msg := service.NewMessage(b)
+		msg.MetaSetMut("event_type", "relation")
+		msg.MetaSetMut("table", table)
+		msgs = append(msgs, msg)
+		r.announced[table] = struct{}{}
+	}
+	return msgs, nil
+}
+
+// queryRelations loads the descriptors of the replicated tables.
+func (p *pgStreamInput) queryRelations(ctx context.Context) error {
+	descriptors, err := queryCatalog(ctx, p.catalogRetrier, "relations", func(ctx context.Context) (map[string]relationDescriptor, error) {
+		return queryRelationDescriptors(ctx, p.db, p.schema, p.tables, p.primaryKeys)
+	})
+	if err != nil {
+		return err
+	}
+	p.relations.reset(descriptors)
+	return nil
+}
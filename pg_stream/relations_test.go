@@ -0,0 +1,59 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestRelationAnnouncerAnnouncesEachTableOnce(t *testing.T) {
+	descriptors := map[string]relationDescriptor{
+		"orders": {
+			Schema:     "public",
+			Table:      "orders",
+			Columns:    []relationColumn{{Name: "id", Type: "integer"}, {Name: "note", Type: "text", Nullable: true}},
+			PrimaryKey: []string{"id"},
+		},
+	}
+	r := &relationAnnouncer{}
+	r.reset(descriptors)
+
+	msgs, err := r.announce([]pglogicalstream.Wal2JsonChange{
+		{Kind: "insert", Schema: "public", Table: "orders"},
+		{Kind: "update", Schema: "public", Table: "orders"},
+		{Kind: "insert", Schema: "public", Table: "unknown"},
+	})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	b, err := msgs[0].AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"schema": "public",
+		"table": "orders",
+		"columns": [{"name": "id", "type": "integer", "nullable": false}, {"name": "note", "type": "text", "nullable": true}],
+		"primary_key": ["id"]
+	}`, string(b))
+	eventType, _ := msgs[0].MetaGet("event_type")
+	assert.Equal(t, "relation", eventType)
+
+	msgs, err = r.announce([]pglogicalstream.Wal2JsonChange{{Kind: "insert", Schema: "public", Table: "orders"}})
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+
+	r.reset(descriptors)
+	msgs, err = r.announce([]pglogicalstream.Wal2JsonChange{{Kind: "delete", Schema: "public", Table: "orders"}})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var pgStreamReplayConfigSpec = service.NewConfigSpec().
+	Summary("Replays a capture file recorded by the `record` option of the pg_stream input").
+	Description("Events are emitted with the metadata they were recorded with, paced by their commit timestamps.").
+	Field(service.NewStringField("path").
+		Description("Capture file written by pg_stream").
+		Example("./capture.jsonl")).
+	Field(service.NewFloatField("speed").
+		Description("Replay speed relative to the original capture. `1` keeps the recorded pacing, `10` replays ten times faster and `0` emits events as fast as possible").
+		Example(10).
+		Default(1))
+
+func newPgStreamReplayInput(conf *service.ParsedConfig) (s service.Input, err error) {
+	var (
+		path  string
+		speed float64
+	)
+
+	path, err = conf.FieldString("path")
+	if err != nil {
+		return nil, err
+	}
+
+	speed, err = conf.FieldFloat("speed")
+	if err != nil {
+		return nil, err
+	}
+
+	return service.AutoRetryNacks(&pgStreamReplayInput{
+		path:  path,
+		speed: speed,
+	}), nil
+}
+
+func init() {
+	err := service.RegisterInput(
+		"pg_stream_replay", pgStreamReplayConfigSpec,
+		func(conf *service.ParsedConfig, mgr *service.Resources) (service.Input, error) {
+			return newPgStreamReplayInput(conf)
+		})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type pgStreamReplayInput struct {
+	path  string
+	speed float64
+
+	file    *os.File
+	scanner *bufio.Scanner
+	last    time.Time
+}
+
+func (p *pgStreamReplayInput) Connect(ctx context.Context) error {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	if p.file != nil {
+		_ = p.file.Close()
+	}
+	p.file = file
+	p.scanner = bufio.NewScanner(file)
+	p.scanner.Buffer(nil, 64*1024*1024)
+	p.last = time.Time{}
+	return nil
+}
+
+func (p *pgStreamReplayInput) Read(ctx context.Context) (*service.Message, service.AckFunc, error) {
+	if p.scanner == nil {
+		return nil, nil, service.ErrNotConnected
+	}
+
+	if !p.scanner.Scan() {
+		if err := p.scanner.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, service.ErrEndOfInput
+	}
+
+	var event recordedEvent
+	if err := json.Unmarshal(p.scanner.Bytes(), &event); err != nil {
+		return nil, nil, err
+	}
+
+	if p.speed > 0 && !p.last.IsZero() {
+		if wait := time.Duration(float64(event.Timestamp.Sub(p.last)) / p.speed); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+		}
+	}
+	p.last = event.Timestamp
+
+	msg := service.NewMessage(event.Payload)
+	for key, value := range event.Metadata {
+		msg.MetaSetMut(key, value)
+	}
+	return msg, func(ctx context.Context, err error) error {
+		return nil
+	}, nil
+}
+
+func (p *pgStreamReplayInput) Close(ctx context.Context) error {
+	if p.file != nil {
+		return p.file.Close()
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/lib/pq"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var reselectConfigFields = []*service.ConfigField{
+	service.NewStringListField("tables").
+		Description("Tables whose inserted and updated rows are re-selected").
+		Example([]string{"documents"}),
+	service.NewIntField("batch_size").
+		Description("The maximum number of rows re-selected per query. Rows of pending changes of the same table are re-selected along with the row being emitted").
+		Default(100),
+	service.NewStringField("rate_limit").
+		Description("An optional rate limit resource to throttle the re-select queries").
+		Optional(),
+}
+
+type reselectedRow struct {
+	// horizon is the LSN of the last change received before the row was
+	// re-selected. The row may predate changes received after it.
+	horizon pglogrepl.LSN
+	names   []string
+	types   []string
+	values  []interface{}
+}
+
+// rowReselector replaces inserted and updated rows with their current state,
+// queried by primary key. Tables without REPLICA IDENTITY FULL and rows with
+// unchanged TOAST values otherwise lack columns in update events.
+type rowReselector struct {
+	tables    map[string]struct{}
+	batchSize int
+	rateLimit string
+
+	// prefetched holds rows re-selected for pending changes, which are used
+	// once those changes are emitted.
+	prefetched map[string]reselectedRow
+	res        *service.Resources
+}
+
+func newRowReselectorFromParsed(conf *service.ParsedConfig, res *service.Resources) (r *rowReselector, err error) {
+	r = &rowReselector{
+		tables:     map[string]struct{}{},
+		prefetched: map[string]reselectedRow{},
+		res:        res,
+	}
+
+	var tables []string
+	if tables, err = conf.FieldStringList("tables"); err != nil {
+		return nil, err
+	}
+	for _, table := range tables {
+		r.tables[table] = struct{}{}
+	}
+	if r.batchSize, err = conf.FieldInt("batch_size"); err != nil {
+		return nil, err
+	}
+	if r.batchSize < 1 {
+		return nil, fmt.Errorf("reselect batch_size must be at least 1, got %d", r.batchSize)
+	}
+	if conf.Contains("rate_limit") {
+		if r.rateLimit, err = conf.FieldString("rate_limit"); err != nil {
+			return nil, err
+		}
+		if !res.HasRateLimit(r.rateLimit) {
+			return nil, fmt.Errorf("rate limit resource %q doesn't exist", r.rateLimit)
+		}
+	}
+	return r, nil
+}
+
+func (r *rowReselector) reset() {
+	r.prefetched = map[string]reselectedRow{}
+}
+
+func (r *rowReselector) reselects(change pglogicalstream.Wal2JsonChange) bool {
+	if change.Kind != "insert" && change.Kind != "update" {
+		return false
+	}
+	_, ok := r.tables[change.Table]
+	return ok
+}
+
+// reselectRows replaces the rows of the changes received at the LSN with their
+// current state. Rows that no longer exist are left as they are. Pending
+// changes of the same tables are re-selected in the same queries.
+func (p *pgStreamInput) reselectRows(ctx context.Context, lsn string, changes []pglogicalstream.Wal2JsonChange) error {
+	r := p.reselect
+	changeLSN, err := pglogrepl.ParseLSN(lsn)
+	if err != nil {
+		return fmt.Errorf("failed to parse LSN of changes: %w", err)
+	}
+	for i := range changes {
+		c := &changes[i]
+		if !r.reselects(*c) {
+			continue
+		}
+		keyColumns, ok := p.primaryKeys[c.Table]
+		if !ok {
+			continue
+		}
+
+		key := reselectKey(c.Table, keyColumns, c.ColumnNames, c.ColumnValues)
+		if key == "" {
+			continue
+		}
+		row, ok := r.prefetched[key]
+		if !ok || row.horizon < changeLSN {
+			if err := p.prefetchRows(ctx, changeLSN, *c, keyColumns); err != nil {
+				return err
+			}
+			if row, ok = r.prefetched[key]; !ok {
+				continue
+			}
+		}
+		delete(r.prefetched, key)
+
+		types := make([]string, len(row.names))
+		for j, name := range row.names {
+			types[j] = row.types[j]
+			for k, original := range c.ColumnNames {
+				if original == name && k < len(c.ColumnTypes) {
+					types[j] = c.ColumnTypes[k]
+				}
+			}
+		}
+		c.ColumnNames, c.ColumnTypes, c.ColumnValues = row.names, types, row.values
+	}
+	return nil
+}
+
+// prefetchRows re-selects the row of the change along with the rows of pending
+// changes of the same table, up to the batch size.
+func (p *pgStreamInput) prefetchRows(ctx context.Context, changeLSN pglogrepl.LSN, change pglogicalstream.Wal2JsonChange, keyColumns []string) error {
+	r := p.reselect
+	// Rows prefetched for changes that were dropped before being emitted
+	// can't be used for later changes.
+	for key, row := range r.prefetched {
+		if row.horizon < changeLSN {
+			delete(r.prefetched, key)
+		}
+	}
+
+	keys := map[string][]interface{}{}
+	addKey := func(c pglogicalstream.Wal2JsonChange) {
+		values := make([]interface{}, len(keyColumns))
+		for i, column := range keyColumns {
+			v, _ := columnValue(c.ColumnNames, c.ColumnValues, column)
+			values[i] = keyValueString(v)
+		}
+		keys[reselectKey(c.Table, keyColumns, c.ColumnNames, c.ColumnValues)] = values
+	}
+	addKey(change)
+	horizon := changeLSN
+	for _, pending := range p.backlog.queue {
+		if pending.Lsn != nil {
+			if lsn, err := pglogrepl.ParseLSN(*pending.Lsn); err == nil && lsn > horizon {
+				horizon = lsn
+			}
+		}
+		for _, c := range pending.Changes {
+			if len(keys) >= r.batchSize {
+				break
+			}
+			if c.Table == change.Table && r.reselects(c) {
+				if key := reselectKey(c.Table, keyColumns, c.ColumnNames, c.ColumnValues); key != "" {
+					addKey(c)
+				}
+			}
+		}
+	}
+
+	if err := r.waitForRateLimit(ctx); err != nil {
+		return err
+	}
+
+	quotedKeys := make([]string, len(keyColumns))
+	for i, column := range keyColumns {
+		quotedKeys[i] = pq.QuoteIdentifier(column)
+	}
+	var tuples []string
+	var args []interface{}
+	for _, values := range keys {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		tuples = append(tuples, "("+strings.Join(placeholders, ", ")+")")
+	}
+	query := fmt.Sprintf("SELECT * FROM %s.%s WHERE (%s) IN (%s)",
+		pq.QuoteIdentifier(p.schema), pq.QuoteIdentifier(change.Table),
+		strings.Join(quotedKeys, ", "), strings.Join(tuples, ", "))
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to re-select rows of %s: %w", change.Table, err)
+	}
+	defer rows.Close()
+
+	names, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	types := make([]string, len(columnTypes))
+	for i, t := range columnTypes {
+		types[i] = strings.ToLower(t.DatabaseTypeName())
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(names))
+		scanArgs := make([]interface{}, len(names))
+		for i := range values {
+			scanArgs[i] = &values[i]
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, isBytes := v.([]byte); isBytes {
+				values[i] = string(b)
+			}
+		}
+		r.prefetched[reselectKey(change.Table, keyColumns, names, values)] = reselectedRow{horizon: horizon, names: names, types: types, values: values}
+	}
+	return rows.Err()
+}
+
+func (r *rowReselector) waitForRateLimit(ctx context.Context) error {
+	return waitForRateLimit(ctx, r.res, r.rateLimit)
+}
+
+// waitForRateLimit waits until the rate limit resource grants access, an
+// empty name means no rate limit.
+func waitForRateLimit(ctx context.Context, res *service.Resources, name string) error {
+	if name == "" {
+		return nil
+	}
+	for {
+		var wait time.Duration
+		var err error
+		if aerr := res.AccessRateLimit(ctx, name, func(rl service.RateLimit) {
+			wait, err = rl.Access(ctx)
+		}); aerr != nil {
+			return aerr
+		}
+		if err != nil {
+			return err
+		}
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reselectKey identifies a row by the values of its key columns. Values of
+// changes are decoded from JSON whereas re-selected values are scanned, so
+// they are formatted the same way regardless of their Go type.
+func reselectKey(table string, columns, names []string, values []interface{}) string {
+	var b strings.Builder
+	b.WriteString(table)
+	for _, column := range columns {
+		v, ok := columnValue(names, values, column)
+		if !ok || v == nil {
+			return ""
+		}
+		b.WriteByte(0)
+		b.WriteString(keyValueString(v))
+	}
+	return b.String()
+}
+
+func keyValueString(v interface{}) string {
+	switch t := v.(type) {
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
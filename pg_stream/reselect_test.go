@@ -0,0 +1,40 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestReselectKeyMatchesScannedValues(t *testing.T) {
+	columns := []string{"tenant", "id"}
+	decoded := reselectKey("docs", columns, []string{"id", "body", "tenant"}, []interface{}{float64(1000000), "x", "a"})
+	numbers := reselectKey("docs", columns, []string{"id", "tenant"}, []interface{}{json.Number("1000000"), "a"})
+	scanned := reselectKey("docs", columns, []string{"tenant", "id"}, []interface{}{"a", int64(1000000)})
+
+	assert.NotEmpty(t, decoded)
+	assert.Equal(t, decoded, scanned)
+	assert.Equal(t, numbers, scanned)
+	assert.Empty(t, reselectKey("docs", columns, []string{"id"}, []interface{}{int64(1)}))
+	assert.Empty(t, reselectKey("docs", columns, []string{"id", "tenant"}, []interface{}{int64(1), nil}))
+}
+
+func TestReselectsInsertsAndUpdatesOfTables(t *testing.T) {
+	r := &rowReselector{tables: map[string]struct{}{"docs": {}}}
+
+	assert.True(t, r.reselects(pglogicalstream.Wal2JsonChange{Kind: "insert", Table: "docs"}))
+	assert.True(t, r.reselects(pglogicalstream.Wal2JsonChange{Kind: "update", Table: "docs"}))
+	assert.False(t, r.reselects(pglogicalstream.Wal2JsonChange{Kind: "delete", Table: "docs"}))
+	assert.False(t, r.reselects(pglogicalstream.Wal2JsonChange{Kind: "update", Table: "other"}))
+}
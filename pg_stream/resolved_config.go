@@ -0,0 +1,92 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// resolvedConfig is the configuration the input streams with once defaults,
+// sharding and plugin option overrides are applied.
+type resolvedConfig struct {
+	Host                  string            `json:"host"`
+	Database              string            `json:"database"`
+	Schema                string            `json:"schema"`
+	Tables                []string          `json:"tables"`
+	Slot                  string            `json:"slot"`
+	Publication           string            `json:"publication"`
+	Decoder               string            `json:"decoder"`
+	PluginOptions         map[string]string `json:"plugin_options"`
+	StreamSnapshot        bool              `json:"stream_snapshot"`
+	SnapshotOrder         string            `json:"snapshot_order"`
+	SnapshotPlanning      string            `json:"snapshot_planning"`
+	SeparateChanges       bool              `json:"separate_changes"`
+	TransactionBoundaries bool              `json:"transaction_boundaries"`
+	UpdatePayload         string            `json:"update_payload"`
+	JSONNumbers           string            `json:"json_numbers"`
+	NonFiniteFloats       string            `json:"non_finite_floats"`
+	Checksum              string            `json:"checksum"`
+}
+
+func (p *pgStreamInput) resolvedConfig() resolvedConfig {
+	slot := fmt.Sprintf("rs_%s", p.slotName)
+	return resolvedConfig{
+		Host:                  p.dbConfig.Host,
+		Database:              p.dbConfig.Database,
+		Schema:                p.schema,
+		Tables:                p.tables,
+		Slot:                  slot,
+		Publication:           pglogicalstream.PublicationName(slot),
+		Decoder:               "wal2json",
+		PluginOptions:         pglogicalstream.ResolvePluginOptions(p.pluginOptions),
+		StreamSnapshot:        p.streamSnapshot,
+		SnapshotOrder:         p.snapshotOrder,
+		SnapshotPlanning:      p.snapshotPlanning,
+		SeparateChanges:       p.separateChanges,
+		TransactionBoundaries: p.transactionBoundaries,
+		UpdatePayload:         string(p.updatePayload),
+		JSONNumbers:           string(p.numbers),
+		NonFiniteFloats:       string(p.nonFiniteFloats),
+		Checksum:              string(p.checksum),
+	}
+}
+
+// logResolvedConfig logs the resolved configuration with structured fields,
+// and queues it as a message when enabled.
+func (p *pgStreamInput) logResolvedConfig() error {
+	c := p.resolvedConfig()
+	p.logger.With(
+		"schema", c.Schema,
+		"tables", c.Tables,
+		"slot", c.Slot,
+		"publication", c.Publication,
+		"decoder", c.Decoder,
+		"plugin_options", c.PluginOptions,
+		"separate_changes", c.SeparateChanges,
+		"update_payload", c.UpdatePayload,
+		"json_numbers", c.JSONNumbers,
+	).Info("Resolved replication configuration")
+
+	if !p.emitResolvedConfig {
+		return nil
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "resolved_config")
+	p.controlMessages = append([]*service.Message{msg}, p.controlMessages...)
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestResolvedConfig(t *testing.T) {
+	conf, err := pgStreamConfigSpec.ParseYAML(`
+host: localhost
+user: postgres
+password: secret
+database: shop
+schema: public
+tables: [ orders ]
+slot_name: shop
+slot_guard: false
+emit_resolved_config: true
+checksum: sha256
+`, nil)
+	require.NoError(t, err)
+	input, err := newPgStreamInput(conf, service.MockResources())
+	require.NoError(t, err)
+
+	script := &pglogicalstream.FakeScript{Transactions: []string{
+		`{"change":[{"kind":"insert","schema":"public","table":"orders","columnnames":["id"],"columntypes":["integer"],"columnvalues":[1]}]}`,
+	}}
+	input.newSource = script.Source
+
+	ctx := context.Background()
+	require.NoError(t, input.Connect(ctx))
+	t.Cleanup(func() { _ = input.Close(ctx) })
+
+	// The resolved configuration is the first message.
+	msg, ack, err := input.Read(ctx)
+	require.NoError(t, err)
+	eventType, _ := msg.MetaGet("event_type")
+	assert.Equal(t, "resolved_config", eventType)
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "secret")
+
+	var resolved resolvedConfig
+	require.NoError(t, json.Unmarshal(b, &resolved))
+	assert.Equal(t, input.resolvedConfig(), resolved)
+	assert.Equal(t, "localhost", resolved.Host)
+	assert.Equal(t, []string{"orders"}, resolved.Tables)
+	assert.Equal(t, "rs_shop", resolved.Slot)
+	assert.Equal(t, pglogicalstream.PublicationName("rs_shop"), resolved.Publication)
+	assert.Equal(t, "sha256", resolved.Checksum)
+	require.NoError(t, ack(ctx, nil))
+
+	msg, ack, err = input.Read(ctx)
+	require.NoError(t, err)
+	table, _ := msg.MetaGet("table")
+	assert.Equal(t, "orders", table)
+	require.NoError(t, ack(ctx, nil))
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var samplingConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table the sampling applies to").
+		Example("metrics"),
+	service.NewFloatField("rate").
+		Description("The fraction of changes of the table that are emitted, between 0 and 1").
+		Example(0.01).
+		Default(1.0),
+	service.NewDurationField("per_key_interval").
+		Description("Emit at most one change per key within this interval. Changes that pass the interval are still subject to `rate`").
+		Example("1m").
+		Optional(),
+	service.NewStringListField("key_columns").
+		Description("The columns identifying a key for `per_key_interval`").
+		Example([]string{"device_id"}).
+		Default([]any{}),
+	service.NewIntField("max_keys").
+		Description("The maximum number of keys whose last emission is remembered for `per_key_interval`, the least recently seen keys are forgotten first").
+		Default(10000),
+}
+
+type tableSampler struct {
+	rate        float64
+	keyInterval time.Duration
+	keyColumns  []string
+	lastEmitted *lru.Cache[string, time.Time]
+}
+
+// changeSampler emits a sample of the changes of high volume tables. Changes
+// that are sampled out are acknowledged so the slot keeps advancing.
+type changeSampler struct {
+	tables     map[string]*tableSampler
+	sampledOut *service.MetricCounter
+}
+
+func newChangeSamplerFromParsed(confs []*service.ParsedConfig, metrics *service.Metrics) (*changeSampler, error) {
+	s := &changeSampler{
+		tables:     map[string]*tableSampler{},
+		sampledOut: metrics.NewCounter("pg_stream_sampled_out"),
+	}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		ts := &tableSampler{}
+		if ts.rate, err = conf.FieldFloat("rate"); err != nil {
+			return nil, err
+		}
+		if ts.rate < 0 || ts.rate > 1 {
+			return nil, fmt.Errorf("sampling rate of table %s must be between 0 and 1, got %v", table, ts.rate)
+		}
+		if conf.Contains("per_key_interval") {
+			if ts.keyInterval, err = conf.FieldDuration("per_key_interval"); err != nil {
+				return nil, err
+			}
+			if ts.keyColumns, err = conf.FieldStringList("key_columns"); err != nil {
+				return nil, err
+			}
+			if len(ts.keyColumns) == 0 {
+				return nil, errors.New("sampling with a per_key_interval requires key_columns")
+			}
+			var maxKeys int
+			if maxKeys, err = conf.FieldInt("max_keys"); err != nil {
+				return nil, err
+			}
+			if ts.lastEmitted, err = lru.New[string, time.Time](maxKeys); err != nil {
+				return nil, err
+			}
+		}
+		s.tables[table] = ts
+	}
+	return s, nil
+}
+
+// sample returns false when the changes should be skipped. Changes spanning
+// several tables are kept if any of them is.
+func (s *changeSampler) sample(changes []pglogicalstream.Wal2JsonChange, now time.Time) bool {
+	for _, change := range changes {
+		ts, ok := s.tables[change.Table]
+		if !ok || ts.sample(change, now) {
+			return true
+		}
+	}
+	if len(changes) == 0 {
+		return true
+	}
+	s.sampledOut.Incr(1)
+	return false
+}
+
+func (ts *tableSampler) sample(change pglogicalstream.Wal2JsonChange, now time.Time) bool {
+	if ts.lastEmitted != nil {
+		key := ts.key(change)
+		if last, ok := ts.lastEmitted.Get(key); ok && now.Sub(last) < ts.keyInterval {
+			return false
+		}
+		if ts.rate < 1 && rand.Float64() >= ts.rate {
+			return false
+		}
+		ts.lastEmitted.Add(key, now)
+		return true
+	}
+	return ts.rate >= 1 || rand.Float64() < ts.rate
+}
+
+func (ts *tableSampler) key(change pglogicalstream.Wal2JsonChange) string {
+	parts := make([]string, len(ts.keyColumns))
+	for i, column := range ts.keyColumns {
+		if v, ok := columnValue(change.ColumnNames, change.ColumnValues, column); ok {
+			parts[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
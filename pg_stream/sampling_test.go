@@ -0,0 +1,55 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestChangeSamplerPerKeyInterval(t *testing.T) {
+	spec := service.NewConfigSpec().Field(service.NewObjectListField("sampling", samplingConfigFields...))
+	conf, err := spec.ParseYAML(`
+sampling:
+  - table: metrics
+    per_key_interval: 1m
+    key_columns: [ device_id ]
+  - table: dropped
+    rate: 0
+`, nil)
+	require.NoError(t, err)
+	samplingConfs, err := conf.FieldObjectList("sampling")
+	require.NoError(t, err)
+	sampler, err := newChangeSamplerFromParsed(samplingConfs, service.MockResources().Metrics())
+	require.NoError(t, err)
+
+	change := func(table string, device string) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{
+			Kind:         "insert",
+			Table:        table,
+			ColumnNames:  []string{"device_id", "value"},
+			ColumnValues: []interface{}{device, float64(1)},
+		}}
+	}
+
+	now := time.Now()
+	assert.True(t, sampler.sample(change("metrics", "a"), now))
+	assert.False(t, sampler.sample(change("metrics", "a"), now.Add(30*time.Second)))
+	assert.True(t, sampler.sample(change("metrics", "b"), now.Add(30*time.Second)))
+	assert.True(t, sampler.sample(change("metrics", "a"), now.Add(time.Minute)))
+
+	assert.False(t, sampler.sample(change("dropped", "a"), now))
+	assert.True(t, sampler.sample(change("other", "a"), now))
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/hex"
+
+	"github.com/OneOfOne/xxhash"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// schemaFingerprint hashes the column names and types of the first inserted
+// or updated row of the changes. Deleted rows only hold their key columns and
+// have no fingerprint.
+func schemaFingerprint(changes []pglogicalstream.Wal2JsonChange) (string, bool) {
+	for _, change := range changes {
+		if change.Kind == "delete" || len(change.ColumnNames) == 0 {
+			continue
+		}
+
+		h := xxhash.New64()
+		for i, name := range change.ColumnNames {
+			_, _ = h.WriteString(name)
+			_, _ = h.Write([]byte{0})
+			if i < len(change.ColumnTypes) {
+				_, _ = h.WriteString(change.ColumnTypes[i])
+			}
+			_, _ = h.Write([]byte{0})
+		}
+		return hex.EncodeToString(h.Sum(nil)), true
+	}
+	return "", false
+}
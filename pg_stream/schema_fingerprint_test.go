@@ -0,0 +1,40 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestSchemaFingerprint(t *testing.T) {
+	change := func(kind string, names, types []string, values ...interface{}) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{Kind: kind, Table: "orders", ColumnNames: names, ColumnTypes: types, ColumnValues: values}}
+	}
+
+	insert, ok := schemaFingerprint(change("insert", []string{"id", "note"}, []string{"integer", "text"}, 1, "a"))
+	require.True(t, ok)
+	update, ok := schemaFingerprint(change("update", []string{"id", "note"}, []string{"integer", "text"}, 2, "b"))
+	require.True(t, ok)
+	assert.Equal(t, insert, update, "values don't change the fingerprint")
+
+	retyped, _ := schemaFingerprint(change("update", []string{"id", "note"}, []string{"bigint", "text"}, 2, "b"))
+	assert.NotEqual(t, insert, retyped)
+	added, _ := schemaFingerprint(change("update", []string{"id", "note", "extra"}, []string{"integer", "text", "text"}, 2, "b", "c"))
+	assert.NotEqual(t, insert, added)
+	renamed, _ := schemaFingerprint(change("update", []string{"idn", "ote"}, []string{"integer", "text"}, 2, "b"))
+	assert.NotEqual(t, insert, renamed)
+
+	_, ok = schemaFingerprint(change("delete", nil, nil, 1))
+	assert.False(t, ok)
+}
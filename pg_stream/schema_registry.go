@@ -0,0 +1,203 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRegistryClient registers schemas with a Confluent compatible schema
+// registry, such as the one of Redpanda.
+type schemaRegistryClient struct {
+	url      *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	mut sync.Mutex
+	// ids caches the ids of the schemas registered per subject.
+	ids map[string]map[string]int
+	// compatibility holds the subjects whose compatibility level was handled.
+	compatibility map[string]struct{}
+}
+
+func newSchemaRegistryClient(u *url.URL, username, password string, timeout time.Duration) *schemaRegistryClient {
+	return &schemaRegistryClient{
+		url:           u,
+		username:      username,
+		password:      password,
+		client:        &http.Client{Timeout: timeout},
+		ids:           map[string]map[string]int{},
+		compatibility: map[string]struct{}{},
+	}
+}
+
+// schemaRegistryError is the error document of the schema registry API.
+type schemaRegistryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+func (e *schemaRegistryError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.ErrorCode)
+}
+
+// schemaRegistrySubjectNotFound is the error code of unknown subjects.
+const schemaRegistrySubjectNotFound = 40401
+
+// do sends a request to the path, which may hold a query, with body encoded
+// as JSON unless it is nil.
+func (c *schemaRegistryClient) do(ctx context.Context, method, path string, body, out any) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	path, query, _ := strings.Cut(path, "?")
+	u := c.url.JoinPath(path)
+	u.RawQuery = query
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var regErr schemaRegistryError
+		if json.Unmarshal(respBody, &regErr) == nil && regErr.Message != "" {
+			return fmt.Errorf("schema registry request %s %s failed with status %d: %w", method, u.Path, resp.StatusCode, &regErr)
+		}
+		return fmt.Errorf("schema registry request %s %s failed with status %d: %s", method, u.Path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// setCompatibility sets the compatibility level of the subject when it has no
+// versions yet, once per subject. The level of existing subjects is left as
+// it is configured in the registry.
+func (c *schemaRegistryClient) setCompatibility(ctx context.Context, subject, level string) error {
+	c.mut.Lock()
+	_, done := c.compatibility[subject]
+	c.mut.Unlock()
+	if done {
+		return nil
+	}
+	exists, err := c.subjectExists(ctx, subject)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := c.do(ctx, http.MethodPut, "/config/"+url.PathEscape(subject), map[string]string{"compatibility": level}, nil); err != nil {
+			return err
+		}
+	}
+	c.mut.Lock()
+	c.compatibility[subject] = struct{}{}
+	c.mut.Unlock()
+	return nil
+}
+
+// subjectExists returns whether the subject has registered versions.
+func (c *schemaRegistryClient) subjectExists(ctx context.Context, subject string) (bool, error) {
+	var versions []int
+	if err := c.do(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions", nil, &versions); err != nil {
+		var regErr *schemaRegistryError
+		if errors.As(err, &regErr) && regErr.ErrorCode == schemaRegistrySubjectNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read the versions of subject %s: %w", subject, err)
+	}
+	return len(versions) > 0, nil
+}
+
+// register registers the schema under the subject, as a new version when it
+// differs from the registered ones, and returns its id. The registry rejects
+// schemas that break the compatibility level of the subject.
+func (c *schemaRegistryClient) register(ctx context.Context, subject, schema string) (int, error) {
+	c.mut.Lock()
+	id, ok := c.ids[subject][schema]
+	c.mut.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.do(ctx, http.MethodPost, path, map[string]string{"schema": schema}, &resp); err != nil {
+		return 0, fmt.Errorf("failed to register the schema of subject %s: %w", subject, err)
+	}
+
+	c.mut.Lock()
+	if c.ids[subject] == nil {
+		c.ids[subject] = map[string]int{}
+	}
+	c.ids[subject][schema] = resp.ID
+	c.mut.Unlock()
+	return resp.ID, nil
+}
+
+// checkCompatibility tests the schema against the latest version of the
+// subject with its compatibility level, and returns the reasons it is
+// incompatible. Subjects without versions accept any schema.
+func (c *schemaRegistryClient) checkCompatibility(ctx context.Context, subject, schema string) (compatible bool, messages []string, err error) {
+	var resp struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest?verbose=true"
+	if err := c.do(ctx, http.MethodPost, path, map[string]string{"schema": schema}, &resp); err != nil {
+		var regErr *schemaRegistryError
+		if errors.As(err, &regErr) && regErr.ErrorCode == schemaRegistrySubjectNotFound {
+			return true, nil, nil
+		}
+		return false, nil, fmt.Errorf("failed to check the compatibility of subject %s: %w", subject, err)
+	}
+	return resp.IsCompatible, resp.Messages, nil
+}
+
+// latestSchema returns the latest schema registered under the subject.
+func (c *schemaRegistryClient) latestSchema(ctx context.Context, subject string) (string, error) {
+	var resp struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to read the latest schema of subject %s: %w", subject, err)
+	}
+	return resp.Schema, nil
+}
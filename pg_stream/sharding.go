@@ -0,0 +1,194 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/jackc/pglogrepl"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var shardingConfigFields = []*service.ConfigField{
+	service.NewIntField("count").
+		Description("The number of pipeline replicas the tables are split across").
+		Example(4),
+	service.NewIntField("index").
+		Description("The shard of this replica, from 0 to `count - 1`. With a Kubernetes StatefulSet it can be set from the pod ordinal through an environment variable").
+		Example("${POD_ORDINAL}"),
+	service.NewDurationField("lease").
+		Description("How long the membership of a replica in its shard lasts without being renewed, when a `checkpoint` backend is set. Replicas renew it every third of the lease while connected and release it when closed").
+		Default("30s"),
+}
+
+// tableShard selects the subset of the configured tables streamed by one of
+// several pipeline replicas. Tables are assigned by a hash of their name, so
+// the assignment of a table doesn't change when other tables are added.
+type tableShard struct {
+	count int
+	index int
+	lease time.Duration
+}
+
+func newTableShardFromParsed(conf *service.ParsedConfig) (s tableShard, err error) {
+	if s.count, err = conf.FieldInt("count"); err != nil {
+		return s, err
+	}
+	if s.index, err = conf.FieldInt("index"); err != nil {
+		return s, err
+	}
+	if s.lease, err = conf.FieldDuration("lease"); err != nil {
+		return s, err
+	}
+	if s.count < 1 {
+		return s, fmt.Errorf("shard count must be at least 1, got %d", s.count)
+	}
+	if s.index < 0 || s.index >= s.count {
+		return s, fmt.Errorf("shard index must be between 0 and %d, got %d", s.count-1, s.index)
+	}
+	if s.lease <= 0 {
+		return s, fmt.Errorf("shard lease must be positive, got %v", s.lease)
+	}
+	return s, nil
+}
+
+func (s tableShard) owns(table string) bool {
+	return xxhash.ChecksumString64(table)%uint64(s.count) == uint64(s.index)
+}
+
+// tables returns the tables of the shard, in their configured order.
+func (s tableShard) tables(tables []string) []string {
+	var owned []string
+	for _, table := range tables {
+		if s.owns(table) {
+			owned = append(owned, table)
+		}
+	}
+	return owned
+}
+
+// slotName returns the name of the slot of the shard. Every shard streams its
+// tables from its own slot.
+func (s tableShard) slotName(slotName string) string {
+	return fmt.Sprintf("%s_shard%d", slotName, s.index)
+}
+
+// shardMembership registers the replica streaming a shard in the checkpoint
+// backend, so that a second replica deployed with the same index is detected
+// rather than both streaming the slot of the shard. Memberships are leases
+// stored under a key of their own, renewed while the replica is connected and
+// released when it closes.
+//
+// Backends may only store LSNs, and only let them move forward, so a
+// membership is stored as the LSN holding the time it was renewed at in its
+// upper 32 bits and the id of the replica in its lower ones. A released
+// membership has the id 0.
+type shardMembership struct {
+	index int
+	key   string
+	lease time.Duration
+	id    uint32
+
+	renewed time.Time
+}
+
+func newShardMembership(shard tableShard, checkpointKey string) *shardMembership {
+	return &shardMembership{
+		index: shard.index,
+		key:   checkpointKey + "_member",
+		lease: shard.lease,
+		id:    rand.Uint32()>>1 + 1,
+	}
+}
+
+func encodeShardMember(at time.Time, id uint32) string {
+	return pglogrepl.LSN(uint64(at.Unix())<<32 | uint64(id)).String()
+}
+
+func decodeShardMember(value string) (at time.Time, id uint32, err error) {
+	if value == "" {
+		return time.Time{}, 0, nil
+	}
+	lsn, err := pglogrepl.ParseLSN(value)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to parse the membership of shard: %w", err)
+	}
+	return time.Unix(int64(lsn>>32), 0), uint32(lsn), nil
+}
+
+// held returns an error when another replica holds the membership of the
+// shard.
+func (m *shardMembership) held(ctx context.Context, checkpointer Checkpointer) error {
+	value, err := checkpointer.Get(ctx, m.key)
+	if err != nil {
+		return fmt.Errorf("failed to read the membership of shard %d: %w", m.index, err)
+	}
+	at, id, err := decodeShardMember(value)
+	if err != nil {
+		return err
+	}
+	if id != 0 && id != m.id && time.Since(at) < m.lease {
+		return fmt.Errorf("shard %d is held by another replica, renewed at %v, check that the sharding index of every replica is unique", m.index, at.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// join takes the membership of the shard, unless another replica holds it.
+func (m *shardMembership) join(ctx context.Context, checkpointer Checkpointer) error {
+	if err := m.held(ctx, checkpointer); err != nil {
+		return err
+	}
+	return m.renew(ctx, checkpointer)
+}
+
+// renew stores the membership and reads it back, so that of replicas joining
+// at the same time only the one whose write won keeps the shard.
+func (m *shardMembership) renew(ctx context.Context, checkpointer Checkpointer) error {
+	now := time.Now()
+	if err := checkpointer.Set(ctx, m.key, encodeShardMember(now, m.id)); err != nil {
+		return fmt.Errorf("failed to store the membership of shard %d: %w", m.index, err)
+	}
+	if err := m.held(ctx, checkpointer); err != nil {
+		return err
+	}
+	m.renewed = now
+	return nil
+}
+
+// nextRenewal returns when the membership is renewed next.
+func (m *shardMembership) nextRenewal() time.Time {
+	return m.renewed.Add(m.lease / 3)
+}
+
+// check renews the membership once a third of the lease elapsed, and returns
+// an error when another replica took the shard over meanwhile.
+func (m *shardMembership) check(ctx context.Context, checkpointer Checkpointer) error {
+	if time.Now().Before(m.nextRenewal()) {
+		return nil
+	}
+	if err := m.held(ctx, checkpointer); err != nil {
+		return err
+	}
+	return m.renew(ctx, checkpointer)
+}
+
+// leave releases the membership so that a replacement replica can join right
+// away. Backends that ignore the release, as it was renewed in the same
+// second, let it expire with the lease instead.
+func (m *shardMembership) leave(ctx context.Context, checkpointer Checkpointer) error {
+	if m.renewed.IsZero() {
+		return nil
+	}
+	m.renewed = time.Time{}
+	return checkpointer.Set(ctx, m.key, encodeShardMember(time.Now(), 0))
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableShardsSplitTables(t *testing.T) {
+	var tables []string
+	for i := 0; i < 50; i++ {
+		tables = append(tables, fmt.Sprintf("table_%d", i))
+	}
+
+	seen := map[string]int{}
+	for index := 0; index < 3; index++ {
+		shard := tableShard{count: 3, index: index}
+		owned := shard.tables(tables)
+		assert.NotEmpty(t, owned)
+		for _, table := range owned {
+			seen[table]++
+		}
+		assert.Equal(t, fmt.Sprintf("cdc_shard%d", index), shard.slotName("cdc"))
+	}
+	assert.Len(t, seen, len(tables))
+	for table, n := range seen {
+		assert.Equal(t, 1, n, table)
+	}
+
+	// Adding tables doesn't move existing ones.
+	shard := tableShard{count: 3, index: 1}
+	assert.Equal(t, shard.tables(tables), shard.tables(append(tables, "extra"))[:len(shard.tables(tables))])
+}
+
+func TestTableShardValidation(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(shardingConfigFields...)
+
+	conf, err := spec.ParseYAML("count: 2\nindex: 2", nil)
+	require.NoError(t, err)
+	_, err = newTableShardFromParsed(conf)
+	assert.Error(t, err)
+
+	conf, err = spec.ParseYAML("count: 2\nindex: 1", nil)
+	require.NoError(t, err)
+	shard, err := newTableShardFromParsed(conf)
+	require.NoError(t, err)
+	assert.Equal(t, tableShard{count: 2, index: 1, lease: 30 * time.Second}, shard)
+}
+
+func TestShardMembership(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryCheckpointer{lsns: map[string]string{}}
+	shard := tableShard{count: 2, index: 1, lease: 30 * time.Second}
+	first := newShardMembership(shard, "cdc_shard1")
+	second := newShardMembership(shard, "cdc_shard1")
+	require.NotEqual(t, first.id, second.id)
+
+	// A replica deployed with the index of a connected one fails to join.
+	require.NoError(t, first.join(ctx, store))
+	assert.ErrorContains(t, second.join(ctx, store), "shard 1 is held by another replica")
+	// Reconnecting keeps the membership.
+	require.NoError(t, first.join(ctx, store))
+
+	// A released membership can be taken right away.
+	require.NoError(t, first.leave(ctx, store))
+	require.NoError(t, second.join(ctx, store))
+
+	// A replica whose shard was taken over stops when renewing.
+	first.renewed = time.Now().Add(-time.Minute)
+	assert.ErrorContains(t, first.check(ctx, store), "shard 1 is held by another replica")
+
+	// An expired membership can be taken.
+	require.NoError(t, store.Set(ctx, "cdc_shard1_member", encodeShardMember(time.Now().Add(-time.Minute), second.id)))
+	require.NoError(t, first.join(ctx, store))
+
+	at, id, err := decodeShardMember(store.lsns["cdc_shard1_member"])
+	require.NoError(t, err)
+	assert.Equal(t, first.id, id)
+	assert.WithinDuration(t, time.Now(), at, 2*time.Second)
+}
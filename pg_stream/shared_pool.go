@@ -0,0 +1,97 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var sharedPoolConfigFields = []*service.ConfigField{
+	service.NewStringField("name").
+		Description("Inputs that reference the same pool name share one set of SQL connections. They must connect to the same server, database and user"),
+	service.NewIntField("max_connections").
+		Description("The maximum number of SQL connections open in the pool. The first input to open the pool sets the limit").
+		Default(2),
+}
+
+type sharedPoolConfig struct {
+	name           string
+	maxConnections int
+}
+
+func newSharedPoolConfigFromParsed(conf *service.ParsedConfig) (c sharedPoolConfig, err error) {
+	if c.name, err = conf.FieldString("name"); err != nil {
+		return c, err
+	}
+	if c.maxConnections, err = conf.FieldInt("max_connections"); err != nil {
+		return c, err
+	}
+	if c.maxConnections < 1 {
+		return c, fmt.Errorf("max_connections must be at least 1, got %d", c.maxConnections)
+	}
+	return c, nil
+}
+
+type sharedPool struct {
+	db      *sql.DB
+	connStr string
+	refs    int
+}
+
+var (
+	sharedPoolsMut sync.Mutex
+	sharedPools    = map[string]*sharedPool{}
+)
+
+// acquireSharedPool returns the named pool, opening it on first use. Every
+// successful call must be paired with releaseSharedPool, the pool is closed
+// once the last input releases it.
+func acquireSharedPool(conf sharedPoolConfig, dbConfig pgconn.Config, d dialing) (*sql.DB, error) {
+	sharedPoolsMut.Lock()
+	defer sharedPoolsMut.Unlock()
+
+	connStr := sqlConnString(dbConfig)
+	if pool, ok := sharedPools[conf.name]; ok {
+		if pool.connStr != connStr {
+			return nil, fmt.Errorf("shared pool %q is already in use with different connection settings", conf.name)
+		}
+		pool.refs++
+		return pool.db, nil
+	}
+
+	db, err := openPool(connStr, d)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(conf.maxConnections)
+	db.SetMaxIdleConns(conf.maxConnections)
+
+	sharedPools[conf.name] = &sharedPool{db: db, connStr: connStr, refs: 1}
+	return db, nil
+}
+
+func releaseSharedPool(name string) error {
+	sharedPoolsMut.Lock()
+	defer sharedPoolsMut.Unlock()
+
+	pool, ok := sharedPools[name]
+	if !ok {
+		return nil
+	}
+	if pool.refs--; pool.refs > 0 {
+		return nil
+	}
+	delete(sharedPools, name)
+	return pool.db.Close()
+}
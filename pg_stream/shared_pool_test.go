@@ -0,0 +1,38 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedPoolIsReferenceCounted(t *testing.T) {
+	conf := sharedPoolConfig{name: "test_pool", maxConnections: 2}
+	dbConfig := pgconn.Config{Host: "localhost", Port: 5432, User: "user", Database: "db"}
+
+	first, err := acquireSharedPool(conf, dbConfig, dialing{})
+	require.NoError(t, err)
+	second, err := acquireSharedPool(conf, dbConfig, dialing{})
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	other := dbConfig
+	other.Database = "other"
+	_, err = acquireSharedPool(conf, other, dialing{})
+	assert.Error(t, err)
+
+	require.NoError(t, releaseSharedPool(conf.name))
+	assert.Contains(t, sharedPools, conf.name)
+	require.NoError(t, releaseSharedPool(conf.name))
+	assert.NotContains(t, sharedPools, conf.name)
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/OneOfOne/xxhash"
+)
+
+// slotGuard holds an advisory lock derived from the slot name for as long as
+// the input is connected, so that a second pipeline consuming the same slot
+// fails to connect rather than taking turns with the first one. Unlike
+// leader election the lock isn't waited for.
+type slotGuard struct {
+	slotName string
+
+	conn *sql.Conn
+}
+
+// lockKey is distinct from the key of the leader election lease, which
+// defaults to the slot name as well.
+func (g *slotGuard) lockKey() int64 {
+	return int64(xxhash.ChecksumString64("pg_stream_slot_guard:" + g.slotName))
+}
+
+// acquire takes the lock, or fails when another session holds it.
+func (g *slotGuard) acquire(ctx context.Context, db *sql.DB) (err error) {
+	// The session of a previous connection may have been lost already.
+	_ = g.release()
+
+	if g.conn, err = db.Conn(ctx); err != nil {
+		return err
+	}
+	var acquired bool
+	if err = g.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", g.lockKey()).Scan(&acquired); err != nil {
+		_ = g.release()
+		return err
+	}
+	if !acquired {
+		_ = g.conn.Close()
+		g.conn = nil
+		return fmt.Errorf("the replication slot %s is consumed by another pipeline, set slot_guard to false if this is intended", g.slotName)
+	}
+	return nil
+}
+
+// release gives up the lock. The connection is discarded rather than returned
+// to the pool when the lock can't be released, ending its session.
+func (g *slotGuard) release() error {
+	if g.conn == nil {
+		return nil
+	}
+	conn := g.conn
+	g.conn = nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", g.lockKey()); err != nil {
+		_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+		return errors.Join(err, conn.Close())
+	}
+	return conn.Close()
+}
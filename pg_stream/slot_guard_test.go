@@ -0,0 +1,24 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlotGuardLockKey(t *testing.T) {
+	guard := &slotGuard{slotName: "orders"}
+	assert.Equal(t, guard.lockKey(), (&slotGuard{slotName: "orders"}).lockKey())
+	assert.NotEqual(t, guard.lockKey(), (&slotGuard{slotName: "orders_shard1"}).lockKey())
+
+	// Doesn't collide with the lease of a leader election on the same slot.
+	assert.NotEqual(t, guard.lockKey(), (&leaderElection{lockName: "orders"}).lockKey())
+}
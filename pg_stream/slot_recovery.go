@@ -0,0 +1,140 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+const (
+	slotRecoveryFail     = "fail"
+	slotRecoveryRecreate = "recreate"
+)
+
+var slotRecoveryConfigFields = []*service.ConfigField{
+	service.NewStringAnnotatedEnumField("action", map[string]string{
+		slotRecoveryFail:     "Fail to connect until the slot is restored or recreated by hand, so the changes made while the slot was missing aren't skipped silently.",
+		slotRecoveryRecreate: "Recreate the slot and snapshot the tables again.",
+	}).
+		Description("What to do when the replication slot vanished").
+		Default(slotRecoveryFail),
+	service.NewStringMapField("snapshot_filters").
+		Description("SQL conditions by table that restrict the rows snapshotted after the slot was recreated, for example to the rows updated since shortly before the upgrade. Tables without a condition are snapshotted in full").
+		Example(map[string]any{"orders": "updated_at > '2024-03-01 00:00:00+00'"}).
+		Default(map[string]any{}),
+}
+
+// slotRecovery detects a replication slot that vanished since a previous
+// connect, typically because a major version upgrade doesn't carry logical
+// slots over, and either fails or recreates it along with a snapshot.
+type slotRecovery struct {
+	recreate        bool
+	snapshotFilters map[string]string
+
+	// serverVersion is the server_version_num seen on the last connect and
+	// slotSeen whether the slot existed on any connect.
+	serverVersion int
+	slotSeen      bool
+}
+
+func newSlotRecoveryFromParsed(conf *service.ParsedConfig) (r *slotRecovery, err error) {
+	r = &slotRecovery{}
+	var action string
+	if action, err = conf.FieldString("action"); err != nil {
+		return nil, err
+	}
+	r.recreate = action == slotRecoveryRecreate
+	if r.snapshotFilters, err = conf.FieldStringMap("snapshot_filters"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func querySlotState(ctx context.Context, db *sql.DB, slotName string) (version int, exists bool, err error) {
+	err = db.QueryRowContext(ctx, `SELECT current_setting('server_version_num')::int, EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)`, slotName).Scan(&version, &exists)
+	return version, exists, err
+}
+
+// majorVersion returns the major version of a server_version_num. Before
+// PostgreSQL 10 it consists of the first two components, 9.6 is 96.
+func majorVersion(versionNum int) int {
+	if versionNum >= 100000 {
+		return versionNum / 10000
+	}
+	return versionNum/10000*10 + versionNum/100%100
+}
+
+// slotLoss describes a replication slot that vanished.
+type slotLoss struct {
+	Slot        string `json:"slot"`
+	FromVersion int    `json:"from_version,omitempty"`
+	ToVersion   int    `json:"to_version,omitempty"`
+}
+
+func (l slotLoss) String() string {
+	if l.FromVersion != l.ToVersion {
+		return fmt.Sprintf("replication slot %s vanished after a major version upgrade from %d to %d", l.Slot, l.FromVersion, l.ToVersion)
+	}
+	return fmt.Sprintf("replication slot %s vanished", l.Slot)
+}
+
+// check records the state of the server on connect and returns the loss of
+// the slot, when it existed on a previous connect or a checkpoint was stored
+// for it but it doesn't exist anymore.
+func (r *slotRecovery) check(slotName string, version int, exists bool, checkpointed bool) *slotLoss {
+	var loss *slotLoss
+	if !exists && (r.slotSeen || checkpointed) {
+		loss = &slotLoss{Slot: slotName}
+		if r.serverVersion != 0 && majorVersion(r.serverVersion) != majorVersion(version) {
+			loss.FromVersion, loss.ToVersion = majorVersion(r.serverVersion), majorVersion(version)
+		}
+	}
+	r.serverVersion = version
+	r.slotSeen = r.slotSeen || exists
+	return loss
+}
+
+// recoverSlot checks whether the slot vanished since a previous connect. It
+// fails unless the slot may be recreated, in which case it returns true when
+// the tables must be snapshotted again and queues an event reporting the
+// loss.
+func (p *pgStreamInput) recoverSlot(ctx context.Context, checkpointed bool) (bool, error) {
+	slotName := fmt.Sprintf("rs_%s", p.slotName)
+	previous := p.slotRecovery.serverVersion
+	version, exists, err := querySlotState(ctx, p.db, slotName)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the replication slot: %w", err)
+	}
+	if previous != 0 && majorVersion(previous) != majorVersion(version) {
+		p.logger.Warnf("Server major version changed from %d to %d", majorVersion(previous), majorVersion(version))
+	}
+
+	loss := p.slotRecovery.check(slotName, version, exists, checkpointed)
+	if loss == nil {
+		return false, nil
+	}
+	if !p.slotRecovery.recreate {
+		return false, fmt.Errorf("%v, restore it or set slot_recovery.action to recreate to snapshot the tables again", loss)
+	}
+	p.logger.Warnf("The %v, recreating it and snapshotting the tables again", loss)
+
+	b, err := json.Marshal(loss)
+	if err != nil {
+		return false, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "slot_recreated")
+	p.controlMessages = append(p.controlMessages, msg)
+	return true, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMajorVersion(t *testing.T) {
+	assert.Equal(t, 96, majorVersion(90624))
+	assert.Equal(t, 16, majorVersion(160002))
+	assert.Equal(t, 17, majorVersion(170000))
+}
+
+func TestSlotRecoveryDetectsVanishedSlot(t *testing.T) {
+	r := &slotRecovery{}
+
+	// A slot that never existed is created as usual.
+	assert.Nil(t, r.check("rs_orders", 160002, false, false))
+	assert.Nil(t, r.check("rs_orders", 160002, true, false))
+	assert.Nil(t, r.check("rs_orders", 160004, true, false))
+
+	loss := r.check("rs_orders", 170000, false, false)
+	if assert.NotNil(t, loss) {
+		assert.Equal(t, slotLoss{Slot: "rs_orders", FromVersion: 16, ToVersion: 17}, *loss)
+		assert.Equal(t, "replication slot rs_orders vanished after a major version upgrade from 16 to 17", loss.String())
+	}
+
+	// A slot that was dropped without an upgrade.
+	loss = r.check("rs_orders", 170000, false, false)
+	if assert.NotNil(t, loss) {
+		assert.Equal(t, "replication slot rs_orders vanished", loss.String())
+	}
+
+	// Across restarts only a stored checkpoint tells that the slot existed.
+	r = &slotRecovery{}
+	assert.NotNil(t, r.check("rs_orders", 170000, false, true))
+}
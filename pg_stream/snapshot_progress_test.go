@@ -0,0 +1,36 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestSnapshotProgressMessage(t *testing.T) {
+	msg, err := snapshotProgressMessage(&pglogicalstream.SnapshotProgress{
+		Table:         "orders",
+		RowsDone:      2000,
+		RowsEstimated: 5000,
+		RowsPerSecond: 250.5,
+	})
+	require.NoError(t, err)
+
+	b, err := msg.AsBytes()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"table":"orders","rows_done":2000,"rows_estimated":5000,"rows_per_second":250.5,"done":false}`, string(b))
+	eventType, _ := msg.MetaGet("event_type")
+	assert.Equal(t, "snapshot_progress", eventType)
+	table, _ := msg.MetaGet("table")
+	assert.Equal(t, "orders", table)
+}
@@ -0,0 +1,253 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type softDeleteMarker string
+
+const (
+	softDeleteFlag      softDeleteMarker = "flag"
+	softDeleteTimestamp softDeleteMarker = "timestamp"
+)
+
+var softDeleteConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table whose deletes are translated").
+		Example("customers"),
+	service.NewStringField("column").
+		Description("The column marking the row as deleted").
+		Example("deleted_at"),
+	service.NewStringAnnotatedEnumField("marker", map[string]string{
+		string(softDeleteFlag):      "Set the column to `true`.",
+		string(softDeleteTimestamp): "Set the column to the commit timestamp of the delete, in RFC 3339 format.",
+	}).
+		Description("The value the column is set to").
+		Default(string(softDeleteTimestamp)),
+}
+
+type softDelete struct {
+	column string
+	marker softDeleteMarker
+}
+
+// softDeletes translates deletes into updates marking the row as deleted, for
+// sinks that implement soft deletes.
+type softDeletes struct {
+	tables map[string]softDelete
+}
+
+func newSoftDeletesFromParsed(confs []*service.ParsedConfig) (*softDeletes, error) {
+	s := &softDeletes{tables: map[string]softDelete{}}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		column, err := conf.FieldString("column")
+		if err != nil {
+			return nil, err
+		}
+		marker, err := conf.FieldString("marker")
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := s.tables[table]; exists {
+			return nil, fmt.Errorf("soft deletes of table %s are configured twice", table)
+		}
+		s.tables[table] = softDelete{column: column, marker: softDeleteMarker(marker)}
+	}
+	return s, nil
+}
+
+// apply replaces the deletes of the changes with updates of their old keys
+// that set the marker column, and returns true when a delete was replaced.
+func (s *softDeletes) apply(changes []pglogicalstream.Wal2JsonChange, commitTime time.Time) (translated bool) {
+	for i := range changes {
+		change := &changes[i]
+		d, ok := s.tables[change.Table]
+		if !ok || change.Kind != "delete" {
+			continue
+		}
+
+		var value any = true
+		columnType := "boolean"
+		if d.marker == softDeleteTimestamp {
+			value = commitTime.Format(time.RFC3339Nano)
+			columnType = "timestamp with time zone"
+		}
+
+		// The old keys hold the whole row with REPLICA IDENTITY FULL. Their
+		// slices are cloned as the old keys stay unchanged.
+		names := slices.Clone(change.OldKeys.KeyNames)
+		types := slices.Clone(change.OldKeys.KeyTypes)
+		values := slices.Clone(change.OldKeys.KeyValues)
+		if j := slices.Index(names, d.column); j >= 0 && j < len(values) {
+			values[j] = value
+		} else {
+			names = append(names, d.column)
+			values = append(values, value)
+			if len(types) > 0 {
+				types = append(types, columnType)
+			}
+		}
+		change.Kind = "update"
+		change.ColumnNames, change.ColumnTypes, change.ColumnValues = names, types, values
+		translated = true
+	}
+	return translated
+}
+
+var sourceSoftDeleteConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table whose soft deletes are translated").
+		Example("customers"),
+	service.NewStringField("column").
+		Description("The column the source application marks deleted rows with").
+		Example("deleted_at"),
+	service.NewStringAnnotatedEnumField("marker", map[string]string{
+		string(softDeleteFlag):      "Rows are deleted when the column is set to `true`.",
+		string(softDeleteTimestamp): "Rows are deleted when the column is set to a non-null value.",
+	}).
+		Description("How the column marks deleted rows").
+		Default(string(softDeleteTimestamp)),
+	service.NewBoolField("tombstone").
+		Description("Follow the delete with a tombstone, an event with an empty payload and the same metadata, so that compacted Kafka topics drop the key. Tombstones are only emitted for events with a `pg_key`").
+		Default(true),
+}
+
+type sourceSoftDelete struct {
+	column    string
+	marker    softDeleteMarker
+	tombstone bool
+}
+
+// sourceSoftDeletes translates the updates marking rows as deleted into
+// deletes, for sources that never remove rows.
+type sourceSoftDeletes struct {
+	tables map[string]sourceSoftDelete
+}
+
+func newSourceSoftDeletesFromParsed(confs []*service.ParsedConfig) (*sourceSoftDeletes, error) {
+	s := &sourceSoftDeletes{tables: map[string]sourceSoftDelete{}}
+	for _, conf := range confs {
+		table, err := conf.FieldString("table")
+		if err != nil {
+			return nil, err
+		}
+		var d sourceSoftDelete
+		if d.column, err = conf.FieldString("column"); err != nil {
+			return nil, err
+		}
+		var marker string
+		if marker, err = conf.FieldString("marker"); err != nil {
+			return nil, err
+		}
+		d.marker = softDeleteMarker(marker)
+		if d.tombstone, err = conf.FieldBool("tombstone"); err != nil {
+			return nil, err
+		}
+		if _, exists := s.tables[table]; exists {
+			return nil, fmt.Errorf("source soft deletes of table %s are configured twice", table)
+		}
+		s.tables[table] = d
+	}
+	return s, nil
+}
+
+func (d sourceSoftDelete) marks(value any) bool {
+	if d.marker == softDeleteFlag {
+		return value == true
+	}
+	return value != nil
+}
+
+// apply replaces the updates of the changes that mark their row as deleted
+// with deletes of the row, identified by its primary key, and returns true
+// when an update was replaced. Updates of rows that were already marked are
+// only recognized as such when the old keys hold the column, with REPLICA
+// IDENTITY FULL, and are otherwise replaced as well.
+func (s *sourceSoftDeletes) apply(changes []pglogicalstream.Wal2JsonChange, primaryKeys map[string][]string) (translated bool) {
+	for i := range changes {
+		change := &changes[i]
+		d, ok := s.tables[change.Table]
+		if !ok || change.Kind != "update" {
+			continue
+		}
+		j := slices.Index(change.ColumnNames, d.column)
+		if j < 0 || j >= len(change.ColumnValues) || !d.marks(change.ColumnValues[j]) {
+			continue
+		}
+		if k := slices.Index(change.OldKeys.KeyNames, d.column); k >= 0 && k < len(change.OldKeys.KeyValues) && d.marks(change.OldKeys.KeyValues[k]) {
+			continue
+		}
+
+		// Tables without a primary key are identified by the whole row.
+		oldKeys := pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  change.ColumnNames,
+			KeyTypes:  change.ColumnTypes,
+			KeyValues: change.ColumnValues,
+		}
+		if keyColumns := primaryKeys[change.Table]; len(keyColumns) > 0 {
+			if keys, ok := rowKeys(*change, keyColumns); ok {
+				oldKeys = keys
+			}
+		}
+		change.Kind = "delete"
+		change.OldKeys = oldKeys
+		change.ColumnNames, change.ColumnTypes, change.ColumnValues = nil, nil, nil
+		translated = true
+	}
+	return translated
+}
+
+// rowKeys returns the key columns of the row of the change, which must all be
+// present.
+func rowKeys(change pglogicalstream.Wal2JsonChange, keyColumns []string) (pglogicalstream.Wal2JsonOldKeys, bool) {
+	var keys pglogicalstream.Wal2JsonOldKeys
+	for _, column := range keyColumns {
+		j := slices.Index(change.ColumnNames, column)
+		if j < 0 || j >= len(change.ColumnValues) {
+			return pglogicalstream.Wal2JsonOldKeys{}, false
+		}
+		keys.KeyNames = append(keys.KeyNames, column)
+		if j < len(change.ColumnTypes) {
+			keys.KeyTypes = append(keys.KeyTypes, change.ColumnTypes[j])
+		}
+		keys.KeyValues = append(keys.KeyValues, change.ColumnValues[j])
+	}
+	return keys, true
+}
+
+// tombstone returns the tombstone following the translated delete event msg,
+// or nil when its table has no tombstones or the event has no key.
+func (s *sourceSoftDeletes) tombstone(msg *service.Message) *service.Message {
+	if _, ok := msg.MetaGetMut("source_soft_deleted"); !ok {
+		return nil
+	}
+	if _, ok := msg.MetaGetMut("pg_key"); !ok {
+		return nil
+	}
+	table, _ := msg.MetaGetMut("table")
+	if name, _ := table.(string); !s.tables[name].tombstone {
+		return nil
+	}
+	tombstone := msg.Copy()
+	tombstone.SetBytes(nil)
+	tombstone.MetaSetMut("tombstone", "true")
+	return tombstone
+}
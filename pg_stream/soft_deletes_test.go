@@ -0,0 +1,131 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestSoftDeletes(t *testing.T) {
+	s := &softDeletes{tables: map[string]softDelete{
+		"customers": {column: "deleted_at", marker: softDeleteTimestamp},
+		"orders":    {column: "is_deleted", marker: softDeleteFlag},
+	}}
+	oldKeys := pglogicalstream.Wal2JsonOldKeys{
+		KeyNames:  []string{"id"},
+		KeyTypes:  []string{"integer"},
+		KeyValues: []interface{}{float64(7)},
+	}
+	changes := []pglogicalstream.Wal2JsonChange{
+		{Kind: "delete", Table: "customers", OldKeys: oldKeys},
+		{Kind: "delete", Table: "orders", OldKeys: pglogicalstream.Wal2JsonOldKeys{
+			KeyNames:  []string{"id", "is_deleted"},
+			KeyTypes:  []string{"integer", "boolean"},
+			KeyValues: []interface{}{float64(8), false},
+		}},
+		{Kind: "delete", Table: "invoices", OldKeys: oldKeys},
+		{Kind: "insert", Table: "customers", ColumnNames: []string{"id"}, ColumnValues: []interface{}{float64(9)}},
+	}
+
+	commitTime := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.True(t, s.apply(changes, commitTime))
+
+	assert.Equal(t, "update", changes[0].Kind)
+	assert.Equal(t, []string{"id", "deleted_at"}, changes[0].ColumnNames)
+	assert.Equal(t, []string{"integer", "timestamp with time zone"}, changes[0].ColumnTypes)
+	assert.Equal(t, []interface{}{float64(7), "2024-03-01T10:00:00Z"}, changes[0].ColumnValues)
+	assert.Equal(t, []string{"id"}, changes[0].OldKeys.KeyNames)
+
+	assert.Equal(t, "update", changes[1].Kind)
+	assert.Equal(t, []string{"id", "is_deleted"}, changes[1].ColumnNames)
+	assert.Equal(t, []interface{}{float64(8), true}, changes[1].ColumnValues)
+	assert.Equal(t, []interface{}{float64(8), false}, changes[1].OldKeys.KeyValues)
+
+	assert.Equal(t, "delete", changes[2].Kind)
+	assert.Equal(t, "insert", changes[3].Kind)
+
+	assert.False(t, s.apply(changes[2:], commitTime))
+}
+
+func TestSourceSoftDeletes(t *testing.T) {
+	s := &sourceSoftDeletes{tables: map[string]sourceSoftDelete{
+		"customers": {column: "deleted_at", marker: softDeleteTimestamp, tombstone: true},
+		"orders":    {column: "is_deleted", marker: softDeleteFlag},
+	}}
+	primaryKeys := map[string][]string{"customers": {"id"}}
+	changes := []pglogicalstream.Wal2JsonChange{
+		{Kind: "update", Table: "customers",
+			ColumnNames:  []string{"id", "name", "deleted_at"},
+			ColumnTypes:  []string{"integer", "text", "timestamp"},
+			ColumnValues: []interface{}{float64(7), "Ada", "2024-03-01 10:00:00"}},
+		{Kind: "update", Table: "orders",
+			ColumnNames:  []string{"ref", "is_deleted"},
+			ColumnValues: []interface{}{"A-1", true}},
+		{Kind: "update", Table: "orders",
+			ColumnNames:  []string{"ref", "is_deleted"},
+			ColumnValues: []interface{}{"A-2", false}},
+		{Kind: "update", Table: "customers",
+			ColumnNames:  []string{"id", "deleted_at"},
+			ColumnValues: []interface{}{float64(8), "2024-03-02 10:00:00"},
+			OldKeys: pglogicalstream.Wal2JsonOldKeys{
+				KeyNames:  []string{"id", "deleted_at"},
+				KeyValues: []interface{}{float64(8), "2024-03-01 10:00:00"},
+			}},
+	}
+	assert.True(t, s.apply(changes, primaryKeys))
+
+	assert.Equal(t, "delete", changes[0].Kind)
+	assert.Nil(t, changes[0].ColumnNames)
+	assert.Equal(t, pglogicalstream.Wal2JsonOldKeys{
+		KeyNames:  []string{"id"},
+		KeyTypes:  []string{"integer"},
+		KeyValues: []interface{}{float64(7)},
+	}, changes[0].OldKeys)
+
+	// Without a primary key the row identifies itself.
+	assert.Equal(t, "delete", changes[1].Kind)
+	assert.Equal(t, []string{"ref", "is_deleted"}, changes[1].OldKeys.KeyNames)
+
+	assert.Equal(t, "update", changes[2].Kind)
+	// The row was already marked as deleted.
+	assert.Equal(t, "update", changes[3].Kind)
+}
+
+func TestSourceSoftDeleteTombstones(t *testing.T) {
+	s := &sourceSoftDeletes{tables: map[string]sourceSoftDelete{
+		"customers": {column: "deleted_at", marker: softDeleteTimestamp, tombstone: true},
+		"orders":    {column: "is_deleted", marker: softDeleteFlag},
+	}}
+
+	msg := service.NewMessage([]byte(`{"kind":"delete"}`))
+	msg.MetaSetMut("table", "customers")
+	msg.MetaSetMut("pg_key", "7")
+	assert.Nil(t, s.tombstone(msg))
+
+	msg.MetaSetMut("source_soft_deleted", "true")
+	tombstone := s.tombstone(msg)
+	require.NotNil(t, tombstone)
+	body, err := tombstone.AsBytes()
+	require.NoError(t, err)
+	assert.Empty(t, body)
+	key, _ := tombstone.MetaGetMut("pg_key")
+	assert.Equal(t, "7", key)
+	flag, _ := tombstone.MetaGetMut("tombstone")
+	assert.Equal(t, "true", flag)
+
+	msg.MetaSetMut("table", "orders")
+	assert.Nil(t, s.tombstone(msg))
+}
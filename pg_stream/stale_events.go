@@ -0,0 +1,70 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+type staleEventAction string
+
+const (
+	staleEventDrop       staleEventAction = "drop"
+	staleEventDeadLetter staleEventAction = "dead_letter"
+)
+
+var staleEventsConfigFields = []*service.ConfigField{
+	service.NewDurationField("max_age").
+		Description("Events whose transaction committed longer ago than this are considered stale").
+		Example("1h"),
+	service.NewStringAnnotatedEnumField("action", map[string]string{
+		string(staleEventDrop):       "Acknowledge stale events without emitting them.",
+		string(staleEventDeadLetter): "Emit stale events with the metadata field `dead_letter_reason` set to `stale` so they can be routed to a dead-letter output.",
+	}).
+		Description("What to do with stale events").
+		Default(string(staleEventDrop)),
+}
+
+// staleEventGuard detects change events that committed too long ago, which
+// happens during massive catch-ups after a pipeline has been down.
+type staleEventGuard struct {
+	maxAge time.Duration
+	action staleEventAction
+
+	dropped      *service.MetricCounter
+	deadLettered *service.MetricCounter
+}
+
+func newStaleEventGuardFromParsed(conf *service.ParsedConfig, metrics *service.Metrics) (g *staleEventGuard, err error) {
+	g = &staleEventGuard{}
+	if g.maxAge, err = conf.FieldDuration("max_age"); err != nil {
+		return nil, err
+	}
+
+	var action string
+	if action, err = conf.FieldString("action"); err != nil {
+		return nil, err
+	}
+	g.action = staleEventAction(action)
+
+	g.dropped = metrics.NewCounter("pg_stream_stale_events_dropped")
+	g.deadLettered = metrics.NewCounter("pg_stream_stale_events_dead_lettered")
+	return g, nil
+}
+
+// isStale returns true when the commit timestamp is older than the configured
+// maximum age. Snapshot events have no commit timestamp and are never stale.
+func (g *staleEventGuard) isStale(commitTime time.Time) bool {
+	if commitTime.IsZero() {
+		return false
+	}
+	return time.Since(commitTime) > g.maxAge
+}
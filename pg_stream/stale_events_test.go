@@ -0,0 +1,52 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleEventGuard(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(staleEventsConfigFields...)
+	conf, err := spec.ParseYAML(`
+max_age: 1h
+action: dead_letter
+`, nil)
+	require.NoError(t, err)
+	g, err := newStaleEventGuardFromParsed(conf, service.MockResources().Metrics())
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, g.maxAge)
+	assert.Equal(t, staleEventDeadLetter, g.action)
+
+	for _, test := range []struct {
+		name       string
+		commitTime time.Time
+		stale      bool
+	}{
+		{name: "snapshot", commitTime: time.Time{}, stale: false},
+		{name: "recent", commitTime: time.Now().Add(-time.Minute), stale: false},
+		{name: "old", commitTime: time.Now().Add(-2 * time.Hour), stale: true},
+	} {
+		assert.Equal(t, test.stale, g.isStale(test.commitTime), test.name)
+	}
+}
+
+func TestStaleEventGuardDefaultsToDrop(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(staleEventsConfigFields...)
+	conf, err := spec.ParseYAML(`max_age: 30s`, nil)
+	require.NoError(t, err)
+	g, err := newStaleEventGuardFromParsed(conf, service.MockResources().Metrics())
+	require.NoError(t, err)
+	assert.Equal(t, staleEventDrop, g.action)
+}
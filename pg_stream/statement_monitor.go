@@ -0,0 +1,74 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var statementMonitorConfigFields = []*service.ConfigField{
+	service.NewDurationField("interval").
+		Description("How often the statements of the input are looked up in `pg_stat_activity`").
+		Default("30s"),
+}
+
+// statementMonitor periodically finds the longest running statement and
+// transaction of the input's own SQL connections, recognized by their
+// application_name in pg_stat_activity. The replication connection is left
+// out as its START_REPLICATION command runs for as long as the stream.
+type statementMonitor struct {
+	interval        time.Duration
+	applicationName string
+
+	longestStatement   *service.MetricGauge
+	longestTransaction *service.MetricGauge
+	lastCheck          time.Time
+}
+
+func newStatementMonitorFromParsed(conf *service.ParsedConfig, applicationName string, metrics *service.Metrics) (m *statementMonitor, err error) {
+	if applicationName == "" {
+		return nil, errors.New("the statement monitor requires an application_name")
+	}
+	m = &statementMonitor{
+		applicationName:    applicationName,
+		longestStatement:   metrics.NewGauge("pg_stream_longest_statement_ms"),
+		longestTransaction: metrics.NewGauge("pg_stream_longest_transaction_ms"),
+	}
+	if m.interval, err = conf.FieldDuration("interval"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// check updates the gauges once the interval elapsed.
+func (m *statementMonitor) check(ctx context.Context, db *sql.DB) error {
+	if time.Since(m.lastCheck) < m.interval {
+		return nil
+	}
+	m.lastCheck = time.Now()
+
+	var statementSecs, transactionSecs float64
+	if err := db.QueryRowContext(ctx, `SELECT
+	COALESCE(MAX(EXTRACT(EPOCH FROM now() - query_start)) FILTER (WHERE state = 'active'), 0),
+	COALESCE(MAX(EXTRACT(EPOCH FROM now() - xact_start)), 0)
+FROM pg_stat_activity
+WHERE application_name = $1 AND backend_type = 'client backend' AND pid <> pg_backend_pid()`, m.applicationName).
+		Scan(&statementSecs, &transactionSecs); err != nil {
+		return fmt.Errorf("failed to query pg_stat_activity: %w", err)
+	}
+	m.longestStatement.Set(int64(statementSecs * 1000))
+	m.longestTransaction.Set(int64(transactionSecs * 1000))
+	return nil
+}
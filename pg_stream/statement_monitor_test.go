@@ -0,0 +1,40 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementMonitorConfig(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(statementMonitorConfigFields...)
+	conf, err := spec.ParseYAML(`interval: 5s`, nil)
+	require.NoError(t, err)
+
+	m, err := newStatementMonitorFromParsed(conf, "benthos_pg_stream", service.MockResources().Metrics())
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, m.interval)
+
+	_, err = newStatementMonitorFromParsed(conf, "", service.MockResources().Metrics())
+	assert.ErrorContains(t, err, "application_name")
+}
+
+func TestSQLConnStringApplicationName(t *testing.T) {
+	dbConfig := pgconn.Config{Host: "localhost", Port: 5432, User: "postgres", Database: "app"}
+	assert.NotContains(t, sqlConnString(dbConfig), "application_name")
+
+	dbConfig.RuntimeParams = map[string]string{"application_name": "cdc 'orders'"}
+	assert.Contains(t, sqlConnString(dbConfig), `application_name='cdc \'orders\''`)
+}
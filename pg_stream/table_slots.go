@@ -0,0 +1,63 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OneOfOne/xxhash"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// maxSlotNameLength is the longest identifier Postgres accepts.
+const maxSlotNameLength = 63
+
+// tableSlotName returns the name of the replication slot of a table when
+// every table has its own slot. Characters slot names can't hold are replaced,
+// and long names are truncated with a hash of the table name kept unique.
+func tableSlotName(slot, table string) string {
+	name := slot + "_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, table)
+	if len(name) <= maxSlotNameLength {
+		return name
+	}
+	suffix := fmt.Sprintf("_%08x", xxhash.ChecksumString32(table))
+	return name[:maxSlotNameLength-len(suffix)] + suffix
+}
+
+// newTableSources creates a source consuming a slot of its own for every
+// table, so a table can't hold back the WAL of the others.
+func (p *pgStreamInput) newTableSources(config pglogicalstream.Config) (pglogicalstream.ReplicationSource, error) {
+	sources := make([]pglogicalstream.ReplicationSource, 0, len(p.tables))
+	for _, table := range p.tables {
+		tableConfig := config
+		tableConfig.DbTables = []string{table}
+		tableConfig.ReplicationSlotName = tableSlotName(config.ReplicationSlotName, table)
+
+		source, err := p.newSource(tableConfig)
+		if err != nil {
+			for _, s := range sources {
+				err = errors.Join(err, s.Stop())
+			}
+			return nil, fmt.Errorf("failed to start streaming table %s: %w", table, err)
+		}
+		sources = append(sources, source)
+	}
+	return pglogicalstream.NewMultiSource(sources), nil
+}
@@ -0,0 +1,26 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTableSlotName(t *testing.T) {
+	assert.Equal(t, "rs_orders_orders", tableSlotName("rs_orders", "orders"))
+	assert.Equal(t, "rs_cdc_order_items", tableSlotName("rs_cdc", "Order-Items"))
+
+	long := strings.Repeat("a", 70)
+	name := tableSlotName("rs_cdc", long)
+	assert.Len(t, name, maxSlotNameLength)
+	assert.NotEqual(t, name, tableSlotName("rs_cdc", long+"b"))
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// TopicSpec describes the topic of a replicated table.
+type TopicSpec struct {
+	Name       string
+	Partitions int
+	// ReplicationFactor is -1 for the default of the cluster.
+	ReplicationFactor int
+	// Retention is zero for the default of the cluster.
+	Retention time.Duration
+	// Compact selects the compact cleanup policy instead of delete.
+	Compact bool
+}
+
+// TopicProvisioner creates the topics of the replicated tables before the
+// first event is produced, for instance through the Kafka admin API.
+type TopicProvisioner interface {
+	// Provision creates the topics that don't exist yet. Existing topics are
+	// left untouched.
+	Provision(ctx context.Context, topics []TopicSpec) error
+	// Close releases the resources of the provisioner.
+	Close(ctx context.Context) error
+}
+
+// TopicProvisionerConstructor creates a TopicProvisioner from the
+// `topics.provisioning` block of the input config, which holds its settings
+// in the `options` field.
+type TopicProvisionerConstructor func(conf *service.ParsedConfig, mgr *service.Resources) (TopicProvisioner, error)
+
+var (
+	topicProvisionersMut sync.RWMutex
+	topicProvisioners    = map[string]TopicProvisionerConstructor{}
+)
+
+// RegisterTopicProvisioner makes a topic provisioner selectable by name in
+// the `provisioner` field of the `topics.provisioning` block. It is meant to be
+// called from an init function, before configs are parsed.
+func RegisterTopicProvisioner(name string, ctor TopicProvisionerConstructor) {
+	topicProvisionersMut.Lock()
+	defer topicProvisionersMut.Unlock()
+	topicProvisioners[name] = ctor
+}
+
+func topicProvisioner(name string) (TopicProvisionerConstructor, error) {
+	topicProvisionersMut.RLock()
+	defer topicProvisionersMut.RUnlock()
+	if ctor, ok := topicProvisioners[name]; ok {
+		return ctor, nil
+	}
+	names := make([]string, 0, len(topicProvisioners))
+	for name := range topicProvisioners {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return nil, fmt.Errorf("unknown topic provisioner %q, registered provisioners are %v", name, names)
+}
+
+var topicProvisioningConfigFields = []*service.ConfigField{
+	service.NewStringField("provisioner").
+		Description("The name of the topic provisioner registered with `RegisterTopicProvisioner`"),
+	service.NewIntField("partitions").
+		Description("The number of partitions of the created topics").
+		Default(1),
+	service.NewIntField("replication_factor").
+		Description("The replication factor of the created topics, `-1` for the default of the cluster").
+		Default(-1),
+	service.NewDurationField("retention").
+		Description("The retention of the created topics, `0s` for the default of the cluster").
+		Default("0s"),
+	service.NewBoolField("compact").
+		Description("Create compacted topics, which keep the last event of every key").
+		Default(false),
+	service.NewStringMapField("options").
+		Description("Settings of the provisioner, such as the seed brokers of the cluster").
+		Default(map[string]any{}),
+}
+
+// topicProvisioning creates the topics of the replicated tables on the first
+// connect.
+type topicProvisioning struct {
+	ctor TopicProvisionerConstructor
+	spec TopicSpec
+	conf *service.ParsedConfig
+	mgr  *service.Resources
+
+	done bool
+}
+
+func newTopicProvisioningFromParsed(conf *service.ParsedConfig, mgr *service.Resources) (t *topicProvisioning, err error) {
+	t = &topicProvisioning{conf: conf, mgr: mgr}
+	var provisioner string
+	if provisioner, err = conf.FieldString("provisioner"); err != nil {
+		return nil, err
+	}
+	if t.ctor, err = topicProvisioner(provisioner); err != nil {
+		return nil, err
+	}
+	if t.spec.Partitions, err = conf.FieldInt("partitions"); err != nil {
+		return nil, err
+	}
+	if t.spec.ReplicationFactor, err = conf.FieldInt("replication_factor"); err != nil {
+		return nil, err
+	}
+	if t.spec.Retention, err = conf.FieldDuration("retention"); err != nil {
+		return nil, err
+	}
+	if t.spec.Compact, err = conf.FieldBool("compact"); err != nil {
+		return nil, err
+	}
+	if t.spec.Partitions < 1 {
+		return nil, fmt.Errorf("partitions must be at least 1, got %d", t.spec.Partitions)
+	}
+	return t, nil
+}
+
+// provision creates the topics of the tables, once.
+func (t *topicProvisioning) provision(ctx context.Context, namer *topicNamer, schema string, tables []string) error {
+	if t.done {
+		return nil
+	}
+	topics := make([]TopicSpec, 0, len(tables))
+	for _, table := range tables {
+		spec := t.spec
+		spec.Name = namer.topic(schema, table)
+		topics = append(topics, spec)
+	}
+
+	provisioner, err := t.ctor(t.conf, t.mgr)
+	if err != nil {
+		return fmt.Errorf("failed to create the topic provisioner: %w", err)
+	}
+	defer func() {
+		_ = provisioner.Close(ctx)
+	}()
+	if err = provisioner.Provision(ctx, topics); err != nil {
+		return fmt.Errorf("failed to provision the topics: %w", err)
+	}
+	t.done = true
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingProvisioner struct {
+	calls [][]TopicSpec
+}
+
+func (r *recordingProvisioner) Provision(ctx context.Context, topics []TopicSpec) error {
+	r.calls = append(r.calls, topics)
+	return nil
+}
+
+func (r *recordingProvisioner) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestTopicProvisioning(t *testing.T) {
+	var options map[string]string
+	provisioner := &recordingProvisioner{}
+	RegisterTopicProvisioner("test_recording", func(conf *service.ParsedConfig, mgr *service.Resources) (TopicProvisioner, error) {
+		var err error
+		options, err = conf.FieldStringMap("options")
+		return provisioner, err
+	})
+
+	spec := service.NewConfigSpec().Fields(topicsConfigFields...)
+	conf, err := spec.ParseYAML(`
+prefix: cdc.
+provisioning:
+  provisioner: test_recording
+  partitions: 6
+  retention: 168h
+  compact: true
+  options:
+    seed_brokers: localhost:9092
+`, nil)
+	require.NoError(t, err)
+	namer, err := newTopicNamerFromParsed(conf)
+	require.NoError(t, err)
+	provisioning, err := newTopicProvisioningFromParsed(conf.Namespace("provisioning"), service.MockResources())
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, provisioning.provision(ctx, namer, "public", []string{"orders", "order lines"}))
+	assert.Equal(t, map[string]string{"seed_brokers": "localhost:9092"}, options)
+	assert.Equal(t, [][]TopicSpec{{
+		{Name: "cdc.public.orders", Partitions: 6, ReplicationFactor: -1, Retention: 168 * time.Hour, Compact: true},
+		{Name: "cdc.public.order_lines", Partitions: 6, ReplicationFactor: -1, Retention: 168 * time.Hour, Compact: true},
+	}}, provisioner.calls)
+
+	// Reconnects don't provision the topics again.
+	require.NoError(t, provisioning.provision(ctx, namer, "public", []string{"orders", "order lines"}))
+	assert.Len(t, provisioner.calls, 1)
+
+	conf, err = service.NewConfigSpec().Fields(topicProvisioningConfigFields...).ParseYAML(`provisioner: nope`, nil)
+	require.NoError(t, err)
+	_, err = newTopicProvisioningFromParsed(conf, service.MockResources())
+	assert.ErrorContains(t, err, `unknown topic provisioner "nope"`)
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/OneOfOne/xxhash"
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+// maxTopicLength is the longest topic name Kafka accepts.
+const maxTopicLength = 249
+
+var topicsConfigFields = []*service.ConfigField{
+	service.NewStringField("prefix").
+		Description("A prefix of the topic names, used as is").
+		Example("cdc.").
+		Default(""),
+	service.NewStringField("replacement").
+		Description("The string replacing characters topic names can't hold, such as quotes and spaces").
+		Default("_"),
+	service.NewBoolField("replace_dots").
+		Description("Also replace dots within the schema and table names, as topics differing only in dots and underscores collide in metric names").
+		Default(false),
+	service.NewBoolField("lowercase").
+		Description("Fold the schema and table names to lower case").
+		Default(false),
+	service.NewIntField("max_length").
+		Description("The maximum length of topic names. Longer names are truncated, keeping them unique with a hash of the full name").
+		Default(maxTopicLength),
+	service.NewObjectField("provisioning", topicProvisioningConfigFields...).
+		Description("Create the topics of the replicated tables on startup, with a provisioner registered with `RegisterTopicProvisioner`, so that producing the first events of a table doesn't fail when the cluster doesn't create topics automatically").
+		Optional(),
+}
+
+// topicNamer derives topic names from the schema and table of changes, valid
+// under the Kafka topic naming rules.
+type topicNamer struct {
+	prefix      string
+	replacement string
+	replaceDots bool
+	lowercase   bool
+	maxLength   int
+}
+
+func newTopicNamerFromParsed(conf *service.ParsedConfig) (n *topicNamer, err error) {
+	n = &topicNamer{}
+	if n.prefix, err = conf.FieldString("prefix"); err != nil {
+		return nil, err
+	}
+	if n.replacement, err = conf.FieldString("replacement"); err != nil {
+		return nil, err
+	}
+	if n.replaceDots, err = conf.FieldBool("replace_dots"); err != nil {
+		return nil, err
+	}
+	if n.lowercase, err = conf.FieldBool("lowercase"); err != nil {
+		return nil, err
+	}
+	if n.maxLength, err = conf.FieldInt("max_length"); err != nil {
+		return nil, err
+	}
+
+	if n.maxLength < 16 || n.maxLength > maxTopicLength {
+		return nil, fmt.Errorf("max_length must be between 16 and %d, got %d", maxTopicLength, n.maxLength)
+	}
+	if n.sanitize(n.prefix) != n.prefix || n.sanitize(n.replacement) != n.replacement {
+		return nil, errors.New("prefix and replacement may only hold letters, digits, dots, underscores and hyphens")
+	}
+	return n, nil
+}
+
+// sanitize replaces the characters topic names can't hold.
+func (n *topicNamer) sanitize(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == '.' && !n.replaceDots:
+			b.WriteRune(r)
+		default:
+			b.WriteString(n.replacement)
+		}
+	}
+	return b.String()
+}
+
+// topic returns the topic name of a table.
+func (n *topicNamer) topic(schema, table string) string {
+	if n.lowercase {
+		schema, table = strings.ToLower(schema), strings.ToLower(table)
+	}
+	topic := n.prefix + n.sanitize(schema) + "." + n.sanitize(table)
+	if len(topic) > n.maxLength {
+		suffix := fmt.Sprintf("-%08x", xxhash.ChecksumString32(schema+"."+table))
+		topic = topic[:n.maxLength-len(suffix)] + suffix
+	}
+	// Kafka reserves these names.
+	if topic == "." || topic == ".." {
+		topic = strings.ReplaceAll(topic, ".", n.replacement)
+	}
+	return topic
+}
+
+// apply sets the topic metadata field when the changes belong to a single
+// table.
+func (n *topicNamer) apply(msg *service.Message, changes []pglogicalstream.Wal2JsonChange) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, change := range changes[1:] {
+		if change.Schema != changes[0].Schema || change.Table != changes[0].Table {
+			return
+		}
+	}
+	msg.MetaSetMut("topic", n.topic(changes[0].Schema, changes[0].Table))
+}
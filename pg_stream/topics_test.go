@@ -0,0 +1,47 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicNamer(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(topicsConfigFields...)
+	parse := func(yaml string) *topicNamer {
+		t.Helper()
+		conf, err := spec.ParseYAML(yaml, nil)
+		require.NoError(t, err)
+		n, err := newTopicNamerFromParsed(conf)
+		require.NoError(t, err)
+		return n
+	}
+
+	n := parse(`prefix: cdc.`)
+	assert.Equal(t, "cdc.public.orders", n.topic("public", "orders"))
+	assert.Equal(t, "cdc.Sales.Order__Items__v2.1", n.topic("Sales", `Order "Items" v2.1`))
+
+	n = parse("replace_dots: true\nlowercase: true\nreplacement: '-'")
+	assert.Equal(t, "sales.order--items--v2-1", n.topic("Sales", `Order "Items" v2.1`))
+
+	n = parse("max_length: 32")
+	long := n.topic("public", strings.Repeat("t", 40))
+	assert.Len(t, long, 32)
+	assert.NotEqual(t, long, n.topic("public", strings.Repeat("t", 41)))
+
+	conf, err := spec.ParseYAML(`prefix: "cdc/"`, nil)
+	require.NoError(t, err)
+	_, err = newTopicNamerFromParsed(conf)
+	assert.Error(t, err)
+}
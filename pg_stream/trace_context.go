@@ -0,0 +1,115 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+var traceContextConfigFields = []*service.ConfigField{
+	service.NewStringField("column").
+		Description("Column holding the trace context of the transaction that wrote the row").
+		Example("trace_context").
+		Optional(),
+	service.NewStringField("message_prefix").
+		Description("Prefix of messages written with `pg_logical_emit_message(true, prefix, content)` within the transaction that hold its trace context").
+		Example("traceparent").
+		Optional(),
+}
+
+// traceContextExtractor sets the tracing context written by the application
+// that produced a change on the emitted message. The trace context is either
+// a W3C `traceparent` header value or a JSON object of propagation headers,
+// such as `traceparent`, `tracestate` and `baggage`.
+type traceContextExtractor struct {
+	column        string
+	messagePrefix string
+	propagator    propagation.TextMapPropagator
+}
+
+func newTraceContextExtractorFromParsed(conf *service.ParsedConfig) (t *traceContextExtractor, err error) {
+	t = &traceContextExtractor{
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+	if conf.Contains("column") {
+		if t.column, err = conf.FieldString("column"); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Contains("message_prefix") {
+		if t.messagePrefix, err = conf.FieldString("message_prefix"); err != nil {
+			return nil, err
+		}
+	}
+	if t.column == "" && t.messagePrefix == "" {
+		return nil, fmt.Errorf("trace_context requires a column or a message_prefix")
+	}
+	return t, nil
+}
+
+// carrier returns the propagation headers of the changes, if any.
+func (t *traceContextExtractor) carrier(changes pglogicalstream.Wal2JsonChanges) (propagation.MapCarrier, bool) {
+	if t.messagePrefix != "" {
+		for _, m := range changes.Messages {
+			if m.Prefix == t.messagePrefix {
+				return parseTraceCarrier(m.Content)
+			}
+		}
+	}
+
+	if t.column != "" {
+		for _, change := range changes.Changes {
+			v, ok := columnValue(change.ColumnNames, change.ColumnValues, t.column)
+			if s, isStr := v.(string); ok && isStr {
+				return parseTraceCarrier(s)
+			}
+		}
+	}
+	return nil, false
+}
+
+// apply sets the trace context of the changes on the message as a remote span
+// context, which the spans Benthos starts for the message are children of.
+func (t *traceContextExtractor) apply(msg *service.Message, changes pglogicalstream.Wal2JsonChanges) *service.Message {
+	c, ok := t.carrier(changes)
+	if !ok {
+		return msg
+	}
+	return msg.WithContext(t.propagator.Extract(msg.Context(), c))
+}
+
+func parseTraceCarrier(s string) (propagation.MapCarrier, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, false
+	}
+
+	if !strings.HasPrefix(s, "{") {
+		return propagation.MapCarrier{"traceparent": s}, true
+	}
+
+	var headers map[string]any
+	if err := json.Unmarshal([]byte(s), &headers); err != nil {
+		return nil, false
+	}
+	c := propagation.MapCarrier{}
+	for k, v := range headers {
+		if vStr, ok := v.(string); ok {
+			c[strings.ToLower(k)] = vStr
+		}
+	}
+	return c, len(c) > 0
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestTraceContextPropagation(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(traceContextConfigFields...)
+	conf, err := spec.ParseYAML(`
+column: trace_context
+message_prefix: traceparent
+`, nil)
+	require.NoError(t, err)
+	extractor, err := newTraceContextExtractorFromParsed(conf)
+	require.NoError(t, err)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	traceparent := "00-" + traceID + "-" + spanID + "-01"
+
+	spanContext := func(changes pglogicalstream.Wal2JsonChanges) trace.SpanContext {
+		msg := extractor.apply(service.NewMessage(nil), changes)
+		return trace.SpanContextFromContext(msg.Context())
+	}
+
+	sc := spanContext(pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		ColumnNames:  []string{"id", "trace_context"},
+		ColumnValues: []interface{}{float64(1), `{"Traceparent":"` + traceparent + `"}`},
+	}}})
+	assert.Equal(t, traceID, sc.TraceID().String())
+	assert.Equal(t, spanID, sc.SpanID().String())
+	// No span is started by the input, the spans of the pipeline are
+	// children of the remote one.
+	assert.True(t, sc.IsRemote())
+
+	sc = spanContext(pglogicalstream.Wal2JsonChanges{Messages: []pglogicalstream.LogicalMessage{
+		{Prefix: "traceparent", Content: traceparent},
+	}})
+	assert.Equal(t, traceID, sc.TraceID().String())
+
+	sc = spanContext(pglogicalstream.Wal2JsonChanges{Changes: []pglogicalstream.Wal2JsonChange{{
+		ColumnNames:  []string{"id", "trace_context"},
+		ColumnValues: []interface{}{float64(1), "not a traceparent"},
+	}}})
+	assert.False(t, sc.IsValid())
+}
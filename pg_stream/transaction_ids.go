@@ -0,0 +1,52 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+// txidEpochs qualifies the 32-bit transaction ids of changes with their epoch,
+// like txid_current() does, relative to the next transaction id read when
+// connecting.
+type txidEpochs struct {
+	reference uint64
+}
+
+func queryNextTxid(ctx context.Context, db *sql.DB) (uint64, error) {
+	var next uint64
+	// Unlike txid_current() this doesn't assign a transaction id.
+	err := db.QueryRowContext(ctx, "SELECT txid_snapshot_xmax(txid_current_snapshot())").Scan(&next)
+	return next, err
+}
+
+// txid returns the epoch-qualified transaction id closest to the reference.
+// Transactions streamed after connecting are at most 2^31 transactions away
+// from it, as the server refuses to wrap around further.
+func (e txidEpochs) txid(xid uint32) uint64 {
+	txid := e.reference&^0xffffffff | uint64(xid)
+	switch {
+	case txid > e.reference+(1<<31) && txid >= 1<<32:
+		txid -= 1 << 32
+	case txid+(1<<31) < e.reference:
+		txid += 1 << 32
+	}
+	return txid
+}
+
+func (e *txidEpochs) apply(msg *service.Message, xid uint32) {
+	msg.MetaSetMut("xid", strconv.FormatUint(uint64(xid), 10))
+	if e.reference != 0 {
+		msg.MetaSetMut("txid", strconv.FormatUint(e.txid(xid), 10))
+	}
+}
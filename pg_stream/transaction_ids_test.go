@@ -0,0 +1,32 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxidEpochs(t *testing.T) {
+	e := txidEpochs{reference: 3<<32 | 1000}
+
+	assert.Equal(t, uint64(3<<32|900), e.txid(900))
+	assert.Equal(t, uint64(3<<32|5000), e.txid(5000))
+	// Transactions from before the wraparound into the current epoch.
+	assert.Equal(t, uint64(2<<32|0xfffffff0), e.txid(0xfffffff0))
+
+	// Transactions after a wraparound following the reference.
+	e = txidEpochs{reference: 3<<32 | 0xfffffff0}
+	assert.Equal(t, uint64(4<<32|10), e.txid(10))
+
+	// Nothing precedes the first epoch.
+	e = txidEpochs{reference: 1000}
+	assert.Equal(t, uint64(0xfffffff0), e.txid(0xfffffff0))
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+type validationAction string
+
+const (
+	validationDrop       validationAction = "drop"
+	validationDeadLetter validationAction = "dead_letter"
+	validationFail       validationAction = "fail"
+)
+
+var validationRuleConfigFields = []*service.ConfigField{
+	service.NewStringField("table").
+		Description("Table the rule applies to").
+		Example("orders"),
+	service.NewStringField("column").
+		Description("Column the rule checks").
+		Example("status"),
+	service.NewBoolField("not_null").
+		Description("Whether the column must not be null").
+		Default(false),
+	service.NewStringListField("allowed_values").
+		Description("The values the column may hold, compared as strings. Empty lists allow any value. Null values are allowed unless `not_null` is set").
+		Example([]string{"pending", "shipped", "delivered"}).
+		Default([]any{}),
+	service.NewFloatField("min").
+		Description("The minimum numeric value of the column, inclusive").
+		Optional(),
+	service.NewFloatField("max").
+		Description("The maximum numeric value of the column, inclusive").
+		Optional(),
+	service.NewStringAnnotatedEnumField("action", map[string]string{
+		string(validationDrop):       "Acknowledge the event without emitting it.",
+		string(validationDeadLetter): "Emit the event with the metadata field `dead_letter_reason` set to `validation` and `validation_error` describing the failure, so it can be routed to a dead-letter output.",
+		string(validationFail):       "Fail to emit the event, which stops the input from making progress until the row is fixed or the rule changed.",
+	}).
+		Description("What to do with events that fail the rule").
+		Default(string(validationDeadLetter)),
+}
+
+type validationRule struct {
+	table         string
+	column        string
+	notNull       bool
+	allowedValues map[string]struct{}
+	min, max      *float64
+	action        validationAction
+}
+
+// validationRules checks inserted and updated rows against per-table
+// assertions. Deleted rows are not checked since they only carry keys.
+type validationRules struct {
+	rules    map[string][]*validationRule
+	failures *service.MetricCounter
+}
+
+func newValidationRulesFromParsed(confs []*service.ParsedConfig, metrics *service.Metrics) (*validationRules, error) {
+	v := &validationRules{
+		rules:    map[string][]*validationRule{},
+		failures: metrics.NewCounter("pg_stream_validation_failures"),
+	}
+	for _, conf := range confs {
+		rule, err := newValidationRuleFromParsed(conf)
+		if err != nil {
+			return nil, err
+		}
+		v.rules[rule.table] = append(v.rules[rule.table], rule)
+	}
+	return v, nil
+}
+
+func newValidationRuleFromParsed(conf *service.ParsedConfig) (r *validationRule, err error) {
+	r = &validationRule{}
+	if r.table, err = conf.FieldString("table"); err != nil {
+		return nil, err
+	}
+	if r.column, err = conf.FieldString("column"); err != nil {
+		return nil, err
+	}
+	if r.notNull, err = conf.FieldBool("not_null"); err != nil {
+		return nil, err
+	}
+	var values []string
+	if values, err = conf.FieldStringList("allowed_values"); err != nil {
+		return nil, err
+	}
+	if len(values) > 0 {
+		r.allowedValues = make(map[string]struct{}, len(values))
+		for _, v := range values {
+			r.allowedValues[v] = struct{}{}
+		}
+	}
+	for _, bound := range []struct {
+		field string
+		value **float64
+	}{{"min", &r.min}, {"max", &r.max}} {
+		if !conf.Contains(bound.field) {
+			continue
+		}
+		var f float64
+		if f, err = conf.FieldFloat(bound.field); err != nil {
+			return nil, err
+		}
+		*bound.value = &f
+	}
+
+	var action string
+	if action, err = conf.FieldString("action"); err != nil {
+		return nil, err
+	}
+	r.action = validationAction(action)
+	return r, nil
+}
+
+// check returns the first rule the changes fail along with a description of
+// the failure, or nil if they pass every rule.
+func (v *validationRules) check(changes []pglogicalstream.Wal2JsonChange) (*validationRule, string) {
+	for _, change := range changes {
+		if change.Kind != "insert" && change.Kind != "update" {
+			continue
+		}
+		for _, rule := range v.rules[change.Table] {
+			if reason := rule.check(change); reason != "" {
+				v.failures.Incr(1)
+				return rule, fmt.Sprintf("table %s: %s", change.Table, reason)
+			}
+		}
+	}
+	return nil, ""
+}
+
+func (r *validationRule) check(change pglogicalstream.Wal2JsonChange) string {
+	value, ok := columnValue(change.ColumnNames, change.ColumnValues, r.column)
+	if !ok || value == nil {
+		if r.notNull {
+			return fmt.Sprintf("column %s is null", r.column)
+		}
+		return ""
+	}
+
+	if r.allowedValues != nil {
+		if _, ok := r.allowedValues[fmt.Sprint(value)]; !ok {
+			return fmt.Sprintf("column %s holds the value %v which is not allowed", r.column, value)
+		}
+	}
+
+	if r.min != nil || r.max != nil {
+		f, ok := numericValue(value)
+		if !ok {
+			return fmt.Sprintf("column %s holds the value %v which is not a number", r.column, value)
+		}
+		if r.min != nil && f < *r.min {
+			return fmt.Sprintf("column %s holds the value %v which is below the minimum %v", r.column, value, *r.min)
+		}
+		if r.max != nil && f > *r.max {
+			return fmt.Sprintf("column %s holds the value %v which is above the maximum %v", r.column, value, *r.max)
+		}
+	}
+	return ""
+}
+
+// numericValue converts the number representations found in changes, snapshot
+// rows carry some numeric types as strings.
+func numericValue(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
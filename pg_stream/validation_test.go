@@ -0,0 +1,74 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/usedatabrew/benthos_postgres_cdc/internal/pglogicalstream"
+)
+
+func TestValidationRules(t *testing.T) {
+	spec := service.NewConfigSpec().Field(service.NewObjectListField("rules", validationRuleConfigFields...))
+	conf, err := spec.ParseYAML(`
+rules:
+  - table: orders
+    column: id
+    not_null: true
+  - table: orders
+    column: status
+    allowed_values: [ pending, shipped ]
+  - table: orders
+    column: quantity
+    min: 1
+    max: 10
+    action: drop
+`, nil)
+	require.NoError(t, err)
+	ruleConfs, err := conf.FieldObjectList("rules")
+	require.NoError(t, err)
+	rules, err := newValidationRulesFromParsed(ruleConfs, service.MockResources().Metrics())
+	require.NoError(t, err)
+
+	row := func(kind string, values ...interface{}) []pglogicalstream.Wal2JsonChange {
+		return []pglogicalstream.Wal2JsonChange{{
+			Kind:         kind,
+			Schema:       "public",
+			Table:        "orders",
+			ColumnNames:  []string{"id", "status", "quantity"},
+			ColumnValues: values,
+		}}
+	}
+
+	rule, _ := rules.check(row("insert", float64(1), "pending", json.Number("5")))
+	assert.Nil(t, rule)
+
+	rule, reason := rules.check(row("insert", nil, "pending", float64(5)))
+	require.NotNil(t, rule)
+	assert.Equal(t, validationDeadLetter, rule.action)
+	assert.Equal(t, "table orders: column id is null", reason)
+
+	rule, reason = rules.check(row("update", float64(1), "lost", float64(5)))
+	require.NotNil(t, rule)
+	assert.Equal(t, "table orders: column status holds the value lost which is not allowed", reason)
+
+	// Snapshot rows carry bigints as strings.
+	snapshot := row("insert", "1", "shipped", "11")
+	rule, _ = rules.check(snapshot)
+	require.NotNil(t, rule)
+	assert.Equal(t, validationDrop, rule.action)
+
+	rule, _ = rules.check(row("delete", nil, nil, nil))
+	assert.Nil(t, rule)
+}
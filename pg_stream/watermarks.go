@@ -0,0 +1,92 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+)
+
+var watermarksConfigFields = []*service.ConfigField{
+	service.NewDurationField("interval").
+		Description("How often a watermark event is emitted when the watermark advanced. Zero only sets the metadata field").
+		Default("10s"),
+	service.NewDurationField("allowed_lateness").
+		Description("How far the watermark trails the latest commit timestamp, covering the clock skew between concurrently committing sessions").
+		Default("0s"),
+}
+
+// watermarkTracker derives event-time watermarks from commit timestamps. The
+// changes are streamed in commit order, so changes that follow a commit are
+// not older than it, up to the allowed lateness.
+type watermarkTracker struct {
+	interval time.Duration
+	lateness time.Duration
+
+	watermark time.Time
+	emitted   time.Time
+	lastEmit  time.Time
+}
+
+func newWatermarkTrackerFromParsed(conf *service.ParsedConfig) (w *watermarkTracker, err error) {
+	w = &watermarkTracker{}
+	if w.interval, err = conf.FieldDuration("interval"); err != nil {
+		return nil, err
+	}
+	if w.lateness, err = conf.FieldDuration("allowed_lateness"); err != nil {
+		return nil, err
+	}
+	w.lastEmit = time.Now()
+	return w, nil
+}
+
+// observe advances the watermark to the commit timestamp of streamed changes.
+func (w *watermarkTracker) observe(commitTime time.Time) {
+	if commitTime.IsZero() {
+		return
+	}
+	if watermark := commitTime.Add(-w.lateness); watermark.After(w.watermark) {
+		w.watermark = watermark
+	}
+}
+
+func (w *watermarkTracker) apply(msg *service.Message) {
+	if !w.watermark.IsZero() {
+		msg.MetaSetMut("watermark", w.watermark.Format(time.RFC3339Nano))
+	}
+}
+
+// nextEmit returns when the next watermark event is due.
+func (w *watermarkTracker) nextEmit() time.Time {
+	return w.lastEmit.Add(w.interval)
+}
+
+// due returns a watermark event once the interval elapsed and the watermark
+// advanced since the last one, or nil.
+func (w *watermarkTracker) due(now time.Time) (*service.Message, error) {
+	if w.interval <= 0 || now.Before(w.nextEmit()) {
+		return nil, nil
+	}
+	w.lastEmit = now
+	if !w.watermark.After(w.emitted) {
+		return nil, nil
+	}
+	w.emitted = w.watermark
+
+	b, err := json.Marshal(map[string]any{"watermark": w.watermark})
+	if err != nil {
+		return nil, err
+	}
+	msg := service.NewMessage(b)
+	msg.MetaSetMut("event_type", "watermark")
+	w.apply(msg)
+	return msg, nil
+}
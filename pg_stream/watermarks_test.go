@@ -0,0 +1,55 @@
+// Copyright 2024 Redpanda Data, Inc.
+//
+// Licensed as a Redpanda Enterprise file under the Redpanda Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+// https://github.com/redpanda-data/connect/blob/main/licenses/rcl.md
+
+package pg_stream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redpanda-data/benthos/v4/public/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatermarkTracker(t *testing.T) {
+	spec := service.NewConfigSpec().Fields(watermarksConfigFields...)
+	conf, err := spec.ParseYAML("interval: 1m\nallowed_lateness: 5s", nil)
+	require.NoError(t, err)
+	w, err := newWatermarkTrackerFromParsed(conf)
+	require.NoError(t, err)
+
+	start := w.lastEmit
+	commit := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	// Nothing is emitted before a commit was observed.
+	msg, err := w.due(start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+
+	w.observe(commit)
+	w.observe(commit.Add(-time.Minute))
+	w.observe(time.Time{})
+
+	msg, err = w.due(start.Add(90 * time.Second))
+	require.NoError(t, err)
+	assert.Nil(t, msg, "the interval didn't elapse since the last check")
+
+	msg, err = w.due(start.Add(2 * time.Minute))
+	require.NoError(t, err)
+	require.NotNil(t, msg)
+	eventType, _ := msg.MetaGet("event_type")
+	assert.Equal(t, "watermark", eventType)
+	watermark, _ := msg.MetaGet("watermark")
+	assert.Equal(t, "2024-03-01T09:59:55Z", watermark)
+
+	// The watermark didn't advance.
+	msg, err = w.due(start.Add(3 * time.Minute))
+	require.NoError(t, err)
+	assert.Nil(t, msg)
+}